@@ -51,10 +51,14 @@ func writeOpenAPIFile(file string) error {
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.Device",
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceDiscovery",
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceToken",
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DevicePairing",
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.WifiNetwork",
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.WifiPassword",
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.Certificate",
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.UserAccount",
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DNSConfig",
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DHCPLease",
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DHCPReservation",
 		"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1.CustomResourceDefinition",
 		"k8s.io/api/networking/v1.Ingress",
 		"k8s.io/api/core/v1.Secret",
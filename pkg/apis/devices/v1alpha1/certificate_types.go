@@ -9,6 +9,13 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
+const (
+	// SelfCertificateName is the name of the Certificate holding the API server's self-signed certificate.
+	SelfCertificateName = "self"
+	// LocalCACertificateName is the name of the Certificate holding the local CA that issues the certificates of the ingress hosts.
+	LocalCACertificateName = "local-ca"
+)
+
 // CertificateSpec defines a certificate.
 // +k8s:openapi-gen=true
 type CertificateSpec struct {
@@ -38,10 +38,13 @@ type DeviceSpec struct {
 	Mode          DeviceMode `json:"mode"`
 	ServerAddress string     `json:"serverAddress,omitempty"`
 	JoinTokenName string     `json:"joinTokenName,omitempty"`
+	// DualStack enables IPv6 next to IPv4 within the cluster when running as server and registers the node's IPv6 address when running as agent.
+	DualStack bool `json:"dualStack,omitempty"`
 }
 
 // DeviceStatus defines the observed state of the Device.
 // +k8s:openapi-gen=true
+// +kubebuilder:object:generate=true
 type DeviceStatus struct {
 	Generation  int64       `json:"generation,omitempty"`
 	Current     bool        `json:"current"`
@@ -49,8 +52,8 @@ type DeviceStatus struct {
 	Message     string      `json:"message,omitempty"`
 	Address     string      `json:"address,omitempty"`
 	JoinAddress string      `json:"joinAddress,omitempty"`
-	// TODO: add ips (currently this makes the code generation fail):
-	//IPs []string `json:"ips,omitempty"`
+	// IPs lists the device's IPv4 and IPv6 addresses.
+	IPs       []string      `json:"ips,omitempty"`
 	DNSServer ProcessStatus `json:"dnsServer"`
 }
 
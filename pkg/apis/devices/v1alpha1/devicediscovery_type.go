@@ -9,13 +9,58 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
+// DeviceDiscoverySource specifies how a device was discovered.
+// +enum
+type DeviceDiscoverySource string
+
+const (
+	DeviceDiscoverySourceMDNS   DeviceDiscoverySource = "mdns"
+	DeviceDiscoverySourceStatic DeviceDiscoverySource = "static"
+	DeviceDiscoverySourceDNS    DeviceDiscoverySource = "dns"
+	DeviceDiscoverySourceGossip DeviceDiscoverySource = "gossip"
+)
+
+const (
+	// DeviceDiscoveryConditionOffline indicates that a device said goodbye or was not seen by any source recently.
+	DeviceDiscoveryConditionOffline = "Offline"
+)
+
 // DeviceDiscoverySpec provides information about the discovered device.
 // +k8s:openapi-gen=true
+// +kubebuilder:object:generate=true
 type DeviceDiscoverySpec struct {
 	Mode    DeviceMode `json:"mode"`
 	Server  string     `json:"server,omitempty"`
 	Address string     `json:"address"`
 	Current bool       `json:"current,omitempty"`
+	// CertFingerprint is the announced SHA256 fingerprint of the device's API certificate.
+	CertFingerprint string `json:"certFingerprint,omitempty"`
+	// Version is the kubemate version the device runs.
+	Version string `json:"version,omitempty"`
+	// K3sVersion is the version of k3s embedded into kubemate.
+	K3sVersion string      `json:"k3sVersion,omitempty"`
+	State      DeviceState `json:"state,omitempty"`
+	// ClusterID identifies the cluster the device belongs to by the hash of the cluster CA certificate.
+	ClusterID string `json:"clusterID,omitempty"`
+	// Arch is the device's CPU architecture.
+	Arch string   `json:"arch,omitempty"`
+	IPs  []string `json:"ips,omitempty"`
+}
+
+// DeviceDiscoveryStatus indicates whether the announcement could be verified and when the device was last seen.
+// +k8s:openapi-gen=true
+// +kubebuilder:object:generate=true
+type DeviceDiscoveryStatus struct {
+	// Verified is true when the device's TLS endpoint presented the announced certificate
+	// and the announcement was signed with its key or served via that endpoint.
+	Verified bool `json:"verified,omitempty"`
+	// ClusterMember is true when the verified device belongs to the same cluster as this device.
+	ClusterMember bool         `json:"clusterMember,omitempty"`
+	LastSeen      *metav1.Time `json:"lastSeen,omitempty"`
+	// Sources lists the discovery mechanisms that found the device.
+	Sources    []DeviceDiscoverySource `json:"sources,omitempty"`
+	Message    string                  `json:"message,omitempty"`
+	Conditions []metav1.Condition      `json:"conditions,omitempty"`
 }
 
 // DeviceDiscovery is the Schema for the device discovery API.
@@ -25,7 +70,8 @@ type DeviceDiscovery struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata"`
 
-	Spec DeviceDiscoverySpec `json:"spec"`
+	Spec   DeviceDiscoverySpec   `json:"spec"`
+	Status DeviceDiscoveryStatus `json:"status,omitempty"`
 }
 
 func (in *DeviceDiscovery) New() resource.Resource {
@@ -0,0 +1,110 @@
+package v1alpha1
+
+import (
+	"fmt"
+
+	"github.com/mgoltzsche/kubemate/pkg/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// DevicePairingPhase specifies the progress of a pairing.
+// +enum
+type DevicePairingPhase string
+
+const (
+	DevicePairingPhasePending   DevicePairingPhase = "Pending"
+	DevicePairingPhaseConfirmed DevicePairingPhase = "Confirmed"
+	DevicePairingPhaseCompleted DevicePairingPhase = "Completed"
+	DevicePairingPhaseFailed    DevicePairingPhase = "Failed"
+)
+
+// DevicePairingSpec specifies a request to join an agent device to a server device.
+// On the agent, a user specifies the ServerAddress of a discovered server.
+// The agent then submits a pairing request, specifying the Agent fields, to the server.
+// +k8s:openapi-gen=true
+type DevicePairingSpec struct {
+	// ServerAddress is the API address of the server to join (specified on the agent).
+	ServerAddress string `json:"serverAddress,omitempty"`
+	// JoinTokenName is the name of the DeviceToken the agent should store the join token as.
+	JoinTokenName string `json:"joinTokenName,omitempty"`
+	// Agent is the name of the agent that requests to join (specified on the server).
+	// The server names incoming pairing requests itself since the agent's name is not verified.
+	Agent string `json:"agent,omitempty"`
+	// AgentAddress is the API address of the agent that requests to join.
+	AgentAddress string `json:"agentAddress,omitempty"`
+	// AgentCertFingerprint is the SHA256 fingerprint of the agent's API certificate.
+	AgentCertFingerprint string `json:"agentCertFingerprint,omitempty"`
+	// NonceCommitment is the SHA256 hash of the Nonce the agent submits along with its pairing request.
+	NonceCommitment string `json:"nonceCommitment,omitempty"`
+	// Nonce is random data the agent contributes to the confirmation code.
+	// The agent reveals it only after it received the server's nonce.
+	Nonce string `json:"nonce,omitempty"`
+	// Secret authorizes the server to push the join token to the agent.
+	Secret string `json:"secret,omitempty"`
+	// Confirmed must be set on the server when both devices show the same confirmation code.
+	Confirmed bool `json:"confirmed,omitempty"`
+	// JoinToken is pushed by the server to the agent after confirmation.
+	JoinToken string `json:"joinToken,omitempty"`
+}
+
+// DevicePairingStatus provides the confirmation code and progress of a pairing.
+// +k8s:openapi-gen=true
+type DevicePairingStatus struct {
+	Phase DevicePairingPhase `json:"phase,omitempty"`
+	// ConfirmationCode is derived from both devices' certificates and nonces and must be the same on both devices.
+	ConfirmationCode string `json:"confirmationCode,omitempty"`
+	// ServerNonce is random data the server contributes to the confirmation code in response to the agent's nonce commitment.
+	ServerNonce string `json:"serverNonce,omitempty"`
+	// ClientAddress is the address the server received the pairing request from.
+	ClientAddress string `json:"clientAddress,omitempty"`
+	// ServerCertFingerprint is the SHA256 fingerprint of the server's API certificate the agent pinned.
+	ServerCertFingerprint string `json:"serverCertFingerprint,omitempty"`
+	Message               string `json:"message,omitempty"`
+}
+
+// DevicePairing is the schema for the handshake that joins an agent device to a server.
+// +k8s:openapi-gen=true
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type DevicePairing struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+
+	Spec   DevicePairingSpec   `json:"spec"`
+	Status DevicePairingStatus `json:"status,omitempty"`
+}
+
+func (in *DevicePairing) New() resource.Resource {
+	return &DevicePairing{}
+}
+
+func (in *DevicePairing) NewList() runtime.Object {
+	return &DevicePairingList{}
+}
+
+func (in *DevicePairing) GetSingularName() string {
+	return "DevicePairing"
+}
+
+func (in *DevicePairing) GetGroupVersionResource() schema.GroupVersionResource {
+	return GroupVersion.WithResource("devicepairings")
+}
+
+func (in *DevicePairing) DeepCopyIntoResource(res resource.Resource) error {
+	d, ok := res.(*DevicePairing)
+	if !ok {
+		return fmt.Errorf("expected resource of type DevicePairing but received %T", res)
+	}
+	in.DeepCopyInto(d)
+	return nil
+}
+
+// DevicePairingList contains a list of DevicePairing resources.
+// +k8s:openapi-gen=true
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type DevicePairingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DevicePairing `json:"items"`
+}
@@ -0,0 +1,121 @@
+package v1alpha1
+
+import (
+	"fmt"
+
+	"github.com/mgoltzsche/kubemate/pkg/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// DHCPLeaseSpec describes an address the DHCP server leased to a client.
+// +k8s:openapi-gen=true
+// +kubebuilder:object:generate=true
+type DHCPLeaseSpec struct {
+	MACAddress string `json:"macAddress"`
+	IPAddress  string `json:"ipAddress"`
+	// Hostname is the name the client sent along with its request.
+	Hostname string `json:"hostname,omitempty"`
+	ClientID string `json:"clientID,omitempty"`
+	// ExpiryTime is the time the lease expires at. Infinite leases don't specify it.
+	ExpiryTime *metav1.Time `json:"expiryTime,omitempty"`
+}
+
+// DHCPLease is a read-only resource that reflects a lease of the device's DHCP server.
+// +k8s:openapi-gen=true
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type DHCPLease struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+
+	Spec DHCPLeaseSpec `json:"spec"`
+}
+
+func (in *DHCPLease) New() resource.Resource {
+	return &DHCPLease{}
+}
+
+func (in *DHCPLease) NewList() runtime.Object {
+	return &DHCPLeaseList{}
+}
+
+func (in *DHCPLease) GetSingularName() string {
+	return "DHCPLease"
+}
+
+func (in *DHCPLease) GetGroupVersionResource() schema.GroupVersionResource {
+	return GroupVersion.WithResource("dhcpleases")
+}
+
+func (in *DHCPLease) DeepCopyIntoResource(res resource.Resource) error {
+	d, ok := res.(*DHCPLease)
+	if !ok {
+		return fmt.Errorf("expected resource of type DHCPLease but received %T", res)
+	}
+	in.DeepCopyInto(d)
+	return nil
+}
+
+// DHCPLeaseList contains a list of DHCPLease resources.
+// +k8s:openapi-gen=true
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type DHCPLeaseList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DHCPLease `json:"items"`
+}
+
+// DHCPReservationSpec pins the IP address and hostname the DHCP server assigns to a client.
+// +k8s:openapi-gen=true
+type DHCPReservationSpec struct {
+	MACAddress string `json:"macAddress"`
+	// IPAddress is the IPv4 address the client is assigned.
+	IPAddress string `json:"ipAddress"`
+	// Hostname is the name the client is registered with within the local DNS zone.
+	Hostname string `json:"hostname,omitempty"`
+}
+
+// DHCPReservation is the schema for a static DHCP address assignment.
+// +k8s:openapi-gen=true
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type DHCPReservation struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+
+	Spec DHCPReservationSpec `json:"spec"`
+}
+
+func (in *DHCPReservation) New() resource.Resource {
+	return &DHCPReservation{}
+}
+
+func (in *DHCPReservation) NewList() runtime.Object {
+	return &DHCPReservationList{}
+}
+
+func (in *DHCPReservation) GetSingularName() string {
+	return "DHCPReservation"
+}
+
+func (in *DHCPReservation) GetGroupVersionResource() schema.GroupVersionResource {
+	return GroupVersion.WithResource("dhcpreservations")
+}
+
+func (in *DHCPReservation) DeepCopyIntoResource(res resource.Resource) error {
+	d, ok := res.(*DHCPReservation)
+	if !ok {
+		return fmt.Errorf("expected resource of type DHCPReservation but received %T", res)
+	}
+	in.DeepCopyInto(d)
+	return nil
+}
+
+// DHCPReservationList contains a list of DHCPReservation resources.
+// +k8s:openapi-gen=true
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type DHCPReservationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DHCPReservation `json:"items"`
+}
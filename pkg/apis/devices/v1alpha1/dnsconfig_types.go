@@ -0,0 +1,129 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mgoltzsche/kubemate/pkg/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// DNSConfigName is the name of the DNSConfig resource the server device is configured with.
+	DNSConfigName         = "default"
+	DefaultDNSZone        = "kube.m8"
+	DefaultDHCPRangeStart = "11.0.0.10"
+	DefaultDHCPRangeEnd   = "11.0.0.50"
+	DefaultDHCPLeaseTime  = 2 * time.Hour
+)
+
+// DNSRecordType specifies the type of a DNS record.
+// +enum
+type DNSRecordType string
+
+const (
+	DNSRecordTypeA    DNSRecordType = "A"
+	DNSRecordTypeAAAA DNSRecordType = "AAAA"
+	DNSRecordTypeSRV  DNSRecordType = "SRV"
+)
+
+// DNSConfigSpec defines the local DNS zone and DHCP server configuration of the server device.
+// +k8s:openapi-gen=true
+// +kubebuilder:object:generate=true
+type DNSConfigSpec struct {
+	// Zone is the local DNS zone the devices, nodes and ingress hosts are registered within (default: kube.m8).
+	Zone string `json:"zone,omitempty"`
+	// Upstreams lists the DNS servers other names are resolved with. The host's resolvers are used when empty.
+	Upstreams []string `json:"upstreams,omitempty"`
+	// Records lists static DNS records.
+	Records []DNSRecord `json:"records,omitempty"`
+	// DHCP configures the DHCP server that runs in access point mode.
+	DHCP DHCPSpec `json:"dhcp,omitempty"`
+}
+
+// DNSRecord defines a DNS record.
+// +k8s:openapi-gen=true
+type DNSRecord struct {
+	// Name is the record's host name, prefixed with the service and protocol labels in case of an SRV record (e.g. _http._tcp.myapp).
+	// Names without a dot (apart from the SRV labels) are relative to the zone.
+	Name string        `json:"name"`
+	Type DNSRecordType `json:"type"`
+	// Value is the record's address or, in case of an SRV record, the target host and port (e.g. myapp:8080).
+	Value string `json:"value"`
+}
+
+// DHCPSpec defines the DHCP server configuration.
+// +k8s:openapi-gen=true
+// +kubebuilder:object:generate=true
+type DHCPSpec struct {
+	// RangeStart is the first IPv4 address the DHCP server leases (default: 11.0.0.10).
+	RangeStart string `json:"rangeStart,omitempty"`
+	// RangeEnd is the last IPv4 address the DHCP server leases (default: 11.0.0.50).
+	RangeEnd string `json:"rangeEnd,omitempty"`
+	// LeaseTime is the duration a lease is valid for (default: 2h).
+	LeaseTime *metav1.Duration `json:"leaseTime,omitempty"`
+}
+
+// DNSConfigStatus lists the DNS records that were registered automatically.
+// +k8s:openapi-gen=true
+// +kubebuilder:object:generate=true
+type DNSConfigStatus struct {
+	// Records lists the records registered for the cluster nodes, Ingress hosts and annotated Services.
+	Records []RegisteredDNSRecord `json:"records,omitempty"`
+	Message string                `json:"message,omitempty"`
+}
+
+// RegisteredDNSRecord is a DNS record that was registered for an object.
+// +k8s:openapi-gen=true
+type RegisteredDNSRecord struct {
+	DNSRecord `json:",inline"`
+	// Source refers to the object the record was registered for, e.g. node/<name> or ingress/<namespace>/<name>.
+	Source string `json:"source"`
+}
+
+// DNSConfig is the schema for the local DNS and DHCP server configuration.
+// +k8s:openapi-gen=true
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type DNSConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+
+	Spec   DNSConfigSpec   `json:"spec"`
+	Status DNSConfigStatus `json:"status,omitempty"`
+}
+
+func (in *DNSConfig) New() resource.Resource {
+	return &DNSConfig{}
+}
+
+func (in *DNSConfig) NewList() runtime.Object {
+	return &DNSConfigList{}
+}
+
+func (in *DNSConfig) GetSingularName() string {
+	return "DNSConfig"
+}
+
+func (in *DNSConfig) GetGroupVersionResource() schema.GroupVersionResource {
+	return GroupVersion.WithResource("dnsconfigs")
+}
+
+func (in *DNSConfig) DeepCopyIntoResource(res resource.Resource) error {
+	d, ok := res.(*DNSConfig)
+	if !ok {
+		return fmt.Errorf("expected resource of type DNSConfig but received %T", res)
+	}
+	in.DeepCopyInto(d)
+	return nil
+}
+
+// DNSConfigList contains a list of DNSConfig resources.
+// +k8s:openapi-gen=true
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type DNSConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DNSConfig `json:"items"`
+}
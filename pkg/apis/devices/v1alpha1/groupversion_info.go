@@ -17,19 +17,27 @@ func AddToScheme(s *runtime.Scheme) error {
 	s.AddKnownTypeWithName(GroupVersion.WithKind("Device"), &Device{})
 	s.AddKnownTypeWithName(GroupVersion.WithKind("DeviceDiscovery"), &DeviceDiscovery{})
 	s.AddKnownTypeWithName(GroupVersion.WithKind("DeviceToken"), &DeviceToken{})
+	s.AddKnownTypeWithName(GroupVersion.WithKind("DevicePairing"), &DevicePairing{})
 	s.AddKnownTypeWithName(GroupVersion.WithKind("WifiNetwork"), &WifiNetwork{})
 	s.AddKnownTypeWithName(GroupVersion.WithKind("WifiPassword"), &WifiPassword{})
 	s.AddKnownTypeWithName(GroupVersion.WithKind("Certificate"), &Certificate{})
 	s.AddKnownTypeWithName(GroupVersion.WithKind("UserAccount"), &UserAccount{})
+	s.AddKnownTypeWithName(GroupVersion.WithKind("DNSConfig"), &DNSConfig{})
+	s.AddKnownTypeWithName(GroupVersion.WithKind("DHCPLease"), &DHCPLease{})
+	s.AddKnownTypeWithName(GroupVersion.WithKind("DHCPReservation"), &DHCPReservation{})
 	s.AddKnownTypes(GroupVersion,
 		&NetworkInterfaceList{},
 		&DeviceList{},
 		&DeviceDiscoveryList{},
 		&DeviceTokenList{},
+		&DevicePairingList{},
 		&WifiNetworkList{},
 		&WifiPasswordList{},
 		&CertificateList{},
 		&UserAccountList{},
+		&DNSConfigList{},
+		&DHCPLeaseList{},
+		&DHCPReservationList{},
 	)
 	return nil
 }
@@ -2,6 +2,7 @@ package v1alpha1
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/mgoltzsche/kubemate/pkg/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -23,34 +24,223 @@ const (
 	WifiModeDisabled          WifiMode             = "disabled"
 	WifiModeStation           WifiMode             = "station"
 	WifiModeAccessPoint       WifiMode             = "accesspoint"
+	// WifiModeAccessPointStation connects to a wifi network and runs an access point on the same radio simultaneously.
+	WifiModeAccessPointStation WifiMode = "accesspoint+station"
+	// NetworkInterfaceTypeCellular is the network link of an LTE/5G modem managed by ModemManager.
+	NetworkInterfaceTypeCellular NetworkInterfaceType = "cellular"
+)
+
+// WifiBand specifies the frequency band of a wifi network.
+// +enum
+type WifiBand string
+
+// WifiSecurity specifies the authentication method of a wifi network.
+// +enum
+type WifiSecurity string
+
+// IPConfigMode specifies how a link obtains its IP addresses.
+// +enum
+type IPConfigMode string
+
+// WifiEAPMethod specifies the 802.1X authentication method.
+// +enum
+type WifiEAPMethod string
+
+const (
+	WifiBand2GHz         WifiBand      = "2.4GHz"
+	WifiBand5GHz         WifiBand      = "5GHz"
+	WifiSecurityWPA2     WifiSecurity  = "wpa2"
+	WifiSecurityWPA3     WifiSecurity  = "wpa3"
+	WifiSecurityWPA2WPA3 WifiSecurity  = "wpa2-wpa3"
+	IPConfigModeDHCP     IPConfigMode  = "dhcp"
+	IPConfigModeStatic   IPConfigMode  = "static"
+	WifiEAPMethodPEAP    WifiEAPMethod = "PEAP"
+	WifiEAPMethodTTLS    WifiEAPMethod = "TTLS"
+	WifiEAPMethodTLS     WifiEAPMethod = "TLS"
+	// DefaultWifiStationFallbackTimeout is the default time after which the access point is started when the station cannot connect.
+	DefaultWifiStationFallbackTimeout = 3 * time.Minute
+	// WifiChannelAuto lets the access point use the least congested channel.
+	WifiChannelAuto = "auto"
+)
+
+const (
+	// PendingLinkConfigAnnotation holds the PendingLinkConfig as JSON.
+	PendingLinkConfigAnnotation = "kubemate.mgoltzsche.github.com/pending-link-config"
+	// LinkConfigConfirmationTimeout is the time a client has to reach the device again after it changed the link configuration.
+	LinkConfigConfirmationTimeout = 2 * time.Minute
 )
 
 // NetworkInterfaceStatus defines the observed state of the network interface.
 // +k8s:openapi-gen=true
+// +kubebuilder:object:generate=true
 type NetworkInterfaceStatus struct {
-	Link  NetworkLinkStatus `json:"link,omitempty"`
-	Error string            `json:"error,omitempty"`
+	Link NetworkLinkStatus `json:"link,omitempty"`
+	Wifi WifiStatus        `json:"wifi,omitempty"`
+	// Cellular describes the state of the modem of a cellular interface.
+	Cellular *CellularStatus `json:"cellular,omitempty"`
+	// LinkConfigMessage reports whether the link configuration awaits confirmation or was rolled back.
+	LinkConfigMessage string `json:"linkConfigMessage,omitempty"`
+	Error             string `json:"error,omitempty"`
+}
+
+// WifiStatus defines the observed state of the wifi interface.
+// +k8s:openapi-gen=true
+// +kubebuilder:object:generate=true
+type WifiStatus struct {
+	// Channel is the channel the access point operates on.
+	Channel int `json:"channel,omitempty"`
+	// Station describes the wifi network the station is associated with.
+	Station *WifiStationStatus `json:"station,omitempty"`
+	// Fallback indicates that the access point is running since the station could not connect to any saved network.
+	Fallback bool `json:"fallback,omitempty"`
+	// FirewallRules lists the nftables rules applied for the access point within the kubemate table.
+	FirewallRules []string `json:"firewallRules,omitempty"`
+	// Quality describes the radio link quality.
+	Quality *WifiLinkQuality `json:"quality,omitempty"`
+}
+
+// CellularStatus describes the state of the modem and its mobile network registration.
+// +k8s:openapi-gen=true
+// +kubebuilder:object:generate=true
+type CellularStatus struct {
+	// Modem is the manufacturer and model of the modem.
+	Modem string `json:"modem,omitempty"`
+	// State is the ModemManager state of the modem, e.g. locked, registered or connected.
+	State string `json:"state,omitempty"`
+	// RegistrationState is the mobile network registration state, e.g. home, roaming or searching.
+	RegistrationState string `json:"registrationState,omitempty"`
+	// Operator is the name of the mobile network operator.
+	Operator string `json:"operator,omitempty"`
+	// AccessTechnologies lists the radio access technologies in use, e.g. lte or 5gnr.
+	AccessTechnologies []string `json:"accessTechnologies,omitempty"`
+	// SignalQuality is the signal quality in percent.
+	SignalQuality int `json:"signalQuality"`
+}
+
+// WifiLinkQuality describes the radio link quality of the wifi interface.
+// +k8s:openapi-gen=true
+type WifiLinkQuality struct {
+	// Signal is the signal strength of the network the station is associated with in dBm.
+	Signal int `json:"signal,omitempty"`
+	// Noise is the noise level of the channel in use in dBm.
+	Noise int `json:"noise,omitempty"`
+	// Bitrate is the transmit bitrate of the station in Mbit/s.
+	Bitrate int `json:"bitrate,omitempty"`
+	// AccessPointStations is the number of clients associated with the access point.
+	AccessPointStations int `json:"accessPointStations"`
+}
+
+// WifiStationStatus describes the wifi network the station is associated with.
+// +k8s:openapi-gen=true
+type WifiStationStatus struct {
+	SSID      string `json:"ssid"`
+	BSSID     string `json:"bssid,omitempty"`
+	Frequency int    `json:"frequency,omitempty"`
+	// Signal is the signal strength in dBm.
+	Signal int `json:"signal,omitempty"`
+	// Bitrate is the link speed in Mbit/s.
+	Bitrate int `json:"bitrate,omitempty"`
 }
 
 // NetworkLinkStatus defines the observed state of the network link.
 // +k8s:openapi-gen=true
+// +kubebuilder:object:generate=true
 type NetworkLinkStatus struct {
 	Index int                  `json:"index,omitempty"`
 	Type  NetworkInterfaceType `json:"type,omitempty"`
 	Up    bool                 `json:"up"`
 	MAC   string               `json:"mac,omitempty"`
 	IP4   string               `json:"ip4,omitempty"`
-	Error string               `json:"error,omitempty"`
+	// IP6 lists the link's global IPv6 addresses.
+	IP6 []string `json:"ip6,omitempty"`
+	// Statistics holds the link's traffic counters.
+	Statistics *NetworkLinkStatistics `json:"statistics,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	// Absent indicates that the link does not exist currently, e.g. since its USB adapter is unplugged.
+	// A NetworkInterface with a changed spec is kept while its link is absent in order to apply the spec again when the link reappears.
+	Absent bool `json:"absent,omitempty"`
+}
+
+// NetworkLinkStatistics holds the traffic counters of the network link.
+// +k8s:openapi-gen=true
+type NetworkLinkStatistics struct {
+	RxBytes   int64 `json:"rxBytes"`
+	TxBytes   int64 `json:"txBytes"`
+	RxPackets int64 `json:"rxPackets"`
+	TxPackets int64 `json:"txPackets"`
+	RxErrors  int64 `json:"rxErrors"`
+	TxErrors  int64 `json:"txErrors"`
+	RxDropped int64 `json:"rxDropped"`
+	TxDropped int64 `json:"txDropped"`
 }
 
 // NetworkInterfaceSpec defines the network interface configuration.
 // +k8s:openapi-gen=true
+// +kubebuilder:object:generate=true
 type NetworkInterfaceSpec struct {
 	Wifi WifiSpec `json:"wifi,omitempty"`
+	// Link configures the addressing of a wired link. Unless specified, the addressing is left to the host.
+	Link *NetworkLinkConfig `json:"link,omitempty"`
+	// Cellular configures the mobile data connection of a cellular interface. Unless specified, the modem is left to the host.
+	Cellular *CellularConfig `json:"cellular,omitempty"`
+}
+
+// CellularConfig configures the mobile data connection of a modem.
+// +k8s:openapi-gen=true
+type CellularConfig struct {
+	// APN is the access point name of the mobile network operator.
+	APN string `json:"apn"`
+	// PIN unlocks the SIM card.
+	PIN string `json:"pin,omitempty"`
+	// AllowRoaming allows the modem to connect while roaming in a foreign network.
+	AllowRoaming bool `json:"allowRoaming,omitempty"`
+}
+
+// NetworkLinkConfig configures the addressing of a wired link.
+// +k8s:openapi-gen=true
+// +kubebuilder:object:generate=true
+type NetworkLinkConfig struct {
+	IP *IPConfig `json:"ip,omitempty"`
+	// MTU is the maximum transmission unit of the link.
+	MTU int `json:"mtu,omitempty"`
+	// VLANs lists the VLAN sub-interfaces to create on top of the link, named <LINK>.<ID>.
+	VLANs []VLANConfig `json:"vlans,omitempty"`
+}
+
+// IPConfig configures the IP addresses of a link.
+// +k8s:openapi-gen=true
+// +kubebuilder:object:generate=true
+type IPConfig struct {
+	Mode IPConfigMode `json:"mode"`
+	// Addresses lists the static IPv4 and IPv6 addresses in CIDR notation.
+	Addresses []string `json:"addresses,omitempty"`
+	// Gateways lists the static IPv4 and IPv6 default gateways.
+	Gateways []string `json:"gateways,omitempty"`
+	// DNS lists the static DNS servers.
+	DNS []string `json:"dns,omitempty"`
+}
+
+// VLANConfig specifies a VLAN sub-interface.
+// +k8s:openapi-gen=true
+// +kubebuilder:object:generate=true
+type VLANConfig struct {
+	ID  int       `json:"id"`
+	IP  *IPConfig `json:"ip,omitempty"`
+	MTU int       `json:"mtu,omitempty"`
+}
+
+// PendingLinkConfig is stored as annotation until the client that changed the link configuration confirms it by reaching the device again.
+type PendingLinkConfig struct {
+	// Client is the address of the client that changed the link configuration.
+	Client    string      `json:"client"`
+	ChangedAt metav1.Time `json:"changedAt"`
+	// Rollback is the link configuration to restore unless the change is confirmed.
+	Rollback *NetworkLinkConfig `json:"rollback,omitempty"`
 }
 
 // WifiSpec defines the wifi configuration for the device.
 // +k8s:openapi-gen=true
+// +kubebuilder:object:generate=true
 type WifiSpec struct {
 	Mode        WifiMode            `json:"mode"`
 	CountryCode string              `json:"countryCode,omitempty"`
@@ -60,14 +250,66 @@ type WifiSpec struct {
 
 // WifiStationSpec defines the wifi client configuration.
 // +k8s:openapi-gen=true
+// +kubebuilder:object:generate=true
 type WifiStationSpec struct {
-	SSID string `json:'"ssid,omitempty"`
+	// SSID is the preferred wifi network, taking precedence over the saved networks.
+	SSID string `json:"ssid,omitempty"`
+	// Networks lists the saved wifi networks.
+	// The station connects to the network with the highest priority that is in range and roams between them.
+	Networks []SavedWifiNetwork `json:"networks,omitempty"`
+	// FallbackTimeout is the time after which the access point is started when the station cannot connect or obtain an IP address (default: 3m).
+	// The station is restarted once a saved network is in range again. A zero duration disables the fallback.
+	FallbackTimeout *metav1.Duration `json:"fallbackTimeout,omitempty"`
+}
+
+// SavedWifiNetwork specifies a wifi network the station may connect to.
+// +k8s:openapi-gen=true
+// +kubebuilder:object:generate=true
+type SavedWifiNetwork struct {
+	SSID string `json:"ssid"`
+	// Priority is the preference of the network, higher values are preferred (default: 0).
+	Priority int `json:"priority,omitempty"`
+	// PasswordRef is the name of the WifiPassword holding the network's password (default: derived from the SSID).
+	// For 802.1X networks it also holds the certificates and the client key.
+	PasswordRef string `json:"passwordRef,omitempty"`
+	// EAP configures 802.1X authentication (WPA2/WPA3-Enterprise).
+	EAP *WifiEAPSpec `json:"eap,omitempty"`
+}
+
+// WifiEAPSpec configures 802.1X authentication.
+// +k8s:openapi-gen=true
+type WifiEAPSpec struct {
+	// Method is the EAP method.
+	Method WifiEAPMethod `json:"method"`
+	// Phase2 is the inner authentication method of PEAP and TTLS (default: MSCHAPV2).
+	Phase2   string `json:"phase2,omitempty"`
+	Identity string `json:"identity"`
+	// AnonymousIdentity is the outer identity of PEAP and TTLS, exposed unencrypted.
+	AnonymousIdentity string `json:"anonymousIdentity,omitempty"`
+	// DomainSuffixMatch constrains the name of the authentication server's certificate.
+	DomainSuffixMatch string `json:"domainSuffixMatch,omitempty"`
 }
 
 // WifiAccessPointSpec defines the wifi access point configuration.
+// In accesspoint+station mode, the access point operates on the band and channel of the network the station is connected to.
 // +k8s:openapi-gen=true
 type WifiAccessPointSpec struct {
-	SSID string `json:'"ssid,omitempty"`
+	// SSID is the name of the wifi network (default: device name).
+	SSID string `json:"ssid,omitempty"`
+	// Band is the frequency band the access point operates on (default: 2.4GHz).
+	Band WifiBand `json:"band,omitempty"`
+	// Channel is the channel number or auto (default) to pick the least congested channel of the band.
+	Channel string `json:"channel,omitempty"`
+	// Security is the authentication method, either wpa2 (default), wpa3 or wpa2-wpa3 (transition mode).
+	Security WifiSecurity `json:"security,omitempty"`
+	// Hidden disables broadcasting the SSID.
+	Hidden bool `json:"hidden,omitempty"`
+	// MaxClients limits the number of clients that can connect to the access point.
+	MaxClients int `json:"maxClients,omitempty"`
+	// ClientIsolation prevents the access point clients from communicating with each other.
+	ClientIsolation bool `json:"clientIsolation,omitempty"`
+	// IngressOnly restricts the access point clients to the cluster's ingress instead of NATing them through the uplink.
+	IngressOnly bool `json:"ingressOnly,omitempty"`
 }
 
 // NetworkInterface is the Schema for the network interface API.
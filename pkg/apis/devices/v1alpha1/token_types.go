@@ -9,16 +9,63 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
+// DeviceTokenType specifies the purpose of a device token.
+// +enum
+type DeviceTokenType string
+
+const (
+	// DeviceTokenTypeJoin is a token an agent device uses to join a server.
+	DeviceTokenTypeJoin DeviceTokenType = "join"
+	// DeviceTokenTypeServer is the server's own (rotating) token.
+	DeviceTokenTypeServer DeviceTokenType = "server"
+	// DeviceTokenTypeBootstrap is a k3s bootstrap token that is issued by the server and expires.
+	DeviceTokenTypeBootstrap DeviceTokenType = "bootstrap"
+
+	// JoinTokenIDLabel is the node label referring to the bootstrap token a node joined the cluster with.
+	JoinTokenIDLabel = "kubemate.mgoltzsche.github.com/join-token-id"
+	// APICertFingerprintAnnotation is the node annotation holding the SHA256 fingerprint of the device's API server certificate.
+	APICertFingerprintAnnotation = "kubemate.mgoltzsche.github.com/api-cert-sha256"
+)
+
 // DeviceTokenData specifies the device token.
 // +k8s:openapi-gen=true
+// +kubebuilder:object:generate=true
 type DeviceTokenData struct {
-	Token string `json:"token"`
+	// Token holds the server token or the token an agent uses to join a server.
+	// It must be empty for bootstrap tokens since those are generated by the server.
+	Token string `json:"token,omitempty"`
+	// Type specifies the purpose of the token. Defaults to join.
+	Type DeviceTokenType `json:"type,omitempty"`
+	// Description describes what a bootstrap token is used for.
+	Description string `json:"description,omitempty"`
+	// TTL specifies how long a bootstrap token is valid. Defaults to 24h.
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+	// MaxUses specifies how many devices can join using a bootstrap token. 0 means unlimited.
+	MaxUses int `json:"maxUses,omitempty"`
+	// RotationInterval specifies how often the server token is rotated. Defaults to 720h, 0 disables rotation.
+	RotationInterval *metav1.Duration `json:"rotationInterval,omitempty"`
 }
 
 // DeviceTokenStatus provides the server's join token.
 // +k8s:openapi-gen=true
+// +kubebuilder:object:generate=true
 type DeviceTokenStatus struct {
 	JoinToken string `json:"joinToken,omitempty"`
+	// PreviousJoinToken holds the server's join token before the last rotation.
+	// Agents can still authenticate using it in order to obtain the new token.
+	PreviousJoinToken string `json:"previousJoinToken,omitempty"`
+	// LastRotation is the time the server token was rotated last.
+	LastRotation *metav1.Time `json:"lastRotation,omitempty"`
+	// ID is the public ID of a bootstrap token.
+	ID string `json:"id,omitempty"`
+	// Expires is the time a bootstrap token expires.
+	Expires *metav1.Time `json:"expires,omitempty"`
+	// UsedBy lists the nodes that joined the cluster using a bootstrap token.
+	UsedBy []string `json:"usedBy,omitempty"`
+	// Revoked indicates that a bootstrap token has been used up and cannot be used to join anymore.
+	// Until it expires, agents can still use it to obtain the server's join token.
+	Revoked bool   `json:"revoked,omitempty"`
+	Message string `json:"message,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -17,7 +17,18 @@ const (
 // +k8s:openapi-gen=true
 // WifiPasswordData defines the wifi password data.
 type WifiPasswordData struct {
+	// Password is the pre-shared key or the EAP password of a wifi network.
+	// Except for the access point password, it is write-only: it is never returned by the API and kept when an update does not specify it.
 	Password string `json:"password"`
+	// CACert is the PEM-encoded CA certificate the 802.1X authentication server is verified with.
+	CACert string `json:"caCert,omitempty"`
+	// ClientCert is the PEM-encoded client certificate used for EAP-TLS.
+	ClientCert string `json:"clientCert,omitempty"`
+	// ClientKey is the PEM-encoded private key of the client certificate.
+	// It is write-only: it is never returned by the API and kept when an update does not specify it.
+	ClientKey string `json:"clientKey,omitempty"`
+	// ClientKeyPassword is the password the client key is encrypted with. It is write-only as well.
+	ClientKeyPassword string `json:"clientKeyPassword,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/rest"
 	"k8s.io/apiserver/pkg/authentication/user"
 	"k8s.io/apiserver/pkg/authorization/authorizer"
 )
@@ -15,9 +16,11 @@ const (
 
 var readOnlyVerbs = []string{"get", "list", "watch"}
 
-type deviceAuthorizer struct{}
+type deviceAuthorizer struct {
+	deviceName string
+}
 
-func (deviceAuthorizer) Authorize(ctx context.Context, a authorizer.Attributes) (authorized authorizer.Decision, reason string, err error) {
+func (z *deviceAuthorizer) Authorize(ctx context.Context, a authorizer.Attributes) (authorized authorizer.Decision, reason string, err error) {
 	if isNotDeviceAPIGroup := a.GetAPIGroup() != deviceapi.GroupVersion.Group; isNotDeviceAPIGroup {
 		// Delegate authorization to proxied apiserver.
 		return authorizer.DecisionAllow, "", nil
@@ -32,10 +35,28 @@ func (deviceAuthorizer) Authorize(ctx context.Context, a authorizer.Attributes)
 		// Let anonymous users read nothing but the available devices.
 		return authorizer.DecisionAllow, "", nil
 	}
+	if isAnonymous && a.GetResource() == "certificates" && a.GetName() == "self" && a.GetVerb() == "get" {
+		// Let devices fetch the certificate to pin it during pairing.
+		return authorizer.DecisionAllow, "", nil
+	}
+	if isAnonymous && a.GetResource() == "devicepairings" && (a.GetVerb() == "create" || a.GetVerb() == "update") {
+		// Let agents submit pairing requests and reveal their nonce afterwards.
+		return authorizer.DecisionAllow, "", nil
+	}
+	isPairing := contains(a.GetUser().GetGroups(), rest.PairingGroup)
+	if isPairing && a.GetResource() == "devicepairings" && a.GetUser().GetName() == rest.PairingUserName(a.GetName()) && (a.GetVerb() == "get" || a.GetVerb() == "update") {
+		// Let the server push the join token to the agent.
+		return authorizer.DecisionAllow, "", nil
+	}
+	isAgent := contains(a.GetUser().GetGroups(), agentGroup)
+	if isAgent && a.GetResource() == "devicetokens" && a.GetName() == z.deviceName && a.GetVerb() == "get" {
+		// Let agents obtain the server's join token after rotation.
+		return authorizer.DecisionAllow, "", nil
+	}
 	return authorizer.DecisionDeny, fmt.Sprintf("you must login to use this device. to manage the device, you need to be a member of the %s group", adminGroup), nil
 }
 
-func (deviceAuthorizer) RulesFor(user user.Info, namespace string) ([]authorizer.ResourceRuleInfo, []authorizer.NonResourceRuleInfo, bool, error) {
+func (z *deviceAuthorizer) RulesFor(user user.Info, namespace string) ([]authorizer.ResourceRuleInfo, []authorizer.NonResourceRuleInfo, bool, error) {
 	return []authorizer.ResourceRuleInfo{
 			&authorizer.DefaultResourceRuleInfo{
 				Verbs:     []string{"get", "list", "watch"},
@@ -50,8 +71,8 @@ func (deviceAuthorizer) RulesFor(user user.Info, namespace string) ([]authorizer
 		}, false, nil
 }
 
-func NewDeviceAuthorizer() *deviceAuthorizer {
-	return new(deviceAuthorizer)
+func NewDeviceAuthorizer(deviceName string) *deviceAuthorizer {
+	return &deviceAuthorizer{deviceName: deviceName}
 }
 
 func contains(l []string, item string) bool {
@@ -0,0 +1,54 @@
+package apiserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"slices"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/storage"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+const agentGroup = "kubemate-agents"
+
+// joinTokenAuthenticator authenticates agents using the server's current or previous join token.
+// This allows agents to obtain the new join token after the server token has been rotated.
+// Bootstrap tokens are not accepted since they must not grant access to the server's long-term join token:
+// agents that joined using a bootstrap token authenticate using their node certificate instead (see nodeCertAuthenticator).
+type joinTokenAuthenticator struct {
+	deviceName   string
+	deviceTokens storage.Interface
+}
+
+func newJoinTokenAuthenticator(deviceName string, deviceTokens storage.Interface) *joinTokenAuthenticator {
+	return &joinTokenAuthenticator{deviceName: deviceName, deviceTokens: deviceTokens}
+}
+
+func (a *joinTokenAuthenticator) AuthenticateToken(ctx context.Context, token string) (*authenticator.Response, bool, error) {
+	l := &deviceapi.DeviceTokenList{}
+	err := a.deviceTokens.List(l)
+	if err != nil {
+		return nil, false, nil
+	}
+	if !slices.ContainsFunc(l.Items, func(t deviceapi.DeviceToken) bool { return a.authenticates(&t, token) }) {
+		return nil, false, nil
+	}
+	return &authenticator.Response{
+		User: &user.DefaultInfo{
+			Name:   "agent",
+			UID:    "agent",
+			Groups: []string{agentGroup},
+		},
+	}, true, nil
+}
+
+func (a *joinTokenAuthenticator) authenticates(t *deviceapi.DeviceToken, token string) bool {
+	return t.Name == a.deviceName && t.Data.Type != deviceapi.DeviceTokenTypeBootstrap &&
+		(tokenEquals(t.Status.JoinToken, token) || tokenEquals(t.Status.PreviousJoinToken, token))
+}
+
+func tokenEquals(expected, actual string) bool {
+	return expected != "" && subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) == 1
+}
@@ -0,0 +1,144 @@
+package apiserver
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/storage"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/request/anonymous"
+	"k8s.io/apiserver/pkg/authentication/request/bearertoken"
+	"k8s.io/apiserver/pkg/authentication/request/union"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+func TestJoinTokenAuthenticator(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, deviceapi.AddToScheme(scheme))
+	store := storage.InMemory(scheme)
+	expires := metav1.NewTime(time.Now().Add(time.Hour))
+	for name, tok := range map[string]*deviceapi.DeviceToken{
+		"server": {Status: deviceapi.DeviceTokenStatus{JoinToken: "current", PreviousJoinToken: "previous"}},
+		"valid": {
+			Data:   deviceapi.DeviceTokenData{Type: deviceapi.DeviceTokenTypeBootstrap},
+			Status: deviceapi.DeviceTokenStatus{JoinToken: "bootstrap-valid", Expires: &expires},
+		},
+		"used": {
+			Data:   deviceapi.DeviceTokenData{Type: deviceapi.DeviceTokenTypeBootstrap, MaxUses: 1},
+			Status: deviceapi.DeviceTokenStatus{JoinToken: "bootstrap-used", Expires: &expires, UsedBy: []string{"agent1"}, Revoked: true},
+		},
+	} {
+		require.NoError(t, store.Create(name, tok), "create token %s", name)
+	}
+	authn := union.New(
+		bearertoken.New(newJoinTokenAuthenticator("server", store)),
+		anonymous.NewAuthenticator(nil),
+	)
+	authz := NewDeviceAuthorizer("server")
+	for _, c := range []struct {
+		token   string
+		allowed bool
+	}{
+		{token: "current", allowed: true},
+		{token: "previous", allowed: true},
+		{token: "bootstrap-valid"},
+		{token: "bootstrap-used"},
+		{token: "unknown"},
+	} {
+		t.Run(c.token, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+c.token)
+			resp, ok, _ := authn.AuthenticateRequest(req)
+			require.True(t, ok, "authenticate (anonymously)")
+			decision, _, err := authz.Authorize(context.Background(), authorizer.AttributesRecord{
+				User:            resp.User,
+				Verb:            "get",
+				APIGroup:        deviceapi.GroupVersion.Group,
+				Resource:        "devicetokens",
+				Name:            "server",
+				ResourceRequest: true,
+			})
+			require.NoError(t, err)
+			require.Equal(t, c.allowed, decision == authorizer.DecisionAllow, "may read the server token")
+		})
+	}
+}
+
+func TestNodeCertAuthenticator(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "k3s-client-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTpl, caTpl, caKey.Public(), caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+	caFile := filepath.Join(t.TempDir(), "client-ca.crt")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0644))
+	clientCert := func(ca *x509.Certificate, key *ecdsa.PrivateKey, cn string, groups ...string) *x509.Certificate {
+		k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		tpl := &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      pkix.Name{CommonName: cn, Organization: groups},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		if ca == nil {
+			ca, key = tpl, k
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tpl, ca, k.Public(), key)
+		require.NoError(t, err)
+		c, err := x509.ParseCertificate(der)
+		require.NoError(t, err)
+		return c
+	}
+	a := newNodeCertAuthenticator(caFile)
+	for _, c := range []struct {
+		name     string
+		cert     *x509.Certificate
+		expected bool
+	}{
+		{name: "node", cert: clientCert(caCert, caKey, "system:node:agent1", nodesGroup), expected: true},
+		{name: "other group", cert: clientCert(caCert, caKey, "admin", "system:masters")},
+		{name: "self-signed node", cert: clientCert(nil, nil, "system:node:agent1", nodesGroup)},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{c.cert}}
+			resp, ok, err := a.AuthenticateRequest(req)
+			require.NoError(t, err)
+			require.Equal(t, c.expected, ok, "authenticated")
+			if ok {
+				require.Equal(t, &authenticator.Response{User: resp.User}, resp)
+				require.Equal(t, []string{agentGroup}, resp.User.GetGroups())
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package apiserver
+
+import (
+	"crypto/x509"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	x509request "k8s.io/apiserver/pkg/authentication/request/x509"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+const (
+	nodesGroup = "system:nodes"
+	// clientCAReloadInterval is the interval in which the k3s client CA file is read again.
+	clientCAReloadInterval = time.Minute
+)
+
+// nodeCertAuthenticator authenticates agents using the kubelet client certificate k3s issued to them when they joined.
+// This allows agents that joined using a single-use bootstrap token to obtain the server's join token after it has been rotated.
+type nodeCertAuthenticator struct {
+	x509 *x509request.Authenticator
+}
+
+func newNodeCertAuthenticator(clientCAFile string) *nodeCertAuthenticator {
+	ca := &clientCA{file: clientCAFile}
+	return &nodeCertAuthenticator{x509: x509request.NewDynamic(ca.verifyOptions, x509request.CommonNameUserConversion)}
+}
+
+func (a *nodeCertAuthenticator) AuthenticateRequest(req *http.Request) (*authenticator.Response, bool, error) {
+	resp, ok, err := a.x509.AuthenticateRequest(req)
+	if err != nil || !ok || !slices.Contains(resp.User.GetGroups(), nodesGroup) {
+		return nil, false, nil
+	}
+	return &authenticator.Response{
+		User: &user.DefaultInfo{
+			Name:   "agent",
+			UID:    "agent",
+			Groups: []string{agentGroup},
+		},
+	}, true, nil
+}
+
+// clientCA provides the verify options for the k3s client CA, which does not exist before k3s started.
+type clientCA struct {
+	file     string
+	pool     *x509.CertPool
+	loadedAt time.Time
+	mutex    sync.Mutex
+}
+
+func (c *clientCA) verifyOptions() (x509.VerifyOptions, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.pool == nil || time.Since(c.loadedAt) > clientCAReloadInterval {
+		c.loadedAt = time.Now()
+		b, err := os.ReadFile(c.file)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				logrus.WithError(err).Warn("failed to read k3s client ca")
+			}
+			c.pool = nil
+			return x509.VerifyOptions{}, false
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			logrus.Warnf("no certificate found within k3s client ca file %s", c.file)
+			c.pool = nil
+			return x509.VerifyOptions{}, false
+		}
+		c.pool = pool
+	}
+	return x509.VerifyOptions{
+		Roots:     c.pool,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, true
+}
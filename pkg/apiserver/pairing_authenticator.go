@@ -0,0 +1,42 @@
+package apiserver
+
+import (
+	"context"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/rest"
+	"github.com/mgoltzsche/kubemate/pkg/storage"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+// pairingAuthenticator authenticates a server pushing a join token to the agent
+// using the secret the agent sent along with its pairing request.
+type pairingAuthenticator struct {
+	pairings storage.Interface
+}
+
+func newPairingAuthenticator(pairings storage.Interface) *pairingAuthenticator {
+	return &pairingAuthenticator{pairings: pairings}
+}
+
+func (a *pairingAuthenticator) AuthenticateToken(ctx context.Context, token string) (*authenticator.Response, bool, error) {
+	l := &deviceapi.DevicePairingList{}
+	err := a.pairings.List(l)
+	if err != nil {
+		return nil, false, nil
+	}
+	for _, p := range l.Items {
+		if p.Spec.ServerAddress != "" && p.Status.Phase == deviceapi.DevicePairingPhasePending && tokenEquals(p.Spec.Secret, token) {
+			name := rest.PairingUserName(p.Name)
+			return &authenticator.Response{
+				User: &user.DefaultInfo{
+					Name:   name,
+					UID:    name,
+					Groups: []string{rest.PairingGroup},
+				},
+			}, true, nil
+		}
+	}
+	return nil, false, nil
+}
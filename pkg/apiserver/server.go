@@ -1,20 +1,26 @@
 package apiserver
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"runtime/debug"
 	"strings"
 	"time"
 
 	"github.com/k3s-io/k3s/pkg/version"
 	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/cellular"
+	"github.com/mgoltzsche/kubemate/pkg/certpin"
 	"github.com/mgoltzsche/kubemate/pkg/controller"
+	"github.com/mgoltzsche/kubemate/pkg/dhcp"
 	"github.com/mgoltzsche/kubemate/pkg/discovery"
 	generatedopenapi "github.com/mgoltzsche/kubemate/pkg/generated/openapi"
 	"github.com/mgoltzsche/kubemate/pkg/ingress"
+	"github.com/mgoltzsche/kubemate/pkg/localca"
 	"github.com/mgoltzsche/kubemate/pkg/middleware"
 	"github.com/mgoltzsche/kubemate/pkg/networkifaces"
 	devicectrl "github.com/mgoltzsche/kubemate/pkg/reconciler/device"
@@ -53,12 +59,16 @@ type ServerOptions struct {
 	HTTPAddress         string
 	HTTPPort            int
 	AdvertiseIfaces     []string
+	DiscoveryPeers      []string
+	DiscoveryDomain     string
+	DiscoveryGossip     bool
 	WebDir              string
 	ManifestDir         string
 	DataDir             string
 	KubeletArgs         []string
 	Docker              bool
 	WriteHostResolvConf bool
+	ModemManagerCLI     string
 	Shutdown            func() error
 }
 
@@ -189,14 +199,33 @@ func NewServer(o ServerOptions) (*genericapiserver.GenericAPIServer, error) {
 			Extra:  map[string][]string{},
 		},
 	}))
+	k3sDataDir := filepath.Join(o.DataDir, "k3s")
+	joinTokenDir := filepath.Join(o.DataDir, "devicetokens")
+	deviceTokenREST, err := rest.NewDeviceTokenREST(joinTokenDir, scheme, o.DeviceName, k3sDataDir)
+	if err != nil {
+		return nil, err
+	}
+	caCert, caKey := serverConfig.SecureServing.Cert.CurrentCertKeyContent()
+	caCertFingerprint, err := certpin.Fingerprint(caCert)
+	if err != nil {
+		return nil, fmt.Errorf("api server certificate: %w", err)
+	}
+	apiCert, err := tls.X509KeyPair(caCert, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("api server certificate: %w", err)
+	}
+	discoveryStore := storage.InMemory(scheme)
+	devicePairingREST := rest.NewDevicePairingREST(scheme, o.DeviceName, caCertFingerprint, discoveryStore)
 	serverConfig.Authentication.Authenticator = union.New(
 		authz,
 		ctrlAuthz,
+		bearertoken.New(newJoinTokenAuthenticator(o.DeviceName, deviceTokenREST.Store())),
+		bearertoken.New(newPairingAuthenticator(devicePairingREST.Store())),
+		newNodeCertAuthenticator(filepath.Join(k3sDataDir, "server", "tls", "client-ca.crt")),
 		anonymous.NewAuthenticator(nil),
 	)
-	serverConfig.Authorization.Authorizer = NewDeviceAuthorizer()
+	serverConfig.Authorization.Authorizer = NewDeviceAuthorizer(o.DeviceName)
 
-	k3sDataDir := filepath.Join(o.DataDir, "k3s")
 	k3sProxyEnabled := false
 	apiProxy := newAPIServerProxy("127.0.0.1:6443", filepath.Join(k3sDataDir, "server", "tls"), &k3sProxyEnabled)
 	genericServer, err := serverConfig.Complete().New("kubemate", apiProxy.DelegationTarget())
@@ -209,27 +238,40 @@ func NewServer(o ServerOptions) (*genericapiserver.GenericAPIServer, error) {
 	if err != nil {
 		return nil, err
 	}
-	caCert, _ := serverConfig.SecureServing.Cert.CurrentCertKeyContent()
-	certREST := rest.NewCertificateREST(scheme, caCert)
+	dnsConfigREST, err := rest.NewDNSConfigREST(filepath.Join(o.DataDir, "dnsconfig"), scheme)
+	if err != nil {
+		return nil, err
+	}
+	localZone := func() string {
+		c := deviceapi.DNSConfig{}
+		err := dnsConfigREST.Store().Get(deviceapi.DNSConfigName, &c)
+		if err != nil || c.Spec.Zone == "" {
+			return deviceapi.DefaultDNSZone
+		}
+		return c.Spec.Zone
+	}
+	localCA, err := localca.LoadOrCreate(filepath.Join(o.DataDir, "localca"), fmt.Sprintf("kubemate local CA %s", o.DeviceName), localZone())
+	if err != nil {
+		return nil, err
+	}
+	certREST := rest.NewCertificateREST(scheme, caCert, localCA.CertPEM())
 	userAccountREST, err := rest.NewUserAccountREST(filepath.Join(o.DataDir, "useraccounts"), scheme)
 	if err != nil {
 		return nil, err
 	}
 	ifaceREST := rest.NewNetworkInterfaceREST(ifaceStore)
-	discoveryStore := storage.InMemory(scheme)
-	discovery := discovery.NewDeviceDiscovery(o.DeviceName, o.HTTPSPort, o.AdvertiseIfaces, discoveryStore, logger)
+	discovery := discovery.NewDeviceDiscovery(o.DeviceName, o.HTTPSPort, o.AdvertiseIfaces, &apiCert, discovery.PeerOptions{
+		StaticPeers: o.DiscoveryPeers,
+		Domain:      o.DiscoveryDomain,
+		Gossip:      o.DiscoveryGossip,
+	}, discoveryStore, logger)
 	discoveryREST := rest.NewDeviceDiscoveryREST(discovery.Store())
 	deviceConfigDir := filepath.Join(o.DataDir, "deviceconfig")
 	deviceREST, err := rest.NewDeviceREST(o.DeviceName, deviceConfigDir, scheme)
 	if err != nil {
 		return nil, err
 	}
-	joinTokenDir := filepath.Join(o.DataDir, "devicetokens")
-	deviceTokenREST, err := rest.NewDeviceTokenREST(joinTokenDir, scheme, o.DeviceName)
-	if err != nil {
-		return nil, err
-	}
-	wifi := wifi.New(logger, o.DataDir, func(cmd runner.Command) {
+	wifi := wifi.NewRadios(logger, o.DataDir, func(cmd runner.Command) {
 		time.Sleep(time.Second)
 		l := deviceapi.NetworkInterfaceList{}
 		err := ifaceStore.List(&l)
@@ -248,18 +290,43 @@ func NewServer(o ServerOptions) (*genericapiserver.GenericAPIServer, error) {
 		}
 	})
 	wifi.WriteHostResolvConf = o.WriteHostResolvConf
-	wifi.DNSKeyFile = filepath.Join(o.DataDir, "k3s", "dns", "zone.key")
 	wifi.CaptivePortalURL = fmt.Sprintf("https://%s", externalAddr)
+	wifi.IngressPorts = []int{o.HTTPPort, o.HTTPSPort}
+	modems := cellular.New(logger.WithField("comp", "cellular"))
+	if o.ModemManagerCLI != "" {
+		modems.Command = o.ModemManagerCLI
+	}
 	wifiNetworkREST := rest.NewWifiNetworkREST(wifi, scheme)
 	wifiPasswordDir := filepath.Join(o.DataDir, "wifipasswords")
 	wifiPasswordREST, err := rest.NewWifiPasswordREST(wifiPasswordDir, scheme)
 	if err != nil {
 		return nil, err
 	}
+	dhcpReservationREST, err := rest.NewDHCPReservationREST(filepath.Join(o.DataDir, "dhcpreservations"), scheme)
+	if err != nil {
+		return nil, err
+	}
+	dhcpLeaseSync := &dhcp.LeaseSync{
+		LeaseFile: wifi.DHCPDLeaseFile,
+		Store:     storage.InMemory(scheme),
+		Logger:    logger.WithField("comp", "dhcp-lease-sync"),
+	}
+	installDHCPLeaseSync(genericServer, dhcpLeaseSync)
 	installDeviceDiscovery(genericServer, discovery)
 	apiHandler := genericServer.Handler.FullHandlerChain
 	apiHandler = apiProxy.APIGroupListCompletionFilter(apiHandler)
 	ingressRouter := ingress.NewIngressController("kubemate", http.NotFoundHandler(), logrus.WithField("comp", "ingress-controller"))
+	ingressRouter.DeviceName = o.DeviceName
+	ingressRouter.LocalCA = localCA
+	ingressRouter.LocalZone = localZone
+	// Only the user accounts may log in to the ingress routes, not the agents, the pairing devices or the controller.
+	ingressRouter.Authenticator = authz
+	ingressRouter.DeniedGroups = []string{agentGroup, rest.PairingGroup}
+	ingressRouter.ReservedPorts = []int32{int32(o.HTTPPort), int32(o.HTTPSPort)}
+	ingressRouter.ExternalIPs = discovery.ExternalIPs
+	ingressRouter.Hostname = func() string {
+		return fmt.Sprintf("%s.%s", o.DeviceName, ingressRouter.LocalZone())
+	}
 	mux := http.NewServeMux()
 	mux.Handle("/", rootPathHandler("/ui/", ingressRouter, apiHandler))
 	mux.Handle("/ui/", http.StripPrefix("/ui/", http.FileServer(http.Dir(o.WebDir))))
@@ -267,9 +334,20 @@ func NewServer(o ServerOptions) (*genericapiserver.GenericAPIServer, error) {
 		mux.Handle(fmt.Sprintf("%s/", apiPath), apiHandler)
 	}
 	handler := middleware.ForceHTTPS(mux)
-	// TODO: don't redirect ingress hosts
-	handler = middleware.ForceHTTPSHost(externalAddr, handler)
+	handler = middleware.ForceHTTPSHost(externalAddr, ingressRouter.IsIngressHost, handler)
+	clients := middleware.NewClientTracker()
+	handler = clients.Handler(handler)
 	genericServer.Handler.FullHandlerChain = handler
+	// kubemate serves TLS itself in order to select the ingress hosts' certificates via SNI, falling back to the API server certificate.
+	installTLSServer(genericServer, genericServer.SecureServingInfo.Listener, &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"h2", "http/1.1"},
+		Certificates:   []tls.Certificate{apiCert},
+		GetCertificate: ingressRouter.GetCertificate,
+		// Agents present their node certificate when fetching the server's join token.
+		ClientAuth: tls.RequestClientCert,
+	})
+	genericServer.SecureServingInfo = nil
 	apiGroup := &genericapiserver.APIGroupInfo{
 		PrioritizedVersions:  scheme.PrioritizedVersionsForGroup(deviceapi.GroupVersion.Group),
 		Scheme:               scheme,
@@ -284,8 +362,12 @@ func NewServer(o ServerOptions) (*genericapiserver.GenericAPIServer, error) {
 				"devices/shutdown":  rest.NewDeviceShutdownREST(o.DeviceName, deviceREST.Store(), k3sDataDir),
 				"devicediscovery":   discoveryREST,
 				"devicetokens":      deviceTokenREST,
+				"devicepairings":    devicePairingREST,
 				"wifipasswords":     wifiPasswordREST,
 				"wifinetworks":      wifiNetworkREST,
+				"dnsconfigs":        dnsConfigREST,
+				"dhcpleases":        rest.NewDHCPLeaseREST(dhcpLeaseSync.Store),
+				"dhcpreservations":  dhcpReservationREST,
 			},
 		},
 	}
@@ -301,6 +383,8 @@ func NewServer(o ServerOptions) (*genericapiserver.GenericAPIServer, error) {
 			WifiNetworks:      wifiNetworkREST.Store(),
 			WifiPasswords:     wifiPasswordREST.Store(),
 			Wifi:              wifi,
+			Modems:            modems,
+			Clients:           clients,
 		},
 		&devicectrl.DeviceReconciler{
 			DeviceName:            o.DeviceName,
@@ -309,20 +393,60 @@ func NewServer(o ServerOptions) (*genericapiserver.GenericAPIServer, error) {
 			DataDir:               k3sDataDir,
 			ManifestDir:           o.ManifestDir,
 			ExternalPort:          o.HTTPSPort,
+			APICertFingerprint:    caCertFingerprint,
+			Version:               version.Version,
+			K3sVersion:            k3sModuleVersion(),
 			Docker:                o.Docker,
 			KubeletArgs:           o.KubeletArgs,
 			Devices:               deviceREST.Store(),
 			DeviceTokens:          deviceTokenREST.Store(),
 			NetworkInterfaces:     ifaceStore,
+			DNSConfigs:            dnsConfigREST.Store(),
+			DHCPReservations:      dhcpReservationREST.Store(),
+			DHCPLeaseFile:         wifi.DHCPDLeaseFile,
 			NetworkInterfaceNames: o.AdvertiseIfaces,
 			IngressController:     ingressRouter,
 			K3sProxyEnabled:       &k3sProxyEnabled,
 			Shutdown:              o.Shutdown,
 			Logger:                logger,
+		},
+		&devicectrl.LocalCAReconciler{
+			LocalCA:      localCA,
+			Certificates: certREST.Store(),
+			DNSConfigs:   dnsConfigREST.Store(),
+		},
+		&devicectrl.DeviceTokenReconciler{
+			DeviceName:   o.DeviceName,
+			K3sDir:       k3sDataDir,
+			Devices:      deviceREST.Store(),
+			DeviceTokens: deviceTokenREST.Store(),
+		},
+		&devicectrl.DevicePairingReconciler{
+			DeviceName:         o.DeviceName,
+			DeviceAddress:      fmt.Sprintf("https://%s", externalAddr),
+			APICertFingerprint: caCertFingerprint,
+			Devices:            deviceREST.Store(),
+			DeviceTokens:       deviceTokenREST.Store(),
+			DevicePairings:     devicePairingREST.Store(),
 		})
 	return genericServer, nil
 }
 
+func installTLSServer(genericServer *genericapiserver.GenericAPIServer, ln net.Listener, tlsConfig *tls.Config) {
+	genericServer.AddPostStartHookOrDie("tls-server", func(ctx genericapiserver.PostStartHookContext) error {
+		srv := &http.Server{
+			Handler:           genericServer.Handler,
+			TLSConfig:         tlsConfig,
+			MaxHeaderBytes:    1 << 20,
+			IdleTimeout:       90 * time.Second,
+			ReadHeaderTimeout: 32 * time.Second,
+		}
+		logrus.Infof("serving securely on %s", ln.Addr())
+		_, _, err := genericapiserver.RunServer(srv, ln, genericServer.ShutdownTimeout, ctx.Done())
+		return err
+	})
+}
+
 func installNetworkInterfaceSync(genericServer *genericapiserver.GenericAPIServer, sync *networkifaces.NetworkIfaceSync) {
 	genericServer.AddPostStartHookOrDie("networkiface-sync", func(ctx genericapiserver.PostStartHookContext) error {
 		return sync.Start()
@@ -330,12 +454,33 @@ func installNetworkInterfaceSync(genericServer *genericapiserver.GenericAPIServe
 	genericServer.AddPreShutdownHookOrDie("networkiface-sync", sync.Stop)
 }
 
+// k3sModuleVersion returns the version of the k3s module kubemate was built with.
+func k3sModuleVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, m := range info.Deps {
+		if m.Path == "github.com/k3s-io/k3s" {
+			if m.Replace != nil && m.Replace.Version != "" {
+				return m.Replace.Version
+			}
+			return m.Version
+		}
+	}
+	return ""
+}
+
+func installDHCPLeaseSync(genericServer *genericapiserver.GenericAPIServer, sync *dhcp.LeaseSync) {
+	genericServer.AddPostStartHookOrDie("dhcp-lease-sync", func(ctx genericapiserver.PostStartHookContext) error {
+		return sync.Start()
+	})
+	genericServer.AddPreShutdownHookOrDie("dhcp-lease-sync", sync.Stop)
+}
+
 func installDeviceDiscovery(genericServer *genericapiserver.GenericAPIServer, discovery *discovery.DeviceDiscovery) {
 	genericServer.AddPostStartHookOrDie("device-discovery", func(ctx genericapiserver.PostStartHookContext) error {
-		err := discovery.Discover()
-		if err != nil {
-			logrus.WithError(err).Error("device discovery post start hook failed")
-		}
+		discovery.Start()
 		return nil
 	})
 	genericServer.AddPreShutdownHookOrDie("device-discovery", discovery.Close)
@@ -0,0 +1,278 @@
+package cellular
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	mmService          = "org.freedesktop.ModemManager1"
+	mmPath             = "/org/freedesktop/ModemManager1"
+	mmModemIface       = mmService + ".Modem"
+	mmModem3gppIface   = mmService + ".Modem.Modem3gpp"
+	mmModemSimpleIface = mmService + ".Modem.Simple"
+	mmBearerIface      = mmService + ".Bearer"
+	mmModemPortTypeNet = 2
+)
+
+// modemStates maps ModemManager's MMModemState values to their names.
+var modemStates = map[int32]string{
+	-1: "failed",
+	0:  "unknown",
+	1:  "initializing",
+	2:  ModemStateLocked,
+	3:  "disabled",
+	4:  "disabling",
+	5:  "enabling",
+	6:  "enabled",
+	7:  "searching",
+	8:  "registered",
+	9:  "disconnecting",
+	10: ModemStateConnecting,
+	11: ModemStateConnected,
+}
+
+// registrationStates maps ModemManager's MMModem3gppRegistrationState values to their names.
+var registrationStates = []string{
+	"idle",
+	"home",
+	"searching",
+	"denied",
+	"unknown",
+	"roaming",
+	"home-sms-only",
+	"roaming-sms-only",
+	"emergency-services",
+	"home-csfb-not-preferred",
+	"roaming-csfb-not-preferred",
+	"attached-rlos",
+}
+
+// accessTechnologies lists the names of ModemManager's MMModemAccessTechnology flags in the order of their bits.
+var accessTechnologies = []string{
+	"pots",
+	"gsm",
+	"gsm-compact",
+	"gprs",
+	"edge",
+	"umts",
+	"hsdpa",
+	"hsupa",
+	"hspa",
+	"hspa-plus",
+	"1xrtt",
+	"evdo0",
+	"evdoa",
+	"evdob",
+	"lte",
+	"5gnr",
+	"lte-cat-m",
+	"lte-nb-iot",
+}
+
+// bearerIPMethods maps ModemManager's MMBearerIpMethod values to their names.
+var bearerIPMethods = map[uint32]string{
+	1: "ppp",
+	2: BearerIPMethodStatic,
+	3: BearerIPMethodDHCP,
+}
+
+// dbusModemManager controls the modems using ModemManager's D-Bus API.
+// It requires access to the D-Bus system socket.
+type dbusModemManager struct{}
+
+func (c *dbusModemManager) Modems(ctx context.Context) ([]*Modem, error) {
+	var objects map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+	err := c.call(ctx, mmPath, "org.freedesktop.DBus.ObjectManager.GetManagedObjects", &objects)
+	if err != nil {
+		return nil, fmt.Errorf("list modems: %w", err)
+	}
+	modems := make([]*Modem, 0, len(objects))
+	for path, o := range objects {
+		if _, ok := o[mmModemIface]; !ok {
+			continue
+		}
+		modem, err := modemFromProperties(path, o)
+		if err != nil {
+			return nil, fmt.Errorf("modem %s: %w", path, err)
+		}
+		modems = append(modems, modem)
+	}
+	return modems, nil
+}
+
+func (c *dbusModemManager) Connect(ctx context.Context, modem string, conf ConnectConfig) error {
+	props := map[string]dbus.Variant{
+		"apn":           dbus.MakeVariant(conf.APN),
+		"allow-roaming": dbus.MakeVariant(conf.AllowRoaming),
+	}
+	if conf.PIN != "" {
+		props["pin"] = dbus.MakeVariant(conf.PIN)
+	}
+	var bearer dbus.ObjectPath
+	return c.call(ctx, dbus.ObjectPath(modem), mmModemSimpleIface+".Connect", &bearer, props)
+}
+
+func (c *dbusModemManager) Disconnect(ctx context.Context, modem string) error {
+	// The root path lets ModemManager disconnect all bearers.
+	return c.call(ctx, dbus.ObjectPath(modem), mmModemSimpleIface+".Disconnect", nil, dbus.ObjectPath("/"))
+}
+
+func (c *dbusModemManager) Bearer(ctx context.Context, bearer string) (*BearerIPConfig, bool, error) {
+	var props map[string]dbus.Variant
+	err := c.call(ctx, dbus.ObjectPath(bearer), "org.freedesktop.DBus.Properties.GetAll", &props, mmBearerIface)
+	if err != nil {
+		return nil, false, err
+	}
+	return bearerFromProperties(props)
+}
+
+// call calls the given method of a ModemManager object and stores the result within the given value, unless it is nil.
+func (c *dbusModemManager) call(ctx context.Context, path dbus.ObjectPath, method string, result interface{}, args ...interface{}) error {
+	conn, err := dbus.ConnectSystemBus(dbus.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("connect to d-bus: %w", err)
+	}
+	defer conn.Close()
+	call := conn.Object(mmService, path).CallWithContext(ctx, method, 0, args...)
+	if call.Err != nil {
+		return call.Err
+	}
+	if result == nil {
+		return nil
+	}
+	return call.Store(result)
+}
+
+// modemFromProperties maps the properties of a ModemManager modem object to a Modem.
+func modemFromProperties(path dbus.ObjectPath, o map[string]map[string]dbus.Variant) (*Modem, error) {
+	var (
+		props = o[mmModemIface]
+		p     struct {
+			Manufacturer       string
+			Model              string
+			State              int32
+			AccessTechnologies uint32
+			SignalQuality      struct {
+				Value  uint32
+				Recent bool
+			}
+			Ports []struct {
+				Name string
+				Type uint32
+			}
+			Bearers []dbus.ObjectPath
+		}
+		threeGPP struct {
+			RegistrationState uint32
+			OperatorName      string
+		}
+	)
+	err := storeProperties(props, map[string]interface{}{
+		"Manufacturer":       &p.Manufacturer,
+		"Model":              &p.Model,
+		"State":              &p.State,
+		"AccessTechnologies": &p.AccessTechnologies,
+		"SignalQuality":      &p.SignalQuality,
+		"Ports":              &p.Ports,
+		"Bearers":            &p.Bearers,
+	})
+	if err != nil {
+		return nil, err
+	}
+	threeGPP.RegistrationState = 4 // unknown
+	err = storeProperties(o[mmModem3gppIface], map[string]interface{}{
+		"RegistrationState": &threeGPP.RegistrationState,
+		"OperatorName":      &threeGPP.OperatorName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	modem := &Modem{
+		Path:          string(path),
+		Model:         strings.TrimSpace(strings.Join(nonEmpty(p.Manufacturer, p.Model), " ")),
+		State:         modemStates[p.State],
+		Operator:      threeGPP.OperatorName,
+		SignalQuality: int(p.SignalQuality.Value),
+		Bearers:       make([]string, len(p.Bearers)),
+	}
+	if _, ok := o[mmModem3gppIface]; ok && int(threeGPP.RegistrationState) < len(registrationStates) {
+		modem.RegistrationState = registrationStates[threeGPP.RegistrationState]
+	}
+	for i, t := range accessTechnologies {
+		if p.AccessTechnologies&(1<<i) != 0 {
+			modem.AccessTechnologies = append(modem.AccessTechnologies, t)
+		}
+	}
+	for _, port := range p.Ports {
+		if port.Type == mmModemPortTypeNet {
+			modem.NetPorts = append(modem.NetPorts, port.Name)
+		}
+	}
+	for i, b := range p.Bearers {
+		modem.Bearers[i] = string(b)
+	}
+	return modem, nil
+}
+
+// bearerFromProperties returns the IPv4 configuration of a ModemManager bearer object and whether it is connected.
+func bearerFromProperties(props map[string]dbus.Variant) (*BearerIPConfig, bool, error) {
+	var (
+		connected bool
+		ip4Config map[string]dbus.Variant
+		c         struct {
+			Method  uint32
+			Address string
+			Prefix  uint32
+			Gateway string
+			DNS     [3]string
+			MTU     uint32
+		}
+	)
+	err := storeProperties(props, map[string]interface{}{
+		"Connected": &connected,
+		"Ip4Config": &ip4Config,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	err = storeProperties(ip4Config, map[string]interface{}{
+		"method":  &c.Method,
+		"address": &c.Address,
+		"prefix":  &c.Prefix,
+		"gateway": &c.Gateway,
+		"dns1":    &c.DNS[0],
+		"dns2":    &c.DNS[1],
+		"dns3":    &c.DNS[2],
+		"mtu":     &c.MTU,
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("ip4 config: %w", err)
+	}
+	return &BearerIPConfig{
+		Method:  bearerIPMethods[c.Method],
+		Address: c.Address,
+		Prefix:  int(c.Prefix),
+		Gateway: c.Gateway,
+		DNS:     nonEmpty(c.DNS[:]...),
+		MTU:     int(c.MTU),
+	}, connected, nil
+}
+
+// storeProperties stores the values of the given D-Bus properties that are present within the corresponding destinations.
+func storeProperties(props map[string]dbus.Variant, dest map[string]interface{}) error {
+	for name, d := range dest {
+		v, ok := props[name]
+		if !ok {
+			continue
+		}
+		err := dbus.Store([]interface{}{v.Value()}, d)
+		if err != nil {
+			return fmt.Errorf("property %s: %w", name, err)
+		}
+	}
+	return nil
+}
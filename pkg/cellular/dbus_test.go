@@ -0,0 +1,92 @@
+package cellular
+
+import (
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModemFromProperties(t *testing.T) {
+	modem, err := modemFromProperties("/org/freedesktop/ModemManager1/Modem/0", map[string]map[string]dbus.Variant{
+		mmModemIface: {
+			"Manufacturer":       dbus.MakeVariant("QUALCOMM INCORPORATED"),
+			"Model":              dbus.MakeVariant("QUECTEL Mobile Broadband Module"),
+			"State":              dbus.MakeVariant(int32(11)),
+			"AccessTechnologies": dbus.MakeVariant(uint32(1 << 14)),
+			"SignalQuality":      dbus.MakeVariant([]interface{}{uint32(67), true}),
+			"Ports": dbus.MakeVariant([][]interface{}{
+				{"cdc-wdm0", uint32(6)},
+				{"ttyUSB2", uint32(3)},
+				{"wwan0", uint32(2)},
+			}),
+			"Bearers": dbus.MakeVariant([]dbus.ObjectPath{"/org/freedesktop/ModemManager1/Bearer/0"}),
+		},
+		mmModem3gppIface: {
+			"RegistrationState": dbus.MakeVariant(uint32(1)),
+			"OperatorName":      dbus.MakeVariant("Telekom.de"),
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, &Modem{
+		Path:               "/org/freedesktop/ModemManager1/Modem/0",
+		Model:              "QUALCOMM INCORPORATED QUECTEL Mobile Broadband Module",
+		State:              ModemStateConnected,
+		RegistrationState:  "home",
+		Operator:           "Telekom.de",
+		AccessTechnologies: []string{"lte"},
+		SignalQuality:      67,
+		NetPorts:           []string{"wwan0"},
+		Bearers:            []string{"/org/freedesktop/ModemManager1/Bearer/0"},
+	}, modem)
+
+	modem, err = modemFromProperties("/org/freedesktop/ModemManager1/Modem/1", map[string]map[string]dbus.Variant{
+		mmModemIface: {
+			"State": dbus.MakeVariant(int32(2)),
+			"Ports": dbus.MakeVariant([][]interface{}{{"wwan0", uint32(2)}}),
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, ModemStateLocked, modem.State, "state")
+	require.Equal(t, "", modem.Model, "model")
+	require.Equal(t, "", modem.RegistrationState, "registration state")
+	require.Equal(t, []string{"wwan0"}, modem.NetPorts, "net ports")
+
+	_, err = modemFromProperties("/org/freedesktop/ModemManager1/Modem/2", map[string]map[string]dbus.Variant{
+		mmModemIface: {"State": dbus.MakeVariant("connected")},
+	})
+	require.Error(t, err, "invalid property type")
+}
+
+func TestBearerFromProperties(t *testing.T) {
+	ip, connected, err := bearerFromProperties(map[string]dbus.Variant{
+		"Connected": dbus.MakeVariant(true),
+		"Ip4Config": dbus.MakeVariant(map[string]dbus.Variant{
+			"method":  dbus.MakeVariant(uint32(2)),
+			"address": dbus.MakeVariant("10.64.12.7"),
+			"prefix":  dbus.MakeVariant(uint32(29)),
+			"gateway": dbus.MakeVariant("10.64.12.8"),
+			"dns1":    dbus.MakeVariant("10.74.210.210"),
+			"dns2":    dbus.MakeVariant("10.74.210.211"),
+			"mtu":     dbus.MakeVariant(uint32(1500)),
+		}),
+	})
+	require.NoError(t, err)
+	require.True(t, connected, "connected")
+	require.Equal(t, &BearerIPConfig{
+		Method:  BearerIPMethodStatic,
+		Address: "10.64.12.7",
+		Prefix:  29,
+		Gateway: "10.64.12.8",
+		DNS:     []string{"10.74.210.210", "10.74.210.211"},
+		MTU:     1500,
+	}, ip)
+
+	ip, connected, err = bearerFromProperties(map[string]dbus.Variant{
+		"Connected": dbus.MakeVariant(false),
+		"Ip4Config": dbus.MakeVariant(map[string]dbus.Variant{}),
+	})
+	require.NoError(t, err)
+	require.False(t, connected, "connected")
+	require.Equal(t, "", ip.Method, "method")
+}
@@ -0,0 +1,184 @@
+package cellular
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mgoltzsche/kubemate/pkg/cliutils"
+)
+
+// mmcli controls the modems using ModemManager's command line client.
+// Since command line arguments are visible within the process list, it does not support unlocking the SIM card with a PIN.
+type mmcli struct {
+	Command string
+}
+
+func (c *mmcli) Modems(ctx context.Context) ([]*Modem, error) {
+	out, err := c.run(ctx, "-L")
+	if err != nil {
+		return nil, err
+	}
+	paths, err := parseModemList(out)
+	if err != nil {
+		return nil, err
+	}
+	modems := make([]*Modem, 0, len(paths))
+	for _, path := range paths {
+		out, err = c.run(ctx, "-m", path)
+		if err != nil {
+			return nil, err
+		}
+		modem, err := parseModem(out)
+		if err != nil {
+			return nil, fmt.Errorf("modem %s: %w", path, err)
+		}
+		modems = append(modems, modem)
+	}
+	return modems, nil
+}
+
+func (c *mmcli) Connect(ctx context.Context, modem string, conf ConnectConfig) error {
+	if conf.PIN != "" {
+		return errors.New("unlocking the SIM card with a PIN is not supported using mmcli")
+	}
+	_, err := c.run(ctx, "-m", modem, "--simple-connect="+simpleConnectArgs(conf))
+	return err
+}
+
+func (c *mmcli) Disconnect(ctx context.Context, modem string) error {
+	_, err := c.run(ctx, "-m", modem, "--simple-disconnect")
+	return err
+}
+
+func (c *mmcli) Bearer(ctx context.Context, bearer string) (*BearerIPConfig, bool, error) {
+	out, err := c.run(ctx, "-b", bearer)
+	if err != nil {
+		return nil, false, err
+	}
+	return parseBearer(out)
+}
+
+func (c *mmcli) run(ctx context.Context, args ...string) (string, error) {
+	return cliutils.Run(ctx, c.Command, append([]string{"-J"}, args...)...)
+}
+
+func simpleConnectArgs(c ConnectConfig) string {
+	roaming := "no"
+	if c.AllowRoaming {
+		roaming = "yes"
+	}
+	return strings.Join([]string{"apn=" + c.APN, "allow-roaming=" + roaming}, ",")
+}
+
+// parseModemList parses the output of `mmcli -J -L`.
+func parseModemList(out string) ([]string, error) {
+	var l struct {
+		Modems []string `json:"modem-list"`
+	}
+	err := json.Unmarshal([]byte(out), &l)
+	if err != nil {
+		return nil, fmt.Errorf("parse modem list: %w", err)
+	}
+	return l.Modems, nil
+}
+
+// parseModem parses the output of `mmcli -J -m <MODEM>`.
+func parseModem(out string) (*Modem, error) {
+	var o struct {
+		Modem struct {
+			DBusPath string `json:"dbus-path"`
+			ThreeGPP struct {
+				OperatorName      string `json:"operator-name"`
+				RegistrationState string `json:"registration-state"`
+			} `json:"3gpp"`
+			Generic struct {
+				AccessTechnologies []string `json:"access-technologies"`
+				Bearers            []string `json:"bearers"`
+				Manufacturer       string   `json:"manufacturer"`
+				Model              string   `json:"model"`
+				Ports              []string `json:"ports"`
+				SignalQuality      struct {
+					Value string `json:"value"`
+				} `json:"signal-quality"`
+				State string `json:"state"`
+			} `json:"generic"`
+		} `json:"modem"`
+	}
+	err := json.Unmarshal([]byte(out), &o)
+	if err != nil {
+		return nil, fmt.Errorf("parse modem: %w", err)
+	}
+	g := o.Modem.Generic
+	modem := &Modem{
+		Path:               o.Modem.DBusPath,
+		Model:              strings.TrimSpace(strings.Join(nonEmpty(g.Manufacturer, g.Model), " ")),
+		State:              nonEmptyValue(g.State),
+		RegistrationState:  nonEmptyValue(o.Modem.ThreeGPP.RegistrationState),
+		Operator:           nonEmptyValue(o.Modem.ThreeGPP.OperatorName),
+		AccessTechnologies: g.AccessTechnologies,
+		Bearers:            g.Bearers,
+	}
+	modem.SignalQuality, _ = strconv.Atoi(g.SignalQuality.Value)
+	for _, port := range g.Ports {
+		name, ok := strings.CutSuffix(port, " (net)")
+		if ok {
+			modem.NetPorts = append(modem.NetPorts, name)
+		}
+	}
+	return modem, nil
+}
+
+// parseBearer parses the output of `mmcli -J -b <BEARER>` and returns its IPv4 configuration and whether it is connected.
+func parseBearer(out string) (*BearerIPConfig, bool, error) {
+	var o struct {
+		Bearer struct {
+			IPv4Config struct {
+				Method  string   `json:"method"`
+				Address string   `json:"address"`
+				Prefix  string   `json:"prefix"`
+				Gateway string   `json:"gateway"`
+				DNS     []string `json:"dns"`
+				MTU     string   `json:"mtu"`
+			} `json:"ipv4-config"`
+			Status struct {
+				Connected string `json:"connected"`
+			} `json:"status"`
+		} `json:"bearer"`
+	}
+	err := json.Unmarshal([]byte(out), &o)
+	if err != nil {
+		return nil, false, fmt.Errorf("parse bearer: %w", err)
+	}
+	c := o.Bearer.IPv4Config
+	ip := &BearerIPConfig{
+		Method:  nonEmptyValue(c.Method),
+		Address: nonEmptyValue(c.Address),
+		Gateway: nonEmptyValue(c.Gateway),
+		DNS:     c.DNS,
+	}
+	ip.Prefix, _ = strconv.Atoi(c.Prefix)
+	ip.MTU, _ = strconv.Atoi(c.MTU)
+	return ip, o.Bearer.Status.Connected == "yes", nil
+}
+
+// nonEmptyValue maps mmcli's placeholder for an unknown value to an empty string.
+func nonEmptyValue(v string) string {
+	if v == "--" {
+		return ""
+	}
+	return v
+}
+
+func nonEmpty(values ...string) []string {
+	r := make([]string, 0, len(values))
+	for _, v := range values {
+		if v = nonEmptyValue(v); v != "" {
+			r = append(r, v)
+		}
+	}
+	return r
+}
@@ -0,0 +1,66 @@
+package cellular
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseModemList(t *testing.T) {
+	paths, err := parseModemList(`{"modem-list":["/org/freedesktop/ModemManager1/Modem/0"]}`)
+	require.NoError(t, err)
+	require.Equal(t, []string{"/org/freedesktop/ModemManager1/Modem/0"}, paths)
+	paths, err = parseModemList(`{"modem-list":[]}`)
+	require.NoError(t, err)
+	require.Empty(t, paths, "no modems")
+}
+
+func TestParseModem(t *testing.T) {
+	out := `{"modem":{"3gpp":{"imei":"867962040000000","operator-code":"26201","operator-name":"Telekom.de","registration-state":"home"},"dbus-path":"/org/freedesktop/ModemManager1/Modem/0","generic":{"access-technologies":["lte"],"bearers":["/org/freedesktop/ModemManager1/Bearer/0"],"manufacturer":"QUALCOMM INCORPORATED","model":"QUECTEL Mobile Broadband Module","ports":["cdc-wdm0 (qmi)","ttyUSB0 (qcdm)","ttyUSB2 (at)","wwan0 (net)"],"power-state":"on","signal-quality":{"recent":"yes","value":"67"},"state":"connected","unlock-required":"--"}}}`
+	modem, err := parseModem(out)
+	require.NoError(t, err)
+	require.Equal(t, &Modem{
+		Path:               "/org/freedesktop/ModemManager1/Modem/0",
+		Model:              "QUALCOMM INCORPORATED QUECTEL Mobile Broadband Module",
+		State:              ModemStateConnected,
+		RegistrationState:  "home",
+		Operator:           "Telekom.de",
+		AccessTechnologies: []string{"lte"},
+		SignalQuality:      67,
+		NetPorts:           []string{"wwan0"},
+		Bearers:            []string{"/org/freedesktop/ModemManager1/Bearer/0"},
+	}, modem)
+
+	out = `{"modem":{"3gpp":{"operator-name":"--","registration-state":"--"},"dbus-path":"/org/freedesktop/ModemManager1/Modem/1","generic":{"access-technologies":[],"bearers":[],"manufacturer":"--","model":"--","ports":["cdc-wdm0 (mbim)","wwan0 (net)"],"signal-quality":{"recent":"no","value":"0"},"state":"locked","unlock-required":"sim-pin"}}}`
+	modem, err = parseModem(out)
+	require.NoError(t, err)
+	require.Equal(t, "", modem.Model, "model")
+	require.Equal(t, ModemStateLocked, modem.State, "state")
+	require.Equal(t, "", modem.Operator, "operator")
+	require.Equal(t, "", modem.RegistrationState, "registration state")
+}
+
+func TestParseBearer(t *testing.T) {
+	out := `{"bearer":{"dbus-path":"/org/freedesktop/ModemManager1/Bearer/0","ipv4-config":{"address":"10.64.12.7","dns":["10.74.210.210","10.74.210.211"],"gateway":"10.64.12.8","method":"static","mtu":"1500","prefix":"29"},"ipv6-config":{"method":"--"},"properties":{"apn":"internet.telekom","roaming":"forbidden"},"status":{"connected":"yes","interface":"wwan0"}}}`
+	ip, connected, err := parseBearer(out)
+	require.NoError(t, err)
+	require.True(t, connected, "connected")
+	require.Equal(t, &BearerIPConfig{
+		Method:  BearerIPMethodStatic,
+		Address: "10.64.12.7",
+		Prefix:  29,
+		Gateway: "10.64.12.8",
+		DNS:     []string{"10.74.210.210", "10.74.210.211"},
+		MTU:     1500,
+	}, ip)
+
+	ip, connected, err = parseBearer(`{"bearer":{"ipv4-config":{"method":"--"},"status":{"connected":"no"}}}`)
+	require.NoError(t, err)
+	require.False(t, connected, "connected")
+	require.Equal(t, "", ip.Method, "method")
+}
+
+func TestSimpleConnectArgs(t *testing.T) {
+	require.Equal(t, "apn=internet,allow-roaming=no", simpleConnectArgs(ConnectConfig{APN: "internet"}))
+	require.Equal(t, "apn=internet,allow-roaming=yes", simpleConnectArgs(ConnectConfig{APN: "internet", AllowRoaming: true}))
+}
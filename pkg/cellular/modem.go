@@ -0,0 +1,147 @@
+package cellular
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	ModemStateLocked     = "locked"
+	ModemStateConnecting = "connecting"
+	ModemStateConnected  = "connected"
+	// BearerIPMethodStatic indicates that the bearer's IP configuration must be applied to the network link.
+	BearerIPMethodStatic = "static"
+	// BearerIPMethodDHCP indicates that the network link obtains its IP configuration via DHCP.
+	BearerIPMethodDHCP = "dhcp"
+)
+
+// InterfaceNamePrefixes are the name prefixes of the network links of modems.
+var InterfaceNamePrefixes = []string{"wwan", "wwp", "wwx"}
+
+// ErrModemNotFound is returned when no modem provides the requested network link.
+var ErrModemNotFound = errors.New("modem not found")
+
+// Modems controls the modems via ModemManager's D-Bus API.
+type Modems struct {
+	// Command is an mmcli executable the modems are controlled with instead of the D-Bus API.
+	// It allows to use a stand-in for testing.
+	Command string
+	logger  *logrus.Entry
+}
+
+// modemManager is a ModemManager client.
+type modemManager interface {
+	Modems(ctx context.Context) ([]*Modem, error)
+	Connect(ctx context.Context, modem string, c ConnectConfig) error
+	Disconnect(ctx context.Context, modem string) error
+	// Bearer returns the IPv4 configuration of the given bearer and whether it is connected.
+	Bearer(ctx context.Context, bearer string) (*BearerIPConfig, bool, error)
+}
+
+// Modem describes the state of a modem.
+type Modem struct {
+	// Path is the D-Bus object path of the modem.
+	Path               string
+	Model              string
+	State              string
+	RegistrationState  string
+	Operator           string
+	AccessTechnologies []string
+	// SignalQuality is the signal quality in percent.
+	SignalQuality int
+	// NetPorts lists the network links the modem provides.
+	NetPorts []string
+	// Bearers lists the D-Bus object paths of the modem's bearers.
+	Bearers []string
+}
+
+// ConnectConfig specifies the mobile data connection.
+type ConnectConfig struct {
+	APN          string
+	PIN          string
+	AllowRoaming bool
+}
+
+// BearerIPConfig is the IPv4 configuration the mobile network assigned to a connected bearer.
+type BearerIPConfig struct {
+	Method  string
+	Address string
+	Prefix  int
+	Gateway string
+	DNS     []string
+	MTU     int
+}
+
+func New(logger *logrus.Entry) *Modems {
+	return &Modems{logger: logger}
+}
+
+func (m *Modems) client() modemManager {
+	if m.Command != "" {
+		return &mmcli{Command: m.Command}
+	}
+	return &dbusModemManager{}
+}
+
+// Find returns the modem that provides the given network link.
+func (m *Modems) Find(iface string) (*Modem, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+	modems, err := m.client().Modems(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, modem := range modems {
+		for _, port := range modem.NetPorts {
+			if port == iface {
+				return modem, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w for network link %s", ErrModemNotFound, iface)
+}
+
+// Connect unlocks the SIM card if necessary, registers the modem with the mobile network and connects a bearer.
+func (m *Modems) Connect(modem *Modem, c ConnectConfig) error {
+	m.logger.WithField("modem", modem.Path).WithField("apn", c.APN).Info("connecting modem")
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+	err := m.client().Connect(ctx, modem.Path, c)
+	if err != nil {
+		return fmt.Errorf("connect modem: %w", err)
+	}
+	return nil
+}
+
+// Disconnect disconnects all bearers of the modem.
+func (m *Modems) Disconnect(modem *Modem) error {
+	m.logger.WithField("modem", modem.Path).Info("disconnecting modem")
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+	err := m.client().Disconnect(ctx, modem.Path)
+	if err != nil {
+		return fmt.Errorf("disconnect modem: %w", err)
+	}
+	return nil
+}
+
+// BearerIPConfig returns the IPv4 configuration of the modem's connected bearer.
+func (m *Modems) BearerIPConfig(modem *Modem) (*BearerIPConfig, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+	c := m.client()
+	for _, path := range modem.Bearers {
+		ip, connected, err := c.Bearer(ctx, path)
+		if err != nil {
+			return nil, fmt.Errorf("bearer %s: %w", path, err)
+		}
+		if connected {
+			return ip, nil
+		}
+	}
+	return nil, fmt.Errorf("modem %s has no connected bearer", modem.Path)
+}
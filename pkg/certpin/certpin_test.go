@@ -0,0 +1,44 @@
+package certpin
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSConfig(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	defer srv.Close()
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	fingerprint, err := Fingerprint(append([]byte("garbage\n"), certPEM...))
+	require.NoError(t, err)
+	require.Len(t, fingerprint, 64)
+
+	for _, c := range []struct {
+		name        string
+		fingerprint string
+		valid       bool
+	}{
+		{"matching fingerprint", fingerprint, true},
+		{"other fingerprint", fingerprint[1:] + "0", false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: TLSConfig(c.fingerprint)}}
+			resp, err := client.Get(srv.URL)
+			if c.valid {
+				require.NoError(t, err)
+				resp.Body.Close()
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestFingerprintNoCert(t *testing.T) {
+	_, err := Fingerprint([]byte("no cert"))
+	require.Error(t, err)
+}
@@ -18,6 +18,7 @@ type ConnectConfig struct {
 	apiserver.ServerOptions
 	HTTPAddress     string
 	AdvertiseIfaces cli.StringSlice
+	DiscoveryPeers  cli.StringSlice
 	KubeletArgs     cli.StringSlice
 	LogLevel        string
 }
@@ -62,6 +63,24 @@ var ConnectFlags = []cli.Flag{
 		EnvVars: []string{"KUBEMATE_ADVERTISE_IFACE"},
 		Value:   &Connect.AdvertiseIfaces,
 	},
+	&cli.StringSliceFlag{
+		Name:    "discovery-peer",
+		Usage:   "(agent/runtime) Address(es) of devices to discover via HTTPS, e.g. when mdns does not work",
+		EnvVars: []string{"KUBEMATE_DISCOVERY_PEER"},
+		Value:   &Connect.DiscoveryPeers,
+	},
+	&cli.StringFlag{
+		Name:        "discovery-domain",
+		Usage:       "(agent/runtime) DNS domain to discover devices within via unicast DNS-SD",
+		EnvVars:     []string{"KUBEMATE_DISCOVERY_DOMAIN"},
+		Destination: &Connect.DiscoveryDomain,
+	},
+	&cli.BoolFlag{
+		Name:        "discovery-gossip",
+		Usage:       "(agent/runtime) discover the cluster members that discovered servers know",
+		EnvVars:     []string{"KUBEMATE_DISCOVERY_GOSSIP"},
+		Destination: &Connect.DiscoveryGossip,
+	},
 	&cli.StringFlag{
 		Name:        "web-dir",
 		Usage:       "(agent/runtime) directory that holds the static web application",
@@ -101,6 +120,12 @@ var ConnectFlags = []cli.Flag{
 		EnvVars:     []string{"KUBEMATE_WRITE_HOST_RESOLVCONF"},
 		Destination: &Connect.WriteHostResolvConf,
 	},
+	&cli.StringFlag{
+		Name:        "mmcli",
+		Usage:       "(agent/runtime) ModemManager CLI (mmcli) stand-in to control cellular modems with for testing instead of ModemManager's D-Bus API",
+		EnvVars:     []string{"KUBEMATE_MMCLI"},
+		Destination: &Connect.ModemManagerCLI,
+	},
 	&cli.StringFlag{
 		Name:        "shutdown-file",
 		Usage:       "(agent/runtime) write a file when a shutdown is initiated via the API",
@@ -144,6 +169,7 @@ func run(ctx context.Context) error {
 		return nil
 	}
 	Connect.ServerOptions.AdvertiseIfaces = Connect.AdvertiseIfaces.Value()
+	Connect.ServerOptions.DiscoveryPeers = Connect.DiscoveryPeers.Value()
 	Connect.ServerOptions.KubeletArgs = Connect.KubeletArgs.Value()
 	genericServer, err := apiserver.NewServer(Connect.ServerOptions)
 	if err != nil {
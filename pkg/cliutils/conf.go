@@ -25,3 +25,27 @@ func WriteTempConfigFile(name, confTpl string, args ...string) (string, bool, er
 	}
 	return file, false, nil
 }
+
+// WriteConfigFile writes the given content into the given file unless it already contains it.
+// It returns true when the file has been changed.
+func WriteConfigFile(file, content string) (bool, error) {
+	b, err := os.ReadFile(file)
+	if err == nil && string(b) == content {
+		return false, nil
+	}
+	err = os.MkdirAll(filepath.Dir(file), 0700)
+	if err != nil {
+		return false, err
+	}
+	tmpFile := file + ".tmp"
+	err = os.WriteFile(tmpFile, []byte(content), 0600)
+	if err != nil {
+		return false, fmt.Errorf("write %s: %w", filepath.Base(file), err)
+	}
+	err = os.Rename(tmpFile, file)
+	if err != nil {
+		_ = os.Remove(tmpFile)
+		return false, fmt.Errorf("write %s: %w", filepath.Base(file), err)
+	}
+	return true, nil
+}
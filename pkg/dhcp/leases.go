@@ -0,0 +1,201 @@
+package dhcp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/storage"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// LeaseSync maintains a DHCPLease resource for every lease within the dnsmasq lease file.
+type LeaseSync struct {
+	LeaseFile string
+	Store     storage.Interface
+	Logger    *logrus.Entry
+	mutex     sync.Mutex
+	cancel    context.CancelFunc
+}
+
+// Start starts watching the lease file asynchronously.
+func (s *LeaseSync) Start() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.cancel != nil {
+		return nil // already started
+	}
+	dir := filepath.Dir(s.LeaseFile)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return fmt.Errorf("create dhcp lease dir: %w", err)
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("watch dhcp leases: %w", err)
+	}
+	// Watch the directory since dnsmasq may replace the file.
+	err = watcher.Add(dir)
+	if err != nil {
+		_ = watcher.Close()
+		return fmt.Errorf("watch dhcp leases: %w", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.sync()
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case evt, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(evt.Name) == filepath.Clean(s.LeaseFile) {
+					s.sync()
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				s.Logger.WithError(err).Warn("dhcp lease file watch error")
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops watching the lease file.
+func (s *LeaseSync) Stop() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+	return nil
+}
+
+func (s *LeaseSync) sync() {
+	err := syncLeases(s.LeaseFile, s.Store)
+	if err != nil {
+		s.Logger.WithError(err).Error("failed to sync dhcp leases")
+	}
+}
+
+func syncLeases(file string, store storage.Interface) error {
+	leases := map[string]deviceapi.DHCPLeaseSpec{}
+	f, err := os.Open(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		defer f.Close()
+		leases, err = ParseLeases(f)
+		if err != nil {
+			return fmt.Errorf("parse %s: %w", file, err)
+		}
+	}
+	l := &deviceapi.DHCPLeaseList{}
+	err = store.List(l)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]deviceapi.DHCPLeaseSpec, len(l.Items))
+	for _, lease := range l.Items {
+		if _, ok := leases[lease.Name]; !ok {
+			err = store.Delete(lease.Name, &lease, func() error { return nil })
+			if err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+			continue
+		}
+		existing[lease.Name] = lease.Spec
+	}
+	for name, spec := range leases {
+		lease := &deviceapi.DHCPLease{}
+		current, ok := existing[name]
+		if !ok {
+			lease.Name = name
+			lease.Spec = spec
+			err = store.Create(name, lease)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if equality.Semantic.DeepEqual(current, spec) {
+			continue
+		}
+		err = store.Update(name, lease, func() error {
+			lease.Spec = spec
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseLeases parses the IPv4 leases of a dnsmasq lease file and maps them by resource name.
+// Each line is formatted as "<expiry> <mac> <ip> <hostname> <client-id>" with an expiry of 0 denoting an infinite lease.
+// IPv6 leases are skipped.
+func ParseLeases(r io.Reader) (map[string]deviceapi.DHCPLeaseSpec, error) {
+	leases := map[string]deviceapi.DHCPLeaseSpec{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[0] == "duid" {
+			continue
+		}
+		mac, err := net.ParseMAC(fields[1])
+		if err != nil {
+			continue // IPv6 lease specifying an IAID
+		}
+		ip := net.ParseIP(fields[2])
+		if ip == nil || ip.To4() == nil {
+			continue
+		}
+		expiry, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lease expiry %q", fields[0])
+		}
+		spec := deviceapi.DHCPLeaseSpec{
+			MACAddress: mac.String(),
+			IPAddress:  ip.String(),
+		}
+		if expiry > 0 {
+			spec.ExpiryTime = &metav1.Time{Time: time.Unix(expiry, 0)}
+		}
+		if fields[3] != "*" {
+			spec.Hostname = fields[3]
+		}
+		if len(fields) > 4 && fields[4] != "*" {
+			spec.ClientID = fields[4]
+		}
+		leases[LeaseName(mac)] = spec
+	}
+	return leases, scanner.Err()
+}
+
+// LeaseName derives the DHCPLease resource name from the client's MAC address.
+func LeaseName(mac net.HardwareAddr) string {
+	return strings.ReplaceAll(mac.String(), ":", "-")
+}
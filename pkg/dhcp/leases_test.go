@@ -0,0 +1,64 @@
+package dhcp
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/storage"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestParseLeases(t *testing.T) {
+	leases, err := ParseLeases(strings.NewReader(`1697712345 aa:bb:cc:dd:ee:01 11.0.0.23 esp32 01:aa:bb:cc:dd:ee:01
+0 AA:BB:CC:DD:EE:02 11.0.0.24 * *
+duid 00:01:00:01:2c:1f:1a:2b:aa:bb:cc:dd:ee:ff
+1697712345 1234567 fd00::23 laptop 00:01:00:01
+`))
+	require.NoError(t, err)
+	require.Equal(t, map[string]deviceapi.DHCPLeaseSpec{
+		"aa-bb-cc-dd-ee-01": {
+			MACAddress: "aa:bb:cc:dd:ee:01",
+			IPAddress:  "11.0.0.23",
+			Hostname:   "esp32",
+			ClientID:   "01:aa:bb:cc:dd:ee:01",
+			ExpiryTime: &metav1.Time{Time: time.Unix(1697712345, 0)},
+		},
+		"aa-bb-cc-dd-ee-02": {
+			MACAddress: "aa:bb:cc:dd:ee:02",
+			IPAddress:  "11.0.0.24",
+		},
+	}, leases)
+
+	_, err = ParseLeases(strings.NewReader("never aa:bb:cc:dd:ee:01 11.0.0.23 esp32 *\n"))
+	require.Error(t, err, "invalid expiry")
+}
+
+func TestSyncLeases(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, deviceapi.AddToScheme(scheme))
+	store := storage.InMemory(scheme)
+	file := filepath.Join(t.TempDir(), "dnsmasq.leases")
+
+	require.NoError(t, syncLeases(file, store), "missing lease file")
+
+	require.NoError(t, os.WriteFile(file, []byte("0 aa:bb:cc:dd:ee:01 11.0.0.23 esp32 *\n0 aa:bb:cc:dd:ee:02 11.0.0.24 * *\n"), 0644))
+	require.NoError(t, syncLeases(file, store))
+	l := &deviceapi.DHCPLeaseList{}
+	require.NoError(t, store.List(l))
+	require.Len(t, l.Items, 2)
+
+	require.NoError(t, os.WriteFile(file, []byte("0 aa:bb:cc:dd:ee:02 11.0.0.30 tv *\n"), 0644))
+	require.NoError(t, syncLeases(file, store))
+	l = &deviceapi.DHCPLeaseList{}
+	require.NoError(t, store.List(l))
+	require.Len(t, l.Items, 1)
+	require.Equal(t, "aa-bb-cc-dd-ee-02", l.Items[0].Name)
+	require.Equal(t, "11.0.0.30", l.Items[0].Spec.IPAddress)
+	require.Equal(t, "tv", l.Items[0].Spec.Hostname)
+}
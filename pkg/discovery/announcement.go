@@ -0,0 +1,219 @@
+package discovery
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/certpin"
+)
+
+const (
+	mdnsFieldCertFingerprint = "kubemate.mgoltzsche.github.com/cert-sha256"
+	mdnsFieldSignaturePrefix = "kubemate.mgoltzsche.github.com/sig."
+	// signatureChunkSize keeps each TXT record string below the 255 bytes limit.
+	signatureChunkSize  = 200
+	verificationTimeout = 5 * time.Second
+)
+
+// signAnnouncement signs the announced host, port and fields with the device's API certificate key.
+// It returns the fields to announce including the certificate fingerprint and the chunked signature.
+func signAnnouncement(host string, port int, fields map[string]string, cert *tls.Certificate) (map[string]string, error) {
+	if len(cert.Certificate) == 0 {
+		return nil, fmt.Errorf("sign announcement: no certificate provided")
+	}
+	signer, ok := cert.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("sign announcement: unsupported private key type %T", cert.PrivateKey)
+	}
+	signed := make(map[string]string, len(fields)+3)
+	for k, v := range fields {
+		if !strings.HasPrefix(k, mdnsFieldSignaturePrefix) {
+			signed[k] = v
+		}
+	}
+	signed[mdnsFieldCertFingerprint] = certpin.FingerprintDER(cert.Certificate[0])
+	payload := announcementPayload(host, port, signed)
+	var sig []byte
+	var err error
+	if _, ok := signer.Public().(ed25519.PublicKey); ok {
+		sig, err = signer.Sign(rand.Reader, payload, crypto.Hash(0))
+	} else {
+		digest := sha256.Sum256(payload)
+		sig, err = signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sign announcement: %w", err)
+	}
+	encoded := base64.RawStdEncoding.EncodeToString(sig)
+	chunks := make([]string, 0, len(encoded)/signatureChunkSize+1)
+	for len(encoded) > 0 {
+		n := signatureChunkSize
+		if n > len(encoded) {
+			n = len(encoded)
+		}
+		chunks = append(chunks, encoded[:n])
+		encoded = encoded[n:]
+	}
+	setIndexedFields(signed, mdnsFieldSignaturePrefix, chunks)
+	return signed, nil
+}
+
+// verifyAnnouncement verifies the announcement's signature using the given certificate.
+// The certificate must match the announced fingerprint.
+func verifyAnnouncement(host string, port int, fields map[string]string, cert *x509.Certificate) error {
+	announced := fields[mdnsFieldCertFingerprint]
+	if announced == "" {
+		return fmt.Errorf("announcement does not specify a certificate fingerprint")
+	}
+	if fp := certpin.FingerprintDER(cert.Raw); fp != strings.ToLower(announced) {
+		return fmt.Errorf("device presented certificate %s but announced %s", fp, announced)
+	}
+	encoded := strings.Join(indexedFields(fields, mdnsFieldSignaturePrefix), "")
+	if encoded == "" {
+		return fmt.Errorf("announcement is not signed")
+	}
+	sig, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("decode announcement signature: %w", err)
+	}
+	payload := announcementPayload(host, port, fields)
+	digest := sha256.Sum256(payload)
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest[:], sig) {
+			err = fmt.Errorf("ecdsa verification failed")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, payload, sig) {
+			err = fmt.Errorf("ed25519 verification failed")
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", cert.PublicKey)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid announcement signature: %w", err)
+	}
+	return nil
+}
+
+// announcementPayload returns the canonical representation of an announcement, excluding its signature.
+func announcementPayload(host string, port int, fields map[string]string) []byte {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		if !strings.HasPrefix(k, mdnsFieldSignaturePrefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(strings.TrimSuffix(host, "."))
+	b.WriteString("\n")
+	b.WriteString(strconv.Itoa(port))
+	b.WriteString("\n")
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteString("=")
+		b.WriteString(fields[k])
+		b.WriteString("\n")
+	}
+	return []byte(b.String())
+}
+
+// fetchPeerCertificate connects to the device's TLS endpoint and returns the certificate it presents.
+// The certificate is not verified against a CA since devices use self-signed certificates.
+func fetchPeerCertificate(ctx context.Context, addr, serverName string) (*x509.Certificate, error) {
+	ctx, cancel := context.WithTimeout(ctx, verificationTimeout)
+	defer cancel()
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{},
+		Config: &tls.Config{
+			ServerName: serverName,
+			// The certificate is verified against the announced fingerprint instead.
+			InsecureSkipVerify: true,
+		},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("connect to device: %w", err)
+	}
+	defer conn.Close()
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("device did not present a certificate")
+	}
+	return certs[0], nil
+}
+
+// announcementFields returns the TXT record fields announcing the given device.
+func announcementFields(spec *deviceapi.DeviceDiscoverySpec) map[string]string {
+	fields := map[string]string{
+		"kubemate":          "",
+		mdnsFieldDeviceMode: string(spec.Mode),
+	}
+	for k, v := range map[string]string{
+		mdnsFieldServer:     spec.Server,
+		mdnsFieldState:      string(spec.State),
+		mdnsFieldVersion:    spec.Version,
+		mdnsFieldK3sVersion: spec.K3sVersion,
+		mdnsFieldClusterID:  spec.ClusterID,
+		mdnsFieldArch:       spec.Arch,
+	} {
+		if v != "" {
+			fields[k] = v
+		}
+	}
+	setIndexedFields(fields, mdnsFieldIPPrefix, spec.IPs)
+	return fields
+}
+
+// parseAnnouncementFields returns the device information announced with the given TXT record fields.
+func parseAnnouncementFields(fields map[string]string) deviceapi.DeviceDiscoverySpec {
+	return deviceapi.DeviceDiscoverySpec{
+		Mode:            deviceapi.DeviceMode(fields[mdnsFieldDeviceMode]),
+		Server:          fields[mdnsFieldServer],
+		State:           deviceapi.DeviceState(fields[mdnsFieldState]),
+		Version:         fields[mdnsFieldVersion],
+		K3sVersion:      fields[mdnsFieldK3sVersion],
+		ClusterID:       fields[mdnsFieldClusterID],
+		Arch:            fields[mdnsFieldArch],
+		IPs:             indexedFields(fields, mdnsFieldIPPrefix),
+		CertFingerprint: fields[mdnsFieldCertFingerprint],
+	}
+}
+
+// setIndexedFields stores a list of values as fields named with the given prefix and the value's index
+// since each TXT record string is limited to 255 bytes.
+func setIndexedFields(fields map[string]string, prefix string, values []string) {
+	for i, v := range values {
+		fields[fmt.Sprintf("%s%d", prefix, i)] = v
+	}
+}
+
+// indexedFields returns the list of values stored by setIndexedFields.
+func indexedFields(fields map[string]string, prefix string) []string {
+	var values []string
+	for i := 0; ; i++ {
+		v, ok := fields[fmt.Sprintf("%s%d", prefix, i)]
+		if !ok {
+			return values
+		}
+		values = append(values, v)
+	}
+}
@@ -0,0 +1,81 @@
+package discovery
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnouncementSignature(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	defer srv.Close()
+	cert := &srv.TLS.Certificates[0]
+	fields := map[string]string{
+		"kubemate":          "",
+		mdnsFieldDeviceMode: "server",
+	}
+	signed, err := signAnnouncement("device-a.", 8443, fields, cert)
+	require.NoError(t, err)
+	require.NotEmpty(t, signed[mdnsFieldCertFingerprint])
+	for k, v := range signed {
+		require.LessOrEqual(t, len(k)+len(v)+1, 255, "TXT record string length")
+	}
+	peerCert, err := fetchPeerCertificate(context.Background(), srv.Listener.Addr().String(), "device-a")
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		name   string
+		host   string
+		port   int
+		modify func(map[string]string)
+		valid  bool
+	}{
+		{"valid", "device-a.", 8443, func(map[string]string) {}, true},
+		{"host without trailing dot", "device-a", 8443, func(map[string]string) {}, true},
+		{"other host", "device-b.", 8443, func(map[string]string) {}, false},
+		{"other port", "device-a.", 443, func(map[string]string) {}, false},
+		{"modified field", "device-a.", 8443, func(f map[string]string) { f[mdnsFieldDeviceMode] = "agent" }, false},
+		{"added field", "device-a.", 8443, func(f map[string]string) { f[mdnsFieldServer] = "https://evil" }, false},
+		{"other fingerprint", "device-a.", 8443, func(f map[string]string) { f[mdnsFieldCertFingerprint] = "00" }, false},
+		{"unsigned", "device-a.", 8443, func(f map[string]string) { delete(f, mdnsFieldSignaturePrefix+"0") }, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			announced := maps.Clone(signed)
+			c.modify(announced)
+			err := verifyAnnouncement(c.host, c.port, announced, peerCert)
+			if c.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestAnnouncementFields(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		spec deviceapi.DeviceDiscoverySpec
+	}{
+		{"minimal", deviceapi.DeviceDiscoverySpec{Mode: deviceapi.DeviceModeServer}},
+		{"full", deviceapi.DeviceDiscoverySpec{
+			Mode:       deviceapi.DeviceModeAgent,
+			Server:     "https://server-a",
+			State:      deviceapi.DeviceStateRunning,
+			Version:    "v0.8.0",
+			K3sVersion: "v1.33.3+k3s1",
+			ClusterID:  "0123456789abcdef",
+			Arch:       "arm64",
+			IPs:        []string{"192.168.1.2", "fd00::2", "2001:db8::2"},
+		}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.spec, parseAnnouncementFields(announcementFields(&c.spec)))
+		})
+	}
+}
@@ -1,100 +1,159 @@
 package discovery
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"net"
-	"strings"
+	"slices"
+	"strconv"
 	"sync"
 	"time"
 
-	"github.com/hashicorp/mdns"
+	"github.com/brutella/dnssd"
 	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/certpin"
 	"github.com/mgoltzsche/kubemate/pkg/storage"
 	"github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/api/equality"
-	"k8s.io/apimachinery/pkg/api/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
 	mdnsZone            = "_kubemate._tcp"
+	mdnsDomain          = "local"
 	mdnsDiscoveryLabel  = "kubemate.mgoltzsche.github.com/mdns-discovery"
 	mdnsFieldDeviceMode = "kubemate.mgoltzsche.github.com/device-mode"
 	mdnsFieldServer     = "kubemate.mgoltzsche.github.com/server"
 	mdnsFieldState      = "kubemate.mgoltzsche.github.com/state"
+	mdnsFieldVersion    = "kubemate.mgoltzsche.github.com/version"
+	mdnsFieldK3sVersion = "kubemate.mgoltzsche.github.com/k3s-version"
+	mdnsFieldClusterID  = "kubemate.mgoltzsche.github.com/cluster-id"
+	mdnsFieldArch       = "kubemate.mgoltzsche.github.com/arch"
+	mdnsFieldIPPrefix   = "kubemate.mgoltzsche.github.com/ip."
+	// verificationRetryInterval specifies when a device that failed verification is verified again.
+	verificationRetryInterval = time.Minute
+	// lastSeenRefreshInterval limits how often a device's lastSeen status is updated.
+	lastSeenRefreshInterval = time.Minute
+	// browseSessionDuration specifies how long a browse session lasts before its records are queried again.
+	// It must be shorter than the records' TTL.
+	browseSessionDuration = 2 * time.Minute
+	// browseRetryInterval specifies how long to wait before browsing again after browsing failed.
+	browseRetryInterval = 10 * time.Second
+	// offlineDeviceTTL specifies how long an offline device remains listed.
+	offlineDeviceTTL = 24 * time.Hour
 )
 
+// recordTTL is the time after which a device is considered offline when it was not seen anymore.
+var recordTTL = time.Duration(dnssd.TTLDefault) * time.Second
+
+// DeviceDiscovery advertises this device and continuously browses for other devices via mdns.
 type DeviceDiscovery struct {
 	deviceName      string
 	port            int
 	advertiseIfaces []string
-	srv             *mdns.Server
+	cert            *tls.Certificate
+	peers           PeerOptions
 	store           storage.Interface
 	logger          *logrus.Entry
+	verifications   map[string]verification
+	// clusterNodes maps the names of the cluster's nodes to the fingerprint of their API certificate.
+	clusterNodes  map[string]string
+	responder     dnssd.Responder
+	service       dnssd.ServiceHandle
+	cancelRespond context.CancelFunc
+	cancelBrowse  context.CancelFunc
+	wg            sync.WaitGroup
+	mutex         sync.Mutex
+}
+
+// verification caches the result of verifying a device's announcement.
+type verification struct {
+	announcement [sha256.Size]byte
+	err          error
+	time         time.Time
 }
 
-func NewDeviceDiscovery(deviceName string, port int, advertiseIfaces []string, store storage.Interface, logger *logrus.Entry) *DeviceDiscovery {
-	d := &DeviceDiscovery{
+// NewDeviceDiscovery creates a device discovery that signs its announcements with the given API certificate key.
+// Additionally to mdns, it probes the peers configured with the given options.
+func NewDeviceDiscovery(deviceName string, port int, advertiseIfaces []string, cert *tls.Certificate, peers PeerOptions, store storage.Interface, logger *logrus.Entry) *DeviceDiscovery {
+	return &DeviceDiscovery{
 		deviceName:      deviceName,
 		port:            port,
 		advertiseIfaces: advertiseIfaces,
+		cert:            cert,
+		peers:           peers,
+		store:           store,
 		logger:          logger.WithField("comp", "device-discovery"),
+		verifications:   map[string]verification{},
 	}
-	d.store = storage.RefreshPeriodically(store, 10*time.Second, func(store storage.Interface) {
-		err := d.Discover()
-		if err != nil {
-			d.logger.Error("failed to discover devices via mdns")
-		}
-	})
-	return d
 }
 
 func (d *DeviceDiscovery) Store() storage.Interface {
 	return d.store
 }
 
-func (d *DeviceDiscovery) Advertise(device *deviceapi.DeviceDiscovery, ip net.IP) error {
+// Advertise announces this device via mdns.
+// When the announcement changed, the responder announces the updated TXT record.
+func (d *DeviceDiscovery) Advertise(device *deviceapi.DeviceDiscovery) error {
 	if device.Name != d.deviceName {
 		return fmt.Errorf("refusing to advertise a different device than this one via mdns")
 	}
-	info := []string{
-		"kubemate",
-		fmt.Sprintf("%s=%s", mdnsFieldDeviceMode, device.Spec.Mode),
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	spec := device.Spec
+	spec.CertFingerprint = certpin.FingerprintDER(d.cert.Certificate[0])
+	existing := &deviceapi.DeviceDiscovery{}
+	if d.service != nil && d.store.Get(d.deviceName, existing) == nil && equality.Semantic.DeepEqual(&existing.Spec, &spec) {
+		return nil // already advertised
 	}
-	if device.Spec.Server != "" {
-		info = append(info, fmt.Sprintf("%s=%s", mdnsFieldServer, device.Spec.Server))
+	svc, err := dnssd.NewService(dnssd.Config{
+		Name:   d.deviceName,
+		Type:   mdnsZone,
+		Domain: mdnsDomain,
+		Host:   d.deviceName,
+		Port:   d.port,
+		Ifaces: d.advertiseIfaces,
+	})
+	if err != nil {
+		return fmt.Errorf("advertise mdns name: %w", err)
+	}
+	fields, err := signAnnouncement(svc.Host, d.port, announcementFields(&spec), d.cert)
+	if err != nil {
+		return fmt.Errorf("advertise mdns name: %w", err)
 	}
 	logrus.
-		WithField("ip", ip.String()).
+		WithField("ips", spec.IPs).
 		WithField("device", d.deviceName).
 		Info("advertise device via mdns")
-	hostname := fmt.Sprintf("%s.", d.deviceName)
-	ips := []net.IP{ip}
-	svc, err := mdns.NewMDNSService(d.deviceName, mdnsZone, "", hostname, d.port, ips, info)
-	if err != nil {
-		return fmt.Errorf("advertise mdns name: %s", err)
-	}
-	// Terminate previous mdns server if exists
-	if d.srv != nil {
-		err = d.srv.Shutdown()
+	if d.service != nil {
+		d.service.UpdateText(fields, d.responder)
+	} else {
+		err = d.startResponder(svc, fields)
 		if err != nil {
-			return fmt.Errorf("advertise mdns name: %s", err)
+			return fmt.Errorf("advertise mdns name: %w", err)
 		}
 	}
-	// (re)start mdns server with new service
-	srv, err := mdns.NewServer(&mdns.Config{Zone: svc})
-	if err != nil {
-		return fmt.Errorf("advertise mdns name: %s", err)
+	status := deviceapi.DeviceDiscoveryStatus{
+		Verified:      true,
+		ClusterMember: true,
+		LastSeen:      &metav1.Time{Time: time.Now()},
 	}
-	d.srv = srv
 	dev := &deviceapi.DeviceDiscovery{}
 	dev.Name = d.deviceName
 	err = d.store.Update(d.deviceName, dev, func() error {
-		dev.Spec = device.Spec
+		dev.Spec = spec
+		dev.Status = status
 		return nil
 	})
 	if err != nil {
-		dev.Spec = device.Spec
+		dev.Spec = spec
+		dev.Status = status
 		e := d.store.Create(d.deviceName, dev)
 		if e != nil {
 			return fmt.Errorf("advertise mdns name: %s. %s", err, e)
@@ -104,9 +163,88 @@ func (d *DeviceDiscovery) Advertise(device *deviceapi.DeviceDiscovery, ip net.IP
 	return nil
 }
 
-func (d *DeviceDiscovery) Discover() error {
-	d.logger.Debug("scanning for devices via mdns")
-	return populateDevicesFromMDNS(d.deviceName, d.store, d.logger)
+func (d *DeviceDiscovery) startResponder(svc dnssd.Service, fields map[string]string) error {
+	svc.Text = fields
+	responder, err := dnssd.NewResponder()
+	if err != nil {
+		return fmt.Errorf("new mdns responder: %w", err)
+	}
+	handle, err := responder.Add(svc)
+	if err != nil {
+		return fmt.Errorf("add mdns service to responder: %w", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	d.responder = responder
+	d.service = handle
+	d.cancelRespond = cancel
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		// Sends a goodbye packet when the context is cancelled.
+		err := responder.Respond(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			d.logger.WithError(err).Error("mdns responder terminated")
+			d.mutex.Lock()
+			if d.responder == responder {
+				// Advertise the device again during the next reconciliation.
+				d.responder = nil
+				d.service = nil
+			}
+			d.mutex.Unlock()
+		}
+	}()
+	return nil
+}
+
+// Start browses for other devices and probes the configured peers until Close is called.
+func (d *DeviceDiscovery) Start() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.cancelBrowse != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancelBrowse = cancel
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.browse(ctx)
+	}()
+	if d.peers.enabled() {
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			d.discoverPeers(ctx)
+		}()
+	}
+}
+
+func (d *DeviceDiscovery) browse(ctx context.Context) {
+	serviceType := fmt.Sprintf("%s.%s.", mdnsZone, mdnsDomain)
+	for {
+		// LookupType queries the records once and keeps them within a cache for the duration of the session,
+		// reporting goodbye packets and expired records.
+		// Starting a new session periodically refreshes the records before they expire.
+		d.logger.Debug("browsing for devices via mdns")
+		sessionCtx, cancel := context.WithTimeout(ctx, browseSessionDuration)
+		err := dnssd.LookupType(sessionCtx, serviceType, d.addDevice, d.removeDevice)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			d.logger.WithError(err).Error("failed to browse for devices via mdns")
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(browseRetryInterval):
+			}
+		}
+		err = d.expireDevices()
+		if err != nil {
+			d.logger.WithError(err).Error("failed to expire devices")
+		}
+	}
 }
 
 // TODO: remove this in favour of the NetworkInterface resource, each exposing an IP within its status.
@@ -173,107 +311,303 @@ func toBroadcastIP(ip *net.IPNet) net.IP {
 	return brd
 }
 
+// Close stops browsing and unannounces this device.
 func (d *DeviceDiscovery) Close() error {
-	if s := d.srv; s != nil {
-		err := s.Shutdown()
-		d.srv = nil
+	d.mutex.Lock()
+	if d.cancelBrowse != nil {
+		d.cancelBrowse()
+		d.cancelBrowse = nil
+	}
+	if d.cancelRespond != nil {
+		d.cancelRespond()
+		d.cancelRespond = nil
+		d.responder = nil
+		d.service = nil
+	}
+	d.mutex.Unlock()
+	d.wg.Wait()
+	return nil
+}
+
+// addDevice registers a device that was announced via mdns.
+func (d *DeviceDiscovery) addDevice(entry dnssd.BrowseEntry) {
+	name := entry.Host
+	if name == d.deviceName {
+		return
+	}
+	spec := parseAnnouncementFields(entry.Text)
+	spec.Address = fmt.Sprintf("https://%s", name)
+	if entry.Port != 443 {
+		spec.Address = fmt.Sprintf("%s:%d", spec.Address, entry.Port)
+	}
+	verifyErr := d.verifyDevice(name, &entry)
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.registerDevice(name, spec, verifyErr, deviceapi.DeviceDiscoverySourceMDNS)
+}
+
+// SetClusterNodes sets the names of the cluster's nodes along with the fingerprint of their API certificate
+// and updates the cluster membership of the discovered devices accordingly.
+func (d *DeviceDiscovery) SetClusterNodes(nodes map[string]string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.clusterNodes = nodes
+	l := &deviceapi.DeviceDiscoveryList{}
+	err := d.store.List(l)
+	if err != nil {
 		return err
 	}
+	for _, dev := range l.Items {
+		member := dev.Status.Verified && d.isClusterMember(dev.Name, dev.Spec.CertFingerprint)
+		if dev.Spec.Current || dev.Status.ClusterMember == member {
+			continue
+		}
+		err = d.store.Update(dev.Name, &dev, func() error {
+			dev.Status.ClusterMember = member
+			return nil
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
 	return nil
 }
 
-func populateDevicesFromMDNS(deviceName string, devices storage.Interface, logger *logrus.Entry) error {
-	foundDevices := map[string]struct{}{
-		deviceName: struct{}{},
+// isClusterMember returns true if the cluster has a node with the given name that published the given API certificate fingerprint.
+// Unlike the cluster ID a device announces, the node cannot be spoofed by a device outside the cluster.
+// The caller must hold the mutex.
+func (d *DeviceDiscovery) isClusterMember(name, fingerprint string) bool {
+	nodeFingerprint, ok := d.clusterNodes[name]
+	return ok && fingerprint != "" && nodeFingerprint == fingerprint
+}
+
+// registerDevice creates or updates the DeviceDiscovery resource for a device found by the given source.
+// The caller must hold the mutex.
+func (d *DeviceDiscovery) registerDevice(name string, spec deviceapi.DeviceDiscoverySpec, verifyErr error, source deviceapi.DeviceDiscoverySource) {
+	spec.Current = false
+	dev := &deviceapi.DeviceDiscovery{}
+	dev.Name = name
+	modify := func() {
+		dev.Labels = map[string]string{mdnsDiscoveryLabel: "true"}
+		lastSeen := dev.Status.LastSeen
+		if lastSeen == nil || time.Since(lastSeen.Time) > lastSeenRefreshInterval {
+			lastSeen = &metav1.Time{Time: time.Now()}
+		}
+		sources := dev.Status.Sources
+		if !slices.Contains(sources, source) {
+			sources = append(slices.Clone(sources), source)
+			slices.Sort(sources)
+		}
+		dev.Spec = spec
+		dev.Status = deviceapi.DeviceDiscoveryStatus{
+			Verified:   verifyErr == nil,
+			LastSeen:   lastSeen,
+			Sources:    sources,
+			Conditions: dev.Status.Conditions,
+		}
+		if verifyErr != nil {
+			dev.Status.Message = verifyErr.Error()
+		} else {
+			dev.Status.ClusterMember = d.isClusterMember(name, spec.CertFingerprint)
+		}
+		meta.SetStatusCondition(&dev.Status.Conditions, metav1.Condition{
+			Type:    deviceapi.DeviceDiscoveryConditionOffline,
+			Status:  metav1.ConditionFalse,
+			Reason:  "Seen",
+			Message: fmt.Sprintf("device was found via %s", source),
+		})
 	}
-	wg := &sync.WaitGroup{}
-	wg.Add(1)
-	ch := make(chan *mdns.ServiceEntry, 4)
-	go func() {
-		for entry := range ch {
-			d := &deviceapi.DeviceDiscovery{}
-			d.Name = strings.TrimRight(entry.Host, ".")
-			foundDevices[d.Name] = struct{}{}
-			if d.Name == deviceName {
-				continue
-			}
-			modify := func() {
-				d.Labels = map[string]string{mdnsDiscoveryLabel: "true"}
-				addrs := fmt.Sprintf("https://%s", strings.TrimRight(entry.Host, "."))
-				if entry.Port != 443 {
-					addrs = fmt.Sprintf("%s:%d", addrs, entry.Port)
-				}
-				d.Spec.Address = addrs
-				d.Spec.Mode = deviceapi.DeviceMode(getMDNSEntryField(entry, mdnsFieldDeviceMode))
-				d.Spec.Server = getMDNSEntryField(entry, mdnsFieldServer)
-			}
-			err := devices.Get(d.Name, d)
-			if errors.IsNotFound(err) {
-				modify()
-				err = devices.Create(d.Name, d)
-			} else if err == nil {
-				existingDevice := d.DeepCopy()
-				modify()
-				if equality.Semantic.DeepEqual(&existingDevice.Spec, &d.Spec) {
-					continue
-				}
-				err = devices.Update(d.Name, d, func() error {
-					modify()
-					return nil
-				})
-			}
-			logger.
-				WithField("mode", d.Spec.Mode).
-				WithField("address", d.Spec.Address).
-				WithField("device", entry.Name).
-				Info("discovered new device via mdns")
-			if err != nil && !errors.IsAlreadyExists(err) {
-				logrus.WithError(err).
-					WithField("address", d.Spec.Address).
-					WithField("device", entry.Name).
-					Error("failed to register device")
-				continue
-			}
+	err := d.store.Get(name, dev)
+	if apierrors.IsNotFound(err) {
+		modify()
+		err = d.store.Create(name, dev)
+	} else if err == nil {
+		if dev.Status.Verified && verifyErr != nil && !slices.Contains(dev.Status.Sources, source) {
+			return // don't let an unverified source override verified information
 		}
-		wg.Done()
-	}()
-	p := mdns.DefaultParams(mdnsZone)
-	p.DisableIPv6 = true // fails within docker network otherwise
-	p.Entries = ch
-	err := mdns.Query(p)
-	close(ch)
-	wg.Wait()
+		if source == deviceapi.DeviceDiscoverySourceGossip && dev.Status.Verified && slices.ContainsFunc(dev.Status.Sources, isDirectSource) {
+			// Don't let gossip override the information the device reported itself.
+			spec, verifyErr = dev.Spec, nil
+		}
+		existingDevice := dev.DeepCopy()
+		modify()
+		if equality.Semantic.DeepEqual(&existingDevice.Spec, &dev.Spec) && equality.Semantic.DeepEqual(&existingDevice.Status, &dev.Status) {
+			return
+		}
+		err = d.store.Update(name, dev, func() error {
+			modify()
+			return nil
+		})
+	}
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		d.logger.WithError(err).
+			WithField("address", dev.Spec.Address).
+			WithField("device", name).
+			Error("failed to register device")
+		return
+	}
+	d.logger.
+		WithField("mode", dev.Spec.Mode).
+		WithField("address", dev.Spec.Address).
+		WithField("device", name).
+		WithField("verified", dev.Status.Verified).
+		WithField("source", source).
+		Info("discovered device")
+}
+
+// removeDevice unregisters the mdns source of a device that sent a goodbye packet or whose records expired.
+func (d *DeviceDiscovery) removeDevice(entry dnssd.BrowseEntry) {
+	if entry.Host == d.deviceName {
+		return
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	err := d.removeSource(entry.Host, deviceapi.DeviceDiscoverySourceMDNS, "Unannounced", "device sent a goodbye packet or its mdns records expired")
 	if err != nil {
-		return fmt.Errorf("mdns lookup: %w", err)
+		d.logger.WithError(err).WithField("device", entry.Host).Error("failed to mark device offline")
 	}
+}
 
-	// Remove old devices
+// expireDevices marks devices offline that have not been seen within the records' TTL
+// and removes devices that have been offline for a long time.
+func (d *DeviceDiscovery) expireDevices() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
 	l := &deviceapi.DeviceDiscoveryList{}
-	err = devices.List(l)
+	err := d.store.List(l)
 	if err != nil {
-		return fmt.Errorf("scan for devices: %w", err)
-	}
-	for _, d := range l.Items {
-		if hasLabel(&d, mdnsDiscoveryLabel) {
-			if _, found := foundDevices[d.Name]; !found {
-				logrus.Infof("device %s appears to be offline", d.Name)
-				if e := devices.Delete(d.Name, &d, func() error { return nil }); e != nil && err == nil && !errors.IsNotFound(err) {
-					err = e
-				}
+		return err
+	}
+	for _, dev := range l.Items {
+		if !hasLabel(&dev, mdnsDiscoveryLabel) || dev.Status.LastSeen == nil {
+			continue
+		}
+		unseen := time.Since(dev.Status.LastSeen.Time)
+		if unseen > offlineDeviceTTL {
+			d.logger.WithField("device", dev.Name).Info("removing device that has been offline for a long time")
+			delete(d.verifications, dev.Name)
+			if e := d.store.Delete(dev.Name, &dev, func() error { return nil }); e != nil && !apierrors.IsNotFound(e) {
+				err = e
+			}
+		} else if unseen > recordTTL {
+			if e := d.removeSource(dev.Name, "", "Expired", "device was not seen by any source recently"); e != nil {
+				err = e
 			}
 		}
 	}
 	return err
 }
 
-func getMDNSEntryField(entry *mdns.ServiceEntry, field string) string {
-	prefix := fmt.Sprintf("%s=", field)
-	for _, v := range entry.InfoFields {
-		if strings.HasPrefix(v, prefix) {
-			return v[len(prefix):]
+// removeSource removes the given source from the device or all sources if none is specified.
+// The device is marked offline when no source is left.
+func (d *DeviceDiscovery) removeSource(name string, source deviceapi.DeviceDiscoverySource, reason, message string) error {
+	dev := &deviceapi.DeviceDiscovery{}
+	err := d.store.Get(name, dev)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	sources := slices.DeleteFunc(slices.Clone(dev.Status.Sources), func(s deviceapi.DeviceDiscoverySource) bool {
+		return source == "" || s == source
+	})
+	if len(sources) > 0 {
+		if len(sources) == len(dev.Status.Sources) {
+			return nil
+		}
+		return d.store.Update(name, dev, func() error {
+			dev.Status.Sources = sources
+			return nil
+		})
+	}
+	if meta.IsStatusConditionTrue(dev.Status.Conditions, deviceapi.DeviceDiscoveryConditionOffline) {
+		return nil
+	}
+	d.logger.WithField("device", name).WithField("reason", reason).Info("device appears to be offline")
+	return d.store.Update(name, dev, func() error {
+		dev.Status.Sources = nil
+		dev.Status.ClusterMember = false
+		meta.SetStatusCondition(&dev.Status.Conditions, metav1.Condition{
+			Type:    deviceapi.DeviceDiscoveryConditionOffline,
+			Status:  metav1.ConditionTrue,
+			Reason:  reason,
+			Message: message,
+		})
+		return nil
+	})
+}
+
+// verifyDevice checks that the device's TLS endpoint presents the announced certificate
+// and that the announcement was signed with the certificate's key.
+// Results are cached until the announcement changes.
+func (d *DeviceDiscovery) verifyDevice(name string, entry *dnssd.BrowseEntry) error {
+	announcement := sha256.Sum256(announcementPayload(entry.Host, entry.Port, entry.Text))
+	return d.verifyCached(name, announcement, func() error {
+		err := verifyBrowseEntry(entry)
+		if err != nil {
+			d.logger.WithError(err).WithField("device", name).Warn("failed to verify device announcement")
+		}
+		return err
+	})
+}
+
+// verifyCached returns the cached verification result for the given device and key or runs the given verification.
+// The verification runs without holding the mutex since it connects to the device.
+func (d *DeviceDiscovery) verifyCached(name string, key [sha256.Size]byte, verify func() error) error {
+	d.mutex.Lock()
+	v, ok := d.verifications[name]
+	d.mutex.Unlock()
+	if ok && v.announcement == key {
+		if v.err == nil || time.Since(v.time) < verificationRetryInterval {
+			return v.err
+		}
+	}
+	err := verify()
+	d.mutex.Lock()
+	d.verifications[name] = verification{announcement: key, err: err, time: time.Now()}
+	d.mutex.Unlock()
+	return err
+}
+
+func verifyBrowseEntry(entry *dnssd.BrowseEntry) error {
+	if entry.Text[mdnsFieldCertFingerprint] == "" {
+		return fmt.Errorf("announcement does not specify a certificate fingerprint")
+	}
+	cert, err := fetchPeerCertificate(context.Background(), net.JoinHostPort(browseEntryHost(entry), strconv.Itoa(entry.Port)), entry.Host)
+	if err != nil {
+		return err
+	}
+	return verifyAnnouncement(entry.Host, entry.Port, entry.Text, cert)
+}
+
+// browseEntryHost returns the address to connect to the announced device.
+// IPv4 addresses are preferred over global IPv6 addresses over link-local IPv6 addresses which require the interface as zone.
+func browseEntryHost(entry *dnssd.BrowseEntry) string {
+	host := entry.Host
+	rank := 3
+	for _, ip := range entry.IPs {
+		r, h := 2, ip.String()
+		switch {
+		case ip.To4() != nil:
+			r = 0
+		case ip.IsGlobalUnicast():
+			r = 1
+		case ip.IsLinkLocalUnicast() && entry.IfaceName != "":
+			h = fmt.Sprintf("%s%%%s", ip, entry.IfaceName)
+		default:
+			continue
+		}
+		if r < rank {
+			rank, host = r, h
 		}
 	}
-	return ""
+	return host
+}
+
+// isDirectSource returns true if the device was found by the given source itself instead of via another device.
+func isDirectSource(s deviceapi.DeviceDiscoverySource) bool {
+	return s != deviceapi.DeviceDiscoverySourceGossip
 }
 
 func hasLabel(o *deviceapi.DeviceDiscovery, label string) bool {
@@ -0,0 +1,66 @@
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/brutella/dnssd"
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/storage"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestBrowseEntryHost(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		ips      []string
+		expected string
+	}{
+		{"no ip", nil, "device-a"},
+		{"ipv4", []string{"fe80::1", "2001:db8::2", "192.168.1.2"}, "192.168.1.2"},
+		{"global ipv6", []string{"fe80::1", "2001:db8::2"}, "2001:db8::2"},
+		{"link-local ipv6", []string{"fe80::1"}, "fe80::1%eth0"},
+		{"loopback", []string{"::1"}, "device-a"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			entry := &dnssd.BrowseEntry{Host: "device-a", IfaceName: "eth0"}
+			for _, ip := range c.ips {
+				entry.IPs = append(entry.IPs, net.ParseIP(ip))
+			}
+			require.Equal(t, c.expected, browseEntryHost(entry))
+		})
+	}
+}
+
+func TestClusterMembership(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, deviceapi.AddToScheme(scheme))
+	d := NewDeviceDiscovery("device-a", 8443, nil, nil, PeerOptions{}, storage.InMemory(scheme), logrus.NewEntry(logrus.New()))
+	spec := func(fingerprint string) deviceapi.DeviceDiscoverySpec {
+		return deviceapi.DeviceDiscoverySpec{Mode: deviceapi.DeviceModeAgent, ClusterID: "cluster-a", CertFingerprint: fingerprint}
+	}
+	members := func() map[string]bool {
+		l := &deviceapi.DeviceDiscoveryList{}
+		require.NoError(t, d.store.List(l))
+		m := map[string]bool{}
+		for _, dev := range l.Items {
+			m[dev.Name] = dev.Status.ClusterMember
+		}
+		return m
+	}
+	d.registerDevice("device-b", spec("fp-b"), nil, deviceapi.DeviceDiscoverySourceMDNS)
+	d.registerDevice("device-c", spec("fp-c"), nil, deviceapi.DeviceDiscoverySourceMDNS)
+	d.registerDevice("device-d", spec("fp-d"), fmt.Errorf("unverified"), deviceapi.DeviceDiscoverySourceMDNS)
+	require.Equal(t, map[string]bool{"device-b": false, "device-c": false, "device-d": false}, members(), "should not trust announced cluster id")
+
+	require.NoError(t, d.SetClusterNodes(map[string]string{"device-a": "fp-a", "device-b": "fp-b", "device-c": "other", "device-d": "fp-d"}))
+	require.Equal(t, map[string]bool{"device-b": true, "device-c": false, "device-d": false}, members(), "after nodes were set")
+	d.registerDevice("device-e", spec("fp-e"), nil, deviceapi.DeviceDiscoverySourceMDNS)
+	require.False(t, members()["device-e"], "device without node")
+
+	require.NoError(t, d.SetClusterNodes(map[string]string{"device-e": "fp-e"}))
+	require.Equal(t, map[string]bool{"device-b": false, "device-c": false, "device-d": false, "device-e": true}, members(), "after nodes changed")
+}
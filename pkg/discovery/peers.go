@@ -0,0 +1,303 @@
+package discovery
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/certpin"
+	"github.com/miekg/dns"
+	"k8s.io/apimachinery/pkg/api/meta"
+)
+
+const (
+	// peerProbeInterval specifies how often peers are probed.
+	peerProbeInterval  = time.Minute
+	peerRequestTimeout = 10 * time.Second
+	resolvConfFile     = "/etc/resolv.conf"
+)
+
+// PeerOptions configures discovery sources for networks where mdns does not work,
+// e.g. across docker networks, VLANs or on managed wifi networks.
+type PeerOptions struct {
+	// StaticPeers lists addresses of devices that are probed via HTTPS.
+	StaticPeers []string
+	// Domain is looked up via unicast DNS-SD to find peers.
+	Domain string
+	// Gossip enables adding the cluster members that discovered servers report.
+	Gossip bool
+}
+
+func (o *PeerOptions) enabled() bool {
+	return len(o.StaticPeers) > 0 || o.Domain != "" || o.Gossip
+}
+
+// peer is a device address that should be probed.
+type peer struct {
+	Address string
+	Source  deviceapi.DeviceDiscoverySource
+}
+
+func (d *DeviceDiscovery) discoverPeers(ctx context.Context) {
+	for {
+		d.probePeers(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(peerProbeInterval):
+		}
+	}
+}
+
+func (d *DeviceDiscovery) probePeers(ctx context.Context) {
+	peers := make([]peer, 0, len(d.peers.StaticPeers))
+	for _, addr := range d.peers.StaticPeers {
+		addr, err := normalizePeerAddress(addr)
+		if err != nil {
+			d.logger.WithError(err).Warn("ignoring invalid static peer")
+			continue
+		}
+		peers = append(peers, peer{Address: addr, Source: deviceapi.DeviceDiscoverySourceStatic})
+	}
+	if d.peers.Domain != "" {
+		addrs, err := lookupDNSSD(ctx, "", d.peers.Domain)
+		if err != nil {
+			d.logger.WithError(err).Warn("failed to look up peers via unicast dns-sd")
+		}
+		for _, addr := range addrs {
+			peers = append(peers, peer{Address: addr, Source: deviceapi.DeviceDiscoverySourceDNS})
+		}
+	}
+	probed := make(map[string]struct{}, len(peers))
+	for _, p := range peers {
+		probed[p.Address] = struct{}{}
+		d.probePeer(ctx, p)
+	}
+	if d.peers.Gossip {
+		// Ask servers found by other sources for their cluster members as well.
+		for _, addr := range d.verifiedServerAddresses() {
+			if _, ok := probed[addr]; !ok {
+				d.probePeer(ctx, peer{Address: addr})
+			}
+		}
+	}
+}
+
+// probePeer fetches the devices a peer knows and registers the peer itself.
+// The peer's cluster members are registered as well when gossip is enabled.
+func (d *DeviceDiscovery) probePeer(ctx context.Context, p peer) {
+	devices, fingerprint, err := fetchPeerDevices(ctx, p.Address)
+	if err != nil {
+		d.logger.WithError(err).WithField("address", p.Address).Debug("failed to probe peer")
+		return
+	}
+	var self *deviceapi.DeviceDiscovery
+	for i, dev := range devices.Items {
+		if dev.Spec.Current {
+			self = &devices.Items[i]
+			break
+		}
+	}
+	if self == nil {
+		d.logger.WithField("address", p.Address).Warn("peer did not report itself")
+		return
+	}
+	if self.Name == d.deviceName {
+		return
+	}
+	if p.Source != "" {
+		var verifyErr error
+		if self.Spec.CertFingerprint != fingerprint {
+			verifyErr = fmt.Errorf("peer presented certificate %s but reported %s", fingerprint, self.Spec.CertFingerprint)
+		}
+		spec := self.Spec
+		spec.Address = p.Address
+		d.mutex.Lock()
+		d.registerDevice(self.Name, spec, verifyErr, p.Source)
+		d.mutex.Unlock()
+	}
+	if !d.peers.Gossip || self.Spec.Mode != deviceapi.DeviceModeServer {
+		return
+	}
+	for _, member := range devices.Items {
+		if member.Spec.Current || member.Name == d.deviceName || !member.Status.ClusterMember ||
+			meta.IsStatusConditionTrue(member.Status.Conditions, deviceapi.DeviceDiscoveryConditionOffline) {
+			continue
+		}
+		// The peer's claims are not trusted: the member's certificate is verified and its cluster membership is determined locally.
+		verifyErr := d.verifyAddress(ctx, member.Name, member.Spec.Address, member.Spec.CertFingerprint)
+		d.mutex.Lock()
+		d.registerDevice(member.Name, member.Spec, verifyErr, deviceapi.DeviceDiscoverySourceGossip)
+		d.mutex.Unlock()
+	}
+}
+
+// verifyAddress checks that the device's TLS endpoint presents the certificate with the given fingerprint.
+func (d *DeviceDiscovery) verifyAddress(ctx context.Context, name, address, fingerprint string) error {
+	key := sha256.Sum256([]byte(address + "\n" + fingerprint))
+	return d.verifyCached(name, key, func() error {
+		if fingerprint == "" {
+			return fmt.Errorf("device does not specify a certificate fingerprint")
+		}
+		u, err := url.Parse(address)
+		if err != nil {
+			return fmt.Errorf("invalid device address %q: %w", address, err)
+		}
+		port := u.Port()
+		if port == "" {
+			port = "443"
+		}
+		cert, err := fetchPeerCertificate(ctx, net.JoinHostPort(u.Hostname(), port), u.Hostname())
+		if err != nil {
+			return err
+		}
+		if fp := certpin.FingerprintDER(cert.Raw); fp != fingerprint {
+			return fmt.Errorf("device presented certificate %s but reported %s", fp, fingerprint)
+		}
+		return nil
+	})
+}
+
+func (d *DeviceDiscovery) verifiedServerAddresses() []string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	l := &deviceapi.DeviceDiscoveryList{}
+	err := d.store.List(l)
+	if err != nil {
+		d.logger.WithError(err).Error("failed to list devices")
+		return nil
+	}
+	addrs := make([]string, 0, len(l.Items))
+	for _, dev := range l.Items {
+		if !dev.Spec.Current && dev.Status.Verified && dev.Spec.Mode == deviceapi.DeviceModeServer &&
+			!meta.IsStatusConditionTrue(dev.Status.Conditions, deviceapi.DeviceDiscoveryConditionOffline) {
+			addrs = append(addrs, dev.Spec.Address)
+		}
+	}
+	return addrs
+}
+
+// fetchPeerDevices lists the devices known to the peer and returns them along with the fingerprint of the certificate the peer presented.
+func fetchPeerDevices(ctx context.Context, address string) (*deviceapi.DeviceDiscoveryList, string, error) {
+	gv := deviceapi.GroupVersion
+	u := fmt.Sprintf("%s/apis/%s/%s/devicediscovery", address, gv.Group, gv.Version)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			// The certificate is verified against the fingerprint the peer reports instead.
+			InsecureSkipVerify: true,
+		}},
+		Timeout: peerRequestTimeout,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("fetch peer devices: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("fetch peer devices: server responded with status %s", resp.Status)
+	}
+	if resp.TLS == nil || len(resp.TLS.PeerCertificates) == 0 {
+		return nil, "", fmt.Errorf("fetch peer devices: peer did not present a certificate")
+	}
+	l := &deviceapi.DeviceDiscoveryList{}
+	err = json.NewDecoder(resp.Body).Decode(l)
+	if err != nil {
+		return nil, "", fmt.Errorf("decode peer devices: %w", err)
+	}
+	return l, certpin.FingerprintDER(resp.TLS.PeerCertificates[0].Raw), nil
+}
+
+// lookupDNSSD resolves the addresses of the kubemate service instances registered within the given domain via unicast DNS-SD.
+// When no DNS server is specified, the first one configured within /etc/resolv.conf is used.
+func lookupDNSSD(ctx context.Context, server, domain string) ([]string, error) {
+	if server == "" {
+		conf, err := dns.ClientConfigFromFile(resolvConfFile)
+		if err != nil {
+			return nil, fmt.Errorf("load dns client config: %w", err)
+		}
+		if len(conf.Servers) == 0 {
+			return nil, fmt.Errorf("no dns server configured within %s", resolvConfFile)
+		}
+		server = net.JoinHostPort(conf.Servers[0], conf.Port)
+	}
+	c := &dns.Client{Timeout: peerRequestTimeout}
+	ptrs, err := queryDNS(ctx, c, server, fmt.Sprintf("%s.%s", mdnsZone, dns.Fqdn(domain)), dns.TypePTR)
+	if err != nil {
+		return nil, err
+	}
+	var addrs []string
+	for _, rr := range ptrs {
+		ptr, ok := rr.(*dns.PTR)
+		if !ok {
+			continue
+		}
+		srvs, err := queryDNS(ctx, c, server, ptr.Ptr, dns.TypeSRV)
+		if err != nil {
+			return addrs, err
+		}
+		for _, rr := range srvs {
+			if srv, ok := rr.(*dns.SRV); ok {
+				addrs = append(addrs, peerAddress(strings.TrimSuffix(srv.Target, "."), int(srv.Port)))
+			}
+		}
+	}
+	return addrs, nil
+}
+
+func queryDNS(ctx context.Context, c *dns.Client, server, name string, qtype uint16) ([]dns.RR, error) {
+	m := &dns.Msg{}
+	m.SetQuestion(name, qtype)
+	r, _, err := c.ExchangeContext(ctx, m, server)
+	if err != nil {
+		return nil, fmt.Errorf("dns lookup %s: %w", name, err)
+	}
+	if r.Rcode != dns.RcodeSuccess && r.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("dns lookup %s: %s", name, dns.RcodeToString[r.Rcode])
+	}
+	return r.Answer, nil
+}
+
+// normalizePeerAddress converts a host, host:port or URL into an HTTPS base URL.
+func normalizePeerAddress(addr string) (string, error) {
+	if !strings.Contains(addr, "://") {
+		addr = "https://" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid peer address %q: %w", addr, err)
+	}
+	if u.Scheme != "https" || u.Hostname() == "" {
+		return "", fmt.Errorf("invalid peer address %q: must be an https URL or host", addr)
+	}
+	port := 443
+	if p := u.Port(); p != "" {
+		port, err = strconv.Atoi(p)
+		if err != nil {
+			return "", fmt.Errorf("invalid peer address %q: %w", addr, err)
+		}
+	}
+	return peerAddress(u.Hostname(), port), nil
+}
+
+func peerAddress(host string, port int) string {
+	if strings.Contains(host, ":") {
+		host = fmt.Sprintf("[%s]", host)
+	}
+	if port == 443 {
+		return fmt.Sprintf("https://%s", host)
+	}
+	return fmt.Sprintf("https://%s:%d", host, port)
+}
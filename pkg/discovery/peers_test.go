@@ -0,0 +1,151 @@
+package discovery
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/certpin"
+	"github.com/mgoltzsche/kubemate/pkg/storage"
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestFetchPeerDevices(t *testing.T) {
+	devices := deviceapi.DeviceDiscoveryList{Items: []deviceapi.DeviceDiscovery{
+		{ObjectMeta: metav1.ObjectMeta{Name: "device-a"}, Spec: deviceapi.DeviceDiscoverySpec{Current: true, Mode: deviceapi.DeviceModeServer}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "device-b"}, Spec: deviceapi.DeviceDiscoverySpec{Mode: deviceapi.DeviceModeAgent}},
+	}}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/kubemate.mgoltzsche.github.com/v1alpha1/devicediscovery" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(devices)
+	}))
+	defer srv.Close()
+
+	l, fingerprint, err := fetchPeerDevices(context.Background(), srv.URL)
+	require.NoError(t, err)
+	require.Equal(t, devices.Items, l.Items)
+	require.Equal(t, certpin.FingerprintDER(srv.Certificate().Raw), fingerprint)
+
+	_, _, err = fetchPeerDevices(context.Background(), srv.URL+"/other")
+	require.Error(t, err, "not found")
+}
+
+func TestLookupDNSSD(t *testing.T) {
+	mux := dns.NewServeMux()
+	mux.HandleFunc("example.org.", func(w dns.ResponseWriter, r *dns.Msg) {
+		m := &dns.Msg{}
+		m.SetReply(r)
+		q := r.Question[0]
+		hdr := dns.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: dns.ClassINET, Ttl: 60}
+		switch {
+		case q.Name == "_kubemate._tcp.example.org." && q.Qtype == dns.TypePTR:
+			m.Answer = []dns.RR{
+				&dns.PTR{Hdr: hdr, Ptr: "device-a._kubemate._tcp.example.org."},
+				&dns.PTR{Hdr: hdr, Ptr: "device-b._kubemate._tcp.example.org."},
+			}
+		case q.Name == "device-a._kubemate._tcp.example.org." && q.Qtype == dns.TypeSRV:
+			m.Answer = []dns.RR{&dns.SRV{Hdr: hdr, Target: "device-a.example.org.", Port: 443}}
+		case q.Name == "device-b._kubemate._tcp.example.org." && q.Qtype == dns.TypeSRV:
+			m.Answer = []dns.RR{&dns.SRV{Hdr: hdr, Target: "device-b.example.org.", Port: 8443}}
+		default:
+			m.Rcode = dns.RcodeNameError
+		}
+		_ = w.WriteMsg(m)
+	})
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := &dns.Server{PacketConn: conn, Handler: mux}
+	go func() { _ = srv.ActivateAndServe() }()
+	defer func() { _ = srv.Shutdown() }()
+
+	addrs, err := lookupDNSSD(context.Background(), conn.LocalAddr().String(), "example.org")
+	require.NoError(t, err)
+	require.Equal(t, []string{"https://device-a.example.org", "https://device-b.example.org:8443"}, addrs)
+
+	addrs, err = lookupDNSSD(context.Background(), conn.LocalAddr().String(), "example.org.")
+	require.NoError(t, err)
+	require.Len(t, addrs, 2, "fqdn")
+}
+
+func TestNormalizePeerAddress(t *testing.T) {
+	for _, c := range []struct {
+		input    string
+		expected string
+	}{
+		{"device-a", "https://device-a"},
+		{"device-a:443", "https://device-a"},
+		{"device-a:8443", "https://device-a:8443"},
+		{"https://device-a:8443/", "https://device-a:8443"},
+		{"192.168.1.2", "https://192.168.1.2"},
+		{"[fd00::2]:8443", "https://[fd00::2]:8443"},
+		{"http://device-a", ""},
+		{"https://", ""},
+	} {
+		t.Run(c.input, func(t *testing.T) {
+			addr, err := normalizePeerAddress(c.input)
+			if c.expected == "" {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.expected, addr)
+		})
+	}
+}
+
+func TestProbePeerGossip(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, deviceapi.AddToScheme(scheme))
+	var devices deviceapi.DeviceDiscoveryList
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(devices)
+	}))
+	defer srv.Close()
+	fingerprint := certpin.FingerprintDER(srv.Certificate().Raw)
+	member := func(name, address string) deviceapi.DeviceDiscovery {
+		return deviceapi.DeviceDiscovery{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       deviceapi.DeviceDiscoverySpec{Mode: deviceapi.DeviceModeAgent, Address: address, CertFingerprint: fingerprint},
+			Status:     deviceapi.DeviceDiscoveryStatus{Verified: true, ClusterMember: true},
+		}
+	}
+	devices.Items = []deviceapi.DeviceDiscovery{
+		{ObjectMeta: metav1.ObjectMeta{Name: "server"}, Spec: deviceapi.DeviceDiscoverySpec{Current: true, Mode: deviceapi.DeviceModeServer, CertFingerprint: fingerprint}},
+		member("gossiped", srv.URL),
+		member("known", "https://attacker.example.org"),
+		member("unreachable", "https://127.0.0.1:9"),
+	}
+	d := NewDeviceDiscovery("device-a", 8443, nil, nil, PeerOptions{Gossip: true}, storage.InMemory(scheme), logrus.NewEntry(logrus.New()))
+	d.registerDevice("known", deviceapi.DeviceDiscoverySpec{Mode: deviceapi.DeviceModeAgent, Address: "https://known:8443", CertFingerprint: fingerprint}, nil, deviceapi.DeviceDiscoverySourceMDNS)
+	// Pretend the gossiped address of the known device verified to check that gossip does not override the device's own information.
+	d.verifications["known"] = verification{announcement: sha256.Sum256([]byte("https://attacker.example.org\n" + fingerprint)), time: time.Now()}
+
+	d.probePeer(context.Background(), peer{Address: srv.URL, Source: deviceapi.DeviceDiscoverySourceStatic})
+
+	get := func(name string) *deviceapi.DeviceDiscovery {
+		dev := &deviceapi.DeviceDiscovery{}
+		require.NoError(t, d.store.Get(name, dev), name)
+		return dev
+	}
+	require.True(t, get("server").Status.Verified, "server verified")
+	gossiped := get("gossiped")
+	require.True(t, gossiped.Status.Verified, "gossiped member verified")
+	require.False(t, gossiped.Status.ClusterMember, "should not trust the peer's cluster membership claim")
+	known := get("known")
+	require.Equal(t, "https://known:8443", known.Spec.Address, "gossip should not override a device found directly")
+	require.Equal(t, []deviceapi.DeviceDiscoverySource{deviceapi.DeviceDiscoverySourceGossip, deviceapi.DeviceDiscoverySourceMDNS}, known.Status.Sources, "sources")
+	require.False(t, get("unreachable").Status.Verified, "unreachable member verified")
+}
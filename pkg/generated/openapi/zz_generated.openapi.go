@@ -25,30 +25,57 @@ func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenA
 		"github.com/mgoltzsche/kubemate/pkg/apis/apps/v1alpha1.CrossNamespaceSourceReference":        schema_pkg_apis_apps_v1alpha1_CrossNamespaceSourceReference(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/apps/v1alpha1.KustomizationSpec":                    schema_pkg_apis_apps_v1alpha1_KustomizationSpec(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/apps/v1alpha1.ParameterDefinition":                  schema_pkg_apis_apps_v1alpha1_ParameterDefinition(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.CellularConfig":                    schema_pkg_apis_devices_v1alpha1_CellularConfig(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.CellularStatus":                    schema_pkg_apis_devices_v1alpha1_CellularStatus(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.Certificate":                       schema_pkg_apis_devices_v1alpha1_Certificate(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.CertificateList":                   schema_pkg_apis_devices_v1alpha1_CertificateList(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.CertificateSpec":                   schema_pkg_apis_devices_v1alpha1_CertificateSpec(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DHCPLease":                         schema_pkg_apis_devices_v1alpha1_DHCPLease(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DHCPLeaseList":                     schema_pkg_apis_devices_v1alpha1_DHCPLeaseList(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DHCPLeaseSpec":                     schema_pkg_apis_devices_v1alpha1_DHCPLeaseSpec(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DHCPReservation":                   schema_pkg_apis_devices_v1alpha1_DHCPReservation(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DHCPReservationList":               schema_pkg_apis_devices_v1alpha1_DHCPReservationList(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DHCPReservationSpec":               schema_pkg_apis_devices_v1alpha1_DHCPReservationSpec(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DHCPSpec":                          schema_pkg_apis_devices_v1alpha1_DHCPSpec(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DNSConfig":                         schema_pkg_apis_devices_v1alpha1_DNSConfig(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DNSConfigList":                     schema_pkg_apis_devices_v1alpha1_DNSConfigList(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DNSConfigSpec":                     schema_pkg_apis_devices_v1alpha1_DNSConfigSpec(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DNSConfigStatus":                   schema_pkg_apis_devices_v1alpha1_DNSConfigStatus(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DNSRecord":                         schema_pkg_apis_devices_v1alpha1_DNSRecord(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.Device":                            schema_pkg_apis_devices_v1alpha1_Device(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceDiscovery":                   schema_pkg_apis_devices_v1alpha1_DeviceDiscovery(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceDiscoveryList":               schema_pkg_apis_devices_v1alpha1_DeviceDiscoveryList(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceDiscoverySpec":               schema_pkg_apis_devices_v1alpha1_DeviceDiscoverySpec(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceDiscoveryStatus":             schema_pkg_apis_devices_v1alpha1_DeviceDiscoveryStatus(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceList":                        schema_pkg_apis_devices_v1alpha1_DeviceList(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DevicePairing":                     schema_pkg_apis_devices_v1alpha1_DevicePairing(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DevicePairingList":                 schema_pkg_apis_devices_v1alpha1_DevicePairingList(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DevicePairingSpec":                 schema_pkg_apis_devices_v1alpha1_DevicePairingSpec(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DevicePairingStatus":               schema_pkg_apis_devices_v1alpha1_DevicePairingStatus(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceSpec":                        schema_pkg_apis_devices_v1alpha1_DeviceSpec(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceStatus":                      schema_pkg_apis_devices_v1alpha1_DeviceStatus(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceToken":                       schema_pkg_apis_devices_v1alpha1_DeviceToken(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceTokenData":                   schema_pkg_apis_devices_v1alpha1_DeviceTokenData(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceTokenList":                   schema_pkg_apis_devices_v1alpha1_DeviceTokenList(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceTokenStatus":                 schema_pkg_apis_devices_v1alpha1_DeviceTokenStatus(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.IPConfig":                          schema_pkg_apis_devices_v1alpha1_IPConfig(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.NetworkInterface":                  schema_pkg_apis_devices_v1alpha1_NetworkInterface(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.NetworkInterfaceList":              schema_pkg_apis_devices_v1alpha1_NetworkInterfaceList(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.NetworkInterfaceSpec":              schema_pkg_apis_devices_v1alpha1_NetworkInterfaceSpec(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.NetworkInterfaceStatus":            schema_pkg_apis_devices_v1alpha1_NetworkInterfaceStatus(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.NetworkLinkConfig":                 schema_pkg_apis_devices_v1alpha1_NetworkLinkConfig(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.NetworkLinkStatistics":             schema_pkg_apis_devices_v1alpha1_NetworkLinkStatistics(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.NetworkLinkStatus":                 schema_pkg_apis_devices_v1alpha1_NetworkLinkStatus(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.ProcessStatus":                     schema_pkg_apis_devices_v1alpha1_ProcessStatus(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.RegisteredDNSRecord":               schema_pkg_apis_devices_v1alpha1_RegisteredDNSRecord(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.SavedWifiNetwork":                  schema_pkg_apis_devices_v1alpha1_SavedWifiNetwork(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.UserAccount":                       schema_pkg_apis_devices_v1alpha1_UserAccount(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.UserAccountData":                   schema_pkg_apis_devices_v1alpha1_UserAccountData(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.UserAccountList":                   schema_pkg_apis_devices_v1alpha1_UserAccountList(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.VLANConfig":                        schema_pkg_apis_devices_v1alpha1_VLANConfig(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.WifiAccessPointSpec":               schema_pkg_apis_devices_v1alpha1_WifiAccessPointSpec(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.WifiEAPSpec":                       schema_pkg_apis_devices_v1alpha1_WifiEAPSpec(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.WifiLinkQuality":                   schema_pkg_apis_devices_v1alpha1_WifiLinkQuality(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.WifiNetwork":                       schema_pkg_apis_devices_v1alpha1_WifiNetwork(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.WifiNetworkData":                   schema_pkg_apis_devices_v1alpha1_WifiNetworkData(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.WifiNetworkList":                   schema_pkg_apis_devices_v1alpha1_WifiNetworkList(ref),
@@ -57,6 +84,8 @@ func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenA
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.WifiPasswordList":                  schema_pkg_apis_devices_v1alpha1_WifiPasswordList(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.WifiSpec":                          schema_pkg_apis_devices_v1alpha1_WifiSpec(ref),
 		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.WifiStationSpec":                   schema_pkg_apis_devices_v1alpha1_WifiStationSpec(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.WifiStationStatus":                 schema_pkg_apis_devices_v1alpha1_WifiStationStatus(ref),
+		"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.WifiStatus":                        schema_pkg_apis_devices_v1alpha1_WifiStatus(ref),
 		"k8s.io/api/core/v1.AWSElasticBlockStoreVolumeSource":                                        schema_k8sio_api_core_v1_AWSElasticBlockStoreVolumeSource(ref),
 		"k8s.io/api/core/v1.Affinity":                                                                schema_k8sio_api_core_v1_Affinity(ref),
 		"k8s.io/api/core/v1.AppArmorProfile":                                                         schema_k8sio_api_core_v1_AppArmorProfile(ref),
@@ -852,6 +881,107 @@ func schema_pkg_apis_apps_v1alpha1_ParameterDefinition(ref common.ReferenceCallb
 	}
 }
 
+func schema_pkg_apis_devices_v1alpha1_CellularConfig(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "CellularConfig configures the mobile data connection of a modem.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"apn": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APN is the access point name of the mobile network operator.",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"pin": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PIN unlocks the SIM card.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"allowRoaming": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AllowRoaming allows the modem to connect while roaming in a foreign network.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"apn"},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_devices_v1alpha1_CellularStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "CellularStatus describes the state of the modem and its mobile network registration.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"modem": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Modem is the manufacturer and model of the modem.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"state": {
+						SchemaProps: spec.SchemaProps{
+							Description: "State is the ModemManager state of the modem, e.g. locked, registered or connected.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"registrationState": {
+						SchemaProps: spec.SchemaProps{
+							Description: "RegistrationState is the mobile network registration state, e.g. home, roaming or searching.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"operator": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Operator is the name of the mobile network operator.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"accessTechnologies": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AccessTechnologies lists the radio access technologies in use, e.g. lte or 5gnr.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
+					"signalQuality": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SignalQuality is the signal quality in percent.",
+							Default:     0,
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+				},
+				Required: []string{"signalQuality"},
+			},
+		},
+	}
+}
+
 func schema_pkg_apis_devices_v1alpha1_Certificate(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
@@ -962,11 +1092,11 @@ func schema_pkg_apis_devices_v1alpha1_CertificateSpec(ref common.ReferenceCallba
 	}
 }
 
-func schema_pkg_apis_devices_v1alpha1_Device(ref common.ReferenceCallback) common.OpenAPIDefinition {
+func schema_pkg_apis_devices_v1alpha1_DHCPLease(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
 			SchemaProps: spec.SchemaProps{
-				Description: "Device is the Schema for the devices API",
+				Description: "DHCPLease is a read-only resource that reflects a lease of the device's DHCP server.",
 				Type:        []string{"object"},
 				Properties: map[string]spec.Schema{
 					"kind": {
@@ -992,29 +1122,23 @@ func schema_pkg_apis_devices_v1alpha1_Device(ref common.ReferenceCallback) commo
 					"spec": {
 						SchemaProps: spec.SchemaProps{
 							Default: map[string]interface{}{},
-							Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceSpec"),
-						},
-					},
-					"status": {
-						SchemaProps: spec.SchemaProps{
-							Default: map[string]interface{}{},
-							Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceStatus"),
+							Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DHCPLeaseSpec"),
 						},
 					},
 				},
-				Required: []string{"metadata", "spec", "status"},
+				Required: []string{"metadata", "spec"},
 			},
 		},
 		Dependencies: []string{
-			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceSpec", "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceStatus", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DHCPLeaseSpec", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
 	}
 }
 
-func schema_pkg_apis_devices_v1alpha1_DeviceDiscovery(ref common.ReferenceCallback) common.OpenAPIDefinition {
+func schema_pkg_apis_devices_v1alpha1_DHCPLeaseList(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
 			SchemaProps: spec.SchemaProps{
-				Description: "DeviceDiscovery is the Schema for the device discovery API.",
+				Description: "DHCPLeaseList contains a list of DHCPLease resources.",
 				Type:        []string{"object"},
 				Properties: map[string]spec.Schema{
 					"kind": {
@@ -1034,120 +1158,127 @@ func schema_pkg_apis_devices_v1alpha1_DeviceDiscovery(ref common.ReferenceCallba
 					"metadata": {
 						SchemaProps: spec.SchemaProps{
 							Default: map[string]interface{}{},
-							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"),
+							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.ListMeta"),
 						},
 					},
-					"spec": {
+					"items": {
 						SchemaProps: spec.SchemaProps{
-							Default: map[string]interface{}{},
-							Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceDiscoverySpec"),
+							Type: []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DHCPLease"),
+									},
+								},
+							},
 						},
 					},
 				},
-				Required: []string{"metadata", "spec"},
+				Required: []string{"items"},
 			},
 		},
 		Dependencies: []string{
-			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceDiscoverySpec", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DHCPLease", "k8s.io/apimachinery/pkg/apis/meta/v1.ListMeta"},
 	}
 }
 
-func schema_pkg_apis_devices_v1alpha1_DeviceDiscoveryList(ref common.ReferenceCallback) common.OpenAPIDefinition {
+func schema_pkg_apis_devices_v1alpha1_DHCPLeaseSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
 			SchemaProps: spec.SchemaProps{
-				Description: "DeviceDiscoveryList defines a list of discovered devices.",
+				Description: "DHCPLeaseSpec describes an address the DHCP server leased to a client.",
 				Type:        []string{"object"},
 				Properties: map[string]spec.Schema{
-					"kind": {
+					"macAddress": {
 						SchemaProps: spec.SchemaProps{
-							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#types-kinds",
-							Type:        []string{"string"},
-							Format:      "",
+							Default: "",
+							Type:    []string{"string"},
+							Format:  "",
 						},
 					},
-					"apiVersion": {
+					"ipAddress": {
 						SchemaProps: spec.SchemaProps{
-							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources",
+							Default: "",
+							Type:    []string{"string"},
+							Format:  "",
+						},
+					},
+					"hostname": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Hostname is the name the client sent along with its request.",
 							Type:        []string{"string"},
 							Format:      "",
 						},
 					},
-					"metadata": {
+					"clientID": {
 						SchemaProps: spec.SchemaProps{
-							Default: map[string]interface{}{},
-							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.ListMeta"),
+							Type:   []string{"string"},
+							Format: "",
 						},
 					},
-					"items": {
+					"expiryTime": {
 						SchemaProps: spec.SchemaProps{
-							Type: []string{"array"},
-							Items: &spec.SchemaOrArray{
-								Schema: &spec.Schema{
-									SchemaProps: spec.SchemaProps{
-										Default: map[string]interface{}{},
-										Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceDiscovery"),
-									},
-								},
-							},
+							Description: "ExpiryTime is the time the lease expires at. Infinite leases don't specify it.",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
 						},
 					},
 				},
-				Required: []string{"items"},
+				Required: []string{"macAddress", "ipAddress"},
 			},
 		},
 		Dependencies: []string{
-			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceDiscovery", "k8s.io/apimachinery/pkg/apis/meta/v1.ListMeta"},
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
 	}
 }
 
-func schema_pkg_apis_devices_v1alpha1_DeviceDiscoverySpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+func schema_pkg_apis_devices_v1alpha1_DHCPReservation(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
 			SchemaProps: spec.SchemaProps{
-				Description: "DeviceDiscoverySpec provides information about the discovered device.",
+				Description: "DHCPReservation is the schema for a static DHCP address assignment.",
 				Type:        []string{"object"},
 				Properties: map[string]spec.Schema{
-					"mode": {
+					"kind": {
 						SchemaProps: spec.SchemaProps{
-							Description: "Possible enum values:\n - `\"agent\"`\n - `\"server\"`",
-							Default:     "",
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#types-kinds",
 							Type:        []string{"string"},
 							Format:      "",
-							Enum:        []interface{}{"agent", "server"},
 						},
 					},
-					"server": {
+					"apiVersion": {
 						SchemaProps: spec.SchemaProps{
-							Type:   []string{"string"},
-							Format: "",
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
 						},
 					},
-					"address": {
+					"metadata": {
 						SchemaProps: spec.SchemaProps{
-							Default: "",
-							Type:    []string{"string"},
-							Format:  "",
+							Default: map[string]interface{}{},
+							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"),
 						},
 					},
-					"current": {
+					"spec": {
 						SchemaProps: spec.SchemaProps{
-							Type:   []string{"boolean"},
-							Format: "",
+							Default: map[string]interface{}{},
+							Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DHCPReservationSpec"),
 						},
 					},
 				},
-				Required: []string{"mode", "address"},
+				Required: []string{"metadata", "spec"},
 			},
 		},
+		Dependencies: []string{
+			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DHCPReservationSpec", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
 	}
 }
 
-func schema_pkg_apis_devices_v1alpha1_DeviceList(ref common.ReferenceCallback) common.OpenAPIDefinition {
+func schema_pkg_apis_devices_v1alpha1_DHCPReservationList(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
 			SchemaProps: spec.SchemaProps{
-				Description: "DeviceList contains a list of Device resources.",
+				Description: "DHCPReservationList contains a list of DHCPReservation resources.",
 				Type:        []string{"object"},
 				Properties: map[string]spec.Schema{
 					"kind": {
@@ -1177,7 +1308,7 @@ func schema_pkg_apis_devices_v1alpha1_DeviceList(ref common.ReferenceCallback) c
 								Schema: &spec.Schema{
 									SchemaProps: spec.SchemaProps{
 										Default: map[string]interface{}{},
-										Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.Device"),
+										Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DHCPReservation"),
 									},
 								},
 							},
@@ -1188,112 +1319,86 @@ func schema_pkg_apis_devices_v1alpha1_DeviceList(ref common.ReferenceCallback) c
 			},
 		},
 		Dependencies: []string{
-			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.Device", "k8s.io/apimachinery/pkg/apis/meta/v1.ListMeta"},
+			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DHCPReservation", "k8s.io/apimachinery/pkg/apis/meta/v1.ListMeta"},
 	}
 }
 
-func schema_pkg_apis_devices_v1alpha1_DeviceSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+func schema_pkg_apis_devices_v1alpha1_DHCPReservationSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
 			SchemaProps: spec.SchemaProps{
-				Description: "DeviceSpec defines the desired state of the Device.",
+				Description: "DHCPReservationSpec pins the IP address and hostname the DHCP server assigns to a client.",
 				Type:        []string{"object"},
 				Properties: map[string]spec.Schema{
-					"mode": {
+					"macAddress": {
 						SchemaProps: spec.SchemaProps{
-							Description: "Possible enum values:\n - `\"agent\"`\n - `\"server\"`",
-							Default:     "",
-							Type:        []string{"string"},
-							Format:      "",
-							Enum:        []interface{}{"agent", "server"},
+							Default: "",
+							Type:    []string{"string"},
+							Format:  "",
 						},
 					},
-					"serverAddress": {
+					"ipAddress": {
 						SchemaProps: spec.SchemaProps{
-							Type:   []string{"string"},
-							Format: "",
+							Description: "IPAddress is the IPv4 address the client is assigned.",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
 						},
 					},
-					"joinTokenName": {
+					"hostname": {
 						SchemaProps: spec.SchemaProps{
-							Type:   []string{"string"},
-							Format: "",
+							Description: "Hostname is the name the client is registered with within the local DNS zone.",
+							Type:        []string{"string"},
+							Format:      "",
 						},
 					},
 				},
-				Required: []string{"mode"},
+				Required: []string{"macAddress", "ipAddress"},
 			},
 		},
 	}
 }
 
-func schema_pkg_apis_devices_v1alpha1_DeviceStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+func schema_pkg_apis_devices_v1alpha1_DHCPSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
 			SchemaProps: spec.SchemaProps{
-				Description: "DeviceStatus defines the observed state of the Device.",
+				Description: "DHCPSpec defines the DHCP server configuration.",
 				Type:        []string{"object"},
 				Properties: map[string]spec.Schema{
-					"generation": {
-						SchemaProps: spec.SchemaProps{
-							Type:   []string{"integer"},
-							Format: "int64",
-						},
-					},
-					"current": {
-						SchemaProps: spec.SchemaProps{
-							Default: false,
-							Type:    []string{"boolean"},
-							Format:  "",
-						},
-					},
-					"state": {
+					"rangeStart": {
 						SchemaProps: spec.SchemaProps{
-							Description: "Possible enum values:\n - `\"error\"`\n - `\"exited\"`\n - `\"running\"`\n - `\"starting\"`\n - `\"terminating\"`\n - `\"unknown\"`",
+							Description: "RangeStart is the first IPv4 address the DHCP server leases (default: 11.0.0.10).",
 							Type:        []string{"string"},
 							Format:      "",
-							Enum:        []interface{}{"error", "exited", "running", "starting", "terminating", "unknown"},
-						},
-					},
-					"message": {
-						SchemaProps: spec.SchemaProps{
-							Type:   []string{"string"},
-							Format: "",
-						},
-					},
-					"address": {
-						SchemaProps: spec.SchemaProps{
-							Type:   []string{"string"},
-							Format: "",
 						},
 					},
-					"joinAddress": {
+					"rangeEnd": {
 						SchemaProps: spec.SchemaProps{
-							Type:   []string{"string"},
-							Format: "",
+							Description: "RangeEnd is the last IPv4 address the DHCP server leases (default: 11.0.0.50).",
+							Type:        []string{"string"},
+							Format:      "",
 						},
 					},
-					"dnsServer": {
+					"leaseTime": {
 						SchemaProps: spec.SchemaProps{
-							Description: "IPs []string `json:\"ips,omitempty\"`",
-							Default:     map[string]interface{}{},
-							Ref:         ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.ProcessStatus"),
+							Description: "LeaseTime is the duration a lease is valid for (default: 2h).",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
 						},
 					},
 				},
-				Required: []string{"current", "dnsServer"},
 			},
 		},
 		Dependencies: []string{
-			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.ProcessStatus"},
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Duration"},
 	}
 }
 
-func schema_pkg_apis_devices_v1alpha1_DeviceToken(ref common.ReferenceCallback) common.OpenAPIDefinition {
+func schema_pkg_apis_devices_v1alpha1_DNSConfig(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
 			SchemaProps: spec.SchemaProps{
-				Description: "DeviceToken is the schema for cluster join tokens within the devices API.",
+				Description: "DNSConfig is the schema for the local DNS and DHCP server configuration.",
 				Type:        []string{"object"},
 				Properties: map[string]spec.Schema{
 					"kind": {
@@ -1316,111 +1421,1214 @@ func schema_pkg_apis_devices_v1alpha1_DeviceToken(ref common.ReferenceCallback)
 							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"),
 						},
 					},
-					"data": {
+					"spec": {
 						SchemaProps: spec.SchemaProps{
 							Default: map[string]interface{}{},
-							Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceTokenData"),
+							Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DNSConfigSpec"),
 						},
 					},
 					"status": {
 						SchemaProps: spec.SchemaProps{
 							Default: map[string]interface{}{},
-							Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceTokenStatus"),
+							Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DNSConfigStatus"),
 						},
 					},
 				},
-				Required: []string{"metadata", "data"},
+				Required: []string{"metadata", "spec"},
 			},
 		},
 		Dependencies: []string{
-			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceTokenData", "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceTokenStatus", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DNSConfigSpec", "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DNSConfigStatus", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
 	}
 }
 
-func schema_pkg_apis_devices_v1alpha1_DeviceTokenData(ref common.ReferenceCallback) common.OpenAPIDefinition {
+func schema_pkg_apis_devices_v1alpha1_DNSConfigList(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
 			SchemaProps: spec.SchemaProps{
-				Description: "DeviceTokenData specifies the device token.",
+				Description: "DNSConfigList contains a list of DNSConfig resources.",
 				Type:        []string{"object"},
 				Properties: map[string]spec.Schema{
-					"token": {
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#types-kinds",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.ListMeta"),
+						},
+					},
+					"items": {
+						SchemaProps: spec.SchemaProps{
+							Type: []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DNSConfig"),
+									},
+								},
+							},
+						},
+					},
+				},
+				Required: []string{"items"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DNSConfig", "k8s.io/apimachinery/pkg/apis/meta/v1.ListMeta"},
+	}
+}
+
+func schema_pkg_apis_devices_v1alpha1_DNSConfigSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "DNSConfigSpec defines the local DNS zone and DHCP server configuration of the server device.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"zone": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Zone is the local DNS zone the devices, nodes and ingress hosts are registered within (default: kube.m8).",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"upstreams": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Upstreams lists the DNS servers other names are resolved with. The host's resolvers are used when empty.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
+					"records": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Records lists static DNS records.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DNSRecord"),
+									},
+								},
+							},
+						},
+					},
+					"dhcp": {
+						SchemaProps: spec.SchemaProps{
+							Description: "DHCP configures the DHCP server that runs in access point mode.",
+							Default:     map[string]interface{}{},
+							Ref:         ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DHCPSpec"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DHCPSpec", "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DNSRecord"},
+	}
+}
+
+func schema_pkg_apis_devices_v1alpha1_DNSConfigStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "DNSConfigStatus lists the DNS records that were registered automatically.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"records": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Records lists the records registered for the cluster nodes, Ingress hosts and annotated Services.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.RegisteredDNSRecord"),
+									},
+								},
+							},
+						},
+					},
+					"message": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.RegisteredDNSRecord"},
+	}
+}
+
+func schema_pkg_apis_devices_v1alpha1_DNSRecord(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "DNSRecord defines a DNS record.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"name": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Name is the record's host name, prefixed with the service and protocol labels in case of an SRV record (e.g. _http._tcp.myapp). Names without a dot (apart from the SRV labels) are relative to the zone.",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"type": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Possible enum values:\n - `\"A\"`\n - `\"AAAA\"`\n - `\"SRV\"`",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+							Enum:        []interface{}{"A", "AAAA", "SRV"},
+						},
+					},
+					"value": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Value is the record's address or, in case of an SRV record, the target host and port (e.g. myapp:8080).",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"name", "type", "value"},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_devices_v1alpha1_Device(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "Device is the Schema for the devices API",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#types-kinds",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"),
+						},
+					},
+					"spec": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceSpec"),
+						},
+					},
+					"status": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceStatus"),
+						},
+					},
+				},
+				Required: []string{"metadata", "spec", "status"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceSpec", "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceStatus", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+	}
+}
+
+func schema_pkg_apis_devices_v1alpha1_DeviceDiscovery(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "DeviceDiscovery is the Schema for the device discovery API.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#types-kinds",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"),
+						},
+					},
+					"spec": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceDiscoverySpec"),
+						},
+					},
+					"status": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceDiscoveryStatus"),
+						},
+					},
+				},
+				Required: []string{"metadata", "spec"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceDiscoverySpec", "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceDiscoveryStatus", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+	}
+}
+
+func schema_pkg_apis_devices_v1alpha1_DeviceDiscoveryList(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "DeviceDiscoveryList defines a list of discovered devices.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#types-kinds",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.ListMeta"),
+						},
+					},
+					"items": {
+						SchemaProps: spec.SchemaProps{
+							Type: []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceDiscovery"),
+									},
+								},
+							},
+						},
+					},
+				},
+				Required: []string{"items"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceDiscovery", "k8s.io/apimachinery/pkg/apis/meta/v1.ListMeta"},
+	}
+}
+
+func schema_pkg_apis_devices_v1alpha1_DeviceDiscoverySpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "DeviceDiscoverySpec provides information about the discovered device.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"mode": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Possible enum values:\n - `\"agent\"`\n - `\"server\"`",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+							Enum:        []interface{}{"agent", "server"},
+						},
+					},
+					"server": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"address": {
+						SchemaProps: spec.SchemaProps{
+							Default: "",
+							Type:    []string{"string"},
+							Format:  "",
+						},
+					},
+					"current": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"boolean"},
+							Format: "",
+						},
+					},
+					"certFingerprint": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CertFingerprint is the announced SHA256 fingerprint of the device's API certificate.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"version": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Version is the kubemate version the device runs.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"k3sVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "K3sVersion is the version of k3s embedded into kubemate.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"state": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Possible enum values:\n - `\"error\"`\n - `\"exited\"`\n - `\"running\"`\n - `\"starting\"`\n - `\"terminating\"`\n - `\"unknown\"`",
+							Type:        []string{"string"},
+							Format:      "",
+							Enum:        []interface{}{"error", "exited", "running", "starting", "terminating", "unknown"},
+						},
+					},
+					"clusterID": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ClusterID identifies the cluster the device belongs to by the hash of the cluster CA certificate.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"arch": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Arch is the device's CPU architecture.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"ips": {
+						SchemaProps: spec.SchemaProps{
+							Type: []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
+				},
+				Required: []string{"mode", "address"},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_devices_v1alpha1_DeviceDiscoveryStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "DeviceDiscoveryStatus indicates whether the announcement could be verified and when the device was last seen.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"verified": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Verified is true when the device's TLS endpoint presented the announced certificate and the announcement was signed with its key or served via that endpoint.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"clusterMember": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ClusterMember is true when the verified device belongs to the same cluster as this device.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"lastSeen": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"sources": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Sources lists the discovery mechanisms that found the device.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+										Enum:    []interface{}{"dns", "gossip", "mdns", "static"},
+									},
+								},
+							},
+						},
+					},
+					"message": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"conditions": {
+						SchemaProps: spec.SchemaProps{
+							Type: []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.Condition"),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Condition", "k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
+	}
+}
+
+func schema_pkg_apis_devices_v1alpha1_DeviceList(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "DeviceList contains a list of Device resources.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#types-kinds",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.ListMeta"),
+						},
+					},
+					"items": {
+						SchemaProps: spec.SchemaProps{
+							Type: []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.Device"),
+									},
+								},
+							},
+						},
+					},
+				},
+				Required: []string{"items"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.Device", "k8s.io/apimachinery/pkg/apis/meta/v1.ListMeta"},
+	}
+}
+
+func schema_pkg_apis_devices_v1alpha1_DevicePairing(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "DevicePairing is the schema for the handshake that joins an agent device to a server.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#types-kinds",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"),
+						},
+					},
+					"spec": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DevicePairingSpec"),
+						},
+					},
+					"status": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DevicePairingStatus"),
+						},
+					},
+				},
+				Required: []string{"metadata", "spec"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DevicePairingSpec", "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DevicePairingStatus", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+	}
+}
+
+func schema_pkg_apis_devices_v1alpha1_DevicePairingList(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "DevicePairingList contains a list of DevicePairing resources.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#types-kinds",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.ListMeta"),
+						},
+					},
+					"items": {
+						SchemaProps: spec.SchemaProps{
+							Type: []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DevicePairing"),
+									},
+								},
+							},
+						},
+					},
+				},
+				Required: []string{"items"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DevicePairing", "k8s.io/apimachinery/pkg/apis/meta/v1.ListMeta"},
+	}
+}
+
+func schema_pkg_apis_devices_v1alpha1_DevicePairingSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "DevicePairingSpec specifies a request to join an agent device to a server device. On the agent, a user specifies the ServerAddress of a discovered server. The agent then submits a pairing request, specifying the Agent fields, to the server.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"serverAddress": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ServerAddress is the API address of the server to join (specified on the agent).",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"joinTokenName": {
+						SchemaProps: spec.SchemaProps{
+							Description: "JoinTokenName is the name of the DeviceToken the agent should store the join token as.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"agent": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Agent is the name of the agent that requests to join (specified on the server). The server names incoming pairing requests itself since the agent's name is not verified.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"agentAddress": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AgentAddress is the API address of the agent that requests to join.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"agentCertFingerprint": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AgentCertFingerprint is the SHA256 fingerprint of the agent's API certificate.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"nonceCommitment": {
+						SchemaProps: spec.SchemaProps{
+							Description: "NonceCommitment is the SHA256 hash of the Nonce the agent submits along with its pairing request.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"nonce": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Nonce is random data the agent contributes to the confirmation code. The agent reveals it only after it received the server's nonce.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"secret": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Secret authorizes the server to push the join token to the agent.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"confirmed": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Confirmed must be set on the server when both devices show the same confirmation code.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"joinToken": {
+						SchemaProps: spec.SchemaProps{
+							Description: "JoinToken is pushed by the server to the agent after confirmation.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_devices_v1alpha1_DevicePairingStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "DevicePairingStatus provides the confirmation code and progress of a pairing.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"phase": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Possible enum values:\n - `\"Completed\"`\n - `\"Confirmed\"`\n - `\"Failed\"`\n - `\"Pending\"`",
+							Type:        []string{"string"},
+							Format:      "",
+							Enum:        []interface{}{"Completed", "Confirmed", "Failed", "Pending"},
+						},
+					},
+					"confirmationCode": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ConfirmationCode is derived from both devices' certificates and nonces and must be the same on both devices.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"serverNonce": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ServerNonce is random data the server contributes to the confirmation code in response to the agent's nonce commitment.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"clientAddress": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ClientAddress is the address the server received the pairing request from.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"serverCertFingerprint": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ServerCertFingerprint is the SHA256 fingerprint of the server's API certificate the agent pinned.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"message": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_devices_v1alpha1_DeviceSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "DeviceSpec defines the desired state of the Device.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"mode": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Possible enum values:\n - `\"agent\"`\n - `\"server\"`",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+							Enum:        []interface{}{"agent", "server"},
+						},
+					},
+					"serverAddress": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"joinTokenName": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"dualStack": {
+						SchemaProps: spec.SchemaProps{
+							Description: "DualStack enables IPv6 next to IPv4 within the cluster when running as server and registers the node's IPv6 address when running as agent.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"mode"},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_devices_v1alpha1_DeviceStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "DeviceStatus defines the observed state of the Device.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"generation": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"integer"},
+							Format: "int64",
+						},
+					},
+					"current": {
+						SchemaProps: spec.SchemaProps{
+							Default: false,
+							Type:    []string{"boolean"},
+							Format:  "",
+						},
+					},
+					"state": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Possible enum values:\n - `\"error\"`\n - `\"exited\"`\n - `\"running\"`\n - `\"starting\"`\n - `\"terminating\"`\n - `\"unknown\"`",
+							Type:        []string{"string"},
+							Format:      "",
+							Enum:        []interface{}{"error", "exited", "running", "starting", "terminating", "unknown"},
+						},
+					},
+					"message": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"address": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"joinAddress": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"ips": {
+						SchemaProps: spec.SchemaProps{
+							Description: "IPs lists the device's IPv4 and IPv6 addresses.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
+					"dnsServer": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.ProcessStatus"),
+						},
+					},
+				},
+				Required: []string{"current", "dnsServer"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.ProcessStatus"},
+	}
+}
+
+func schema_pkg_apis_devices_v1alpha1_DeviceToken(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "DeviceToken is the schema for cluster join tokens within the devices API.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#types-kinds",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"),
+						},
+					},
+					"data": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceTokenData"),
+						},
+					},
+					"status": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceTokenStatus"),
+						},
+					},
+				},
+				Required: []string{"metadata", "data"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceTokenData", "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceTokenStatus", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+	}
+}
+
+func schema_pkg_apis_devices_v1alpha1_DeviceTokenData(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "DeviceTokenData specifies the device token.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"token": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Token holds the server token or the token an agent uses to join a server. It must be empty for bootstrap tokens since those are generated by the server.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"type": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Type specifies the purpose of the token. Defaults to join.\n\nPossible enum values:\n - `\"bootstrap\"` is a k3s bootstrap token that is issued by the server and expires.\n - `\"join\"` is a token an agent device uses to join a server.\n - `\"server\"` is the server's own (rotating) token.",
+							Type:        []string{"string"},
+							Format:      "",
+							Enum:        []interface{}{"bootstrap", "join", "server"},
+						},
+					},
+					"description": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Description describes what a bootstrap token is used for.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"ttl": {
+						SchemaProps: spec.SchemaProps{
+							Description: "TTL specifies how long a bootstrap token is valid. Defaults to 24h.",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
+						},
+					},
+					"maxUses": {
+						SchemaProps: spec.SchemaProps{
+							Description: "MaxUses specifies how many devices can join using a bootstrap token. 0 means unlimited.",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"rotationInterval": {
+						SchemaProps: spec.SchemaProps{
+							Description: "RotationInterval specifies how often the server token is rotated. Defaults to 720h, 0 disables rotation.",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Duration"},
+	}
+}
+
+func schema_pkg_apis_devices_v1alpha1_DeviceTokenList(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "DeviceTokenList contains a list of DeviceToken resources.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#types-kinds",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.ListMeta"),
+						},
+					},
+					"items": {
+						SchemaProps: spec.SchemaProps{
+							Type: []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceToken"),
+									},
+								},
+							},
+						},
+					},
+				},
+				Required: []string{"items"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceToken", "k8s.io/apimachinery/pkg/apis/meta/v1.ListMeta"},
+	}
+}
+
+func schema_pkg_apis_devices_v1alpha1_DeviceTokenStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "DeviceTokenStatus provides the server's join token.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"joinToken": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"previousJoinToken": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PreviousJoinToken holds the server's join token before the last rotation. Agents can still authenticate using it in order to obtain the new token.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"lastRotation": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LastRotation is the time the server token was rotated last.",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"id": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ID is the public ID of a bootstrap token.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"expires": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Expires is the time a bootstrap token expires.",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"usedBy": {
+						SchemaProps: spec.SchemaProps{
+							Description: "UsedBy lists the nodes that joined the cluster using a bootstrap token.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
+					"revoked": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Revoked indicates that a bootstrap token has been used up and cannot be used to join anymore. Until it expires, agents can still use it to obtain the server's join token.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"message": {
 						SchemaProps: spec.SchemaProps{
-							Default: "",
-							Type:    []string{"string"},
-							Format:  "",
+							Type:   []string{"string"},
+							Format: "",
 						},
 					},
 				},
-				Required: []string{"token"},
 			},
 		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
 	}
 }
 
-func schema_pkg_apis_devices_v1alpha1_DeviceTokenList(ref common.ReferenceCallback) common.OpenAPIDefinition {
+func schema_pkg_apis_devices_v1alpha1_IPConfig(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
 			SchemaProps: spec.SchemaProps{
-				Description: "DeviceTokenList contains a list of DeviceToken resources.",
+				Description: "IPConfig configures the IP addresses of a link.",
 				Type:        []string{"object"},
 				Properties: map[string]spec.Schema{
-					"kind": {
-						SchemaProps: spec.SchemaProps{
-							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#types-kinds",
-							Type:        []string{"string"},
-							Format:      "",
-						},
-					},
-					"apiVersion": {
+					"mode": {
 						SchemaProps: spec.SchemaProps{
-							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources",
+							Description: "Possible enum values:\n - `\"dhcp\"`\n - `\"static\"`",
+							Default:     "",
 							Type:        []string{"string"},
 							Format:      "",
+							Enum:        []interface{}{"dhcp", "static"},
 						},
 					},
-					"metadata": {
+					"addresses": {
 						SchemaProps: spec.SchemaProps{
-							Default: map[string]interface{}{},
-							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.ListMeta"),
+							Description: "Addresses lists the static IPv4 and IPv6 addresses in CIDR notation.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
 						},
 					},
-					"items": {
+					"gateways": {
 						SchemaProps: spec.SchemaProps{
-							Type: []string{"array"},
+							Description: "Gateways lists the static IPv4 and IPv6 default gateways.",
+							Type:        []string{"array"},
 							Items: &spec.SchemaOrArray{
 								Schema: &spec.Schema{
 									SchemaProps: spec.SchemaProps{
-										Default: map[string]interface{}{},
-										Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceToken"),
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
 									},
 								},
 							},
 						},
 					},
-				},
-				Required: []string{"items"},
-			},
-		},
-		Dependencies: []string{
-			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.DeviceToken", "k8s.io/apimachinery/pkg/apis/meta/v1.ListMeta"},
-	}
-}
-
-func schema_pkg_apis_devices_v1alpha1_DeviceTokenStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
-	return common.OpenAPIDefinition{
-		Schema: spec.Schema{
-			SchemaProps: spec.SchemaProps{
-				Description: "DeviceTokenStatus provides the server's join token.",
-				Type:        []string{"object"},
-				Properties: map[string]spec.Schema{
-					"joinToken": {
+					"dns": {
 						SchemaProps: spec.SchemaProps{
-							Type:   []string{"string"},
-							Format: "",
+							Description: "DNS lists the static DNS servers.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
 						},
 					},
 				},
+				Required: []string{"mode"},
 			},
 		},
 	}
@@ -1536,11 +2744,23 @@ func schema_pkg_apis_devices_v1alpha1_NetworkInterfaceSpec(ref common.ReferenceC
 							Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.WifiSpec"),
 						},
 					},
+					"link": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Link configures the addressing of a wired link. Unless specified, the addressing is left to the host.",
+							Ref:         ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.NetworkLinkConfig"),
+						},
+					},
+					"cellular": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Cellular configures the mobile data connection of a cellular interface. Unless specified, the modem is left to the host.",
+							Ref:         ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.CellularConfig"),
+						},
+					},
 				},
 			},
 		},
 		Dependencies: []string{
-			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.WifiSpec"},
+			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.CellularConfig", "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.NetworkLinkConfig", "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.WifiSpec"},
 	}
 }
 
@@ -1557,6 +2777,25 @@ func schema_pkg_apis_devices_v1alpha1_NetworkInterfaceStatus(ref common.Referenc
 							Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.NetworkLinkStatus"),
 						},
 					},
+					"wifi": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.WifiStatus"),
+						},
+					},
+					"cellular": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Cellular describes the state of the modem of a cellular interface.",
+							Ref:         ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.CellularStatus"),
+						},
+					},
+					"linkConfigMessage": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LinkConfigMessage reports whether the link configuration awaits confirmation or was rolled back.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
 					"error": {
 						SchemaProps: spec.SchemaProps{
 							Type:   []string{"string"},
@@ -1567,7 +2806,118 @@ func schema_pkg_apis_devices_v1alpha1_NetworkInterfaceStatus(ref common.Referenc
 			},
 		},
 		Dependencies: []string{
-			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.NetworkLinkStatus"},
+			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.CellularStatus", "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.NetworkLinkStatus", "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.WifiStatus"},
+	}
+}
+
+func schema_pkg_apis_devices_v1alpha1_NetworkLinkConfig(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "NetworkLinkConfig configures the addressing of a wired link.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"ip": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.IPConfig"),
+						},
+					},
+					"mtu": {
+						SchemaProps: spec.SchemaProps{
+							Description: "MTU is the maximum transmission unit of the link.",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"vlans": {
+						SchemaProps: spec.SchemaProps{
+							Description: "VLANs lists the VLAN sub-interfaces to create on top of the link, named <LINK>.<ID>.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.VLANConfig"),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.IPConfig", "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.VLANConfig"},
+	}
+}
+
+func schema_pkg_apis_devices_v1alpha1_NetworkLinkStatistics(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "NetworkLinkStatistics holds the traffic counters of the network link.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"rxBytes": {
+						SchemaProps: spec.SchemaProps{
+							Default: 0,
+							Type:    []string{"integer"},
+							Format:  "int64",
+						},
+					},
+					"txBytes": {
+						SchemaProps: spec.SchemaProps{
+							Default: 0,
+							Type:    []string{"integer"},
+							Format:  "int64",
+						},
+					},
+					"rxPackets": {
+						SchemaProps: spec.SchemaProps{
+							Default: 0,
+							Type:    []string{"integer"},
+							Format:  "int64",
+						},
+					},
+					"txPackets": {
+						SchemaProps: spec.SchemaProps{
+							Default: 0,
+							Type:    []string{"integer"},
+							Format:  "int64",
+						},
+					},
+					"rxErrors": {
+						SchemaProps: spec.SchemaProps{
+							Default: 0,
+							Type:    []string{"integer"},
+							Format:  "int64",
+						},
+					},
+					"txErrors": {
+						SchemaProps: spec.SchemaProps{
+							Default: 0,
+							Type:    []string{"integer"},
+							Format:  "int64",
+						},
+					},
+					"rxDropped": {
+						SchemaProps: spec.SchemaProps{
+							Default: 0,
+							Type:    []string{"integer"},
+							Format:  "int64",
+						},
+					},
+					"txDropped": {
+						SchemaProps: spec.SchemaProps{
+							Default: 0,
+							Type:    []string{"integer"},
+							Format:  "int64",
+						},
+					},
+				},
+				Required: []string{"rxBytes", "txBytes", "rxPackets", "txPackets", "rxErrors", "txErrors", "rxDropped", "txDropped"},
+			},
+		},
 	}
 }
 
@@ -1586,10 +2936,10 @@ func schema_pkg_apis_devices_v1alpha1_NetworkLinkStatus(ref common.ReferenceCall
 					},
 					"type": {
 						SchemaProps: spec.SchemaProps{
-							Description: "Possible enum values:\n - `\"ether\"`\n - `\"wifi\"`",
+							Description: "Possible enum values:\n - `\"cellular\"` is the network link of an LTE/5G modem managed by ModemManager.\n - `\"ether\"`\n - `\"wifi\"`",
 							Type:        []string{"string"},
 							Format:      "",
-							Enum:        []interface{}{"ether", "wifi"},
+							Enum:        []interface{}{"cellular", "ether", "wifi"},
 						},
 					},
 					"up": {
@@ -1611,16 +2961,46 @@ func schema_pkg_apis_devices_v1alpha1_NetworkLinkStatus(ref common.ReferenceCall
 							Format: "",
 						},
 					},
+					"ip6": {
+						SchemaProps: spec.SchemaProps{
+							Description: "IP6 lists the link's global IPv6 addresses.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
+					"statistics": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Statistics holds the link's traffic counters.",
+							Ref:         ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.NetworkLinkStatistics"),
+						},
+					},
 					"error": {
 						SchemaProps: spec.SchemaProps{
 							Type:   []string{"string"},
 							Format: "",
 						},
 					},
+					"absent": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Absent indicates that the link does not exist currently, e.g. since its USB adapter is unplugged. A NetworkInterface with a changed spec is kept while its link is absent in order to apply the spec again when the link reappears.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
 				},
 				Required: []string{"up"},
 			},
 		},
+		Dependencies: []string{
+			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.NetworkLinkStatistics"},
 	}
 }
 
@@ -1651,6 +3031,96 @@ func schema_pkg_apis_devices_v1alpha1_ProcessStatus(ref common.ReferenceCallback
 	}
 }
 
+func schema_pkg_apis_devices_v1alpha1_RegisteredDNSRecord(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "RegisteredDNSRecord is a DNS record that was registered for an object.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"name": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Name is the record's host name, prefixed with the service and protocol labels in case of an SRV record (e.g. _http._tcp.myapp). Names without a dot (apart from the SRV labels) are relative to the zone.",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"type": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Possible enum values:\n - `\"A\"`\n - `\"AAAA\"`\n - `\"SRV\"`",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+							Enum:        []interface{}{"A", "AAAA", "SRV"},
+						},
+					},
+					"value": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Value is the record's address or, in case of an SRV record, the target host and port (e.g. myapp:8080).",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"source": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Source refers to the object the record was registered for, e.g. node/<name> or ingress/<namespace>/<name>.",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"name", "type", "value", "source"},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_devices_v1alpha1_SavedWifiNetwork(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "SavedWifiNetwork specifies a wifi network the station may connect to.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"ssid": {
+						SchemaProps: spec.SchemaProps{
+							Default: "",
+							Type:    []string{"string"},
+							Format:  "",
+						},
+					},
+					"priority": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Priority is the preference of the network, higher values are preferred (default: 0).",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"passwordRef": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PasswordRef is the name of the WifiPassword holding the network's password (default: derived from the SSID). For 802.1X networks it also holds the certificates and the client key.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"eap": {
+						SchemaProps: spec.SchemaProps{
+							Description: "EAP configures 802.1X authentication (WPA2/WPA3-Enterprise).",
+							Ref:         ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.WifiEAPSpec"),
+						},
+					},
+				},
+				Required: []string{"ssid"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.WifiEAPSpec"},
+	}
+}
+
 func schema_pkg_apis_devices_v1alpha1_UserAccount(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
@@ -1769,22 +3239,200 @@ func schema_pkg_apis_devices_v1alpha1_UserAccountList(ref common.ReferenceCallba
 	}
 }
 
+func schema_pkg_apis_devices_v1alpha1_VLANConfig(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "VLANConfig specifies a VLAN sub-interface.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"id": {
+						SchemaProps: spec.SchemaProps{
+							Default: 0,
+							Type:    []string{"integer"},
+							Format:  "int32",
+						},
+					},
+					"ip": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.IPConfig"),
+						},
+					},
+					"mtu": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"integer"},
+							Format: "int32",
+						},
+					},
+				},
+				Required: []string{"id"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.IPConfig"},
+	}
+}
+
 func schema_pkg_apis_devices_v1alpha1_WifiAccessPointSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
 			SchemaProps: spec.SchemaProps{
-				Description: "WifiAccessPointSpec defines the wifi access point configuration.",
+				Description: "WifiAccessPointSpec defines the wifi access point configuration. In accesspoint+station mode, the access point operates on the band and channel of the network the station is connected to.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"ssid": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SSID is the name of the wifi network (default: device name).",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"band": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Band is the frequency band the access point operates on (default: 2.4GHz).\n\nPossible enum values:\n - `\"2.4GHz\"`\n - `\"5GHz\"`",
+							Type:        []string{"string"},
+							Format:      "",
+							Enum:        []interface{}{"2.4GHz", "5GHz"},
+						},
+					},
+					"channel": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Channel is the channel number or auto (default) to pick the least congested channel of the band.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"security": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Security is the authentication method, either wpa2 (default), wpa3 or wpa2-wpa3 (transition mode).\n\nPossible enum values:\n - `\"wpa2\"`\n - `\"wpa2-wpa3\"`\n - `\"wpa3\"`",
+							Type:        []string{"string"},
+							Format:      "",
+							Enum:        []interface{}{"wpa2", "wpa2-wpa3", "wpa3"},
+						},
+					},
+					"hidden": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Hidden disables broadcasting the SSID.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"maxClients": {
+						SchemaProps: spec.SchemaProps{
+							Description: "MaxClients limits the number of clients that can connect to the access point.",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"clientIsolation": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ClientIsolation prevents the access point clients from communicating with each other.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"ingressOnly": {
+						SchemaProps: spec.SchemaProps{
+							Description: "IngressOnly restricts the access point clients to the cluster's ingress instead of NATing them through the uplink.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_devices_v1alpha1_WifiEAPSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "WifiEAPSpec configures 802.1X authentication.",
 				Type:        []string{"object"},
 				Properties: map[string]spec.Schema{
-					"SSID": {
+					"method": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Method is the EAP method.\n\nPossible enum values:\n - `\"PEAP\"`\n - `\"TLS\"`\n - `\"TTLS\"`",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+							Enum:        []interface{}{"PEAP", "TLS", "TTLS"},
+						},
+					},
+					"phase2": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Phase2 is the inner authentication method of PEAP and TTLS (default: MSCHAPV2).",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"identity": {
 						SchemaProps: spec.SchemaProps{
 							Default: "",
 							Type:    []string{"string"},
 							Format:  "",
 						},
 					},
+					"anonymousIdentity": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AnonymousIdentity is the outer identity of PEAP and TTLS, exposed unencrypted.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"domainSuffixMatch": {
+						SchemaProps: spec.SchemaProps{
+							Description: "DomainSuffixMatch constrains the name of the authentication server's certificate.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"method", "identity"},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_devices_v1alpha1_WifiLinkQuality(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "WifiLinkQuality describes the radio link quality of the wifi interface.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"signal": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Signal is the signal strength of the network the station is associated with in dBm.",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"noise": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Noise is the noise level of the channel in use in dBm.",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"bitrate": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Bitrate is the transmit bitrate of the station in Mbit/s.",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"accessPointStations": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AccessPointStations is the number of clients associated with the access point.",
+							Default:     0,
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
 				},
-				Required: []string{"SSID"},
+				Required: []string{"accessPointStations"},
 			},
 		},
 	}
@@ -1953,9 +3601,38 @@ func schema_pkg_apis_devices_v1alpha1_WifiPasswordData(ref common.ReferenceCallb
 				Properties: map[string]spec.Schema{
 					"password": {
 						SchemaProps: spec.SchemaProps{
-							Default: "",
-							Type:    []string{"string"},
-							Format:  "",
+							Description: "Password is the pre-shared key or the EAP password of a wifi network. Except for the access point password, it is write-only: it is never returned by the API and kept when an update does not specify it.",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"caCert": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CACert is the PEM-encoded CA certificate the 802.1X authentication server is verified with.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"clientCert": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ClientCert is the PEM-encoded client certificate used for EAP-TLS.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"clientKey": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ClientKey is the PEM-encoded private key of the client certificate. It is write-only: it is never returned by the API and kept when an update does not specify it.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"clientKeyPassword": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ClientKeyPassword is the password the client key is encrypted with. It is write-only as well.",
+							Type:        []string{"string"},
+							Format:      "",
 						},
 					},
 				},
@@ -2023,11 +3700,11 @@ func schema_pkg_apis_devices_v1alpha1_WifiSpec(ref common.ReferenceCallback) com
 				Properties: map[string]spec.Schema{
 					"mode": {
 						SchemaProps: spec.SchemaProps{
-							Description: "Possible enum values:\n - `\"accesspoint\"`\n - `\"disabled\"`\n - `\"station\"`",
+							Description: "Possible enum values:\n - `\"accesspoint\"`\n - `\"accesspoint+station\"` connects to a wifi network and runs an access point on the same radio simultaneously.\n - `\"disabled\"`\n - `\"station\"`",
 							Default:     "",
 							Type:        []string{"string"},
 							Format:      "",
-							Enum:        []interface{}{"accesspoint", "disabled", "station"},
+							Enum:        []interface{}{"accesspoint", "accesspoint+station", "disabled", "station"},
 						},
 					},
 					"countryCode": {
@@ -2064,17 +3741,141 @@ func schema_pkg_apis_devices_v1alpha1_WifiStationSpec(ref common.ReferenceCallba
 				Description: "WifiStationSpec defines the wifi client configuration.",
 				Type:        []string{"object"},
 				Properties: map[string]spec.Schema{
-					"SSID": {
+					"ssid": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SSID is the preferred wifi network, taking precedence over the saved networks.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"networks": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Networks lists the saved wifi networks. The station connects to the network with the highest priority that is in range and roams between them.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.SavedWifiNetwork"),
+									},
+								},
+							},
+						},
+					},
+					"fallbackTimeout": {
+						SchemaProps: spec.SchemaProps{
+							Description: "FallbackTimeout is the time after which the access point is started when the station cannot connect or obtain an IP address (default: 3m). The station is restarted once a saved network is in range again. A zero duration disables the fallback.",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.SavedWifiNetwork", "k8s.io/apimachinery/pkg/apis/meta/v1.Duration"},
+	}
+}
+
+func schema_pkg_apis_devices_v1alpha1_WifiStationStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "WifiStationStatus describes the wifi network the station is associated with.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"ssid": {
 						SchemaProps: spec.SchemaProps{
 							Default: "",
 							Type:    []string{"string"},
 							Format:  "",
 						},
 					},
+					"bssid": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"frequency": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"integer"},
+							Format: "int32",
+						},
+					},
+					"signal": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Signal is the signal strength in dBm.",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"bitrate": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Bitrate is the link speed in Mbit/s.",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+				},
+				Required: []string{"ssid"},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_devices_v1alpha1_WifiStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "WifiStatus defines the observed state of the wifi interface.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"channel": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Channel is the channel the access point operates on.",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"station": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Station describes the wifi network the station is associated with.",
+							Ref:         ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.WifiStationStatus"),
+						},
+					},
+					"fallback": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Fallback indicates that the access point is running since the station could not connect to any saved network.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"firewallRules": {
+						SchemaProps: spec.SchemaProps{
+							Description: "FirewallRules lists the nftables rules applied for the access point within the kubemate table.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
+					"quality": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Quality describes the radio link quality.",
+							Ref:         ref("github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.WifiLinkQuality"),
+						},
+					},
 				},
-				Required: []string{"SSID"},
 			},
 		},
+		Dependencies: []string{
+			"github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.WifiLinkQuality", "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1.WifiStationStatus"},
 	}
 }
 
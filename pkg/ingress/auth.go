@@ -0,0 +1,288 @@
+package ingress
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+const (
+	// authRequired is the auth annotation value that makes an ingress require a kubemate login.
+	authRequired = "required"
+	// loginPath is served on every ingress host in order to log in to the ingress routes that require authentication.
+	loginPath  = "/.kubemate/login"
+	logoutPath = "/.kubemate/logout"
+	// sessionCookieName is the name of the cookie holding the signed session.
+	sessionCookieName = "kubemate_session"
+	sessionDuration   = 12 * time.Hour
+	// headerForwardedUser and headerForwardedGroups pass the authenticated user to the backend.
+	headerForwardedUser   = "X-Forwarded-User"
+	headerForwardedGroups = "X-Forwarded-Groups"
+)
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>kubemate login</title>
+</head>
+<body>
+<form method="post" action="{{.Action}}">
+<h1>Login to {{.Host}}</h1>
+{{if .Error}}<p>{{.Error}}</p>{{end}}
+<input type="hidden" name="rd" value="{{.Redirect}}">
+<label>Token/Password <input type="password" name="token" autofocus required></label>
+<button type="submit">Login</button>
+</form>
+</body>
+</html>
+`))
+
+// sessionAuthenticator authenticates the requests to the ingress routes that require a kubemate login.
+// A user logs in with a token the API server's authenticator accepts and obtains a signed session cookie in return.
+// The session key is generated on startup, ending all sessions on restart.
+// Since the session holds no credentials, it remains valid until it expires even if the token is revoked.
+type sessionAuthenticator struct {
+	authenticator authenticator.Request
+	deniedGroups  []string
+	key           []byte
+	logger        *logrus.Entry
+}
+
+// session is the payload of the session cookie.
+type session struct {
+	User    string   `json:"u"`
+	Groups  []string `json:"g,omitempty"`
+	Expires int64    `json:"e"`
+}
+
+func newSessionKey() []byte {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key) // never returns an error
+	return key
+}
+
+// authenticate returns the user the request was sent by, either using its bearer token or session cookie.
+func (a *sessionAuthenticator) authenticate(req *http.Request) (user.Info, bool) {
+	if strings.HasPrefix(req.Header.Get("Authorization"), "Bearer ") {
+		return a.authenticateToken(req)
+	}
+	c, err := req.Cookie(sessionCookieName)
+	if err != nil {
+		return nil, false
+	}
+	s, err := a.decodeSession(c.Value)
+	if err != nil {
+		a.logger.WithField("host", req.Host).Debugf("rejecting session: %s", err)
+		return nil, false
+	}
+	return &user.DefaultInfo{Name: s.User, Groups: s.Groups}, true
+}
+
+func (a *sessionAuthenticator) authenticateToken(req *http.Request) (user.Info, bool) {
+	if a.authenticator == nil {
+		return nil, false
+	}
+	resp, ok, err := a.authenticator.AuthenticateRequest(req)
+	if err != nil {
+		a.logger.WithField("host", req.Host).WithError(err).Debug("rejecting token")
+		return nil, false
+	}
+	if !ok || resp.User.GetName() == user.Anonymous || slices.Contains(resp.User.GetGroups(), user.AllUnauthenticated) {
+		return nil, false
+	}
+	if slices.ContainsFunc(resp.User.GetGroups(), func(g string) bool { return slices.Contains(a.deniedGroups, g) }) {
+		a.logger.WithField("host", req.Host).WithField("user", resp.User.GetName()).Debug("rejecting token of denied group")
+		return nil, false
+	}
+	return resp.User, true
+}
+
+func (a *sessionAuthenticator) encodeSession(s session) string {
+	payload, _ := json.Marshal(s)
+	p := base64.RawURLEncoding.EncodeToString(payload)
+	return p + "." + base64.RawURLEncoding.EncodeToString(a.sign(p))
+}
+
+func (a *sessionAuthenticator) decodeSession(value string) (*session, error) {
+	p, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, fmt.Errorf("malformed session cookie")
+	}
+	sigBytes, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(sigBytes, a.sign(p)) {
+		return nil, fmt.Errorf("invalid session cookie signature")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(p)
+	if err != nil {
+		return nil, fmt.Errorf("malformed session cookie: %w", err)
+	}
+	var s session
+	err = json.Unmarshal(payload, &s)
+	if err != nil {
+		return nil, fmt.Errorf("malformed session cookie: %w", err)
+	}
+	if time.Now().Unix() >= s.Expires {
+		return nil, fmt.Errorf("session of user %s expired", s.User)
+	}
+	return &s, nil
+}
+
+func (a *sessionAuthenticator) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// ServeHTTP serves the login form and creates a session when a valid token is submitted.
+func (a *sessionAuthenticator) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == logoutPath {
+		http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Path: "/", MaxAge: -1, HttpOnly: true, Secure: req.TLS != nil})
+		http.Redirect(w, req, loginPath, http.StatusFound)
+		return
+	}
+	redirect := safeRedirectPath(req.FormValue("rd"))
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		a.renderLoginPage(w, req, redirect, http.StatusOK, "")
+	case http.MethodPost:
+		tokenReq := req.Clone(req.Context())
+		tokenReq.Header = http.Header{"Authorization": []string{"Bearer " + req.PostFormValue("token")}}
+		u, ok := a.authenticateToken(tokenReq)
+		if !ok {
+			a.logger.WithField("host", req.Host).WithField("client", req.RemoteAddr).Warn("ingress login failed")
+			a.renderLoginPage(w, req, redirect, http.StatusUnauthorized, "Invalid token")
+			return
+		}
+		expires := time.Now().Add(sessionDuration)
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookieName,
+			Value:    a.encodeSession(session{User: u.GetName(), Groups: u.GetGroups(), Expires: expires.Unix()}),
+			Path:     "/",
+			Expires:  expires,
+			HttpOnly: true,
+			Secure:   req.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, req, redirect, http.StatusSeeOther)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *sessionAuthenticator) renderLoginPage(w http.ResponseWriter, req *http.Request, redirect string, status int, errMsg string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	err := loginPage.Execute(w, map[string]string{
+		"Action":   loginPath,
+		"Host":     req.Host,
+		"Redirect": redirect,
+		"Error":    errMsg,
+	})
+	if err != nil {
+		a.logger.WithError(err).Warn("failed to render login page")
+	}
+}
+
+// safeRedirectPath returns the given path if it is local to the host, otherwise the root path.
+func safeRedirectPath(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+		return "/"
+	}
+	return p
+}
+
+// ingressAuth requires the requests to an ingress route to be authenticated by a user of one of the allowed groups, if any.
+type ingressAuth struct {
+	sessions *sessionAuthenticator
+	groups   []string
+}
+
+// authorize returns the authenticated user or writes a response that rejects the request.
+// Browsers are redirected to the login form.
+func (a *ingressAuth) authorize(w http.ResponseWriter, req *http.Request) (user.Info, bool) {
+	u, ok := a.sessions.authenticate(req)
+	if !ok {
+		if (req.Method == http.MethodGet || req.Method == http.MethodHead) && strings.Contains(req.Header.Get("Accept"), "text/html") {
+			http.Redirect(w, req, fmt.Sprintf("%s?rd=%s", loginPath, url.QueryEscape(req.URL.RequestURI())), http.StatusFound)
+			return nil, false
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="kubemate"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil, false
+	}
+	if len(a.groups) > 0 && !slices.ContainsFunc(u.GetGroups(), func(g string) bool { return slices.Contains(a.groups, g) }) {
+		a.sessions.logger.WithField("host", req.Host).WithField("user", u.GetName()).Debug("rejecting user since it is not member of any allowed group")
+		w.WriteHeader(http.StatusForbidden)
+		return nil, false
+	}
+	return u, true
+}
+
+// parseAuthAnnotations returns the auth config for the given auth and auth-groups annotation values or nil if no auth is required.
+// An invalid auth value requires authentication nevertheless.
+func parseAuthAnnotations(value, groups string, sessions *sessionAuthenticator) (*ingressAuth, error) {
+	var err error
+	switch strings.ToLower(value) {
+	case "", "none":
+		if groups == "" {
+			return nil, nil
+		}
+	case authRequired:
+	default:
+		err = fmt.Errorf("unsupported auth annotation value %q, supported values are %s and none", value, authRequired)
+	}
+	a := &ingressAuth{sessions: sessions}
+	for _, g := range strings.Split(groups, ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			a.groups = append(a.groups, g)
+		}
+	}
+	return a, err
+}
+
+// setForwardedUser passes the authenticated user to the backend without the client's credentials.
+// The session cookie as well as the user headers the client may have spoofed are removed from every request.
+func setForwardedUser(req *http.Request, u user.Info) {
+	req.Header.Del(headerForwardedUser)
+	req.Header.Del(headerForwardedGroups)
+	removeCookie(req, sessionCookieName)
+	if u == nil {
+		return
+	}
+	if strings.HasPrefix(req.Header.Get("Authorization"), "Bearer ") {
+		req.Header.Del("Authorization")
+	}
+	req.Header.Set(headerForwardedUser, u.GetName())
+	if groups := u.GetGroups(); len(groups) > 0 {
+		req.Header.Set(headerForwardedGroups, strings.Join(groups, ","))
+	}
+}
+
+func removeCookie(req *http.Request, name string) {
+	if _, err := req.Cookie(name); err != nil {
+		return
+	}
+	cookies := req.Cookies()
+	req.Header.Del("Cookie")
+	for _, c := range cookies {
+		if c.Name != name {
+			req.AddCookie(c)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package ingress
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+func newTestSessionAuthenticator() *sessionAuthenticator {
+	return &sessionAuthenticator{
+		authenticator: authenticator.RequestFunc(func(req *http.Request) (*authenticator.Response, bool, error) {
+			switch req.Header.Get("Authorization") {
+			case "Bearer admintoken":
+				return &authenticator.Response{User: &user.DefaultInfo{Name: "admin", Groups: []string{"admin"}}}, true, nil
+			case "Bearer guesttoken":
+				return &authenticator.Response{User: &user.DefaultInfo{Name: "guest", Groups: []string{"guests"}}}, true, nil
+			case "Bearer agenttoken":
+				return &authenticator.Response{User: &user.DefaultInfo{Name: "agent", Groups: []string{"kubemate-agents"}}}, true, nil
+			}
+			return &authenticator.Response{User: &user.DefaultInfo{Name: user.Anonymous, Groups: []string{user.AllUnauthenticated}}}, true, nil
+		}),
+		deniedGroups: []string{"kubemate-agents"},
+		key:          newSessionKey(),
+		logger:       logrus.NewEntry(logrus.New()),
+	}
+}
+
+func TestSessionCookie(t *testing.T) {
+	a := newTestSessionAuthenticator()
+	v := a.encodeSession(session{User: "admin", Groups: []string{"admin"}, Expires: 4102444800})
+	s, err := a.decodeSession(v)
+	require.NoError(t, err, "decode")
+	require.Equal(t, &session{User: "admin", Groups: []string{"admin"}, Expires: 4102444800}, s)
+
+	tampered := a.encodeSession(session{User: "guest", Expires: 4102444800})
+	_, sig, _ := strings.Cut(v, ".")
+	payload, _, _ := strings.Cut(tampered, ".")
+	_, err = a.decodeSession(payload + "." + sig)
+	require.Error(t, err, "tampered")
+	_, err = a.decodeSession(a.encodeSession(session{User: "admin", Expires: 1}))
+	require.Error(t, err, "expired")
+	_, err = newTestSessionAuthenticator().decodeSession(v)
+	require.Error(t, err, "other key")
+}
+
+func TestIngressAuthLogin(t *testing.T) {
+	a := newTestSessionAuthenticator()
+	auth := &ingressAuth{sessions: a}
+
+	req := httptest.NewRequest(http.MethodGet, "https://app.kube.m8/docs?page=1", nil)
+	req.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+	_, ok := auth.authorize(w, req)
+	require.False(t, ok, "browser request without session")
+	require.Equal(t, http.StatusFound, w.Code)
+	require.Equal(t, loginPath+"?rd=%2Fdocs%3Fpage%3D1", w.Header().Get("Location"))
+
+	w = httptest.NewRecorder()
+	_, ok = auth.authorize(w, httptest.NewRequest(http.MethodPost, "https://app.kube.m8/api", nil))
+	require.False(t, ok, "api request without token")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	form := url.Values{"token": {"invalidtoken"}, "rd": {"/docs?page=1"}}
+	req = httptest.NewRequest(http.MethodPost, "https://app.kube.m8"+loginPath, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	a.ServeHTTP(w, req)
+	require.Equal(t, http.StatusUnauthorized, w.Code, "login with anonymous token")
+	require.Empty(t, w.Result().Cookies(), "cookies after failed login")
+
+	form.Set("token", "admintoken")
+	req = httptest.NewRequest(http.MethodPost, "https://app.kube.m8"+loginPath, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	a.ServeHTTP(w, req)
+	require.Equal(t, http.StatusSeeOther, w.Code, "login")
+	require.Equal(t, "/docs?page=1", w.Header().Get("Location"))
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1, "session cookies")
+	require.True(t, cookies[0].HttpOnly && cookies[0].Secure, "cookie should be http-only and secure")
+
+	req = httptest.NewRequest(http.MethodGet, "https://app.kube.m8/docs", nil)
+	req.AddCookie(cookies[0])
+	u, ok := auth.authorize(httptest.NewRecorder(), req)
+	require.True(t, ok, "request with session")
+	require.Equal(t, "admin", u.GetName())
+}
+
+func TestIngressAuthGroups(t *testing.T) {
+	for _, c := range []struct {
+		token    string
+		groups   []string
+		expected int
+	}{
+		{token: "admintoken", groups: []string{"admin"}, expected: http.StatusOK},
+		{token: "guesttoken", groups: []string{"admin"}, expected: http.StatusForbidden},
+		{token: "invalidtoken", groups: []string{"admin"}, expected: http.StatusUnauthorized},
+		{token: "guesttoken", expected: http.StatusOK},
+		{token: "agenttoken", expected: http.StatusUnauthorized},
+	} {
+		t.Run(fmt.Sprintf("%s/%v", c.token, c.groups), func(t *testing.T) {
+			auth := &ingressAuth{sessions: newTestSessionAuthenticator(), groups: c.groups}
+			req := httptest.NewRequest(http.MethodGet, "https://app.kube.m8/", nil)
+			req.Header.Set("Authorization", "Bearer "+c.token)
+			w := httptest.NewRecorder()
+			_, ok := auth.authorize(w, req)
+			require.Equal(t, c.expected == http.StatusOK, ok)
+			require.Equal(t, c.expected, w.Code)
+		})
+	}
+}
+
+func TestSetForwardedUser(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "https://app.kube.m8/", nil)
+	req.Header.Set("Authorization", "Bearer admintoken")
+	req.Header.Set(headerForwardedUser, "spoofed")
+	req.Header.Set("Cookie", "app=1; kubemate_session=abc; lang=en")
+	setForwardedUser(req, &user.DefaultInfo{Name: "admin", Groups: []string{"admin", "system:authenticated"}})
+	require.Equal(t, http.Header{
+		headerForwardedUser:   {"admin"},
+		headerForwardedGroups: {"admin,system:authenticated"},
+		"Cookie":              {"app=1; lang=en"},
+	}, req.Header)
+
+	req = httptest.NewRequest(http.MethodGet, "https://app.kube.m8/", nil)
+	req.Header.Set(headerForwardedUser, "spoofed")
+	req.Header.Set(headerForwardedGroups, "admin")
+	setForwardedUser(req, nil)
+	require.Empty(t, req.Header, "should remove spoofed headers")
+}
+
+func TestParseAuthAnnotations(t *testing.T) {
+	for _, c := range []struct {
+		auth     string
+		groups   string
+		required bool
+		expected []string
+		err      bool
+	}{
+		{},
+		{auth: "none"},
+		{auth: "required", required: true},
+		{auth: "Required", groups: "admin, family,", required: true, expected: []string{"admin", "family"}},
+		{groups: "admin", required: true, expected: []string{"admin"}},
+		{auth: "basic", required: true, err: true},
+	} {
+		t.Run(c.auth+"/"+c.groups, func(t *testing.T) {
+			a, err := parseAuthAnnotations(c.auth, c.groups, &sessionAuthenticator{})
+			if c.err {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, c.required, a != nil, "required")
+			if a != nil {
+				require.Equal(t, c.expected, a.groups, "groups")
+			}
+		})
+	}
+}
+
+func TestSafeRedirectPath(t *testing.T) {
+	for _, c := range []struct {
+		path     string
+		expected string
+	}{
+		{path: "/docs?page=1", expected: "/docs?page=1"},
+		{path: "", expected: "/"},
+		{path: "https://evil.example/", expected: "/"},
+		{path: "//evil.example/", expected: "/"},
+		{path: "/\\evil.example/", expected: "/"},
+	} {
+		require.Equal(t, c.expected, safeRedirectPath(c.path), c.path)
+	}
+}
@@ -0,0 +1,338 @@
+package ingress
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	netv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// loadBalanceRoundRobin distributes the requests evenly across the endpoints.
+	loadBalanceRoundRobin = "round-robin"
+	// loadBalanceLeastConn sends a request to the endpoint with the fewest active requests.
+	loadBalanceLeastConn = "least-conn"
+	// endpointFailTimeout is the time an endpoint is skipped after a request to it failed.
+	endpointFailTimeout = 10 * time.Second
+	// maxBackendAttempts is the maximum number of endpoints a request is sent to when the connection fails.
+	maxBackendAttempts = 3
+)
+
+var errNoEndpoint = errors.New("no backend endpoint available")
+
+var (
+	// httpTransport is shared by all plain HTTP routes in order to reuse the backend connections.
+	httpTransport = newBackendTransport(nil)
+	// httpsTransport is shared by all HTTPS routes. The backends' certificates are not verified since they are usually self-signed.
+	httpsTransport = newBackendTransport(&tls.Config{InsecureSkipVerify: true})
+)
+
+func newBackendTransport(tlsConfig *tls.Config) *http.Transport {
+	return &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   10 * time.Second,
+		MaxIdleConns:          256,
+		MaxIdleConnsPerHost:   32,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// backendPools holds the endpoints of the service ports the ingress resources refer to.
+// The pools are kept across route updates in order to retain the endpoints' health and connection counts.
+type backendPools struct {
+	pools map[string]*backendPool
+	mutex sync.Mutex
+}
+
+func newBackendPools() *backendPools {
+	return &backendPools{pools: map[string]*backendPool{}}
+}
+
+// get returns the pool with the given key, creating it if it does not exist.
+func (p *backendPools) get(key string) *backendPool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	pool, ok := p.pools[key]
+	if !ok {
+		pool = &backendPool{unhealthy: map[string]time.Time{}}
+		p.pools[key] = pool
+	}
+	return pool
+}
+
+// retain removes all pools except the given ones.
+func (p *backendPools) retain(keys map[string]struct{}) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for k := range p.pools {
+		if _, ok := keys[k]; !ok {
+			delete(p.pools, k)
+		}
+	}
+}
+
+// backendPool balances the requests across the ready endpoints of a service port.
+type backendPool struct {
+	endpoints []*backendEndpoint
+	// unhealthy maps the endpoints to the time a request to them failed at.
+	unhealthy map[string]time.Time
+	next      uint64
+	mutex     sync.Mutex
+}
+
+type backendEndpoint struct {
+	// Host is the address and port of the endpoint.
+	Host   string
+	active atomic.Int64
+}
+
+// setEndpoints replaces the endpoints, retaining the state of those that still exist.
+func (p *backendPool) setEndpoints(hosts []string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	existing := make(map[string]*backendEndpoint, len(p.endpoints))
+	for _, e := range p.endpoints {
+		existing[e.Host] = e
+	}
+	endpoints := make([]*backendEndpoint, len(hosts))
+	for i, host := range hosts {
+		e, ok := existing[host]
+		if !ok {
+			e = &backendEndpoint{Host: host}
+		}
+		endpoints[i] = e
+		delete(existing, host)
+	}
+	for host := range existing {
+		delete(p.unhealthy, host)
+	}
+	p.endpoints = endpoints
+}
+
+// pick selects an endpoint using the given policy, skipping the excluded and the recently failed endpoints.
+// When all endpoints failed recently, it picks one of them nevertheless.
+func (p *backendPool) pick(policy string, exclude map[string]struct{}) (*backendEndpoint, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	now := time.Now()
+	candidates := make([]*backendEndpoint, 0, len(p.endpoints))
+	var failed []*backendEndpoint
+	for _, e := range p.endpoints {
+		if _, ok := exclude[e.Host]; ok {
+			continue
+		}
+		if failedAt, ok := p.unhealthy[e.Host]; ok {
+			if now.Sub(failedAt) < endpointFailTimeout {
+				failed = append(failed, e)
+				continue
+			}
+			delete(p.unhealthy, e.Host)
+		}
+		candidates = append(candidates, e)
+	}
+	if len(candidates) == 0 {
+		candidates = failed
+	}
+	if len(candidates) == 0 {
+		return nil, errNoEndpoint
+	}
+	offset := int(p.next % uint64(len(candidates)))
+	p.next++
+	if policy != loadBalanceLeastConn {
+		return candidates[offset], nil
+	}
+	// Start at the round-robin offset in order to distribute the requests among endpoints with equal load.
+	var selected *backendEndpoint
+	for i := range candidates {
+		e := candidates[(offset+i)%len(candidates)]
+		if selected == nil || e.active.Load() < selected.active.Load() {
+			selected = e
+		}
+	}
+	return selected, nil
+}
+
+func (p *backendPool) markFailed(e *backendEndpoint) {
+	p.mutex.Lock()
+	p.unhealthy[e.Host] = time.Now()
+	p.mutex.Unlock()
+}
+
+func (p *backendPool) markSucceeded(e *backendEndpoint) {
+	p.mutex.Lock()
+	delete(p.unhealthy, e.Host)
+	p.mutex.Unlock()
+}
+
+// balancingTransport sends a request to an endpoint of the pool, retrying another endpoint when the connection cannot be established.
+type balancingTransport struct {
+	pool      *backendPool
+	policy    string
+	transport http.RoundTripper
+}
+
+func (t *balancingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tried := map[string]struct{}{}
+	var lastErr error
+	for attempt := 0; attempt < maxBackendAttempts; attempt++ {
+		e, err := t.pool.pick(t.policy, tried)
+		if err != nil {
+			if lastErr != nil {
+				return nil, lastErr
+			}
+			return nil, err
+		}
+		tried[e.Host] = struct{}{}
+		req.URL.Host = e.Host
+		e.active.Add(1)
+		resp, err := t.transport.RoundTrip(req)
+		if err != nil {
+			e.active.Add(-1)
+			if req.Context().Err() != nil {
+				return nil, err
+			}
+			t.pool.markFailed(e)
+			lastErr = err
+			// The request has not been sent when the connection could not be established.
+			// It can be retried unless the transport consumed its body.
+			if isConnectError(err) && (req.Body == nil || req.Body == http.NoBody) {
+				continue
+			}
+			return nil, err
+		}
+		t.pool.markSucceeded(e)
+		resp.Body = newActiveRequestBody(resp.Body, &e.active)
+		return resp, nil
+	}
+	return nil, lastErr
+}
+
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// newActiveRequestBody decrements the endpoint's active request count when the response body is closed.
+// It retains the body's write capability which the reverse proxy requires for upgraded connections.
+func newActiveRequestBody(body io.ReadCloser, active *atomic.Int64) io.ReadCloser {
+	b := &activeRequestBody{ReadCloser: body, active: active}
+	if rw, ok := body.(io.ReadWriteCloser); ok {
+		return &activeUpgradedBody{activeRequestBody: b, w: rw}
+	}
+	return b
+}
+
+type activeRequestBody struct {
+	io.ReadCloser
+	active *atomic.Int64
+	once   sync.Once
+}
+
+func (b *activeRequestBody) Close() error {
+	b.once.Do(func() {
+		b.active.Add(-1)
+	})
+	return b.ReadCloser.Close()
+}
+
+type activeUpgradedBody struct {
+	*activeRequestBody
+	w io.Writer
+}
+
+func (b *activeUpgradedBody) Write(p []byte) (int, error) {
+	return b.w.Write(p)
+}
+
+// loadBalancePolicy maps the value of a load-balance annotation to a policy.
+// It accepts nginx' underscore notation as well.
+func loadBalancePolicy(value string) (string, error) {
+	switch strings.ReplaceAll(strings.ToLower(value), "_", "-") {
+	case "", loadBalanceRoundRobin:
+		return loadBalanceRoundRobin, nil
+	case loadBalanceLeastConn:
+		return loadBalanceLeastConn, nil
+	default:
+		return loadBalanceRoundRobin, fmt.Errorf("unsupported load-balance annotation value %q, supported values are %s and %s", value, loadBalanceRoundRobin, loadBalanceLeastConn)
+	}
+}
+
+// serviceEndpoints returns the addresses of the ready endpoints of the given service port, listed within the service's EndpointSlices.
+func serviceEndpoints(ctx context.Context, svc *netv1.IngressServiceBackend, ns string, c client.Client) ([]string, error) {
+	var service corev1.Service
+	err := c.Get(ctx, types.NamespacedName{Namespace: ns, Name: svc.Name}, &service)
+	if err != nil {
+		return nil, err
+	}
+	servicePort := findServicePort(svc.Port, service.Spec.Ports)
+	if servicePort == nil {
+		return nil, fmt.Errorf("service %s/%s does not expose the port specified by the ingress backend", ns, svc.Name)
+	}
+	var slices discoveryv1.EndpointSliceList
+	err = c.List(ctx, &slices, client.InNamespace(ns), client.MatchingLabels{discoveryv1.LabelServiceName: svc.Name})
+	if err != nil {
+		return nil, err
+	}
+	return readyEndpoints(slices.Items, servicePort.Name), nil
+}
+
+func findServicePort(port netv1.ServiceBackendPort, ports []corev1.ServicePort) *corev1.ServicePort {
+	for i, p := range ports {
+		if (port.Number != 0 && p.Port == port.Number) || (port.Name != "" && p.Name == port.Name) {
+			return &ports[i]
+		}
+	}
+	return nil
+}
+
+// readyEndpoints returns the sorted addresses of the ready endpoints of the named port.
+func readyEndpoints(slices []discoveryv1.EndpointSlice, portName string) []string {
+	hosts := map[string]struct{}{}
+	for _, s := range slices {
+		var port int32
+		for _, p := range s.Ports {
+			name := ""
+			if p.Name != nil {
+				name = *p.Name
+			}
+			if name == portName && p.Port != nil {
+				port = *p.Port
+				break
+			}
+		}
+		if port == 0 {
+			continue
+		}
+		for _, e := range s.Endpoints {
+			if e.Conditions.Ready != nil && !*e.Conditions.Ready || len(e.Addresses) == 0 {
+				continue
+			}
+			hosts[net.JoinHostPort(e.Addresses[0], fmt.Sprintf("%d", port))] = struct{}{}
+		}
+	}
+	r := make([]string, 0, len(hosts))
+	for h := range hosts {
+		r = append(r, h)
+	}
+	sort.Strings(r)
+	return r
+}
@@ -0,0 +1,130 @@
+package ingress
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	discoveryv1 "k8s.io/api/discovery/v1"
+)
+
+func TestBackendPoolRoundRobin(t *testing.T) {
+	p := newBackendPools().get("pool")
+	p.setEndpoints([]string{"10.0.0.1:80", "10.0.0.2:80", "10.0.0.3:80"})
+	var picked []string
+	for i := 0; i < 4; i++ {
+		e, err := p.pick(loadBalanceRoundRobin, nil)
+		require.NoError(t, err)
+		picked = append(picked, e.Host)
+	}
+	require.Equal(t, []string{"10.0.0.1:80", "10.0.0.2:80", "10.0.0.3:80", "10.0.0.1:80"}, picked)
+}
+
+func TestBackendPoolLeastConn(t *testing.T) {
+	p := newBackendPools().get("pool")
+	p.setEndpoints([]string{"10.0.0.1:80", "10.0.0.2:80"})
+	p.endpoints[0].active.Store(2)
+	for i := 0; i < 2; i++ {
+		e, err := p.pick(loadBalanceLeastConn, nil)
+		require.NoError(t, err)
+		require.Equal(t, "10.0.0.2:80", e.Host)
+	}
+}
+
+func TestBackendPoolPassiveHealthCheck(t *testing.T) {
+	p := newBackendPools().get("pool")
+	p.setEndpoints([]string{"10.0.0.1:80", "10.0.0.2:80"})
+	p.markFailed(p.endpoints[0])
+	for i := 0; i < 2; i++ {
+		e, err := p.pick(loadBalanceRoundRobin, nil)
+		require.NoError(t, err)
+		require.Equal(t, "10.0.0.2:80", e.Host, "should skip failed endpoint")
+	}
+	e, err := p.pick(loadBalanceRoundRobin, map[string]struct{}{"10.0.0.2:80": {}})
+	require.NoError(t, err)
+	require.Equal(t, "10.0.0.1:80", e.Host, "should fall back to failed endpoint")
+
+	p.setEndpoints([]string{"10.0.0.2:80"})
+	require.Empty(t, p.unhealthy, "should forget removed endpoints")
+	p.setEndpoints(nil)
+	_, err = p.pick(loadBalanceRoundRobin, nil)
+	require.ErrorIs(t, err, errNoEndpoint)
+}
+
+func TestBalancingTransportRetry(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	unreachable := l.Addr().String()
+	l.Close()
+	reachable, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	p := newBackendPools().get("pool")
+	p.setEndpoints([]string{unreachable, reachable.Host})
+	tr := &balancingTransport{pool: p, policy: loadBalanceRoundRobin, transport: newBackendTransport(nil)}
+	req := httptest.NewRequest(http.MethodGet, "http://backend/", nil)
+	req.RequestURI = ""
+	req.Body = nil
+	resp, err := tr.RoundTrip(req)
+	require.NoError(t, err)
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "ok", string(b))
+	require.Equal(t, int64(1), p.endpoints[1].active.Load(), "active requests before body close")
+	resp.Body.Close()
+	require.Equal(t, int64(0), p.endpoints[1].active.Load(), "active requests after body close")
+	require.Contains(t, p.unhealthy, unreachable, "unreachable endpoint should be marked failed")
+}
+
+func TestLoadBalancePolicy(t *testing.T) {
+	for _, c := range []struct {
+		value    string
+		expected string
+		err      bool
+	}{
+		{value: "", expected: loadBalanceRoundRobin},
+		{value: "least-conn", expected: loadBalanceLeastConn},
+		{value: "least_conn", expected: loadBalanceLeastConn},
+		{value: "round_robin", expected: loadBalanceRoundRobin},
+		{value: "ewma", expected: loadBalanceRoundRobin, err: true},
+	} {
+		t.Run(c.value, func(t *testing.T) {
+			policy, err := loadBalancePolicy(c.value)
+			require.Equal(t, c.expected, policy)
+			if c.err {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestReadyEndpoints(t *testing.T) {
+	ready, notReady := true, false
+	httpName, metricsName := "http", "metrics"
+	port8080, port9090 := int32(8080), int32(9090)
+	slices := []discoveryv1.EndpointSlice{
+		{
+			Ports: []discoveryv1.EndpointPort{{Name: &httpName, Port: &port8080}, {Name: &metricsName, Port: &port9090}},
+			Endpoints: []discoveryv1.Endpoint{
+				{Addresses: []string{"10.42.0.12"}, Conditions: discoveryv1.EndpointConditions{Ready: &ready}},
+				{Addresses: []string{"10.42.0.11"}},
+				{Addresses: []string{"10.42.0.13"}, Conditions: discoveryv1.EndpointConditions{Ready: &notReady}},
+			},
+		},
+		{
+			Ports:     []discoveryv1.EndpointPort{{Name: &httpName, Port: &port8080}},
+			Endpoints: []discoveryv1.Endpoint{{Addresses: []string{"fd00::1"}}},
+		},
+	}
+	require.Equal(t, []string{"10.42.0.11:8080", "10.42.0.12:8080", "[fd00::1]:8080"}, readyEndpoints(slices, "http"))
+	require.Empty(t, readyEndpoints(slices, "https"), "unknown port")
+}
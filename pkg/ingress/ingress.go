@@ -3,7 +3,7 @@ package ingress
 import (
 	"bufio"
 	"context"
-	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -13,14 +13,18 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/mgoltzsche/kubemate/pkg/localca"
 	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	netv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/user"
 	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
@@ -33,16 +37,39 @@ func NewIngressController(ingressClass string, fallbackHandler http.Handler, log
 		ingressClass:    ingressClass,
 		fallbackHandler: fallbackHandler,
 		logger:          logger,
+		pools:           newBackendPools(),
+		sessionKey:      newSessionKey(),
+		streams:         newStreamProxies(logger),
 	}
 	c.setEmptyRouter()
 	return c
 }
 
 type IngressController struct {
+	// DeviceName is the device's host name, which the ingress resources must not specify a certificate for, neither within the local DNS zone.
+	DeviceName string
+	// LocalCA issues the certificates of the ingress hosts within the local DNS zone that do not specify a TLS secret.
+	LocalCA *localca.CA
+	// LocalZone returns the local DNS zone.
+	LocalZone func() string
+	// ExternalIPs returns the device IPs that are written into the status of the served Ingress resources.
+	ExternalIPs func() ([]net.IP, error)
+	// Hostname returns the device's host name that is written into the status of the served Ingress resources.
+	Hostname func() string
+	// Authenticator authenticates the users logging in to the ingress routes that require authentication.
+	// It should accept user accounts only.
+	Authenticator authenticator.Request
+	// DeniedGroups lists the groups of the identities that must not log in to the ingress routes, e.g. the agents.
+	DeniedGroups []string
+	// ReservedPorts are the device ports kubemate listens on, which stream routes must not use.
+	ReservedPorts   []int32
 	ingressClass    string
-	router          *router
+	router          atomic.Pointer[router]
 	fallbackHandler http.Handler
 	logger          *logrus.Entry
+	pools           *backendPools
+	sessionKey      []byte
+	streams         *streamProxies
 	mutex           sync.Mutex
 	started         bool
 }
@@ -56,8 +83,9 @@ func (s *IngressController) Start() {
 	s.started = true
 	s.logger.Info("start watching ingress resources")
 	ctx, cancel := context.WithCancel(context.Background())
-	prevCancel := s.router.Cancel
-	s.router.Cancel = func() {
+	r := s.router.Load()
+	prevCancel := r.Cancel
+	r.Cancel = func() {
 		prevCancel()
 		cancel()
 	}
@@ -89,17 +117,33 @@ func (s *IngressController) start(ctx context.Context, cancel, prevCancel contex
 	handler := mux.NewRouter()
 	handler.NotFoundHandler = s.fallbackHandler
 	r := &router{
-		Handler:         handler,
 		fallbackHandler: s.fallbackHandler,
 		ingressClass:    s.ingressClass,
+		localZone:       s.localZone,
+		reservedPorts:   s.ReservedPorts,
 		ctx:             ctx,
 		client:          cl.GetClient(),
 		logger:          s.logger,
 		Cancel:          cancel,
+		pools:           s.pools,
+		streams:         s.streams,
+		sessions: &sessionAuthenticator{
+			authenticator: s.Authenticator,
+			deniedGroups:  s.DeniedGroups,
+			key:           s.sessionKey,
+			logger:        s.logger,
+		},
+		reporter: &ingressReporter{
+			client:    cl.GetClient(),
+			recorder:  cl.GetEventRecorderFor("kubemate-ingress"),
+			addresses: s.loadBalancerIngress,
+			logger:    s.logger,
+		},
 	}
+	r.routes.Store(&ingressRoutes{handler: handler, hosts: newIngressHosts()})
 	c := cl.GetCache()
 	ch := make(chan struct{}, 10)
-	for _, o := range []client.Object{&netv1.Ingress{}, &corev1.Service{}, &corev1.Endpoints{}} {
+	for _, o := range []client.Object{&netv1.Ingress{}, &corev1.Service{}, &discoveryv1.EndpointSlice{}, &corev1.Secret{}, &corev1.ConfigMap{}} {
 		var inf cache.Informer
 		inf, err = c.GetInformer(ctx, o)
 		if err != nil {
@@ -129,7 +173,7 @@ func (s *IngressController) start(ctx context.Context, cancel, prevCancel contex
 	prevCancel()
 	c.WaitForCacheSync(ctx)
 	r.Update()
-	s.router = r
+	s.router.Store(r)
 	return <-resultCh
 }
 
@@ -138,50 +182,99 @@ func (s *IngressController) Stop() {
 	defer s.mutex.Unlock()
 	if s.started {
 		s.logger.Info("stopping watching ingress resources")
-		s.router.Cancel()
+		s.router.Load().Cancel()
+		s.streams.Close()
 		s.setEmptyRouter()
 		s.started = false
 	}
 }
 
 func (s *IngressController) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	s.router.ServeHTTP(w, req)
+	s.router.Load().ServeHTTP(w, req)
+}
+
+// loadBalancerIngress returns the addresses the ingress controller is reachable at.
+func (s *IngressController) loadBalancerIngress() []netv1.IngressLoadBalancerIngress {
+	var ips []net.IP
+	if s.ExternalIPs != nil {
+		var err error
+		ips, err = s.ExternalIPs()
+		if err != nil {
+			s.logger.WithError(err).Warn("failed to determine external ips for the ingress status")
+		}
+	}
+	hostname := ""
+	if s.Hostname != nil {
+		hostname = s.Hostname()
+	}
+	return loadBalancerIngress(ips, hostname)
 }
 
 func (s *IngressController) setEmptyRouter() {
 	r := mux.NewRouter()
 	r.NotFoundHandler = s.fallbackHandler
-	s.router = &router{
-		Handler: r,
-		Cancel:  func() {},
-	}
+	empty := &router{Cancel: func() {}}
+	empty.routes.Store(&ingressRoutes{handler: r, hosts: newIngressHosts()})
+	s.router.Store(empty)
 }
 
+// router serves the routes of the ingress resources, rebuilding them when the resources change.
+// The routes are published atomically since requests and TLS handshakes read them concurrently.
 type router struct {
-	http.Handler
+	routes          atomic.Pointer[ingressRoutes]
 	fallbackHandler http.Handler
 	ingressClass    string
+	localZone       func() string
+	reservedPorts   []int32
 	ctx             context.Context
 	client          client.Client
 	logger          *logrus.Entry
 	Cancel          context.CancelFunc
+	pools           *backendPools
+	streams         *streamProxies
+	sessions        *sessionAuthenticator
+	reporter        *ingressReporter
 }
 
 func (r *router) Update() {
 	r.logger.Debug("reconciling ingress routes")
-	h, err := newRouter(r.ctx, r.client, r.ingressClass, r.fallbackHandler, r.logger)
+	report := newIngressReport(r.logger)
+	h, hosts, err := newRouter(r.ctx, r.client, r.ingressClass, r.fallbackHandler, r.localZone, r.pools, r.sessions, report, r.logger)
 	if err != nil {
 		r.logger.Error(err)
 		return
 	}
-	r.Handler = h
+	r.routes.Store(&ingressRoutes{handler: h, hosts: hosts})
+	err = r.streams.sync(r.ctx, r.client, r.reservedPorts, report)
+	if err != nil {
+		r.logger.WithError(err).Error("failed to sync stream routes")
+	}
+	r.reporter.report(r.ctx, report)
 }
 
-func newRouter(ctx context.Context, c client.Client, ingressClass string, fallbackHandler http.Handler, logger *logrus.Entry) (http.Handler, error) {
+// ingressRoutes is a snapshot of the request handler and hosts of the ingress resources.
+type ingressRoutes struct {
+	handler http.Handler
+	hosts   *ingressHosts
+}
+
+func (r *router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.routes.Load().handler.ServeHTTP(w, req)
+}
+
+// hosts returns the hosts of the current ingress routes.
+func (r *router) hosts() *ingressHosts {
+	return r.routes.Load().hosts
+}
+
+// newRouter builds the routes of all Ingress resources of the given class.
+// An Ingress that specifies a host path another Ingress specifies already is skipped entirely, while an invalid path is skipped individually.
+// The paths of a rule with a host take precedence over the paths of rules without a host.
+func newRouter(ctx context.Context, c client.Client, ingressClass string, fallbackHandler http.Handler, localZone func() string, pools *backendPools, sessions *sessionAuthenticator, report *ingressReport, logger *logrus.Entry) (http.Handler, *ingressHosts, error) {
 	ingresses := netv1.IngressList{}
 	err := c.List(ctx, &ingresses)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	ingressKeys := make([]string, 0, len(ingresses.Items))
 	ingressMap := map[string]netv1.Ingress{}
@@ -193,15 +286,25 @@ func newRouter(ctx context.Context, c client.Client, ingressClass string, fallba
 		}
 	}
 	sort.Strings(ingressKeys)
-	rootMux := mux.NewRouter()
-	rootMux.NotFoundHandler = fallbackHandler
+	defaultMux := mux.NewRouter()
+	defaultMux.NotFoundHandler = fallbackHandler
 	hosts := map[string]*mux.Router{}
+	ingressHosts := newIngressHosts()
+	usedPools := map[string]struct{}{}
 	paths := make(map[string]string, len(ingressKeys))
 	for _, k := range ingressKeys {
 		ing := ingressMap[k]
+		report.add(&ing)
+		if hostPath, otherIngressKey, dup := findDuplicatePath(&ing, paths); dup {
+			report.warn(&ing, eventReasonDuplicatePath, "ignoring ingress since path %s is specified by ingress %s already", hostPath, otherIngressKey)
+			report.skip(&ing)
+			continue
+		}
 		headers := http.Header{}
 		rewriteTargetPath := ""
 		backendProtocol := "http"
+		loadBalance := loadBalanceRoundRobin
+		var auth *ingressAuth
 		if ing.Annotations != nil {
 			rewriteTargetPath = ing.Annotations["kubemate.mgoltzsche.github.com/rewrite-target"]
 			if rewriteTargetPath == "" {
@@ -218,83 +321,154 @@ func newRouter(ctx context.Context, c client.Client, ingressClass string, fallba
 			if headersStr != "" {
 				values, err := url.ParseQuery(headersStr)
 				if err != nil {
-					// TODO: emit kubernetes event / set Ingress status
-					logger.WithField("resource", k).WithError(err).
-						Warn(fmt.Sprintf("invalid set-headers annotation value %q specified with ingress %s, expects URL query param syntax", headersStr, k))
+					report.warn(&ing, eventReasonInvalidAnnotation, "invalid set-headers annotation value %q, expects URL query param syntax: %s", headersStr, err)
 				}
 				headers = http.Header(values)
 			}
+			lb := ing.Annotations["kubemate.mgoltzsche.github.com/load-balance"]
+			if lb == "" {
+				lb = ing.Annotations["nginx.ingress.kubernetes.io/load-balance"]
+			}
+			loadBalance, err = loadBalancePolicy(lb)
+			if err != nil {
+				report.warn(&ing, eventReasonInvalidAnnotation, "%s", err)
+			}
+			auth, err = parseAuthAnnotations(ing.Annotations["kubemate.mgoltzsche.github.com/auth"], ing.Annotations["kubemate.mgoltzsche.github.com/auth-groups"], sessions)
+			if err != nil {
+				report.warn(&ing, eventReasonInvalidAnnotation, "%s", err)
+			}
 		}
 		backendProtocol = strings.ToLower(backendProtocol)
 
 		for _, r := range ing.Spec.Rules {
-			m := rootMux
+			ingressHosts.addHost(r.Host)
+			m := defaultMux
 			if r.Host != "" {
-				m, ok := hosts[r.Host]
+				host := strings.ToLower(r.Host)
+				hostMux, ok := hosts[host]
 				if !ok {
-					m = mux.NewRouter()
-					rootMux.Host(r.Host).Handler(m)
-					hosts[r.Host] = m
+					hostMux = mux.NewRouter()
+					hosts[host] = hostMux
 				}
+				m = hostMux
+			}
+			if r.HTTP == nil {
+				continue
 			}
 			for _, p := range r.HTTP.Paths {
 				if err := validateIngressBackend(&p.Backend); err != nil {
-					logger.WithField("resource", k).Warn(err.Error())
+					report.warn(&ing, eventReasonInvalidBackend, "ignoring path %s%s: %s", r.Host, p.Path, err)
 					continue
 				}
-				hostPath := fmt.Sprintf("%s%s", r.Host, p.Path)
-				otherIngressKey, exists := paths[hostPath]
-				if exists {
-					// TODO: emit kubernetes event
-					return nil, fmt.Errorf("duplicate ingress endpoint %s, ingresses: %s and %s", hostPath, k, otherIngressKey)
+				if p.PathType != nil && *p.PathType != netv1.PathTypePrefix && *p.PathType != netv1.PathTypeImplementationSpecific && *p.PathType != netv1.PathTypeExact {
+					report.warn(&ing, eventReasonUnsupportedPathType, "ignoring path %s%s since it specifies the unsupported path type %q", r.Host, p.Path, *p.PathType)
+					continue
 				}
-				paths[hostPath] = k
-				backendURL, err := endpointURL(ctx, backendProtocol, p.Backend.Service, ing.Namespace, c)
+				paths[fmt.Sprintf("%s%s", r.Host, p.Path)] = k
+				endpoints, err := serviceEndpoints(ctx, p.Backend.Service, ing.Namespace, c)
 				if err != nil {
-					logger.WithField("resource", k).Warn(err.Error())
+					report.warn(&ing, eventReasonBackendNotFound, "ignoring path %s%s: %s", r.Host, p.Path, err)
 					continue
 				}
-				ph := httputil.NewSingleHostReverseProxy(backendURL)
+				if len(endpoints) == 0 {
+					report.warn(&ing, eventReasonNoEndpoints, "service %s has no ready endpoints", p.Backend.Service.Name)
+				}
+				svcPort := p.Backend.Service.Port.Name
+				if svcPort == "" {
+					svcPort = fmt.Sprintf("%d", p.Backend.Service.Port.Number)
+				}
+				poolKey := fmt.Sprintf("%s/%s/%s/%s", backendProtocol, ing.Namespace, p.Backend.Service.Name, svcPort)
+				pool := pools.get(poolKey)
+				pool.setEndpoints(endpoints)
+				usedPools[poolKey] = struct{}{}
+				// The host is replaced with the address of the endpoint the balancing transport selects.
+				ph := httputil.NewSingleHostReverseProxy(&url.URL{Scheme: backendProtocol, Host: p.Backend.Service.Name})
+				transport := httpTransport
 				if backendProtocol == "https" {
-					ph.Transport = &http.Transport{
-						Dial: (&net.Dialer{
-							Timeout:   30 * time.Second,
-							KeepAlive: 30 * time.Second,
-						}).Dial,
-						TLSClientConfig:     &tls.Config{InsecureSkipVerify: true},
-						TLSHandshakeTimeout: 10 * time.Second,
-					}
+					transport = httpsTransport
 				}
+				ph.Transport = &balancingTransport{pool: pool, policy: loadBalance, transport: transport}
+				ph.ErrorHandler = proxyErrorHandler(logger.WithField("ingress", k))
 				h := &ingressBackendHandler{
 					proxy:             ph,
 					targetPath:        p.Path,
 					rewriteTargetPath: rewriteTargetPath,
 					headers:           headers,
+					auth:              auth,
 					ingressName:       k,
 					serviceName:       p.Backend.Service.Name,
 					logger:            logger.WithField("ingress", k),
 				}
 				pattern := p.Path
-				if p.PathType == nil || *p.PathType == netv1.PathTypePrefix || *p.PathType == netv1.PathTypeImplementationSpecific {
-					pattern = fmt.Sprintf("%s**", p.Path)
-					m.PathPrefix(p.Path).Handler(h)
-				} else if *p.PathType == netv1.PathTypeExact {
+				if p.PathType != nil && *p.PathType == netv1.PathTypeExact {
 					m.Handle(p.Path, h)
 				} else {
-					logger.WithField("resource", k).Warnf("ignoring ingress resource since it specifies an unsupported path type %q", *p.PathType)
-					continue
+					pattern = fmt.Sprintf("%s**", p.Path)
+					m.PathPrefix(p.Path).Handler(h)
 				}
 				logger.
 					WithField("endpoint", fmt.Sprintf("%s%s", r.Host, pattern)).
 					Debug("registered ingress handler")
 			}
 		}
-		if len(ing.Spec.TLS) > 0 {
-			logger.WithField("resource", k).Warn("ignoring custom tls certificate for ingress resource")
+		zone := ""
+		if localZone != nil {
+			zone = strings.ToLower(localZone())
 		}
+		ingressHosts.addCertificates(ctx, &ing, zone, c, report)
+	}
+	pools.retain(usedPools)
+	rootMux := mux.NewRouter()
+	rootMux.NotFoundHandler = defaultMux
+	rootMux.Handle(loginPath, sessions)
+	rootMux.Handle(logoutPath, sessions)
+	hostNames := make([]string, 0, len(hosts))
+	for host := range hosts {
+		hostNames = append(hostNames, host)
 	}
-	// TODO: update ingress status
-	return rootMux, nil
+	// Register wildcard hosts last to let a specific host take precedence.
+	sort.Slice(hostNames, func(i, j int) bool {
+		wi, wj := strings.HasPrefix(hostNames[i], "*."), strings.HasPrefix(hostNames[j], "*.")
+		if wi != wj {
+			return wj
+		}
+		return hostNames[i] < hostNames[j]
+	})
+	for _, host := range hostNames {
+		rootMux.MatcherFunc(hostMatcher(host, localZone)).Handler(hosts[host])
+	}
+	return rootMux, ingressHosts, nil
+}
+
+// hostMatcher matches the requests sent to the given ingress host.
+func hostMatcher(host string, localZone func() string) mux.MatcherFunc {
+	return func(req *http.Request, _ *mux.RouteMatch) bool {
+		name := req.Host
+		if h, _, err := net.SplitHostPort(name); err == nil {
+			name = h
+		}
+		zone := ""
+		if localZone != nil {
+			zone = strings.ToLower(localZone())
+		}
+		return matchesHost(strings.ToLower(strings.TrimSuffix(name, ".")), host, zone)
+	}
+}
+
+// findDuplicatePath returns the first host path of the given Ingress that is registered by another Ingress already.
+func findDuplicatePath(ing *netv1.Ingress, paths map[string]string) (string, string, bool) {
+	for _, r := range ing.Spec.Rules {
+		if r.HTTP == nil {
+			continue
+		}
+		for _, p := range r.HTTP.Paths {
+			hostPath := fmt.Sprintf("%s%s", r.Host, p.Path)
+			if otherIngressKey, exists := paths[hostPath]; exists {
+				return hostPath, otherIngressKey, true
+			}
+		}
+	}
+	return "", "", false
 }
 
 func validateIngressBackend(b *netv1.IngressBackend) error {
@@ -313,45 +487,16 @@ func validateIngressBackend(b *netv1.IngressBackend) error {
 	return nil
 }
 
-func endpointURL(ctx context.Context, protocol string, svc *netv1.IngressServiceBackend, ns string, c client.Client) (*url.URL, error) {
-	var endpoints corev1.Endpoints
-	key := types.NamespacedName{
-		Name:      svc.Name,
-		Namespace: ns,
-	}
-	err := c.Get(ctx, key, &endpoints)
-	if err != nil {
-		return nil, err
-	}
-	portMatched := false
-	for _, s := range endpoints.Subsets {
-		port := findPort(svc.Port, s.Ports)
-		if port > 0 {
-			portMatched = true
-			for _, a := range s.Addresses {
-				if a.IP != "" {
-					u, err := url.Parse(fmt.Sprintf("%s://%s:%d", protocol, a.IP, port))
-					if err != nil {
-						return nil, fmt.Errorf("parse backend endpoint url: %w", err)
-					}
-					return u, nil
-				}
-			}
-		}
-	}
-	if portMatched {
-		return nil, fmt.Errorf("endpoint is not ready")
-	}
-	return nil, fmt.Errorf("port does not match endpoint")
-}
-
-func findPort(port netv1.ServiceBackendPort, ports []corev1.EndpointPort) int32 {
-	for _, p := range ports {
-		if p.Port == port.Number || p.Name == port.Name {
-			return p.Port
+// proxyErrorHandler responds with 503 when the backend has no ready endpoint and with 502 when it cannot be reached.
+func proxyErrorHandler(logger *logrus.Entry) func(http.ResponseWriter, *http.Request, error) {
+	return func(w http.ResponseWriter, req *http.Request, err error) {
+		status := http.StatusBadGateway
+		if errors.Is(err, errNoEndpoint) {
+			status = http.StatusServiceUnavailable
 		}
+		logger.WithField("host", req.Host).WithField("path", req.URL.Path).WithError(err).Warn("ingress backend request failed")
+		w.WriteHeader(status)
 	}
-	return -1
 }
 
 type ingressBackendHandler struct {
@@ -359,6 +504,7 @@ type ingressBackendHandler struct {
 	targetPath        string
 	rewriteTargetPath string
 	headers           http.Header
+	auth              *ingressAuth
 	ingressName       string
 	serviceName       string
 	logger            *logrus.Entry
@@ -366,6 +512,15 @@ type ingressBackendHandler struct {
 
 func (h *ingressBackendHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	startTime := time.Now()
+	var u user.Info
+	if h.auth != nil {
+		var ok bool
+		u, ok = h.auth.authorize(w, req)
+		if !ok {
+			return
+		}
+	}
+	setForwardedUser(req, u)
 	if h.rewriteTargetPath != "" {
 		req.URL.Path = path.Clean(fmt.Sprintf("%s%s", h.rewriteTargetPath, req.URL.Path[len(h.targetPath):]))
 	}
@@ -419,7 +574,11 @@ func newCachedClient(config *rest.Config) (cluster.Cluster, error) {
 	if err != nil {
 		return nil, err
 	}
-	corev1.AddToScheme(scheme)
+	err = corev1.AddToScheme(scheme)
+	if err != nil {
+		return nil, err
+	}
+	err = discoveryv1.AddToScheme(scheme)
 	if err != nil {
 		return nil, err
 	}
@@ -441,11 +600,31 @@ func (i *informer) OnUpdate(oldObj, newObj interface{}) {
 	newClientObj, ok2 := newObj.(client.Object)
 	// TODO: take changed annotations into account
 	if ok1 && ok2 && newClientObj.GetGeneration() > oldClientObj.GetGeneration() ||
-		mapToString(oldClientObj.GetAnnotations()) != mapToString(newClientObj.GetAnnotations()) {
+		mapToString(oldClientObj.GetAnnotations()) != mapToString(newClientObj.GetAnnotations()) ||
+		isTLSSecretChange(oldObj, newObj) || isStreamRoutesChange(oldObj, newObj) {
 		i.update()
 	}
 }
 
+// isTLSSecretChange returns true if the data of a TLS secret changed since secrets are not versioned by a generation.
+func isTLSSecretChange(oldObj, newObj interface{}) bool {
+	oldSecret, ok1 := oldObj.(*corev1.Secret)
+	newSecret, ok2 := newObj.(*corev1.Secret)
+	return ok1 && ok2 && newSecret.Type == corev1.SecretTypeTLS && oldSecret.ResourceVersion != newSecret.ResourceVersion
+}
+
+// isStreamRoutesChange returns true if the data of a ConfigMap that specifies stream routes changed since ConfigMaps are not versioned by a generation.
+func isStreamRoutesChange(oldObj, newObj interface{}) bool {
+	oldCM, ok1 := oldObj.(*corev1.ConfigMap)
+	newCM, ok2 := newObj.(*corev1.ConfigMap)
+	if !ok1 || !ok2 || oldCM.ResourceVersion == newCM.ResourceVersion {
+		return false
+	}
+	_, oldAnnotated := oldCM.Annotations[annotationStreamRoutes]
+	_, newAnnotated := newCM.Annotations[annotationStreamRoutes]
+	return oldAnnotated || newAnnotated
+}
+
 func (i *informer) OnDelete(obj interface{}) {
 	i.update()
 }
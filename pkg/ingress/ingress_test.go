@@ -0,0 +1,105 @@
+package ingress
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestNewRouterHosts(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = fmt.Fprint(w, req.Header.Get("X-Ingress"))
+	}))
+	defer backend.Close()
+	_, portStr, err := net.SplitHostPort(backend.Listener.Addr().String())
+	require.NoError(t, err)
+	port, err := strconv.Atoi(portStr)
+	require.NoError(t, err)
+	backendPort := int32(port)
+	scheme := runtime.NewScheme()
+	require.NoError(t, netv1.AddToScheme(scheme))
+	require.NoError(t, corev1.AddToScheme(scheme))
+	require.NoError(t, discoveryv1.AddToScheme(scheme))
+	objects := []client.Object{
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 80}}},
+		},
+		&discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", Labels: map[string]string{discoveryv1.LabelServiceName: "app"}},
+			Ports:      []discoveryv1.EndpointPort{{Port: &backendPort}},
+			Endpoints:  []discoveryv1.Endpoint{{Addresses: []string{"127.0.0.1"}}},
+		},
+	}
+	// The ingress names are sorted such that the ingress without host is processed first.
+	for _, ing := range []struct{ name, host string }{
+		{name: "a-default"},
+		{name: "b-first", host: "first.example.org"},
+		{name: "c-second", host: "second.example.org"},
+		{name: "d-relative", host: "relative"},
+		{name: "e-wildcard", host: "*.example.org"},
+	} {
+		objects = append(objects, &netv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        ing.name,
+				Namespace:   "default",
+				Annotations: map[string]string{"kubemate.mgoltzsche.github.com/set-headers": "X-Ingress=" + ing.name},
+			},
+			Spec: netv1.IngressSpec{Rules: []netv1.IngressRule{{
+				Host: ing.host,
+				IngressRuleValue: netv1.IngressRuleValue{HTTP: &netv1.HTTPIngressRuleValue{Paths: []netv1.HTTPIngressPath{{
+					Path: "/",
+					Backend: netv1.IngressBackend{Service: &netv1.IngressServiceBackend{
+						Name: "app",
+						Port: netv1.ServiceBackendPort{Number: 80},
+					}},
+				}}}},
+			}}},
+		})
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+	logger := logrus.NewEntry(logrus.New())
+	localZone := func() string { return "kube.m8" }
+	h, _, err := newRouter(context.Background(), cl, "kubemate", http.NotFoundHandler(), localZone, newBackendPools(), &sessionAuthenticator{}, newIngressReport(logger), logger)
+	require.NoError(t, err, "newRouter")
+
+	for _, c := range []struct {
+		host     string
+		expected string
+	}{
+		{host: "first.example.org", expected: "b-first"},
+		{host: "second.example.org:8443", expected: "c-second"},
+		{host: "FIRST.example.org.", expected: "b-first"},
+		{host: "relative.kube.m8", expected: "d-relative"},
+		{host: "other.example.org", expected: "e-wildcard"},
+		{host: "sub.other.example.org", expected: "a-default"},
+		{host: "relative", expected: "d-relative"},
+		{host: "unknown.org", expected: "a-default"},
+	} {
+		t.Run(c.host, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/path", nil)
+			req.Host = c.host
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			require.Equal(t, http.StatusOK, w.Code, "status code")
+			b, err := io.ReadAll(w.Body)
+			require.NoError(t, err)
+			require.Equal(t, c.expected, string(b), "ingress that served the request")
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package ingress
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	eventReasonDuplicatePath       = "DuplicatePath"
+	eventReasonInvalidBackend      = "InvalidBackend"
+	eventReasonBackendNotFound     = "BackendNotFound"
+	eventReasonNoEndpoints         = "NoEndpoints"
+	eventReasonInvalidAnnotation   = "InvalidAnnotation"
+	eventReasonUnsupportedPathType = "UnsupportedPathType"
+	eventReasonInvalidTLSSecret    = "InvalidTLSSecret"
+	eventReasonInvalidTLSHost      = "InvalidTLSHost"
+)
+
+// ingressReport collects the Ingress resources a router serves along with the problems found with them and the stream route ConfigMaps.
+type ingressReport struct {
+	ingresses []*netv1.Ingress
+	skipped   map[string]struct{}
+	problems  []ingressProblem
+	logger    *logrus.Entry
+}
+
+type ingressProblem struct {
+	object  client.Object
+	reason  string
+	message string
+}
+
+func newIngressReport(logger *logrus.Entry) *ingressReport {
+	return &ingressReport{skipped: map[string]struct{}{}, logger: logger}
+}
+
+func (r *ingressReport) add(ing *netv1.Ingress) {
+	r.ingresses = append(r.ingresses, ing)
+}
+
+// skip marks the given Ingress as not served.
+func (r *ingressReport) skip(ing *netv1.Ingress) {
+	r.skipped[ingressKey(ing)] = struct{}{}
+}
+
+// warn records a problem with the given object and logs it.
+func (r *ingressReport) warn(o client.Object, reason, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	r.problems = append(r.problems, ingressProblem{object: o, reason: reason, message: msg})
+	r.logger.WithField("resource", ingressKey(o)).WithField("reason", reason).Warn(msg)
+}
+
+func ingressKey(o client.Object) string {
+	return fmt.Sprintf("%s/%s", o.GetNamespace(), o.GetName())
+}
+
+// ingressReporter emits the problems of a router update as Events and writes the device addresses into the status of the served Ingress resources.
+// A problem is emitted only once as long as it persists across updates.
+type ingressReporter struct {
+	client    client.Client
+	recorder  record.EventRecorder
+	addresses func() []netv1.IngressLoadBalancerIngress
+	reported  map[string]struct{}
+	logger    *logrus.Entry
+}
+
+func (r *ingressReporter) report(ctx context.Context, report *ingressReport) {
+	reported := make(map[string]struct{}, len(report.problems))
+	for _, p := range report.problems {
+		key := fmt.Sprintf("%s/%s/%s/%s", ingressKey(p.object), p.object.GetUID(), p.reason, p.message)
+		reported[key] = struct{}{}
+		if _, ok := r.reported[key]; ok {
+			continue
+		}
+		if r.recorder != nil {
+			r.recorder.Event(p.object, corev1.EventTypeWarning, p.reason, p.message)
+		}
+	}
+	r.reported = reported
+	var addresses []netv1.IngressLoadBalancerIngress
+	if r.addresses != nil {
+		addresses = r.addresses()
+	}
+	for _, ing := range report.ingresses {
+		lbStatus := addresses
+		if _, skipped := report.skipped[ingressKey(ing)]; skipped {
+			lbStatus = nil
+		}
+		err := r.updateStatus(ctx, ing, lbStatus)
+		if err != nil {
+			r.logger.WithField("resource", ingressKey(ing)).WithError(err).Warn("failed to update ingress status")
+		}
+	}
+}
+
+func (r *ingressReporter) updateStatus(ctx context.Context, ing *netv1.Ingress, addresses []netv1.IngressLoadBalancerIngress) error {
+	if len(addresses) == 0 && len(ing.Status.LoadBalancer.Ingress) == 0 || reflect.DeepEqual(addresses, ing.Status.LoadBalancer.Ingress) {
+		return nil
+	}
+	orig := ing
+	ing = ing.DeepCopy()
+	ing.Status.LoadBalancer.Ingress = addresses
+	err := r.client.Status().Patch(ctx, ing, client.MergeFrom(orig))
+	if err != nil {
+		return fmt.Errorf("update ingress status: %w", err)
+	}
+	return nil
+}
+
+// loadBalancerIngress returns the Ingress status entries for the given device IPs and hostname.
+func loadBalancerIngress(ips []net.IP, hostname string) []netv1.IngressLoadBalancerIngress {
+	sorted := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		sorted = append(sorted, ip.String())
+	}
+	sort.Strings(sorted)
+	r := make([]netv1.IngressLoadBalancerIngress, 0, len(ips)+1)
+	for _, ip := range sorted {
+		r = append(r, netv1.IngressLoadBalancerIngress{IP: ip})
+	}
+	if hostname != "" {
+		r = append(r, netv1.IngressLoadBalancerIngress{Hostname: hostname})
+	}
+	return r
+}
@@ -0,0 +1,117 @@
+package ingress
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestNewRouterReport(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, netv1.AddToScheme(scheme))
+	require.NoError(t, corev1.AddToScheme(scheme))
+	require.NoError(t, discoveryv1.AddToScheme(scheme))
+	exact := netv1.PathTypeExact
+	unsupported := netv1.PathType("Regex")
+	ingress := func(name string, paths ...netv1.HTTPIngressPath) *netv1.Ingress {
+		return &netv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: netv1.IngressSpec{Rules: []netv1.IngressRule{{
+				Host:             "app.kube.m8",
+				IngressRuleValue: netv1.IngressRuleValue{HTTP: &netv1.HTTPIngressRuleValue{Paths: paths}},
+			}}},
+		}
+	}
+	backend := func(svc string) netv1.IngressBackend {
+		return netv1.IngressBackend{Service: &netv1.IngressServiceBackend{Name: svc, Port: netv1.ServiceBackendPort{Number: 80}}}
+	}
+	a := ingress("a", netv1.HTTPIngressPath{Path: "/", Backend: backend("app")})
+	a.Annotations = map[string]string{"kubemate.mgoltzsche.github.com/load-balance": "ewma"}
+	b := ingress("b",
+		netv1.HTTPIngressPath{Path: "/b", Backend: backend("app")},
+		netv1.HTTPIngressPath{Path: "/", Backend: backend("app")},
+	)
+	c := ingress("c",
+		netv1.HTTPIngressPath{Path: "/c", PathType: &exact, Backend: backend("missing")},
+		netv1.HTTPIngressPath{Path: "/regex", PathType: &unsupported, Backend: backend("app")},
+	)
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 80}}},
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(a, b, c, svc).Build()
+	report := newIngressReport(logrus.NewEntry(logrus.New()))
+
+	_, hosts, err := newRouter(context.Background(), cl, "kubemate", http.NotFoundHandler(), nil, newBackendPools(), &sessionAuthenticator{}, report, logrus.NewEntry(logrus.New()))
+	require.NoError(t, err, "newRouter")
+	require.Len(t, report.ingresses, 3, "ingresses")
+	require.Equal(t, map[string]struct{}{"default/b": {}}, report.skipped, "skipped")
+	reasons := map[string][]string{}
+	for _, p := range report.problems {
+		reasons[p.object.GetName()] = append(reasons[p.object.GetName()], p.reason)
+	}
+	require.Equal(t, map[string][]string{
+		"a": {eventReasonInvalidAnnotation, eventReasonNoEndpoints},
+		"b": {eventReasonDuplicatePath},
+		"c": {eventReasonBackendNotFound, eventReasonUnsupportedPathType},
+	}, reasons, "problem reasons")
+	require.True(t, hosts.contains("app.kube.m8", ""), "should route host of valid ingress")
+}
+
+func TestIngressReporter(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, netv1.AddToScheme(scheme))
+	served := &netv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "served", Namespace: "default"}}
+	skipped := &netv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "skipped", Namespace: "default"},
+		Status: netv1.IngressStatus{LoadBalancer: netv1.IngressLoadBalancerStatus{
+			Ingress: []netv1.IngressLoadBalancerIngress{{IP: "192.168.1.2"}},
+		}},
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(served, skipped).WithStatusSubresource(served, skipped).Build()
+	recorder := record.NewFakeRecorder(10)
+	addresses := loadBalancerIngress([]net.IP{net.ParseIP("192.168.1.3"), net.ParseIP("10.0.0.2")}, "mydevice.kube.m8")
+	reporter := &ingressReporter{
+		client:    cl,
+		recorder:  recorder,
+		addresses: func() []netv1.IngressLoadBalancerIngress { return addresses },
+		logger:    logrus.NewEntry(logrus.New()),
+	}
+	newReport := func() *ingressReport {
+		report := newIngressReport(logrus.NewEntry(logrus.New()))
+		report.add(served.DeepCopy())
+		report.add(skipped.DeepCopy())
+		report.skip(skipped)
+		report.warn(skipped, eventReasonDuplicatePath, "duplicate path")
+		return report
+	}
+	ctx := context.Background()
+
+	reporter.report(ctx, newReport())
+	require.Len(t, recorder.Events, 1, "events")
+	require.Equal(t, "Warning DuplicatePath duplicate path", <-recorder.Events)
+	reporter.report(ctx, newReport())
+	require.Len(t, recorder.Events, 0, "should not emit persisting problem again")
+
+	var ing netv1.Ingress
+	require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(served), &ing))
+	require.Equal(t, []netv1.IngressLoadBalancerIngress{
+		{IP: "10.0.0.2"},
+		{IP: "192.168.1.3"},
+		{Hostname: "mydevice.kube.m8"},
+	}, ing.Status.LoadBalancer.Ingress, "served ingress status")
+	require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(skipped), &ing))
+	require.Empty(t, ing.Status.LoadBalancer.Ingress, "skipped ingress status")
+}
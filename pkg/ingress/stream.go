@@ -0,0 +1,470 @@
+package ingress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// annotationStreamRoutes marks a ConfigMap that maps device ports to services, specifying the protocol (tcp or udp).
+	annotationStreamRoutes = "kubemate.mgoltzsche.github.com/stream-routes"
+	streamDialTimeout      = 5 * time.Second
+	// udpSessionTimeout is the time after which a UDP session of a client is closed when no packet was forwarded.
+	udpSessionTimeout = time.Minute
+	maxUDPPacketSize  = 65535
+	// maxUDPSessions limits the amount of concurrent client sessions of a UDP listener.
+	maxUDPSessions = 1024
+	// minStreamPort is the lowest port a stream route may use, excluding the privileged ports.
+	minStreamPort = 1024
+
+	eventReasonInvalidStreamRoute = "InvalidStreamRoute"
+	eventReasonDuplicatePort      = "DuplicatePort"
+	eventReasonListenFailed       = "ListenFailed"
+)
+
+// k3sPorts are the ports k3s and its embedded components listen on, which stream routes must not use.
+var k3sPorts = []int32{
+	2379, 2380, // etcd
+	5001,       // embedded registry mirror
+	6443, 6444, // api server and supervisor
+	8472,         // flannel vxlan
+	10010,        // containerd streaming
+	10248, 10250, // kubelet
+	10249, 10256, // kube-proxy
+	10257, 10258, 10259, // controller-manager, cloud-controller-manager and scheduler
+	51820, 51821, // flannel wireguard
+}
+
+// streamRoute forwards the TCP or UDP traffic a device port receives to a service port.
+type streamRoute struct {
+	Protocol  corev1.Protocol
+	Port      int32
+	Namespace string
+	Backend   netv1.IngressServiceBackend
+}
+
+func (r *streamRoute) key() string {
+	return fmt.Sprintf("%s/%d", r.Protocol, r.Port)
+}
+
+// parseStreamRoutes returns the routes the given ConfigMap specifies within its data as "<PORT>": "<SERVICE>:<PORT>".
+// A route must refer to a service within the ConfigMap's namespace and must not use a privileged, k3s or one of the given reserved ports.
+// Invalid entries are skipped and returned as errors.
+func parseStreamRoutes(cm *corev1.ConfigMap, reservedPorts []int32) ([]streamRoute, []error) {
+	var protocol corev1.Protocol
+	switch strings.ToLower(cm.Annotations[annotationStreamRoutes]) {
+	case "tcp":
+		protocol = corev1.ProtocolTCP
+	case "udp":
+		protocol = corev1.ProtocolUDP
+	default:
+		return nil, []error{fmt.Errorf("unsupported %s annotation value %q, supported values are tcp and udp", annotationStreamRoutes, cm.Annotations[annotationStreamRoutes])}
+	}
+	keys := make([]string, 0, len(cm.Data))
+	for k := range cm.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	routes := make([]streamRoute, 0, len(keys))
+	var errs []error
+	for _, k := range keys {
+		port, err := strconv.ParseUint(k, 10, 16)
+		if err != nil || port == 0 {
+			errs = append(errs, fmt.Errorf("invalid stream route port %q", k))
+			continue
+		}
+		if err := validateStreamPort(int32(port), reservedPorts); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		backend, ns, err := parseStreamBackend(cm.Data[k], cm.Namespace)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid stream route for port %d: %w", port, err))
+			continue
+		}
+		routes = append(routes, streamRoute{Protocol: protocol, Port: int32(port), Namespace: ns, Backend: backend})
+	}
+	return routes, errs
+}
+
+// validateStreamPort returns an error if a stream route must not use the given port.
+func validateStreamPort(port int32, reservedPorts []int32) error {
+	if port < minStreamPort {
+		return fmt.Errorf("stream route must not use privileged port %d", port)
+	}
+	if slices.Contains(k3sPorts, port) || slices.Contains(reservedPorts, port) {
+		return fmt.Errorf("stream route must not use port %d reserved by kubemate", port)
+	}
+	return nil
+}
+
+// parseStreamBackend parses a service reference, allowing the namespace to be specified only if it is the given one.
+func parseStreamBackend(value, namespace string) (netv1.IngressServiceBackend, string, error) {
+	svc, portStr, ok := strings.Cut(strings.TrimSpace(value), ":")
+	if !ok || svc == "" || portStr == "" {
+		return netv1.IngressServiceBackend{}, "", fmt.Errorf("expected value of format SERVICE:PORT but got %q", value)
+	}
+	ns := namespace
+	if n, s, ok := strings.Cut(svc, "/"); ok {
+		ns, svc = n, s
+	}
+	if ns != namespace {
+		return netv1.IngressServiceBackend{}, "", fmt.Errorf("service %s/%s is not within the configmap's namespace %s", ns, svc, namespace)
+	}
+	if svc == "" {
+		return netv1.IngressServiceBackend{}, "", fmt.Errorf("expected value of format SERVICE:PORT but got %q", value)
+	}
+	backend := netv1.IngressServiceBackend{Name: svc}
+	if port, err := strconv.ParseInt(portStr, 10, 32); err == nil {
+		backend.Port.Number = int32(port)
+	} else {
+		backend.Port.Name = portStr
+	}
+	return backend, ns, nil
+}
+
+// streamProxies listens on the device ports the stream routes specify and forwards the connections to the services' endpoints.
+// The listeners are kept across updates, only the endpoints they forward to are replaced.
+type streamProxies struct {
+	listeners map[string]*streamListener
+	pools     *backendPools
+	logger    *logrus.Entry
+	mutex     sync.Mutex
+}
+
+func newStreamProxies(logger *logrus.Entry) *streamProxies {
+	return &streamProxies{
+		listeners: map[string]*streamListener{},
+		pools:     newBackendPools(),
+		logger:    logger,
+	}
+}
+
+// sync applies the stream routes of all annotated ConfigMaps, rejecting routes that use one of the given reserved ports.
+// When multiple ConfigMaps specify the same port, the ConfigMap that is sorted first takes precedence.
+func (p *streamProxies) sync(ctx context.Context, c client.Client, reservedPorts []int32, report *ingressReport) error {
+	var configMaps corev1.ConfigMapList
+	err := c.List(ctx, &configMaps)
+	if err != nil {
+		return err
+	}
+	sort.Slice(configMaps.Items, func(i, j int) bool {
+		return ingressKey(&configMaps.Items[i]) < ingressKey(&configMaps.Items[j])
+	})
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if ctx.Err() != nil {
+		// Don't open listeners after the controller was stopped.
+		return ctx.Err()
+	}
+	routes := map[string]*corev1.ConfigMap{}
+	active := map[string]struct{}{}
+	usedPools := map[string]struct{}{}
+	for i := range configMaps.Items {
+		cm := &configMaps.Items[i]
+		if _, ok := cm.Annotations[annotationStreamRoutes]; !ok {
+			continue
+		}
+		policy, err := loadBalancePolicy(cm.Annotations["kubemate.mgoltzsche.github.com/load-balance"])
+		if err != nil {
+			report.warn(cm, eventReasonInvalidAnnotation, "%s", err)
+		}
+		parsed, errs := parseStreamRoutes(cm, reservedPorts)
+		for _, err := range errs {
+			report.warn(cm, eventReasonInvalidStreamRoute, "%s", err)
+		}
+		for _, r := range parsed {
+			key := r.key()
+			if other, exists := routes[key]; exists {
+				report.warn(cm, eventReasonDuplicatePort, "ignoring stream route since %s port %d is specified by configmap %s already", r.Protocol, r.Port, ingressKey(other))
+				continue
+			}
+			routes[key] = cm
+			endpoints, err := serviceEndpoints(ctx, &r.Backend, r.Namespace, c)
+			if err != nil {
+				report.warn(cm, eventReasonBackendNotFound, "ignoring %s port %d: %s", r.Protocol, r.Port, err)
+				continue
+			}
+			if len(endpoints) == 0 {
+				report.warn(cm, eventReasonNoEndpoints, "service %s/%s has no ready endpoints", r.Namespace, r.Backend.Name)
+			}
+			svcPort := r.Backend.Port.Name
+			if svcPort == "" {
+				svcPort = fmt.Sprintf("%d", r.Backend.Port.Number)
+			}
+			poolKey := fmt.Sprintf("%s/%s/%s/%s", strings.ToLower(string(r.Protocol)), r.Namespace, r.Backend.Name, svcPort)
+			pool := p.pools.get(poolKey)
+			pool.setEndpoints(endpoints)
+			usedPools[poolKey] = struct{}{}
+			target := &streamTarget{pool: pool, policy: policy}
+			if l, ok := p.listeners[key]; ok {
+				l.target.Store(target)
+				active[key] = struct{}{}
+				continue
+			}
+			l, err := listenStream(r.Protocol, fmt.Sprintf(":%d", r.Port), target, p.logger.WithField("port", key))
+			if err != nil {
+				report.warn(cm, eventReasonListenFailed, "%s", err)
+				continue
+			}
+			p.listeners[key] = l
+			active[key] = struct{}{}
+			p.logger.WithField("port", key).WithField("service", fmt.Sprintf("%s/%s", r.Namespace, r.Backend.Name)).Info("listening for stream route")
+		}
+	}
+	for key, l := range p.listeners {
+		if _, ok := active[key]; !ok {
+			p.logger.WithField("port", key).Info("closing stream route listener")
+			_ = l.Close()
+			delete(p.listeners, key)
+		}
+	}
+	p.pools.retain(usedPools)
+	return nil
+}
+
+// Close closes all listeners.
+func (p *streamProxies) Close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for key, l := range p.listeners {
+		_ = l.Close()
+		delete(p.listeners, key)
+	}
+}
+
+// streamTarget specifies the endpoints a stream listener forwards to.
+type streamTarget struct {
+	pool   *backendPool
+	policy string
+}
+
+// dial connects to an endpoint of the pool, retrying another endpoint when the connection cannot be established.
+func (t *streamTarget) dial(network string) (net.Conn, *backendEndpoint, error) {
+	tried := map[string]struct{}{}
+	var lastErr error
+	for attempt := 0; attempt < maxBackendAttempts; attempt++ {
+		e, err := t.pool.pick(t.policy, tried)
+		if err != nil {
+			if lastErr != nil {
+				return nil, nil, lastErr
+			}
+			return nil, nil, err
+		}
+		tried[e.Host] = struct{}{}
+		conn, err := net.DialTimeout(network, e.Host, streamDialTimeout)
+		if err != nil {
+			t.pool.markFailed(e)
+			lastErr = err
+			continue
+		}
+		t.pool.markSucceeded(e)
+		return conn, e, nil
+	}
+	return nil, nil, lastErr
+}
+
+type streamListener struct {
+	target atomic.Pointer[streamTarget]
+	closer io.Closer
+	addr   net.Addr
+}
+
+func (l *streamListener) Close() error {
+	return l.closer.Close()
+}
+
+// listenStream starts listening on the given address, forwarding the traffic to the target.
+func listenStream(protocol corev1.Protocol, addr string, target *streamTarget, logger *logrus.Entry) (*streamListener, error) {
+	l := &streamListener{}
+	l.target.Store(target)
+	switch protocol {
+	case corev1.ProtocolTCP:
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("listen on tcp port: %w", err)
+		}
+		l.closer = ln
+		l.addr = ln.Addr()
+		go l.acceptTCP(ln, logger)
+	case corev1.ProtocolUDP:
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("listen on udp port: %w", err)
+		}
+		p := &udpProxy{conn: conn, listener: l, sessions: map[string]*udpSession{}, logger: logger}
+		l.closer = p
+		l.addr = conn.LocalAddr()
+		go p.serve()
+	default:
+		return nil, fmt.Errorf("unsupported stream protocol %q", protocol)
+	}
+	return l, nil
+}
+
+func (l *streamListener) acceptTCP(ln net.Listener, logger *logrus.Entry) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			logger.WithError(err).Warn("failed to accept tcp connection")
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		go l.forwardTCP(conn, logger)
+	}
+}
+
+func (l *streamListener) forwardTCP(conn net.Conn, logger *logrus.Entry) {
+	defer conn.Close()
+	backend, e, err := l.target.Load().dial("tcp")
+	if err != nil {
+		logger.WithField("client", conn.RemoteAddr().String()).WithError(err).Warn("failed to connect to stream backend")
+		return
+	}
+	defer backend.Close()
+	e.active.Add(1)
+	defer e.active.Add(-1)
+	done := make(chan struct{}, 2)
+	copyStream := func(dst, src net.Conn) {
+		_, _ = io.Copy(dst, src)
+		// Propagate the end of the stream while still receiving the response.
+		if c, ok := dst.(interface{ CloseWrite() error }); ok {
+			_ = c.CloseWrite()
+		} else {
+			_ = dst.Close()
+		}
+		done <- struct{}{}
+	}
+	go copyStream(backend, conn)
+	go copyStream(conn, backend)
+	<-done
+	<-done
+}
+
+var errTooManyUDPSessions = errors.New("dropping packet since the maximum amount of udp sessions is reached")
+
+// udpProxy forwards the packets of each client to an endpoint using a dedicated backend socket per client session.
+type udpProxy struct {
+	conn     net.PacketConn
+	listener *streamListener
+	sessions map[string]*udpSession
+	logger   *logrus.Entry
+	mutex    sync.Mutex
+}
+
+type udpSession struct {
+	backend    net.Conn
+	lastPacket atomic.Int64
+}
+
+func (p *udpProxy) serve() {
+	buf := make([]byte, maxUDPPacketSize)
+	for {
+		n, addr, err := p.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			p.logger.WithError(err).Warn("failed to read udp packet")
+			continue
+		}
+		s, err := p.session(addr)
+		if err != nil {
+			if errors.Is(err, errTooManyUDPSessions) {
+				p.logger.WithField("client", addr.String()).Debug(err)
+				continue
+			}
+			p.logger.WithField("client", addr.String()).WithError(err).Warn("failed to connect to stream backend")
+			continue
+		}
+		s.lastPacket.Store(time.Now().UnixNano())
+		_, err = s.backend.Write(buf[:n])
+		if err != nil {
+			p.logger.WithField("client", addr.String()).WithError(err).Debug("failed to forward udp packet")
+		}
+	}
+}
+
+func (p *udpProxy) session(addr net.Addr) (*udpSession, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	key := addr.String()
+	if s, ok := p.sessions[key]; ok {
+		return s, nil
+	}
+	if len(p.sessions) >= maxUDPSessions {
+		return nil, errTooManyUDPSessions
+	}
+	target := p.listener.target.Load()
+	backend, e, err := target.dial("udp")
+	if err != nil {
+		return nil, err
+	}
+	s := &udpSession{backend: backend}
+	s.lastPacket.Store(time.Now().UnixNano())
+	p.sessions[key] = s
+	e.active.Add(1)
+	go func() {
+		defer e.active.Add(-1)
+		p.reply(s, addr, target, e)
+		p.mutex.Lock()
+		delete(p.sessions, key)
+		p.mutex.Unlock()
+		_ = backend.Close()
+	}()
+	return s, nil
+}
+
+// reply forwards the backend's packets to the client until the session is idle or closed.
+func (p *udpProxy) reply(s *udpSession, addr net.Addr, target *streamTarget, e *backendEndpoint) {
+	buf := make([]byte, maxUDPPacketSize)
+	for {
+		_ = s.backend.SetReadDeadline(time.Now().Add(udpSessionTimeout))
+		n, err := s.backend.Read(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() && time.Since(time.Unix(0, s.lastPacket.Load())) < udpSessionTimeout {
+				continue
+			}
+			if errors.Is(err, syscall.ECONNREFUSED) {
+				target.pool.markFailed(e)
+			}
+			return
+		}
+		s.lastPacket.Store(time.Now().UnixNano())
+		_, err = p.conn.WriteTo(buf[:n], addr)
+		if err != nil && errors.Is(err, net.ErrClosed) {
+			return
+		}
+	}
+}
+
+// Close stops listening and closes all client sessions.
+func (p *udpProxy) Close() error {
+	err := p.conn.Close()
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, s := range p.sessions {
+		_ = s.backend.Close()
+	}
+	return err
+}
@@ -0,0 +1,149 @@
+package ingress
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseStreamRoutes(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "tcp-services",
+			Namespace:   "default",
+			Annotations: map[string]string{annotationStreamRoutes: "TCP"},
+		},
+		Data: map[string]string{
+			"1883":   "mosquitto:1883",
+			"25565":  "games/minecraft:minecraft",
+			"80a":    "app:80",
+			"70000":  "app:80",
+			"1704":   "snapcast",
+			"1705":   "/snapcast:1705",
+			"019999": "default/app:9999",
+			"22":     "ssh:22",
+			"6443":   "app:6443",
+			"8443":   "app:8443",
+		},
+	}
+	routes, errs := parseStreamRoutes(cm, []int32{8080, 8443})
+	require.Equal(t, []streamRoute{
+		{Protocol: corev1.ProtocolTCP, Port: 19999, Namespace: "default", Backend: netv1.IngressServiceBackend{Name: "app", Port: netv1.ServiceBackendPort{Number: 9999}}},
+		{Protocol: corev1.ProtocolTCP, Port: 1883, Namespace: "default", Backend: netv1.IngressServiceBackend{Name: "mosquitto", Port: netv1.ServiceBackendPort{Number: 1883}}},
+	}, routes)
+	require.Len(t, errs, 8, "errors")
+
+	cm.Annotations[annotationStreamRoutes] = "sctp"
+	routes, errs = parseStreamRoutes(cm, nil)
+	require.Empty(t, routes, "routes with unsupported protocol")
+	require.Len(t, errs, 1, "errors with unsupported protocol")
+}
+
+func TestStreamListenerTCP(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	unreachable := closedPort(t, "tcp")
+	pool := newBackendPools().get("tcp/default/echo/7")
+	pool.setEndpoints([]string{unreachable, echo.Addr().String()})
+	l, err := listenStream(corev1.ProtocolTCP, "127.0.0.1:0", &streamTarget{pool: pool, policy: loadBalanceRoundRobin}, logrus.NewEntry(logrus.New()))
+	require.NoError(t, err, "listen")
+	defer l.Close()
+
+	conn, err := net.Dial("tcp", l.addr.String())
+	require.NoError(t, err, "dial proxy")
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Write([]byte("hello\n"))
+	require.NoError(t, err, "write")
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err, "read")
+	require.Equal(t, "hello\n", line)
+	pool.mutex.Lock()
+	require.Contains(t, pool.unhealthy, unreachable, "unreachable endpoint should be marked failed")
+	pool.mutex.Unlock()
+	require.NoError(t, conn.(*net.TCPConn).CloseWrite(), "close write")
+	_, err = conn.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF, "should propagate end of stream")
+	conn.Close()
+}
+
+func TestStreamListenerUDP(t *testing.T) {
+	echo, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer echo.Close()
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := echo.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, _ = echo.WriteTo(buf[:n], addr)
+		}
+	}()
+	pool := newBackendPools().get("udp/default/echo/7")
+	pool.setEndpoints([]string{echo.LocalAddr().String()})
+	l, err := listenStream(corev1.ProtocolUDP, "127.0.0.1:0", &streamTarget{pool: pool, policy: loadBalanceRoundRobin}, logrus.NewEntry(logrus.New()))
+	require.NoError(t, err, "listen")
+	defer l.Close()
+
+	conn, err := net.Dial("udp", l.addr.String())
+	require.NoError(t, err, "dial proxy")
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1024)
+	for _, msg := range []string{"hello", "world"} {
+		_, err = conn.Write([]byte(msg))
+		require.NoError(t, err, "write")
+		n, err := conn.Read(buf)
+		require.NoError(t, err, "read")
+		require.Equal(t, msg, string(buf[:n]))
+	}
+	require.Equal(t, int64(1), pool.endpoints[0].active.Load(), "active sessions")
+}
+
+func TestUDPProxyMaxSessions(t *testing.T) {
+	pool := newBackendPools().get("udp/default/echo/7")
+	pool.setEndpoints([]string{"127.0.0.1:9"})
+	l := &streamListener{}
+	l.target.Store(&streamTarget{pool: pool, policy: loadBalanceRoundRobin})
+	p := &udpProxy{listener: l, sessions: map[string]*udpSession{}, logger: logrus.NewEntry(logrus.New())}
+	for i := 0; i < maxUDPSessions; i++ {
+		p.sessions[fmt.Sprintf("10.0.0.1:%d", i)] = &udpSession{}
+	}
+	existing, err := p.session(&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 0})
+	require.NoError(t, err, "existing session")
+	require.Same(t, p.sessions["10.0.0.1:0"], existing, "existing session")
+	_, err = p.session(&net.UDPAddr{IP: net.ParseIP("10.0.0.2"), Port: 1})
+	require.ErrorIs(t, err, errTooManyUDPSessions, "new session")
+	require.Len(t, p.sessions, maxUDPSessions, "sessions")
+}
+
+func closedPort(t *testing.T, network string) string {
+	l, err := net.Listen(network, "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
@@ -0,0 +1,224 @@
+package ingress
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ingressHosts holds the hosts the ingress resources specify along with their custom TLS certificates.
+type ingressHosts struct {
+	hosts map[string]struct{}
+	certs map[string]*tls.Certificate
+}
+
+func newIngressHosts() *ingressHosts {
+	return &ingressHosts{
+		hosts: map[string]struct{}{},
+		certs: map[string]*tls.Certificate{},
+	}
+}
+
+func (h *ingressHosts) addHost(host string) {
+	if host != "" {
+		h.hosts[strings.ToLower(host)] = struct{}{}
+	}
+}
+
+// addCertificates loads the TLS certificates specified by the given ingress resource.
+// A certificate is registered only for hosts the ingress' rules specify: for those listed within the tls section or, if none, for those the certificate is valid for.
+// Hosts without a dot are relative to the given local DNS zone.
+// Ingress resources that are processed first take precedence when several specify a certificate for the same host.
+func (h *ingressHosts) addCertificates(ctx context.Context, ing *netv1.Ingress, zone string, c client.Client, report *ingressReport) {
+	ruleHosts := make([]string, 0, len(ing.Spec.Rules))
+	for _, r := range ing.Spec.Rules {
+		if r.Host != "" {
+			ruleHosts = append(ruleHosts, qualifyHost(r.Host, zone))
+		}
+	}
+	for _, t := range ing.Spec.TLS {
+		if t.SecretName == "" {
+			continue
+		}
+		cert, err := loadTLSSecret(ctx, types.NamespacedName{Namespace: ing.Namespace, Name: t.SecretName}, c)
+		if err != nil {
+			report.warn(ing, eventReasonInvalidTLSSecret, "%s", err)
+			continue
+		}
+		var hosts []string
+		for _, host := range t.Hosts {
+			host = qualifyHost(host, zone)
+			if !slices.Contains(ruleHosts, host) {
+				report.warn(ing, eventReasonInvalidTLSHost, "ignoring tls host %s since no rule specifies it", host)
+				continue
+			}
+			hosts = append(hosts, host)
+		}
+		if len(t.Hosts) == 0 {
+			for _, host := range ruleHosts {
+				if certificateCovers(cert, host) {
+					hosts = append(hosts, host)
+				}
+			}
+		}
+		for _, host := range hosts {
+			if _, exists := h.certs[host]; !exists {
+				h.certs[host] = cert
+			}
+		}
+	}
+}
+
+// qualifyHost returns the lower case fully qualified name of the given ingress host.
+func qualifyHost(host, zone string) string {
+	host = strings.ToLower(host)
+	if zone != "" && !strings.Contains(host, ".") {
+		return host + "." + zone
+	}
+	return host
+}
+
+// certificateCovers returns true if the given certificate is valid for the given host.
+func certificateCovers(cert *tls.Certificate, host string) bool {
+	for _, name := range cert.Leaf.DNSNames {
+		if strings.EqualFold(name, host) {
+			return true
+		}
+	}
+	return !strings.HasPrefix(host, "*.") && cert.Leaf.VerifyHostname(host) == nil
+}
+
+// certificate returns the custom certificate for the given server name, matching wildcard hosts as well.
+func (h *ingressHosts) certificate(name string) *tls.Certificate {
+	if cert, ok := h.certs[name]; ok {
+		return cert
+	}
+	if _, parent, ok := strings.Cut(name, "."); ok {
+		return h.certs["*."+parent]
+	}
+	return nil
+}
+
+// contains returns true if an ingress resource specifies the given host.
+// Hosts without a dot are relative to the given local DNS zone, wildcard hosts match a single label.
+func (h *ingressHosts) contains(name, zone string) bool {
+	if _, ok := h.hosts[name]; ok {
+		return true
+	}
+	label, parent, hasDot := strings.Cut(name, ".")
+	if !hasDot {
+		return false
+	}
+	if _, ok := h.hosts["*."+parent]; ok {
+		return true
+	}
+	if zone != "" && parent == zone {
+		_, ok := h.hosts[label]
+		return ok
+	}
+	return false
+}
+
+// localCertificateName returns the name the local CA should issue a certificate for to serve the given name within the given zone.
+// A name that matches a wildcard host is served with a wildcard certificate so that arbitrary names do not make the CA issue a certificate each.
+func (h *ingressHosts) localCertificateName(name, zone string) (string, bool) {
+	if zone == "" || !strings.HasSuffix(name, "."+zone) {
+		return "", false
+	}
+	label, parent, _ := strings.Cut(name, ".")
+	if _, ok := h.hosts[name]; ok {
+		return name, true
+	}
+	if _, ok := h.hosts[label]; ok && parent == zone {
+		return name, true
+	}
+	if _, ok := h.hosts["*."+parent]; ok {
+		return "*." + parent, true
+	}
+	return "", false
+}
+
+// matchesHost returns true if the given name matches the given ingress host.
+// A host without a dot is relative to the given local DNS zone, a wildcard host matches a single label.
+func matchesHost(name, host, zone string) bool {
+	if name == host {
+		return true
+	}
+	label, parent, hasDot := strings.Cut(name, ".")
+	if !hasDot {
+		return false
+	}
+	if wildcardParent, ok := strings.CutPrefix(host, "*."); ok {
+		return parent == wildcardParent
+	}
+	return zone != "" && parent == zone && label == host
+}
+
+func loadTLSSecret(ctx context.Context, key types.NamespacedName, c client.Client) (*tls.Certificate, error) {
+	var secret corev1.Secret
+	err := c.Get(ctx, key, &secret)
+	if err != nil {
+		return nil, fmt.Errorf("get tls secret: %w", err)
+	}
+	cert, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, fmt.Errorf("load tls secret %s: %w", key, err)
+	}
+	return &cert, nil
+}
+
+// GetCertificate returns the certificate for the server name the TLS client requested.
+// It prefers the certificate an ingress resource specifies and issues one using the local CA for an ingress host within the local DNS zone.
+// Otherwise, as well as for the device's own names, it returns nil to let the server fall back to its default certificate.
+func (s *IngressController) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if name == "" {
+		return nil, nil
+	}
+	zone := s.localZone()
+	if s.isDeviceHost(name, zone) {
+		return nil, nil
+	}
+	hosts := s.router.Load().hosts()
+	if cert := hosts.certificate(name); cert != nil {
+		return cert, nil
+	}
+	if s.LocalCA == nil {
+		return nil, nil
+	}
+	certName, ok := hosts.localCertificateName(name, zone)
+	if !ok || s.LocalCA.Zone() != zone {
+		// The CA is generated again for a changed zone asynchronously.
+		return nil, nil
+	}
+	return s.LocalCA.Certificate(certName)
+}
+
+// IsIngressHost returns true if an ingress resource specifies the host of the given request host header.
+func (s *IngressController) IsIngressHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return s.router.Load().hosts().contains(strings.ToLower(host), s.localZone())
+}
+
+// isDeviceHost returns true if the given name is the device's own name, which an ingress resource must not specify a certificate for.
+func (s *IngressController) isDeviceHost(name, zone string) bool {
+	deviceName := strings.ToLower(s.DeviceName)
+	return deviceName != "" && (name == deviceName || zone != "" && name == deviceName+"."+zone)
+}
+
+func (s *IngressController) localZone() string {
+	if s.LocalZone == nil {
+		return ""
+	}
+	return strings.ToLower(s.LocalZone())
+}
@@ -0,0 +1,193 @@
+package ingress
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestIngressHostsContains(t *testing.T) {
+	h := newIngressHosts()
+	h.addHost("app")
+	h.addHost("Media.example.org")
+	h.addHost("*.apps.kube.m8")
+	for _, c := range []struct {
+		name     string
+		expected bool
+	}{
+		{name: "app.kube.m8", expected: true},
+		{name: "media.example.org", expected: true},
+		{name: "foo.apps.kube.m8", expected: true},
+		{name: "app", expected: true},
+		{name: "app.example.org"},
+		{name: "other.kube.m8"},
+		{name: "foo.bar.apps.kube.m8"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.expected, h.contains(c.name, "kube.m8"))
+		})
+	}
+}
+
+func TestIngressHostsCertificate(t *testing.T) {
+	exact := &tls.Certificate{}
+	wildcard := &tls.Certificate{}
+	h := newIngressHosts()
+	h.certs["app.example.org"] = exact
+	h.certs["*.example.org"] = wildcard
+	require.Same(t, exact, h.certificate("app.example.org"), "exact")
+	require.Same(t, wildcard, h.certificate("other.example.org"), "wildcard")
+	require.Nil(t, h.certificate("example.org"), "parent domain")
+	require.Nil(t, h.certificate("app.kube.m8"), "unknown host")
+}
+
+func TestIngressHostsLocalCertificateName(t *testing.T) {
+	h := newIngressHosts()
+	h.addHost("app")
+	h.addHost("media.kube.m8")
+	h.addHost("other.example.org")
+	h.addHost("*.apps.kube.m8")
+	for _, c := range []struct {
+		name     string
+		expected string
+	}{
+		{name: "app.kube.m8", expected: "app.kube.m8"},
+		{name: "media.kube.m8", expected: "media.kube.m8"},
+		{name: "foo.apps.kube.m8", expected: "*.apps.kube.m8"},
+		{name: "bar.apps.kube.m8", expected: "*.apps.kube.m8"},
+		{name: "other.example.org"},
+		{name: "unknown.kube.m8"},
+		{name: "foo.bar.apps.kube.m8"},
+		{name: "app"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			name, ok := h.localCertificateName(c.name, "kube.m8")
+			require.Equal(t, c.expected != "", ok, "ok")
+			require.Equal(t, c.expected, name)
+		})
+	}
+}
+
+func TestIngressHostsAddCertificates(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	ingress := func(name string, tlsHosts []string, hosts ...string) *netv1.Ingress {
+		ing := &netv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       netv1.IngressSpec{TLS: []netv1.IngressTLS{{Hosts: tlsHosts, SecretName: name}}},
+		}
+		for _, host := range hosts {
+			ing.Spec.Rules = append(ing.Spec.Rules, netv1.IngressRule{Host: host})
+		}
+		return ing
+	}
+	listed := ingress("listed", []string{"App.example.org", "mydevice.kube.m8"}, "app.example.org")
+	unlisted := ingress("unlisted", nil, "media.example.org", "*.apps.example.org", "other.example.net")
+	relative := ingress("relative", []string{"local"}, "local")
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		tlsSecret(t, "listed", "app.example.org", "mydevice.kube.m8"),
+		tlsSecret(t, "unlisted", "*.example.org", "*.apps.example.org", "mydevice.kube.m8"),
+		tlsSecret(t, "relative", "local.kube.m8"),
+	).Build()
+	report := newIngressReport(logrus.NewEntry(logrus.New()))
+	h := newIngressHosts()
+
+	for _, ing := range []*netv1.Ingress{listed, unlisted, relative} {
+		h.addCertificates(context.Background(), ing, "kube.m8", cl, report)
+	}
+	hosts := make([]string, 0, len(h.certs))
+	for host := range h.certs {
+		hosts = append(hosts, host)
+	}
+	require.ElementsMatch(t, []string{"app.example.org", "media.example.org", "*.apps.example.org", "local.kube.m8"}, hosts, "certificate hosts")
+	require.Len(t, report.problems, 1, "problems")
+	require.Equal(t, eventReasonInvalidTLSHost, report.problems[0].reason, "problem reason")
+	require.Equal(t, "listed", report.problems[0].object.GetName(), "problem object")
+}
+
+func TestIngressControllerGetCertificateDeviceHost(t *testing.T) {
+	custom := &tls.Certificate{}
+	s := NewIngressController("kubemate", http.NotFoundHandler(), logrus.NewEntry(logrus.New()))
+	s.DeviceName = "mydevice"
+	s.LocalZone = func() string { return "kube.m8" }
+	hosts := s.router.Load().hosts()
+	hosts.certs["mydevice"] = custom
+	hosts.certs["mydevice.kube.m8"] = custom
+	hosts.certs["app.kube.m8"] = custom
+	for _, c := range []struct {
+		name     string
+		expected *tls.Certificate
+	}{
+		{name: "app.kube.m8", expected: custom},
+		{name: "mydevice"},
+		{name: "MyDevice.kube.m8."},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			cert, err := s.GetCertificate(&tls.ClientHelloInfo{ServerName: c.name})
+			require.NoError(t, err)
+			require.Same(t, c.expected, cert)
+		})
+	}
+}
+
+func TestIngressControllerConcurrentRouteUpdates(t *testing.T) {
+	s := NewIngressController("kubemate", http.NotFoundHandler(), logrus.NewEntry(logrus.New()))
+	s.LocalZone = func() string { return "kube.m8" }
+	r := s.router.Load()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			hosts := newIngressHosts()
+			hosts.addHost("app")
+			hosts.certs["app.kube.m8"] = &tls.Certificate{}
+			r.routes.Store(&ingressRoutes{handler: http.NotFoundHandler(), hosts: hosts})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		_, err := s.GetCertificate(&tls.ClientHelloInfo{ServerName: "app.kube.m8"})
+		require.NoError(t, err)
+		s.IsIngressHost("app.kube.m8:443")
+	}
+	<-done
+	require.True(t, s.IsIngressHost("app.kube.m8"), "should serve the latest routes")
+}
+
+func tlsSecret(t *testing.T, name string, dnsNames ...string) *corev1.Secret {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "generate key")
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, key.Public(), key)
+	require.NoError(t, err, "create certificate")
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err, "marshal key")
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Type:       corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			corev1.TLSPrivateKeyKey: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		},
+	}
+}
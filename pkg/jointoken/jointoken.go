@@ -0,0 +1,103 @@
+// Package jointoken manages k3s cluster join tokens using the k3s token CLI.
+package jointoken
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mgoltzsche/kubemate/pkg/cliutils"
+)
+
+const k3sBinary = "/proc/self/exe"
+
+var (
+	bootstrapTokenRegex = regexp.MustCompile(`^([a-z0-9]{6})\.[a-z0-9]{16}$`)
+	caHashRegex         = regexp.MustCompile(`^K10[0-9a-f]{64}$`)
+)
+
+// Create creates a new k3s bootstrap token that expires after the given TTL and returns it.
+func Create(ctx context.Context, k3sDir string, ttl time.Duration, description string) (string, error) {
+	args := []string{"token", "create", fmt.Sprintf("--data-dir=%s", k3sDir), fmt.Sprintf("--ttl=%s", ttl)}
+	if description != "" {
+		args = append(args, fmt.Sprintf("--description=%s", description))
+	}
+	out, err := cliutils.Run(ctx, k3sBinary, args...)
+	if err != nil {
+		return "", fmt.Errorf("create bootstrap token: %w", err)
+	}
+	token := strings.TrimSpace(out)
+	if ID(token) == "" {
+		return "", fmt.Errorf("create bootstrap token: unexpected k3s output %q", token)
+	}
+	return token, nil
+}
+
+// Delete deletes the k3s bootstrap token with the given ID.
+func Delete(ctx context.Context, k3sDir, id string) error {
+	_, err := cliutils.Run(ctx, k3sBinary, "token", "delete", fmt.Sprintf("--data-dir=%s", k3sDir), id)
+	if err != nil {
+		return fmt.Errorf("delete bootstrap token %s: %w", id, err)
+	}
+	return nil
+}
+
+// Rotate replaces the k3s server token.
+func Rotate(ctx context.Context, k3sDir, oldToken, newToken string) error {
+	_, err := cliutils.Run(ctx, k3sBinary, "token", "rotate",
+		fmt.Sprintf("--data-dir=%s", k3sDir),
+		fmt.Sprintf("--token=%s", oldToken),
+		fmt.Sprintf("--new-token=%s", newToken))
+	if err != nil {
+		return fmt.Errorf("rotate server token: %w", err)
+	}
+	return nil
+}
+
+// ID returns the public ID of the given bootstrap token or an empty string if it is no bootstrap token.
+func ID(token string) string {
+	m := bootstrapTokenRegex.FindStringSubmatch(secret(token))
+	if len(m) != 2 {
+		return ""
+	}
+	return m[1]
+}
+
+// CAHash returns the hex-encoded cluster CA certificate hash a full join token is prefixed with.
+// It returns an empty string if the token does not specify the CA hash.
+func CAHash(token string) string {
+	hash, _, ok := strings.Cut(token, "::")
+	if !ok || !caHashRegex.MatchString(hash) {
+		return ""
+	}
+	return strings.TrimPrefix(hash, "K10")
+}
+
+// Validate returns an error if the given join token is malformed.
+func Validate(token string) error {
+	if token == "" {
+		return fmt.Errorf("no join token specified")
+	}
+	if strings.ContainsAny(token, " \t\r\n") {
+		return fmt.Errorf("join token must not contain whitespace")
+	}
+	if strings.HasPrefix(token, "K10") {
+		hash, s, ok := strings.Cut(token, "::")
+		if !ok || !caHashRegex.MatchString(hash) {
+			return fmt.Errorf("join token has invalid CA hash prefix")
+		}
+		if user, pw, ok := strings.Cut(s, ":"); ok && (user == "" || pw == "") || s == "" {
+			return fmt.Errorf("join token has an empty secret")
+		}
+	}
+	return nil
+}
+
+func secret(token string) string {
+	if _, s, ok := strings.Cut(token, "::"); ok {
+		return s
+	}
+	return token
+}
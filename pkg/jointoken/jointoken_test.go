@@ -0,0 +1,70 @@
+package jointoken
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const caHash = "K10ffb4b1fa1e8e4a1b3a2f4fb6f6b1d6e77d3f63a2a94f5ab4b77fe2f6e6df0b05"
+
+func TestID(t *testing.T) {
+	for _, c := range []struct {
+		token    string
+		expected string
+	}{
+		{"abcdef.0123456789abcdef", "abcdef"},
+		{caHash + "::abcdef.0123456789abcdef", "abcdef"},
+		{caHash + "::server:secret", ""},
+		{"secret", ""},
+		{"ABCDEF.0123456789abcdef", ""},
+	} {
+		t.Run(c.token, func(t *testing.T) {
+			require.Equal(t, c.expected, ID(c.token))
+		})
+	}
+}
+
+func TestCAHash(t *testing.T) {
+	for _, c := range []struct {
+		token    string
+		expected string
+	}{
+		{caHash + "::abcdef.0123456789abcdef", caHash[3:]},
+		{caHash + "::server:secret", caHash[3:]},
+		{"abcdef.0123456789abcdef", ""},
+		{"K10abc::server:secret", ""},
+		{"secret", ""},
+	} {
+		t.Run(c.token, func(t *testing.T) {
+			require.Equal(t, c.expected, CAHash(c.token))
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, c := range []struct {
+		token string
+		valid bool
+	}{
+		{"secret", true},
+		{"abcdef.0123456789abcdef", true},
+		{caHash + "::abcdef.0123456789abcdef", true},
+		{caHash + "::server:secret", true},
+		{"", false},
+		{"sec ret", false},
+		{"secret\n", false},
+		{"K10abc::server:secret", false},
+		{caHash + "::", false},
+		{caHash + "::server:", false},
+	} {
+		t.Run(c.token, func(t *testing.T) {
+			err := Validate(c.token)
+			if c.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package localca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	caValidity = 10 * 365 * 24 * time.Hour
+	// certValidity is below the 398 days browsers accept for a leaf certificate.
+	certValidity = 365 * 24 * time.Hour
+	// renewBefore is the remaining validity below which a certificate is issued again.
+	renewBefore = 30 * 24 * time.Hour
+	// maxIssued limits the amount of issued certificates the CA keeps in memory.
+	maxIssued = 256
+)
+
+// CA is a local certificate authority that issues the certificates of the ingress hosts within the local DNS zone.
+// Clients need to trust the CA certificate once in order to trust all ingress hosts.
+// The CA certificate is name-constrained to the zone, letting clients reject certificates for any other name.
+type CA struct {
+	dir     string
+	name    string
+	zone    string
+	cert    *x509.Certificate
+	certPEM []byte
+	key     crypto.Signer
+	issued  map[string]*issuedCert
+	mutex   sync.Mutex
+}
+
+type issuedCert struct {
+	cert     *tls.Certificate
+	lastUsed time.Time
+}
+
+// LoadOrCreate loads the CA from the given directory or generates a new one for the given zone if it does not exist.
+// The CA is generated again when the loaded CA is not constrained to the given zone.
+func LoadOrCreate(dir, name, zone string) (*CA, error) {
+	c := &CA{dir: dir, name: name, issued: map[string]*issuedCert{}}
+	err := c.load(zone)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *CA) load(zone string) error {
+	zone = strings.ToLower(zone)
+	certFile := filepath.Join(c.dir, "ca.crt")
+	keyFile := filepath.Join(c.dir, "ca.key")
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("read local ca: %w", err)
+		}
+		return c.create(certFile, keyFile, zone)
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return fmt.Errorf("read local ca: %w", err)
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("load local ca: %w", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("load local ca: %w", err)
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("load local ca: unsupported private key type %T", pair.PrivateKey)
+	}
+	if !cert.PermittedDNSDomainsCritical || len(cert.PermittedDNSDomains) != 1 || cert.PermittedDNSDomains[0] != zone {
+		return c.create(certFile, keyFile, zone)
+	}
+	c.set(zone, cert, certPEM, key)
+	return nil
+}
+
+func (c *CA) create(certFile, keyFile, zone string) error {
+	if zone == "" {
+		return fmt.Errorf("generate local ca: no zone specified")
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("generate local ca key: %w", err)
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	tpl := &x509.Certificate{
+		SerialNumber:                serial,
+		Subject:                     pkix.Name{CommonName: c.name, Organization: []string{"kubemate"}},
+		NotBefore:                   now.Add(-time.Hour),
+		NotAfter:                    now.Add(caValidity),
+		KeyUsage:                    x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid:       true,
+		IsCA:                        true,
+		MaxPathLenZero:              true,
+		PermittedDNSDomainsCritical: true,
+		PermittedDNSDomains:         []string{zone},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, key.Public(), key)
+	if err != nil {
+		return fmt.Errorf("generate local ca certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	err = os.MkdirAll(filepath.Dir(certFile), 0700)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600)
+	if err != nil {
+		return fmt.Errorf("write local ca key: %w", err)
+	}
+	err = os.WriteFile(certFile, certPEM, 0644)
+	if err != nil {
+		return fmt.Errorf("write local ca certificate: %w", err)
+	}
+	c.set(zone, cert, certPEM, key)
+	return nil
+}
+
+func (c *CA) set(zone string, cert *x509.Certificate, certPEM []byte, key crypto.Signer) {
+	c.zone = zone
+	c.cert = cert
+	c.certPEM = certPEM
+	c.key = key
+	c.issued = map[string]*issuedCert{}
+}
+
+// SetZone generates a new CA that is constrained to the given zone if the zone changed.
+// It returns true if the CA changed.
+func (c *CA) SetZone(zone string) (bool, error) {
+	zone = strings.ToLower(zone)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if zone == c.zone {
+		return false, nil
+	}
+	err := c.create(filepath.Join(c.dir, "ca.crt"), filepath.Join(c.dir, "ca.key"), zone)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Zone returns the DNS zone the CA is constrained to.
+func (c *CA) Zone() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.zone
+}
+
+// CertPEM returns the PEM-encoded CA certificate.
+func (c *CA) CertPEM() []byte {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.certPEM
+}
+
+// Certificate returns a certificate for the given host name within the CA's zone, issuing it if it does not exist or expires soon.
+// When the maximum amount of issued certificates is reached, the least recently used one is evicted.
+func (c *CA) Certificate(host string) (*tls.Certificate, error) {
+	host = strings.ToLower(host)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !strings.HasSuffix(host, "."+c.zone) {
+		return nil, fmt.Errorf("issue certificate for %s: host is not within zone %s", host, c.zone)
+	}
+	now := time.Now()
+	if issued, ok := c.issued[host]; ok && issued.cert.Leaf.NotAfter.Sub(now) > renewBefore {
+		issued.lastUsed = now
+		return issued.cert, nil
+	}
+	cert, err := c.issue(host)
+	if err != nil {
+		return nil, fmt.Errorf("issue certificate for %s: %w", host, err)
+	}
+	if _, ok := c.issued[host]; !ok && len(c.issued) >= maxIssued {
+		c.evictLeastRecentlyUsed()
+	}
+	c.issued[host] = &issuedCert{cert: cert, lastUsed: now}
+	return cert, nil
+}
+
+func (c *CA) evictLeastRecentlyUsed() {
+	var lru string
+	var lruTime time.Time
+	for host, issued := range c.issued {
+		if lru == "" || issued.lastUsed.Before(lruTime) {
+			lru = host
+			lruTime = issued.lastUsed
+		}
+	}
+	delete(c.issued, lru)
+}
+
+func (c *CA) issue(host string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	notAfter := now.Add(certValidity)
+	if notAfter.After(c.cert.NotAfter) {
+		notAfter = c.cert.NotAfter
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, c.cert, key.Public(), c.key)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der, c.cert.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+func serialNumber() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("generate certificate serial number: %w", err)
+	}
+	return serial, nil
+}
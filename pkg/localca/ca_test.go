@@ -0,0 +1,95 @@
+package localca
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCA(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := LoadOrCreate(dir, "kubemate local CA", "kube.m8")
+	require.NoError(t, err, "create")
+	cert, err := ca.Certificate("App.kube.m8")
+	require.NoError(t, err, "issue")
+	require.Equal(t, []string{"app.kube.m8"}, cert.Leaf.DNSNames)
+	cached, err := ca.Certificate("app.kube.m8")
+	require.NoError(t, err, "issue again")
+	require.Same(t, cert, cached, "should reuse issued certificate")
+	wildcard, err := ca.Certificate("*.apps.kube.m8")
+	require.NoError(t, err, "issue wildcard certificate")
+	_, err = ca.Certificate("app.example.org")
+	require.Error(t, err, "should not issue certificate outside zone")
+
+	loaded, err := LoadOrCreate(dir, "kubemate local CA", "kube.m8")
+	require.NoError(t, err, "load")
+	require.Equal(t, ca.CertPEM(), loaded.CertPEM(), "loaded ca cert")
+
+	roots := caCertPool(t, loaded.CertPEM())
+	_, err = cert.Leaf.Verify(x509.VerifyOptions{DNSName: "app.kube.m8", Roots: roots})
+	require.NoError(t, err, "verify issued certificate")
+	_, err = wildcard.Leaf.Verify(x509.VerifyOptions{DNSName: "foo.apps.kube.m8", Roots: roots})
+	require.NoError(t, err, "verify issued wildcard certificate")
+}
+
+func TestCANameConstraints(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := LoadOrCreate(dir, "kubemate local CA", "kube.m8")
+	require.NoError(t, err, "create")
+	caPEM := ca.CertPEM()
+	cert, err := ca.Certificate("app.kube.m8")
+	require.NoError(t, err, "issue")
+	// Sign a certificate for a name outside the zone bypassing the check.
+	ca.zone = "org"
+	foreign, err := ca.Certificate("app.example.org")
+	require.NoError(t, err, "issue foreign certificate")
+	_, err = foreign.Leaf.Verify(x509.VerifyOptions{DNSName: "app.example.org", Roots: caCertPool(t, caPEM)})
+	require.Error(t, err, "clients should reject certificate outside the zone")
+
+	changed, err := ca.SetZone("home.arpa")
+	require.NoError(t, err, "set zone")
+	require.True(t, changed, "changed")
+	require.NotEqual(t, caPEM, ca.CertPEM(), "should generate new ca")
+	changed, err = ca.SetZone("home.arpa")
+	require.NoError(t, err, "set zone again")
+	require.False(t, changed, "changed again")
+	_, err = ca.Certificate("app.kube.m8")
+	require.Error(t, err, "should not issue certificate for previous zone")
+	_, err = cert.Leaf.Verify(x509.VerifyOptions{DNSName: "app.kube.m8", Roots: caCertPool(t, ca.CertPEM())})
+	require.Error(t, err, "new ca should not trust certificates of the previous ca")
+
+	loaded, err := LoadOrCreate(dir, "kubemate local CA", "home.arpa")
+	require.NoError(t, err, "load")
+	require.Equal(t, ca.CertPEM(), loaded.CertPEM(), "should load ca of the new zone")
+	loaded, err = LoadOrCreate(dir, "kubemate local CA", "kube.m8")
+	require.NoError(t, err, "load with changed zone")
+	require.NotEqual(t, ca.CertPEM(), loaded.CertPEM(), "should generate new ca when zone changed")
+}
+
+func TestCAEvictsIssuedCertificates(t *testing.T) {
+	ca, err := LoadOrCreate(t.TempDir(), "kubemate local CA", "kube.m8")
+	require.NoError(t, err, "create")
+	first, err := ca.Certificate("host0.kube.m8")
+	require.NoError(t, err)
+	for i := 1; i <= maxIssued; i++ {
+		_, err = ca.Certificate(fmt.Sprintf("host%d.kube.m8", i))
+		require.NoError(t, err)
+	}
+	require.Len(t, ca.issued, maxIssued, "issued")
+	reissued, err := ca.Certificate("host0.kube.m8")
+	require.NoError(t, err)
+	require.NotSame(t, first, reissued, "should have evicted least recently used certificate")
+}
+
+func caCertPool(t *testing.T, caPEM []byte) *x509.CertPool {
+	block, _ := pem.Decode(caPEM)
+	require.NotNil(t, block, "pem")
+	caCert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err, "parse ca cert")
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	return roots
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type clientAddressKey struct{}
+
+// ClientTracker records the time at which each client address sent its latest request.
+type ClientTracker struct {
+	lastSeen map[string]time.Time
+	mutex    sync.Mutex
+}
+
+func NewClientTracker() *ClientTracker {
+	return &ClientTracker{lastSeen: map[string]time.Time{}}
+}
+
+// Handler records the client address of each request and adds it to the request context.
+func (t *ClientTracker) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		addr := clientAddress(req.RemoteAddr)
+		t.mutex.Lock()
+		t.lastSeen[addr] = time.Now()
+		t.mutex.Unlock()
+		h.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), clientAddressKey{}, addr)))
+	})
+}
+
+// LastSeen returns the time of the latest request the given client address sent.
+func (t *ClientTracker) LastSeen(addr string) time.Time {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.lastSeen[addr]
+}
+
+// ClientAddressFromContext returns the address of the client that sent the request.
+func ClientAddressFromContext(ctx context.Context) string {
+	addr, _ := ctx.Value(clientAddressKey{}).(string)
+	return addr
+}
+
+func clientAddress(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
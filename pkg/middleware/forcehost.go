@@ -8,10 +8,11 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-func ForceHTTPSHost(host string, h http.Handler) http.Handler {
+// ForceHTTPSHost redirects requests to the given host unless they are sent from localhost or the passThrough func accepts their host, e.g. an ingress host.
+func ForceHTTPSHost(host string, passThrough func(host string) bool, h http.Handler) http.Handler {
 	host = strings.ToLower(host)
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		if req.Host != host && !strings.HasPrefix(req.RemoteAddr, "127.0.0.1") {
+		if req.Host != host && !strings.HasPrefix(req.RemoteAddr, "127.0.0.1") && !passThrough(req.Host) {
 			u := fmt.Sprintf("https://%s/", host)
 			logrus.WithField("host", req.Host).WithField("from", req.URL.String()).WithField("to", u).WithField("client", req.RemoteAddr).Debug("redirecting request")
 			http.Redirect(w, req, u, http.StatusFound)
@@ -0,0 +1,465 @@
+package networkifaces
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/cellular"
+	"github.com/mgoltzsche/kubemate/pkg/runner"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+// CellularRouteMetric is the metric of a cellular link's default route.
+// It is higher than dhcpcd's default metrics (1000+ifindex for wired and 3000+ifindex for wireless links)
+// and the wifi station's metric in order to prefer wired and wifi uplinks and fail over to cellular when they are down.
+const CellularRouteMetric = 5000
+
+// LinkConfigurator applies the addressing configuration of wired and cellular network links via netlink.
+type LinkConfigurator struct {
+	// ResolvConf is the file the static DNS servers are written to.
+	ResolvConf string
+	logger     *logrus.Entry
+	dhcpcd     map[string]*runner.Runner
+	// snapshots maps the links to their host-managed state before kubemate configured them.
+	snapshots map[string]*linkSnapshot
+	mutex     sync.Mutex
+}
+
+// linkSnapshot is the state of a link that is restored when the link is left to the host again.
+// Since it is kept in memory, a link that kubemate configured before it restarted is not restored.
+type linkSnapshot struct {
+	mtu        int
+	addresses  []string
+	routes     []netlink.Route
+	resolvConf []byte
+}
+
+func NewLinkConfigurator(logger *logrus.Entry) *LinkConfigurator {
+	return &LinkConfigurator{
+		ResolvConf: "/etc/resolv.conf",
+		logger:     logger,
+		dhcpcd:     map[string]*runner.Runner{},
+		snapshots:  map[string]*linkSnapshot{},
+	}
+}
+
+// Apply applies the given configuration to the network link with the given name.
+// When no configuration is provided, the addressing is left to the host:
+// the link's MTU, addresses, default routes and DNS servers are restored to the state before kubemate configured it and its VLAN links are removed.
+func (c *LinkConfigurator) Apply(name string, conf *deviceapi.NetworkLinkConfig) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if conf == nil {
+		c.stopDHCPClients(name)
+		return c.restore(name)
+	}
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return fmt.Errorf("get link %s: %w", name, err)
+	}
+	if _, ok := c.snapshots[name]; !ok {
+		s, err := c.snapshot(link)
+		if err != nil {
+			return err
+		}
+		c.snapshots[name] = s
+	}
+	err = c.configureLink(link, conf.MTU, conf.IP)
+	if err != nil {
+		return err
+	}
+	return c.configureVLANs(link, conf.VLANs)
+}
+
+func (c *LinkConfigurator) configureLink(link netlink.Link, mtu int, ip *deviceapi.IPConfig) error {
+	name := link.Attrs().Name
+	if mtu > 0 && link.Attrs().MTU != mtu {
+		err := netlink.LinkSetMTU(link, mtu)
+		if err != nil {
+			return fmt.Errorf("set link %s mtu: %w", name, err)
+		}
+	}
+	err := netlink.LinkSetUp(link)
+	if err != nil {
+		return fmt.Errorf("set link %s up: %w", name, err)
+	}
+	if ip == nil {
+		c.stopDHCPClient(name)
+		return nil
+	}
+	switch ip.Mode {
+	case deviceapi.IPConfigModeDHCP:
+		return c.startDHCPClient(name)
+	case deviceapi.IPConfigModeStatic:
+		c.stopDHCPClient(name)
+		return c.configureStaticIP(link, ip)
+	default:
+		return fmt.Errorf("unsupported ip mode %q specified for link %s", ip.Mode, name)
+	}
+}
+
+// snapshot returns the current state of the given link.
+func (c *LinkConfigurator) snapshot(link netlink.Link) (*linkSnapshot, error) {
+	name := link.Attrs().Name
+	addrs, err := globalAddresses(link)
+	if err != nil {
+		return nil, err
+	}
+	s := &linkSnapshot{mtu: link.Attrs().MTU}
+	for _, a := range addrs {
+		s.addresses = append(s.addresses, a.String())
+	}
+	s.routes, err = defaultRoutes(link)
+	if err != nil {
+		return nil, err
+	}
+	s.resolvConf, err = os.ReadFile(c.ResolvConf)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("snapshot link %s: %w", name, err)
+	}
+	return s, nil
+}
+
+// restore restores the state of the given link before kubemate configured it, if any.
+func (c *LinkConfigurator) restore(name string) error {
+	s, ok := c.snapshots[name]
+	if !ok {
+		return nil
+	}
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		var notFound netlink.LinkNotFoundError
+		if errors.As(err, &notFound) {
+			delete(c.snapshots, name)
+			return nil
+		}
+		return fmt.Errorf("get link %s: %w", name, err)
+	}
+	c.logger.WithField("link", name).Info("restoring host link configuration")
+	err = c.configureVLANs(link, nil)
+	if err != nil {
+		return err
+	}
+	if s.mtu > 0 && link.Attrs().MTU != s.mtu {
+		err = netlink.LinkSetMTU(link, s.mtu)
+		if err != nil {
+			return fmt.Errorf("restore link %s mtu: %w", name, err)
+		}
+	}
+	err = c.setAddresses(link, s.addresses)
+	if err != nil {
+		return err
+	}
+	routes, err := defaultRoutes(link)
+	if err != nil {
+		return err
+	}
+	for _, r := range routes {
+		if !containsRoute(s.routes, r) {
+			err = netlink.RouteDel(&r)
+			if err != nil {
+				return fmt.Errorf("remove link %s default route via %s: %w", name, r.Gw, err)
+			}
+		}
+	}
+	for _, r := range s.routes {
+		r.LinkIndex = link.Attrs().Index
+		err = netlink.RouteReplace(&r)
+		if err != nil {
+			return fmt.Errorf("restore link %s default route via %s: %w", name, r.Gw, err)
+		}
+	}
+	err = c.restoreResolvConf(s.resolvConf)
+	if err != nil {
+		return fmt.Errorf("restore link %s dns servers: %w", name, err)
+	}
+	delete(c.snapshots, name)
+	return nil
+}
+
+// restoreResolvConf restores the given resolv.conf content unless the file has been changed by another party than kubemate meanwhile.
+func (c *LinkConfigurator) restoreResolvConf(orig []byte) error {
+	current, err := os.ReadFile(c.ResolvConf)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if !bytes.HasPrefix(current, []byte(resolvConfHeader)) || bytes.Equal(current, orig) {
+		return nil
+	}
+	if orig == nil {
+		return os.Remove(c.ResolvConf)
+	}
+	return os.WriteFile(c.ResolvConf, orig, 0644)
+}
+
+func (c *LinkConfigurator) configureStaticIP(link netlink.Link, ip *deviceapi.IPConfig) error {
+	name := link.Attrs().Name
+	err := c.setAddresses(link, ip.Addresses)
+	if err != nil {
+		return err
+	}
+	for _, gw := range ip.Gateways {
+		gwIP := net.ParseIP(gw)
+		if gwIP == nil {
+			return fmt.Errorf("link %s: invalid gateway %q", name, gw)
+		}
+		err = netlink.RouteReplace(&netlink.Route{LinkIndex: link.Attrs().Index, Gw: gwIP, Priority: routeMetric(name)})
+		if err != nil {
+			return fmt.Errorf("set link %s default gateway %s: %w", name, gw, err)
+		}
+	}
+	if len(ip.DNS) > 0 {
+		err = os.WriteFile(c.ResolvConf, []byte(generateResolvConf(ip.DNS)), 0644)
+		if err != nil {
+			return fmt.Errorf("write link %s dns servers: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// setAddresses makes the given addresses the link's only global addresses.
+func (c *LinkConfigurator) setAddresses(link netlink.Link, addresses []string) error {
+	name := link.Attrs().Name
+	current, err := globalAddresses(link)
+	if err != nil {
+		return err
+	}
+	add, del, err := addressChanges(current, addresses)
+	if err != nil {
+		return fmt.Errorf("link %s: %w", name, err)
+	}
+	for _, a := range del {
+		c.logger.WithField("link", name).Infof("removing address %s", a)
+		err = netlink.AddrDel(link, &netlink.Addr{IPNet: a})
+		if err != nil {
+			return fmt.Errorf("remove link %s address %s: %w", name, a, err)
+		}
+	}
+	for _, a := range add {
+		c.logger.WithField("link", name).Infof("adding address %s", a)
+		err = netlink.AddrAdd(link, &netlink.Addr{IPNet: a})
+		if err != nil {
+			return fmt.Errorf("add link %s address %s: %w", name, a, err)
+		}
+	}
+	return nil
+}
+
+func globalAddresses(link netlink.Link) ([]*net.IPNet, error) {
+	addrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, fmt.Errorf("list link %s addresses: %w", link.Attrs().Name, err)
+	}
+	r := make([]*net.IPNet, 0, len(addrs))
+	for _, a := range addrs {
+		if a.IP.IsGlobalUnicast() {
+			r = append(r, a.IPNet)
+		}
+	}
+	return r, nil
+}
+
+// defaultRoutes returns the default routes via the given link.
+func defaultRoutes(link netlink.Link) ([]netlink.Route, error) {
+	routes, err := netlink.RouteList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, fmt.Errorf("list link %s routes: %w", link.Attrs().Name, err)
+	}
+	r := make([]netlink.Route, 0, 1)
+	for _, route := range routes {
+		if route.Gw != nil && isDefaultDst(route.Dst) {
+			r = append(r, route)
+		}
+	}
+	return r, nil
+}
+
+func isDefaultDst(dst *net.IPNet) bool {
+	if dst == nil {
+		return true
+	}
+	ones, _ := dst.Mask.Size()
+	return ones == 0
+}
+
+func containsRoute(routes []netlink.Route, route netlink.Route) bool {
+	for _, r := range routes {
+		if r.Gw.Equal(route.Gw) && r.Priority == route.Priority && r.Table == route.Table {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *LinkConfigurator) configureVLANs(parent netlink.Link, vlans []deviceapi.VLANConfig) error {
+	parentName := parent.Attrs().Name
+	links, err := netlink.LinkList()
+	if err != nil {
+		return fmt.Errorf("list links: %w", err)
+	}
+	desired := make(map[string]struct{}, len(vlans))
+	for _, v := range vlans {
+		desired[vlanLinkName(parentName, v.ID)] = struct{}{}
+	}
+	existing := map[string]netlink.Link{}
+	for _, l := range links {
+		name := l.Attrs().Name
+		if l.Type() != "vlan" || l.Attrs().ParentIndex != parent.Attrs().Index || !isVLANLinkName(parentName, name) {
+			continue
+		}
+		if _, ok := desired[name]; ok {
+			existing[name] = l
+			continue
+		}
+		c.logger.WithField("link", name).Info("removing vlan link")
+		c.stopDHCPClient(name)
+		err = netlink.LinkDel(l)
+		if err != nil {
+			return fmt.Errorf("remove vlan link %s: %w", name, err)
+		}
+	}
+	for _, v := range vlans {
+		name := vlanLinkName(parentName, v.ID)
+		link, ok := existing[name]
+		if !ok {
+			c.logger.WithField("link", name).Info("adding vlan link")
+			link = &netlink.Vlan{
+				LinkAttrs: netlink.LinkAttrs{Name: name, ParentIndex: parent.Attrs().Index},
+				VlanId:    v.ID,
+			}
+			err = netlink.LinkAdd(link)
+			if err != nil {
+				return fmt.Errorf("add vlan link %s: %w", name, err)
+			}
+			link, err = netlink.LinkByName(name)
+			if err != nil {
+				return fmt.Errorf("get vlan link %s: %w", name, err)
+			}
+		}
+		err = c.configureLink(link, v.MTU, v.IP)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *LinkConfigurator) startDHCPClient(name string) error {
+	r, ok := c.dhcpcd[name]
+	if !ok {
+		r = runner.New(c.logger.WithField("proc", "dhcpcd").WithField("link", name))
+		c.dhcpcd[name] = r
+	}
+	args := []string{"-B"}
+	if metric := routeMetric(name); metric > 0 {
+		args = append(args, fmt.Sprintf("--metric=%d", metric))
+	}
+	_, err := r.Start(runner.Cmd("dhcpcd", append(args, name)...))
+	if err != nil {
+		return fmt.Errorf("start link %s dhcp client: %w", name, err)
+	}
+	return nil
+}
+
+func (c *LinkConfigurator) stopDHCPClient(name string) {
+	if r, ok := c.dhcpcd[name]; ok {
+		r.Stop()
+		delete(c.dhcpcd, name)
+	}
+}
+
+// stopDHCPClients stops the DHCP clients of the given link and its VLAN links.
+func (c *LinkConfigurator) stopDHCPClients(name string) {
+	for l := range c.dhcpcd {
+		if l == name || isVLANLinkName(name, l) {
+			c.stopDHCPClient(l)
+		}
+	}
+}
+
+// Close stops all DHCP clients.
+func (c *LinkConfigurator) Close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for l := range c.dhcpcd {
+		c.stopDHCPClient(l)
+	}
+}
+
+// routeMetric returns the metric of the given link's default route or 0 to use the default.
+func routeMetric(name string) int {
+	if startsWith(name, cellular.InterfaceNamePrefixes) {
+		return CellularRouteMetric
+	}
+	return 0
+}
+
+// addressChanges returns the addresses to add and to remove in order to get from the current to the desired global addresses.
+func addressChanges(current []*net.IPNet, desired []string) (add, del []*net.IPNet, err error) {
+	desiredSet := make(map[string]struct{}, len(desired))
+	currentSet := make(map[string]struct{}, len(current))
+	for _, a := range current {
+		if a.IP.IsGlobalUnicast() {
+			currentSet[a.String()] = struct{}{}
+		}
+	}
+	for _, a := range desired {
+		ip, ipNet, err := net.ParseCIDR(a)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid address: %w", err)
+		}
+		ipNet.IP = ip
+		if _, ok := desiredSet[ipNet.String()]; ok {
+			continue
+		}
+		desiredSet[ipNet.String()] = struct{}{}
+		if _, ok := currentSet[ipNet.String()]; !ok {
+			add = append(add, ipNet)
+		}
+	}
+	for _, a := range current {
+		if _, ok := currentSet[a.String()]; !ok {
+			continue
+		}
+		if _, ok := desiredSet[a.String()]; !ok {
+			del = append(del, a)
+		}
+	}
+	return add, del, nil
+}
+
+// resolvConfHeader marks a resolv.conf file written by kubemate.
+const resolvConfHeader = "# Generated by kubemate\n"
+
+func generateResolvConf(dns []string) string {
+	var b strings.Builder
+	b.WriteString(resolvConfHeader)
+	for _, ip := range dns {
+		b.WriteString(fmt.Sprintf("nameserver %s\n", ip))
+	}
+	return b.String()
+}
+
+func vlanLinkName(parent string, id int) string {
+	return fmt.Sprintf("%s.%d", parent, id)
+}
+
+func isVLANLinkName(parent, name string) bool {
+	id, ok := strings.CutPrefix(name, parent+".")
+	if !ok {
+		return false
+	}
+	_, err := strconv.Atoi(id)
+	return err == nil
+}
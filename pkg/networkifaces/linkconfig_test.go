@@ -0,0 +1,128 @@
+package networkifaces
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddressChanges(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		current []string
+		desired []string
+		add     []string
+		del     []string
+	}{
+		{
+			name:    "unchanged",
+			current: []string{"192.168.1.2/24"},
+			desired: []string{"192.168.1.2/24"},
+		},
+		{
+			name:    "replace address",
+			current: []string{"192.168.1.2/24", "fd00::2/64"},
+			desired: []string{"192.168.1.3/24", "fd00::2/64"},
+			add:     []string{"192.168.1.3/24"},
+			del:     []string{"192.168.1.2/24"},
+		},
+		{
+			name:    "change prefix length",
+			current: []string{"192.168.1.2/24"},
+			desired: []string{"192.168.1.2/16"},
+			add:     []string{"192.168.1.2/16"},
+			del:     []string{"192.168.1.2/24"},
+		},
+		{
+			name:    "keep link-local and loopback addresses",
+			current: []string{"fe80::1/64", "127.0.0.1/8"},
+			desired: []string{"10.0.0.2/8", "10.0.0.2/8"},
+			add:     []string{"10.0.0.2/8"},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			current := make([]*net.IPNet, len(c.current))
+			for i, a := range c.current {
+				ip, ipNet, err := net.ParseCIDR(a)
+				require.NoError(t, err)
+				ipNet.IP = ip
+				current[i] = ipNet
+			}
+			add, del, err := addressChanges(current, c.desired)
+			require.NoError(t, err)
+			require.Equal(t, c.add, ipNetStrings(add), "add")
+			require.Equal(t, c.del, ipNetStrings(del), "del")
+		})
+	}
+}
+
+func TestAddressChangesInvalidAddress(t *testing.T) {
+	_, _, err := addressChanges(nil, []string{"192.168.1.2"})
+	require.Error(t, err)
+}
+
+func TestIsVLANLinkName(t *testing.T) {
+	require.True(t, isVLANLinkName("eth0", vlanLinkName("eth0", 10)), "eth0.10")
+	require.False(t, isVLANLinkName("eth0", "eth0"), "eth0")
+	require.False(t, isVLANLinkName("eth0", "eth1.10"), "eth1.10")
+	require.False(t, isVLANLinkName("eth0", "eth0.x"), "eth0.x")
+}
+
+func TestGenerateResolvConf(t *testing.T) {
+	require.Equal(t, "# Generated by kubemate\nnameserver 1.1.1.1\nnameserver 2606:4700:4700::1111\n", generateResolvConf([]string{"1.1.1.1", "2606:4700:4700::1111"}))
+}
+
+func TestRouteMetric(t *testing.T) {
+	require.Equal(t, CellularRouteMetric, routeMetric("wwan0"), "wwan0")
+	require.Equal(t, 0, routeMetric("eth0"), "eth0")
+}
+
+func ipNetStrings(a []*net.IPNet) []string {
+	if len(a) == 0 {
+		return nil
+	}
+	s := make([]string, len(a))
+	for i, n := range a {
+		s[i] = n.String()
+	}
+	return s
+}
+
+func TestRestoreResolvConf(t *testing.T) {
+	generated := generateResolvConf([]string{"1.1.1.1"})
+	for _, c := range []struct {
+		name     string
+		orig     *string
+		current  string
+		expected *string
+	}{
+		{"restore generated", ptr("nameserver 192.168.1.1\n"), generated, ptr("nameserver 192.168.1.1\n")},
+		{"keep changed by host", ptr("nameserver 192.168.1.1\n"), "nameserver 10.0.0.1\n", ptr("nameserver 10.0.0.1\n")},
+		{"remove generated when absent before", nil, generated, nil},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			conf := &LinkConfigurator{ResolvConf: filepath.Join(t.TempDir(), "resolv.conf")}
+			require.NoError(t, os.WriteFile(conf.ResolvConf, []byte(c.current), 0644))
+			var orig []byte
+			if c.orig != nil {
+				orig = []byte(*c.orig)
+			}
+			err := conf.restoreResolvConf(orig)
+			require.NoError(t, err)
+			b, err := os.ReadFile(conf.ResolvConf)
+			if c.expected == nil {
+				require.True(t, os.IsNotExist(err), "should remove file")
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, *c.expected, string(b))
+		})
+	}
+}
+
+func ptr(s string) *string {
+	return &s
+}
@@ -1,23 +1,32 @@
 package networkifaces
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
 	"fmt"
 	"net"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/cellular"
 	"github.com/mgoltzsche/kubemate/pkg/storage"
 	"github.com/mgoltzsche/kubemate/pkg/wifi"
 	"github.com/sirupsen/logrus"
 	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 )
 
+// ManagedInterfaceNamePrefixes are the name prefixes of the network links a NetworkInterface resource is created for automatically.
+var ManagedInterfaceNamePrefixes = []string{"eth", "enp", "enx", "wlan", "wlp", "wlx", "wwan", "wwp", "wwx", "usb"}
+
 // NetworkIfaceSync implements the NetworkInterface resource synchronization.
+// It creates and deletes NetworkInterface resources as network links appear and disappear, e.g. when a USB adapter is plugged in.
 type NetworkIfaceSync struct {
 	Interfaces    []string
 	DefaultAPSSID string
@@ -53,64 +62,217 @@ func (s *NetworkIfaceSync) Stop() error {
 }
 
 func startNetworkLinkStatusSync(ctx context.Context, apSSID string, ifaces []string, store storage.Interface) error {
-	// TODO: remove old iface resources. unify this with the mdns device synchronization.
+	// TODO: unify this with the mdns device synchronization.
 	ch := make(chan netlink.LinkUpdate)
 	err := netlink.LinkSubscribe(ch, ctx.Done())
 	if err != nil {
 		return err
 	}
-	ifaceSet := map[string]struct{}{}
-	for _, iface := range ifaces {
-		ifaceSet[iface] = struct{}{}
-		link, err := netlink.LinkByName(iface)
-		if err != nil {
-			return err
-		}
-		o := deviceapi.NetworkInterface{}
-		o.Name = iface
-		o.Spec.Wifi = deviceapi.WifiSpec{
-			Mode: deviceapi.WifiModeDisabled,
-			AccessPoint: deviceapi.WifiAccessPointSpec{
-				SSID: apSSID,
-			},
+	links, err := netlink.LinkList()
+	if err != nil {
+		return fmt.Errorf("list network links: %w", err)
+	}
+	managed := newLinkSet()
+	for _, link := range links {
+		if !isManagedLink(link, ifaces) {
+			continue
 		}
-		updateNetworkInterfaceStatus(link.Attrs(), &o)
-		err = store.Create(iface, &o)
+		err = ensureNetworkInterface(link.Attrs(), apSSID, store)
 		if err != nil {
-			if !errors.IsAlreadyExists(err) {
-				return err
-			}
-			err = store.Update(o.Name, &o, func() error {
-				updateNetworkInterfaceStatus(link.Attrs(), &o)
-				return nil
-			})
-			if err != nil {
-				return err
-			}
+			return err
 		}
+		managed.add(link.Attrs().Name)
+	}
+	err = removeStaleNetworkInterfaces(managed, apSSID, store)
+	if err != nil {
+		return err
 	}
+	go syncLinkStatistics(ctx, managed, store)
 	go func() {
 		for evt := range ch {
 			name := evt.Attrs().Name
-			_, ok := ifaceSet[name]
-			if ok {
-				logrus.WithField("netlink", name).WithField("flags", evt.Link.Attrs().Flags.String()).Debug("observed network link status update")
-				iface := &deviceapi.NetworkInterface{}
-				err := store.Update(name, iface, func() error {
-					updateNetworkInterfaceStatus(evt.Link.Attrs(), iface)
-					return nil
-				})
+			if !isManagedLink(evt.Link, ifaces) {
+				continue
+			}
+			logger := logrus.WithField("netlink", name)
+			if evt.Header.Type == unix.RTM_DELLINK {
+				logger.Info("network link removed")
+				managed.remove(name)
+				linkMetrics.remove(name)
+				err := removeNetworkInterface(name, apSSID, store)
 				if err != nil {
-					logrus.Error(fmt.Errorf("update networkinterface status: %w", err))
+					logrus.Error(err)
+				}
+				continue
+			}
+			if !managed.contains(name) {
+				logger.Info("network link added")
+				err := ensureNetworkInterface(evt.Link.Attrs(), apSSID, store)
+				if err != nil {
+					logrus.Error(fmt.Errorf("create networkinterface: %w", err))
 					continue
 				}
-				time.Sleep(time.Second)
+				managed.add(name)
+				continue
 			}
+			logger.WithField("flags", evt.Link.Attrs().Flags.String()).Debug("observed network link status update")
+			iface := &deviceapi.NetworkInterface{}
+			err := store.Update(name, iface, func() error {
+				updateNetworkInterfaceStatus(evt.Link.Attrs(), iface)
+				return nil
+			})
+			if err != nil {
+				logrus.Error(fmt.Errorf("update networkinterface status: %w", err))
+				continue
+			}
+			time.Sleep(time.Second)
 		}
 	}()
 	return nil
 }
 
+// isManagedLink returns true if a NetworkInterface resource should be maintained for the given link.
+// These are the explicitly configured interfaces as well as the physical ethernet, wifi and cellular links, including hotplugged USB adapters.
+func isManagedLink(link netlink.Link, ifaces []string) bool {
+	return isManagedLinkName(link.Attrs().Name, link.Type(), ifaces)
+}
+
+func isManagedLinkName(name, linkType string, ifaces []string) bool {
+	for _, iface := range ifaces {
+		if name == iface {
+			return true
+		}
+	}
+	if linkType == "vlan" || name == wifi.VirtualAPInterface {
+		return false
+	}
+	return startsWith(name, ManagedInterfaceNamePrefixes)
+}
+
+// defaultSpec returns the spec of a NetworkInterface resource that is created for a new link.
+func defaultSpec(apSSID string) deviceapi.NetworkInterfaceSpec {
+	return deviceapi.NetworkInterfaceSpec{
+		Wifi: deviceapi.WifiSpec{
+			Mode: deviceapi.WifiModeDisabled,
+			AccessPoint: deviceapi.WifiAccessPointSpec{
+				SSID: apSSID,
+			},
+		},
+	}
+}
+
+// ensureNetworkInterface creates the NetworkInterface resource for the given link or updates its status if it exists already.
+func ensureNetworkInterface(a *netlink.LinkAttrs, apSSID string, store storage.Interface) error {
+	o := deviceapi.NetworkInterface{}
+	o.Name = a.Name
+	o.Spec = defaultSpec(apSSID)
+	updateNetworkInterfaceStatus(a, &o)
+	err := store.Create(o.Name, &o)
+	if err != nil {
+		if !errors.IsAlreadyExists(err) {
+			return err
+		}
+		return store.Update(o.Name, &o, func() error {
+			updateNetworkInterfaceStatus(a, &o)
+			return nil
+		})
+	}
+	return nil
+}
+
+// removeStaleNetworkInterfaces removes the NetworkInterface resources whose link does not exist anymore, e.g. an unplugged USB adapter.
+func removeStaleNetworkInterfaces(managed *linkSet, apSSID string, store storage.Interface) error {
+	l := deviceapi.NetworkInterfaceList{}
+	err := store.List(&l)
+	if err != nil {
+		return err
+	}
+	for _, iface := range l.Items {
+		if managed.contains(iface.Name) || iface.Status.Link.Absent {
+			continue
+		}
+		logrus.WithField("netlink", iface.Name).Info("removing stale network interface")
+		err = removeNetworkInterface(iface.Name, apSSID, store)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeNetworkInterface deletes the NetworkInterface resource of a link that does not exist anymore unless its spec was changed.
+// A changed resource is marked absent instead in order to apply its spec again when the link reappears, e.g. after a USB adapter was replugged or enumerated late during boot.
+func removeNetworkInterface(name, apSSID string, store storage.Interface) error {
+	iface := &deviceapi.NetworkInterface{}
+	keep := false
+	err := store.Delete(name, iface, func() error {
+		if !equality.Semantic.DeepEqual(iface.Spec, defaultSpec(apSSID)) {
+			keep = true
+			return fmt.Errorf("networkinterface %s has a changed spec", name)
+		}
+		return nil
+	})
+	if !keep {
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("delete networkinterface %s: %w", name, err)
+		}
+		return nil
+	}
+	err = store.Update(name, iface, func() error {
+		iface.Status.Link = deviceapi.NetworkLinkStatus{
+			Type:   iface.Status.Link.Type,
+			MAC:    iface.Status.Link.MAC,
+			Absent: true,
+		}
+		return nil
+	})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("mark networkinterface %s absent: %w", name, err)
+	}
+	return nil
+}
+
+// linkSet is the set of network links a NetworkInterface resource is maintained for.
+type linkSet struct {
+	names map[string]struct{}
+	mutex sync.Mutex
+}
+
+func newLinkSet() *linkSet {
+	return &linkSet{names: map[string]struct{}{}}
+}
+
+func (s *linkSet) add(name string) {
+	s.mutex.Lock()
+	s.names[name] = struct{}{}
+	s.mutex.Unlock()
+}
+
+func (s *linkSet) remove(name string) {
+	s.mutex.Lock()
+	delete(s.names, name)
+	s.mutex.Unlock()
+}
+
+func (s *linkSet) contains(name string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, ok := s.names[name]
+	return ok
+}
+
+// list returns the names of the links in alphabetical order.
+func (s *linkSet) list() []string {
+	s.mutex.Lock()
+	names := make([]string, 0, len(s.names))
+	for name := range s.names {
+		names = append(names, name)
+	}
+	s.mutex.Unlock()
+	sort.Strings(names)
+	return names
+}
+
 func updateNetworkInterfaceStatus(a *netlink.LinkAttrs, o *deviceapi.NetworkInterface) {
 	l := &o.Status.Link
 	l.Index = a.Index
@@ -118,7 +280,9 @@ func updateNetworkInterfaceStatus(a *netlink.LinkAttrs, o *deviceapi.NetworkInte
 	l.Up = a.OperState == netlink.OperUp
 	l.MAC = a.HardwareAddr.String()
 	l.IP4 = ""
+	l.IP6 = nil
 	l.Error = ""
+	l.Absent = false
 	if l.Up {
 		ipv4, err := IPv4Address(a.Name)
 		if err != nil {
@@ -129,6 +293,13 @@ func updateNetworkInterfaceStatus(a *netlink.LinkAttrs, o *deviceapi.NetworkInte
 		if ipv4 != nil {
 			l.IP4 = ipv4.String()
 		}
+		ipv6, err := IPv6Addresses(a.Name)
+		if err != nil {
+			logrus.Warnf("failed to get IPv6 addresses for network interface %s: %s", o.Name, err)
+			l.Error = err.Error()
+			return
+		}
+		l.IP6 = IPStrings(ipv6)
 	}
 }
 
@@ -136,6 +307,8 @@ func ifaceType(a *netlink.LinkAttrs) deviceapi.NetworkInterfaceType {
 	t := deviceapi.NetworkInterfaceType(a.EncapType)
 	if startsWith(a.Name, wifi.WifiInterfaceNamePrefixes) {
 		t = deviceapi.NetworkInterfaceTypeWifi
+	} else if startsWith(a.Name, cellular.InterfaceNamePrefixes) {
+		t = deviceapi.NetworkInterfaceTypeCellular
 	}
 	return t
 }
@@ -176,6 +349,63 @@ func IPv4Address(ifaceName string) (net.IP, error) {
 	return nil, nil
 }
 
+// IPAddresses returns the IPv4 address and the global IPv6 addresses of the given network interface.
+func IPAddresses(ifaceName string) ([]net.IP, error) {
+	ipv4, err := IPv4Address(ifaceName)
+	if err != nil {
+		return nil, err
+	}
+	ipv6, err := IPv6Addresses(ifaceName)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, 0, len(ipv6)+1)
+	if ipv4 != nil {
+		ips = append(ips, ipv4)
+	}
+	return append(ips, ipv6...), nil
+}
+
+// IPv6Addresses returns the global (including unique local) IPv6 addresses of the given network interface in a stable order.
+// Temporary (privacy) and deprecated addresses are skipped since they change over time.
+func IPv6Addresses(ifaceName string) ([]net.IP, error) {
+	link, err := netlink.LinkByName(ifaceName)
+	if err != nil {
+		return nil, fmt.Errorf("get network interface %s: %w", ifaceName, err)
+	}
+	addrs, err := netlink.AddrList(link, netlink.FAMILY_V6)
+	if err != nil {
+		return nil, fmt.Errorf("get network interface %s addrs: %w", ifaceName, err)
+	}
+	return stableIPv6Addresses(addrs), nil
+}
+
+func stableIPv6Addresses(addrs []netlink.Addr) []net.IP {
+	var ips []net.IP
+	for _, a := range addrs {
+		if a.IPNet == nil || a.IP.To4() != nil || !a.IP.IsGlobalUnicast() || a.Flags&(unix.IFA_F_TEMPORARY|unix.IFA_F_DEPRECATED) != 0 {
+			continue
+		}
+		ips = append(ips, a.IP)
+	}
+	sort.Slice(ips, func(i, j int) bool {
+		return bytes.Compare(ips[i], ips[j]) < 0
+	})
+	return ips
+}
+
+// IPStrings converts the given IPs to strings.
+func IPStrings(ips []net.IP) []string {
+	if len(ips) == 0 {
+		return nil
+	}
+	s := make([]string, len(ips))
+	for i, ip := range ips {
+		s[i] = ip.String()
+	}
+	return s
+}
+
 func toBroadcastIP(ip *net.IPNet) net.IP {
 	brd := make(net.IP, len(ip.IP.To4()))
 	binary.BigEndian.PutUint32(brd, binary.BigEndian.Uint32(ip.IP.To4())|^binary.BigEndian.Uint32(net.IP(ip.Mask).To4()))
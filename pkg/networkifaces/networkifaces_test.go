@@ -0,0 +1,113 @@
+package networkifaces
+
+import (
+	"net"
+	"testing"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/storage"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestIsManagedLinkName(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		linkType string
+		expected bool
+	}{
+		{name: "eth0", linkType: "device", expected: true},
+		{name: "enx00e04c680001", linkType: "device", expected: true},
+		{name: "wlan1", linkType: "device", expected: true},
+		{name: "wlx00c0ca123456", linkType: "device", expected: true},
+		{name: "wwan0", linkType: "device", expected: true},
+		{name: "wwp0s20f0u6", linkType: "device", expected: true},
+		{name: "wwx0c5b8f279a64", linkType: "device", expected: true},
+		{name: "usb0", linkType: "device", expected: true},
+		{name: "br0", linkType: "bridge", expected: true},
+		{name: "eth0.10", linkType: "vlan"},
+		{name: "uap0", linkType: "device"},
+		{name: "lo", linkType: "device"},
+		{name: "cni0", linkType: "bridge"},
+		{name: "flannel.1", linkType: "vxlan"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.expected, isManagedLinkName(c.name, c.linkType, []string{"br0"}))
+		})
+	}
+}
+
+func TestIfaceType(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		expected deviceapi.NetworkInterfaceType
+	}{
+		{name: "eth0", expected: deviceapi.NetworkInterfaceTypeEther},
+		{name: "wlan0", expected: deviceapi.NetworkInterfaceTypeWifi},
+		{name: "wlx00c0ca123456", expected: deviceapi.NetworkInterfaceTypeWifi},
+		{name: "wwan0", expected: deviceapi.NetworkInterfaceTypeCellular},
+		{name: "wwp0s20f0u6", expected: deviceapi.NetworkInterfaceTypeCellular},
+		{name: "wwx0c5b8f279a64", expected: deviceapi.NetworkInterfaceTypeCellular},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.expected, ifaceType(&netlink.LinkAttrs{Name: c.name, EncapType: "ether"}))
+		})
+	}
+}
+
+func TestLinkSet(t *testing.T) {
+	s := newLinkSet()
+	s.add("wlan1")
+	s.add("eth0")
+	s.add("wlan0")
+	s.remove("wlan1")
+	require.True(t, s.contains("eth0"))
+	require.False(t, s.contains("wlan1"))
+	require.Equal(t, []string{"eth0", "wlan0"}, s.list())
+}
+
+func TestRemoveNetworkInterface(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, deviceapi.AddToScheme(scheme))
+	store := storage.InMemory(scheme)
+	unchanged := &deviceapi.NetworkInterface{Spec: defaultSpec("mydevice")}
+	unchanged.Name = "eth1"
+	unchanged.Status.Link = deviceapi.NetworkLinkStatus{Type: deviceapi.NetworkInterfaceTypeEther, Up: true, IP4: "192.168.1.2"}
+	changed := unchanged.DeepCopy()
+	changed.Name = "enx001122334455"
+	changed.Spec.Link = &deviceapi.NetworkLinkConfig{IP: &deviceapi.IPConfig{Mode: deviceapi.IPConfigModeDHCP}}
+	require.NoError(t, store.Create(unchanged.Name, unchanged))
+	require.NoError(t, store.Create(changed.Name, changed))
+
+	require.NoError(t, removeNetworkInterface(unchanged.Name, "mydevice", store), "remove unchanged")
+	require.NoError(t, removeNetworkInterface(changed.Name, "mydevice", store), "remove changed")
+	require.NoError(t, removeNetworkInterface("missing", "mydevice", store), "remove missing")
+
+	iface := &deviceapi.NetworkInterface{}
+	err := store.Get(unchanged.Name, iface)
+	require.True(t, errors.IsNotFound(err), "should delete unchanged networkinterface, got %v", err)
+	require.NoError(t, store.Get(changed.Name, iface), "should keep changed networkinterface")
+	require.Equal(t, changed.Spec, iface.Spec, "spec")
+	require.Equal(t, deviceapi.NetworkLinkStatus{Type: deviceapi.NetworkInterfaceTypeEther, Absent: true}, iface.Status.Link, "link status")
+}
+
+func TestStableIPv6Addresses(t *testing.T) {
+	addr := func(cidr string, flags int) netlink.Addr {
+		ip, ipnet, err := net.ParseCIDR(cidr)
+		require.NoError(t, err)
+		ipnet.IP = ip
+		return netlink.Addr{IPNet: ipnet, Flags: flags}
+	}
+	ips := stableIPv6Addresses([]netlink.Addr{
+		addr("2001:db8::f00/64", unix.IFA_F_TEMPORARY),
+		addr("2001:db8::2/64", 0),
+		addr("fe80::1/64", 0),
+		addr("2001:db8::3/64", unix.IFA_F_DEPRECATED),
+		addr("2001:db8::1/64", unix.IFA_F_MANAGETEMPADDR),
+		addr("192.168.1.2/24", 0),
+	})
+	require.Equal(t, []string{"2001:db8::1", "2001:db8::2"}, IPStrings(ips))
+}
@@ -0,0 +1,202 @@
+package networkifaces
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/storage"
+	"github.com/mgoltzsche/kubemate/pkg/wifi"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+const (
+	// linkStatisticsInterval is the interval in which the link statistics are collected for the metrics.
+	linkStatisticsInterval = 15 * time.Second
+	// linkStatisticsStatusInterval is the minimum interval between two status updates of a link's statistics.
+	linkStatisticsStatusInterval = time.Minute
+)
+
+var (
+	linkMetrics             = newLinkMetricsCollector()
+	registerLinkMetricsOnce sync.Once
+)
+
+// linkStatistics is a sample of a link's statistics.
+type linkStatistics struct {
+	Up         bool
+	Statistics deviceapi.NetworkLinkStatistics
+	Wifi       *deviceapi.WifiLinkQuality
+}
+
+// syncLinkStatistics collects the link statistics periodically, exposes them as metrics and writes them into the status at a lower rate.
+func syncLinkStatistics(ctx context.Context, links *linkSet, store storage.Interface) {
+	registerLinkMetricsOnce.Do(func() {
+		legacyregistry.CustomMustRegister(linkMetrics)
+	})
+	lastStatusUpdate := map[string]time.Time{}
+	ticker := time.NewTicker(linkStatisticsInterval)
+	defer ticker.Stop()
+	for {
+		for _, name := range links.list() {
+			s, err := readLinkStatistics(name)
+			if err != nil {
+				logrus.WithField("iface", name).Debug(fmt.Errorf("read link statistics: %w", err))
+				continue
+			}
+			linkMetrics.set(name, s)
+			if time.Since(lastStatusUpdate[name]) < linkStatisticsStatusInterval {
+				continue
+			}
+			lastStatusUpdate[name] = time.Now()
+			iface := &deviceapi.NetworkInterface{}
+			err = store.Update(name, iface, func() error {
+				iface.Status.Link.Statistics = &s.Statistics
+				iface.Status.Wifi.Quality = s.Wifi
+				return nil
+			})
+			if err != nil && !errors.IsNotFound(err) {
+				logrus.Error(fmt.Errorf("update networkinterface statistics: %w", err))
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func readLinkStatistics(name string) (*linkStatistics, error) {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return nil, err
+	}
+	a := link.Attrs()
+	s := &linkStatistics{Up: a.OperState == netlink.OperUp}
+	if st := a.Statistics; st != nil {
+		s.Statistics = deviceapi.NetworkLinkStatistics{
+			RxBytes:   int64(st.RxBytes),
+			TxBytes:   int64(st.TxBytes),
+			RxPackets: int64(st.RxPackets),
+			TxPackets: int64(st.TxPackets),
+			RxErrors:  int64(st.RxErrors),
+			TxErrors:  int64(st.TxErrors),
+			RxDropped: int64(st.RxDropped),
+			TxDropped: int64(st.TxDropped),
+		}
+	}
+	if ifaceType(a) == deviceapi.NetworkInterfaceTypeWifi && s.Up {
+		q, err := wifi.InterfaceLinkQuality(name)
+		if err != nil {
+			logrus.WithField("iface", name).Debug(fmt.Errorf("read wifi link quality: %w", err))
+		} else {
+			s.Wifi = &deviceapi.WifiLinkQuality{
+				Signal:              q.Signal,
+				Noise:               q.Noise,
+				Bitrate:             q.Bitrate,
+				AccessPointStations: q.AccessPointStations,
+			}
+		}
+	}
+	return s, nil
+}
+
+// linkMetricsCollector exposes the latest link statistics samples as Prometheus metrics.
+type linkMetricsCollector struct {
+	metrics.BaseStableCollector
+	up         *metrics.Desc
+	counters   []linkCounterMetric
+	signal     *metrics.Desc
+	noise      *metrics.Desc
+	bitrate    *metrics.Desc
+	apStations *metrics.Desc
+	samples    map[string]*linkStatistics
+	mutex      sync.Mutex
+}
+
+type linkCounterMetric struct {
+	desc  *metrics.Desc
+	value func(*deviceapi.NetworkLinkStatistics) int64
+}
+
+func newLinkMetricsCollector() *linkMetricsCollector {
+	desc := func(name, help string) *metrics.Desc {
+		return metrics.NewDesc("kubemate_network_"+name, help, []string{"interface"}, nil, metrics.ALPHA, "")
+	}
+	counter := func(name, help string, value func(*deviceapi.NetworkLinkStatistics) int64) linkCounterMetric {
+		return linkCounterMetric{desc: desc(name, help), value: value}
+	}
+	return &linkMetricsCollector{
+		up: desc("up", "Whether the network link is up."),
+		counters: []linkCounterMetric{
+			counter("receive_bytes_total", "Number of bytes received by the network link.", func(s *deviceapi.NetworkLinkStatistics) int64 { return s.RxBytes }),
+			counter("transmit_bytes_total", "Number of bytes transmitted by the network link.", func(s *deviceapi.NetworkLinkStatistics) int64 { return s.TxBytes }),
+			counter("receive_packets_total", "Number of packets received by the network link.", func(s *deviceapi.NetworkLinkStatistics) int64 { return s.RxPackets }),
+			counter("transmit_packets_total", "Number of packets transmitted by the network link.", func(s *deviceapi.NetworkLinkStatistics) int64 { return s.TxPackets }),
+			counter("receive_errors_total", "Number of receive errors of the network link.", func(s *deviceapi.NetworkLinkStatistics) int64 { return s.RxErrors }),
+			counter("transmit_errors_total", "Number of transmit errors of the network link.", func(s *deviceapi.NetworkLinkStatistics) int64 { return s.TxErrors }),
+			counter("receive_dropped_total", "Number of received packets dropped by the network link.", func(s *deviceapi.NetworkLinkStatistics) int64 { return s.RxDropped }),
+			counter("transmit_dropped_total", "Number of packets to transmit dropped by the network link.", func(s *deviceapi.NetworkLinkStatistics) int64 { return s.TxDropped }),
+		},
+		signal:     desc("wifi_signal_dbm", "Signal strength of the wifi network the station is associated with."),
+		noise:      desc("wifi_noise_dbm", "Noise level of the wifi channel in use."),
+		bitrate:    desc("wifi_bitrate_mbps", "Transmit bitrate of the wifi station."),
+		apStations: desc("wifi_access_point_stations", "Number of clients associated with the wifi access point."),
+		samples:    map[string]*linkStatistics{},
+	}
+}
+
+func (c *linkMetricsCollector) set(iface string, s *linkStatistics) {
+	c.mutex.Lock()
+	c.samples[iface] = s
+	c.mutex.Unlock()
+}
+
+func (c *linkMetricsCollector) remove(iface string) {
+	c.mutex.Lock()
+	delete(c.samples, iface)
+	c.mutex.Unlock()
+}
+
+func (c *linkMetricsCollector) DescribeWithStability(ch chan<- *metrics.Desc) {
+	ch <- c.up
+	for _, m := range c.counters {
+		ch <- m.desc
+	}
+	ch <- c.signal
+	ch <- c.noise
+	ch <- c.bitrate
+	ch <- c.apStations
+}
+
+func (c *linkMetricsCollector) CollectWithStability(ch chan<- metrics.Metric) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for iface, s := range c.samples {
+		up := 0.0
+		if s.Up {
+			up = 1
+		}
+		ch <- metrics.NewLazyConstMetric(c.up, metrics.GaugeValue, up, iface)
+		for _, m := range c.counters {
+			ch <- metrics.NewLazyConstMetric(m.desc, metrics.CounterValue, float64(m.value(&s.Statistics)), iface)
+		}
+		if q := s.Wifi; q != nil {
+			if q.Signal != 0 {
+				ch <- metrics.NewLazyConstMetric(c.signal, metrics.GaugeValue, float64(q.Signal), iface)
+				ch <- metrics.NewLazyConstMetric(c.bitrate, metrics.GaugeValue, float64(q.Bitrate), iface)
+			}
+			if q.Noise != 0 {
+				ch <- metrics.NewLazyConstMetric(c.noise, metrics.GaugeValue, float64(q.Noise), iface)
+			}
+			ch <- metrics.NewLazyConstMetric(c.apStations, metrics.GaugeValue, float64(q.AccessPointStations), iface)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package networkifaces
+
+import (
+	"strings"
+	"testing"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/stretchr/testify/require"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestLinkMetricsCollector(t *testing.T) {
+	c := newLinkMetricsCollector()
+	c.set("eth0", &linkStatistics{
+		Up:         true,
+		Statistics: deviceapi.NetworkLinkStatistics{RxBytes: 1024, TxBytes: 512},
+	})
+	c.set("wlan0", &linkStatistics{
+		Wifi: &deviceapi.WifiLinkQuality{Noise: -95, AccessPointStations: 2},
+	})
+	expected := `
+# HELP kubemate_network_receive_bytes_total [ALPHA] Number of bytes received by the network link.
+# TYPE kubemate_network_receive_bytes_total counter
+kubemate_network_receive_bytes_total{interface="eth0"} 1024
+kubemate_network_receive_bytes_total{interface="wlan0"} 0
+# HELP kubemate_network_up [ALPHA] Whether the network link is up.
+# TYPE kubemate_network_up gauge
+kubemate_network_up{interface="eth0"} 1
+kubemate_network_up{interface="wlan0"} 0
+# HELP kubemate_network_wifi_access_point_stations [ALPHA] Number of clients associated with the wifi access point.
+# TYPE kubemate_network_wifi_access_point_stations gauge
+kubemate_network_wifi_access_point_stations{interface="wlan0"} 2
+# HELP kubemate_network_wifi_noise_dbm [ALPHA] Noise level of the wifi channel in use.
+# TYPE kubemate_network_wifi_noise_dbm gauge
+kubemate_network_wifi_noise_dbm{interface="wlan0"} -95
+`
+	err := testutil.CustomCollectAndCompare(c, strings.NewReader(expected),
+		"kubemate_network_up",
+		"kubemate_network_receive_bytes_total",
+		"kubemate_network_wifi_signal_dbm",
+		"kubemate_network_wifi_noise_dbm",
+		"kubemate_network_wifi_access_point_stations",
+	)
+	require.NoError(t, err)
+}
@@ -0,0 +1,154 @@
+// Package pairing implements the HTTPS client side of the handshake that joins an agent device to a server.
+package pairing
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/certpin"
+)
+
+const requestTimeout = 15 * time.Second
+
+// ConfirmationCode derives the short code a user compares on both devices from both devices' certificate fingerprints and nonces.
+// A man in the middle would present a different certificate to at least one device, resulting in different codes.
+// Since the agent commits to its nonce before it receives the server's nonce and reveals it only afterwards,
+// neither a man in the middle nor one of the devices can choose a nonce that makes the codes match,
+// leaving a single guess with a probability of one in a million.
+func ConfirmationCode(serverFingerprint, agentFingerprint, agentNonce, serverNonce string) string {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s:%s:%s:%s", serverFingerprint, agentFingerprint, agentNonce, serverNonce)))
+	return fmt.Sprintf("%06d", binary.BigEndian.Uint32(h[:4])%1000000)
+}
+
+// NonceCommitment returns the commitment the agent submits instead of its nonce along with its pairing request.
+func NonceCommitment(nonce string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(nonce)))
+}
+
+// FetchCertFingerprint retrieves the peer's certificate from its certificates API and returns its fingerprint.
+// It fails if the certificate does not match the one the peer presents within the TLS handshake.
+func FetchCertFingerprint(ctx context.Context, address string) (string, error) {
+	var presented string
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			// The certificate is trusted on first use and verified by the user comparing the confirmation code.
+			InsecureSkipVerify: true,
+			VerifyConnection: func(s tls.ConnectionState) error {
+				if len(s.PeerCertificates) > 0 {
+					presented = fmt.Sprintf("%x", sha256.Sum256(s.PeerCertificates[0].Raw))
+				}
+				return nil
+			},
+		}},
+		Timeout: requestTimeout,
+	}
+	c := &deviceapi.Certificate{}
+	err := doJSON(ctx, client, http.MethodGet, resourceURL(address, "certificates", "self"), "", nil, c)
+	if err != nil {
+		return "", fmt.Errorf("fetch certificate: %w", err)
+	}
+	pemCert, err := base64.StdEncoding.DecodeString(c.Spec.CACert)
+	if err != nil {
+		return "", fmt.Errorf("decode certificate: %w", err)
+	}
+	fingerprint, err := certpin.Fingerprint(pemCert)
+	if err != nil {
+		return "", err
+	}
+	if fingerprint != presented {
+		return "", fmt.Errorf("certificate provided by %s does not match the presented TLS certificate", address)
+	}
+	return fingerprint, nil
+}
+
+// SubmitRequest sends a pairing request to the server.
+func SubmitRequest(ctx context.Context, serverAddress, serverFingerprint string, p *deviceapi.DevicePairing) (*deviceapi.DevicePairing, error) {
+	created := &deviceapi.DevicePairing{}
+	err := doJSON(ctx, pinnedClient(serverFingerprint), http.MethodPost, resourceURL(serverAddress, "devicepairings", ""), "", p, created)
+	if err != nil {
+		return nil, fmt.Errorf("submit pairing request: %w", err)
+	}
+	return created, nil
+}
+
+// RevealNonce sends the agent's nonce to the server after the server responded to the pairing request with its own nonce.
+// It returns the pairing including the confirmation code the server computed.
+func RevealNonce(ctx context.Context, serverAddress, serverFingerprint string, p *deviceapi.DevicePairing) (*deviceapi.DevicePairing, error) {
+	revealed := &deviceapi.DevicePairing{}
+	err := doJSON(ctx, pinnedClient(serverFingerprint), http.MethodPut, resourceURL(serverAddress, "devicepairings", p.Name), "", p, revealed)
+	if err != nil {
+		return nil, fmt.Errorf("reveal pairing nonce: %w", err)
+	}
+	return revealed, nil
+}
+
+// PushJoinToken sends the join token to the agent, authenticating using the secret the agent provided with its pairing request.
+func PushJoinToken(ctx context.Context, agentAddress, agentFingerprint, secret, serverName, joinToken string) error {
+	client := pinnedClient(agentFingerprint)
+	u := resourceURL(agentAddress, "devicepairings", serverName)
+	p := &deviceapi.DevicePairing{}
+	err := doJSON(ctx, client, http.MethodGet, u, secret, nil, p)
+	if err != nil {
+		return fmt.Errorf("push join token: %w", err)
+	}
+	p.Spec.JoinToken = joinToken
+	err = doJSON(ctx, client, http.MethodPut, u, secret, p, p)
+	if err != nil {
+		return fmt.Errorf("push join token: %w", err)
+	}
+	return nil
+}
+
+func pinnedClient(fingerprint string) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{TLSClientConfig: certpin.TLSConfig(fingerprint)},
+		Timeout:   requestTimeout,
+	}
+}
+
+func resourceURL(address, resource, name string) string {
+	gv := deviceapi.GroupVersion
+	u := fmt.Sprintf("%s/apis/%s/%s/%s", strings.TrimSuffix(address, "/"), gv.Group, gv.Version, resource)
+	if name != "" {
+		u = fmt.Sprintf("%s/%s", u, name)
+	}
+	return u
+}
+
+func doJSON(ctx context.Context, client *http.Client, method, url, bearerToken string, in, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		err := json.NewEncoder(&body).Encode(in)
+		if err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if bearerToken != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", bearerToken))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s: server responded with status %s", method, url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
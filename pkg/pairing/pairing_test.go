@@ -0,0 +1,24 @@
+package pairing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfirmationCode(t *testing.T) {
+	code := ConfirmationCode("serverfp", "agentfp", "agentnonce", "servernonce")
+	require.Len(t, code, 6, "length")
+	require.Equal(t, code, ConfirmationCode("serverfp", "agentfp", "agentnonce", "servernonce"), "deterministic")
+	require.NotEqual(t, code, ConfirmationCode("otherfp", "agentfp", "agentnonce", "servernonce"), "server fingerprint")
+	require.NotEqual(t, code, ConfirmationCode("serverfp", "otherfp", "agentnonce", "servernonce"), "agent fingerprint")
+	require.NotEqual(t, code, ConfirmationCode("serverfp", "agentfp", "other", "servernonce"), "agent nonce")
+	require.NotEqual(t, code, ConfirmationCode("serverfp", "agentfp", "agentnonce", "other"), "server nonce")
+}
+
+func TestNonceCommitment(t *testing.T) {
+	c := NonceCommitment("nonce")
+	require.Len(t, c, 64, "length")
+	require.Equal(t, c, NonceCommitment("nonce"), "deterministic")
+	require.NotEqual(t, c, NonceCommitment("other"), "nonce")
+}
@@ -5,7 +5,6 @@ package app
 
 import (
 	"context"
-	"encoding/binary"
 	"fmt"
 	"net"
 	"regexp"
@@ -13,6 +12,7 @@ import (
 	"sync"
 
 	"github.com/brutella/dnssd"
+	"github.com/mgoltzsche/kubemate/pkg/networkifaces"
 	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
 	errors "k8s.io/apimachinery/pkg/api/errors"
@@ -246,45 +246,26 @@ func ipsForNetworkInterfaces(ifaceNames []string) ([]net.IP, error) {
 	if err != nil {
 		return nil, err
 	}
-	ifaceIPMap := make(map[string]net.IP, len(ifaces))
+	ifaceIPMap := make(map[string][]net.IP, len(ifaces))
 	for _, iface := range ifaces {
-		addrs, e := iface.Addrs()
+		addrs, e := networkifaces.IPAddresses(iface.Name)
 		if e != nil {
 			if err == nil {
 				err = e
 			}
 			continue
 		}
-		for _, a := range addrs {
-			ipnet, ok := a.(*net.IPNet)
-			if !ok {
-				continue
-			}
-			v4 := ipnet.IP.To4()
-			if v4 == nil || v4.IsLoopback() || v4.IsUnspecified() || v4.IsMulticast() || v4.IsLinkLocalMulticast() || v4.IsInterfaceLocalMulticast() || v4.IsLinkLocalUnicast() {
-				continue
-			}
-			brd := toBroadcastIP(ipnet)
-			if brd.String() == v4.String() {
-				continue
-			}
-			ifaceIPMap[iface.Name] = v4
-		}
+		ifaceIPMap[iface.Name] = addrs
 	}
 
 	ips := make([]net.IP, 0, len(ifaceNames))
 	if len(ifaceNames) > 0 {
 		for _, ifaceName := range ifaceNames {
-			ip, ok := ifaceIPMap[ifaceName]
-			if ok {
-				ips = append(ips, ip)
-			}
+			ips = append(ips, ifaceIPMap[ifaceName]...)
 		}
 	} else {
 		for _, iface := range ifaces {
-			if ip, ok := ifaceIPMap[iface.Name]; ok {
-				ips = append(ips, ip)
-			}
+			ips = append(ips, ifaceIPMap[iface.Name]...)
 		}
 	}
 
@@ -294,9 +275,3 @@ func ipsForNetworkInterfaces(ifaceNames []string) ([]net.IP, error) {
 
 	return ips, nil
 }
-
-func toBroadcastIP(ip *net.IPNet) net.IP {
-	brd := make(net.IP, len(ip.IP.To4()))
-	binary.BigEndian.PutUint32(brd, binary.BigEndian.Uint32(ip.IP.To4())|^binary.BigEndian.Uint32(net.IP(ip.Mask).To4()))
-	return brd
-}
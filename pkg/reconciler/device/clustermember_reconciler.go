@@ -0,0 +1,55 @@
+package device
+
+import (
+	"context"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/discovery"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ClusterMemberReconciler lets the device discovery recognize the cluster members by the API certificate fingerprint their Node published.
+type ClusterMemberReconciler struct {
+	DeviceDiscovery *discovery.DeviceDiscovery
+	client.Client
+}
+
+func (r *ClusterMemberReconciler) AddToScheme(s *runtime.Scheme) error {
+	return corev1.AddToScheme(s)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ClusterMemberReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.Client = mgr.GetClient()
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("clustermember").
+		For(&corev1.Node{}).
+		Complete(r)
+}
+
+func (r *ClusterMemberReconciler) Reconcile(ctx context.Context, _ ctrl.Request) (ctrl.Result, error) {
+	nodes := corev1.NodeList{}
+	err := r.Client.List(ctx, &nodes)
+	if err != nil {
+		return requeue(err)
+	}
+	err = r.DeviceDiscovery.SetClusterNodes(clusterNodeFingerprints(nodes.Items))
+	if err != nil {
+		return requeue(err)
+	}
+	return ctrl.Result{}, nil
+}
+
+// clusterNodeFingerprints maps the names of the nodes that published their API certificate fingerprint to the fingerprint.
+func clusterNodeFingerprints(nodes []corev1.Node) map[string]string {
+	fingerprints := make(map[string]string, len(nodes))
+	for _, n := range nodes {
+		if fp := n.GetAnnotations()[deviceapi.APICertFingerprintAnnotation]; fp != "" {
+			fingerprints[n.Name] = fp
+		}
+	}
+	return fingerprints
+}
@@ -6,17 +6,22 @@ import (
 	"fmt"
 	"net"
 	"net/url"
-	"os"
 	"path/filepath"
+	goruntime "runtime"
+	"slices"
+	"sort"
 	"strings"
 	"syscall"
 	"time"
 
 	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
 	"github.com/mgoltzsche/kubemate/pkg/clientconf"
+	"github.com/mgoltzsche/kubemate/pkg/cliutils"
 	"github.com/mgoltzsche/kubemate/pkg/controller"
 	"github.com/mgoltzsche/kubemate/pkg/discovery"
 	"github.com/mgoltzsche/kubemate/pkg/ingress"
+	"github.com/mgoltzsche/kubemate/pkg/jointoken"
+	"github.com/mgoltzsche/kubemate/pkg/networkifaces"
 	"github.com/mgoltzsche/kubemate/pkg/reconciler/app"
 	"github.com/mgoltzsche/kubemate/pkg/runner"
 	"github.com/mgoltzsche/kubemate/pkg/storage"
@@ -32,6 +37,18 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
+// Pod and service networks used by k3s.
+// The IPv4 networks are the k3s defaults, the IPv6 networks are unique local addresses.
+const (
+	k3sClusterCIDRv4 = "10.42.0.0/16"
+	k3sServiceCIDRv4 = "10.43.0.0/16"
+	k3sClusterCIDRv6 = "fd42:42::/56"
+	k3sServiceCIDRv6 = "fd42:43::/112"
+)
+
+// k3sTokenFile is the file within the k3s data directory the cluster token is passed to k3s with.
+const k3sTokenFile = "kubemate-token"
+
 // DeviceReconciler reconciles a Device object.
 type DeviceReconciler struct {
 	DeviceName            string
@@ -39,12 +56,18 @@ type DeviceReconciler struct {
 	DataDir               string
 	ManifestDir           string
 	ExternalPort          int
+	APICertFingerprint    string
+	Version               string
+	K3sVersion            string
 	K3sProxyEnabled       *bool
 	Docker                bool
 	KubeletArgs           []string
 	Devices               storage.Interface
 	DeviceTokens          storage.Interface
 	NetworkInterfaces     storage.Interface
+	DNSConfigs            storage.Interface
+	DHCPReservations      storage.Interface
+	DHCPLeaseFile         string
 	NetworkInterfaceNames []string
 	DeviceDiscovery       *discovery.DeviceDiscovery
 	IngressController     *ingress.IngressController
@@ -73,23 +96,33 @@ func (r *DeviceReconciler) nodeClientConfig() (*rest.Config, error) {
 // SetupWithManager sets up the controller with the Manager.
 func (r *DeviceReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	nodeReconciler := &NodeReconciler{
-		DeviceName:  r.DeviceName,
-		DeviceStore: r.Devices,
-		K3sDir:      r.DataDir,
-		Shutdown:    r.Shutdown,
+		DeviceName:         r.DeviceName,
+		DeviceStore:        r.Devices,
+		DeviceTokens:       r.DeviceTokens,
+		K3sDir:             r.DataDir,
+		APICertFingerprint: r.APICertFingerprint,
+		Shutdown:           r.Shutdown,
 	}
+	clusterMemberReconciler := &ClusterMemberReconciler{DeviceDiscovery: r.DeviceDiscovery}
 	dnsDir := filepath.Join(r.DataDir, "dns")
-	r.dnsServer = newDeviceDnsServerReconciler(dnsDir, r.DeviceName, r.Devices, r.NetworkInterfaces, r.Logger)
+	r.dnsServer = newDeviceDnsServerReconciler(dnsDir, r.DHCPLeaseFile, r.DeviceName, r.Devices, r.NetworkInterfaces, r.DNSConfigs, r.DHCPReservations, r.Logger)
 	// TODO: use mgr.GetLogger() logr.Logger that controller-runtime is providing to the Reconcile method as well
 	r.controllers = controller.NewControllerManager(ctrl.GetConfig, logrus.WithField("comp", "controller-manager"))
 	r.controllers.RegisterReconciler(nodeReconciler)
+	r.controllers.RegisterReconciler(clusterMemberReconciler)
 	r.controllers.RegisterReconciler(&app.AppReconciler{})
 	r.controllers.RegisterReconciler(&app.MDNSReconciler{
 		DeviceName:        r.DeviceName,
 		NetworkInterfaces: r.NetworkInterfaceNames,
 	})
+	r.controllers.RegisterReconciler(&DNSRecordReconciler{
+		DeviceName: r.DeviceName,
+		Devices:    r.Devices,
+		DNSConfigs: r.DNSConfigs,
+	})
 	r.nodeController = controller.NewControllerManager(r.nodeClientConfig, logrus.WithField("comp", "node-controller-manager"))
 	r.nodeController.RegisterReconciler(nodeReconciler)
+	r.nodeController.RegisterReconciler(clusterMemberReconciler)
 	r.k3s = runner.New(r.Logger.WithField("proc", "k3s"))
 	r.k3s.TerminationSignal = syscall.SIGQUIT
 	r.k3s.Reporter = func(cmd runner.Command) {
@@ -128,6 +161,8 @@ func (r *DeviceReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		Watches(&deviceapi.NetworkInterface{}, handler.EnqueueRequestsFromMapFunc(r.deviceReconcileRequest)).
 		Watches(&deviceapi.DeviceToken{}, handler.EnqueueRequestsFromMapFunc(r.deviceReconcileRequest)).
 		Watches(&deviceapi.WifiPassword{}, handler.EnqueueRequestsFromMapFunc(r.deviceReconcileRequest)).
+		Watches(&deviceapi.DNSConfig{}, handler.EnqueueRequestsFromMapFunc(r.deviceReconcileRequest)).
+		Watches(&deviceapi.DHCPReservation{}, handler.EnqueueRequestsFromMapFunc(r.deviceReconcileRequest)).
 		Complete(r)
 }
 
@@ -155,8 +190,9 @@ func (r *DeviceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res
 		return ctrl.Result{}, nil
 	}
 
-	nodeIP, err := r.ipAddress()
+	nodeIPs, err := r.nodeIPs(d.Spec.DualStack)
 	if err != nil {
+		// The reconciliation is triggered again when a network interface gets an IPv4 address.
 		logger.Error(err, "no ip address available")
 		return ctrl.Result{}, nil
 	}
@@ -166,11 +202,15 @@ func (r *DeviceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res
 		return requeue(err)
 	}
 	var args []string
-	fn := func() error {
+	tokenChanged := false
+	fn := func() (err error) {
 		*r.K3sProxyEnabled = d.Spec.Mode == deviceapi.DeviceModeServer
 		switch d.Spec.Mode {
 		case deviceapi.DeviceModeServer:
-			args = buildK3sServerArgs(&d, nodeIP, r.DataDir, r.Docker, r.KubeletArgs, r.DeviceTokens)
+			args, tokenChanged, err = buildK3sServerArgs(&d, nodeIPs, r.DataDir, r.Docker, r.KubeletArgs, r.DeviceTokens)
+			if err != nil {
+				return err
+			}
 		case deviceapi.DeviceModeAgent:
 			if d.Spec.ServerAddress == "" {
 				return fmt.Errorf("no server specified to join")
@@ -185,8 +225,10 @@ func (r *DeviceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res
 			if err != nil {
 				return fmt.Errorf("join cluster: %w", err)
 			}
-			// TODO: provide token as env var
-			args = buildK3sAgentArgs(joinAddr, d.Spec.JoinTokenName, nodeIP, r.DataDir, r.Docker, r.KubeletArgs, r.DeviceTokens)
+			args, tokenChanged, err = buildK3sAgentArgs(joinAddr, d.Spec.JoinTokenName, nodeIPs, d.Spec.DualStack, r.DataDir, r.Docker, r.KubeletArgs, r.DeviceTokens)
+			if err != nil {
+				return fmt.Errorf("join server %s: %w", joinAddr, err)
+			}
 		}
 		return nil
 	}
@@ -202,11 +244,13 @@ func (r *DeviceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res
 	if r.ExternalPort != 443 {
 		addr = fmt.Sprintf("%s:%d", addr, r.ExternalPort)
 	}
-	if d.Status.Message != statusMessage || d.Status.Address != addr {
+	ips := r.ipAddresses(nodeIPs)
+	if d.Status.Message != statusMessage || d.Status.Address != addr || !slices.Equal(d.Status.IPs, ips) {
 		// Update device status
 		err = r.Devices.Update(d.Name, &d, func() error {
 			d.Status.Message = statusMessage
 			d.Status.Address = addr
+			d.Status.IPs = ips
 			d.Status.Current = true
 			return nil
 		})
@@ -215,18 +259,23 @@ func (r *DeviceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res
 		}
 	}
 	if d.Generation == d.Status.Generation {
-		// TODO: advertize only when status changed
 		err = r.DeviceDiscovery.Advertise(&deviceapi.DeviceDiscovery{
 			ObjectMeta: metav1.ObjectMeta{
 				Name: d.Name,
 			},
 			Spec: deviceapi.DeviceDiscoverySpec{
-				Address: d.Status.Address,
-				Mode:    d.Spec.Mode,
-				Server:  d.Spec.ServerAddress,
-				Current: true,
+				Address:    d.Status.Address,
+				Mode:       d.Spec.Mode,
+				Server:     d.Spec.ServerAddress,
+				Current:    true,
+				Version:    r.Version,
+				K3sVersion: r.K3sVersion,
+				State:      d.Status.State,
+				ClusterID:  r.clusterID(&d),
+				Arch:       goruntime.GOARCH,
+				IPs:        d.Status.IPs,
 			},
-		}, nodeIP)
+		})
 		if err != nil {
 			return requeue(err)
 		}
@@ -235,6 +284,10 @@ func (r *DeviceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res
 		if d.Status.State == deviceapi.DeviceStateTerminating {
 			r.k3s.Stop()
 		} else {
+			if tokenChanged {
+				// Restart k3s to apply the rotated token since the token file path does not change.
+				r.k3s.Stop()
+			}
 			r.k3s.Start(runner.Cmd("/proc/self/exe", args...))
 			if d.Spec.Mode == deviceapi.DeviceModeServer {
 				err := r.reconcileServerToken()
@@ -249,6 +302,13 @@ func (r *DeviceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res
 			r.controllers.Start()
 			r.IngressController.Start()
 		} else {
+			if d.Status.State == deviceapi.DeviceStateRunning {
+				err := r.refreshJoinToken(ctx, &d)
+				if err != nil {
+					logger.Error(err, "refresh join token")
+				}
+				res.RequeueAfter = joinTokenRefreshInterval
+			}
 			r.controllers.Stop()
 			r.IngressController.Stop()
 			if d.Status.State == deviceapi.DeviceStateTerminating {
@@ -259,49 +319,84 @@ func (r *DeviceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res
 		}
 	}
 	logger.V(1).Info("device reconciliation complete")
-	return ctrl.Result{}, nil
+	return res, nil
 }
 
-func (r *DeviceReconciler) ipAddress() (net.IP, error) {
+// nodeIPs returns the IPv4 address of the primary network link and, with dualStack enabled, its first IPv6 address.
+// Links without an IPv4 address are not considered since the cluster's IP families must not change after it was initialized.
+func (r *DeviceReconciler) nodeIPs(dualStack bool) ([]net.IP, error) {
 	l := &deviceapi.NetworkInterfaceList{}
 	err := r.NetworkInterfaces.List(l)
 	if err != nil {
 		return nil, fmt.Errorf("detect ip address: %w", err)
 	}
-	idx := 9999999
-	ip := ""
-	for _, iface := range l.Items {
-		if iface.Status.Link.Up && iface.Status.Link.IP4 != "" {
-			if i := iface.Status.Link.Index; i < idx {
-				idx = i
-				ip = iface.Status.Link.IP4
-			}
+	var primary *deviceapi.NetworkLinkStatus
+	for i := range l.Items {
+		link := &l.Items[i].Status.Link
+		if !link.Up || link.IP4 == "" {
+			continue
+		}
+		if primary == nil || link.Index < primary.Index {
+			primary = link
 		}
 	}
-	if ip == "" {
-		return nil, fmt.Errorf("all network links appear to be down")
+	if primary == nil {
+		return nil, fmt.Errorf("no network link with an ipv4 address is up")
 	}
-	return net.ParseIP(ip), nil
+	ips := []net.IP{net.ParseIP(primary.IP4)}
+	if dualStack && len(primary.IP6) > 0 {
+		// The addresses are sorted and exclude temporary ones, keeping the node IPs stable.
+		ips = append(ips, net.ParseIP(primary.IP6[0]))
+	}
+	return ips, nil
 }
 
-func (r *DeviceReconciler) reconcileServerToken() error {
-	t := &deviceapi.DeviceToken{}
-	err := r.DeviceTokens.Get(r.DeviceName, t)
+// ipAddresses returns the node IPs followed by the other IPv4 and IPv6 addresses of the device's network interfaces.
+func (r *DeviceReconciler) ipAddresses(nodeIPs []net.IP) []string {
+	ips := networkifaces.IPStrings(nodeIPs)
+	l := &deviceapi.NetworkInterfaceList{}
+	err := r.NetworkInterfaces.List(l)
 	if err != nil {
-		return err
+		r.Logger.WithError(err).Warn("failed to list network interfaces")
+		return ips
 	}
-	if t.Status.JoinToken != "" {
-		return nil // already set
-	}
-	return r.DeviceTokens.Update(r.DeviceName, t, func() error {
-		serverTokenFile := filepath.Join(r.DataDir, "server", "token")
-		b, err := os.ReadFile(serverTokenFile)
+	sort.Slice(l.Items, func(i, j int) bool {
+		return l.Items[i].Status.Link.Index < l.Items[j].Status.Link.Index
+	})
+	for _, iface := range l.Items {
+		if !iface.Status.Link.Up {
+			continue
+		}
+		addrs, err := networkifaces.IPAddresses(iface.Name)
 		if err != nil {
-			return err
+			r.Logger.WithError(err).Warnf("failed to get ip addresses of network interface %s", iface.Name)
+			continue
 		}
-		t.Status.JoinToken = strings.TrimSuffix(string(b), "\n")
-		return nil
-	})
+		for _, ip := range addrs {
+			if s := ip.String(); !slices.Contains(ips, s) {
+				ips = append(ips, s)
+			}
+		}
+	}
+	return ips
+}
+
+// clusterID returns the hash of the cluster CA certificate the device's join token refers to.
+func (r *DeviceReconciler) clusterID(d *deviceapi.Device) string {
+	t := &deviceapi.DeviceToken{}
+	if d.Spec.Mode == deviceapi.DeviceModeServer {
+		if err := r.DeviceTokens.Get(r.DeviceName, t); err != nil {
+			return ""
+		}
+		return jointoken.CAHash(t.Status.JoinToken)
+	}
+	if d.Spec.JoinTokenName == "" {
+		return ""
+	}
+	if err := r.DeviceTokens.Get(d.Spec.JoinTokenName, t); err != nil {
+		return ""
+	}
+	return jointoken.CAHash(t.Data.Token)
 }
 
 func requeue(err error) (r ctrl.Result, e error) {
@@ -322,54 +417,96 @@ func joinAddress(d *deviceapi.Device) (string, error) {
 	return fmt.Sprintf("https://%s:6443", u.Hostname()), nil
 }
 
-func buildK3sServerArgs(d *deviceapi.Device, nodeIP net.IP, dataDir string, docker bool, kubeletArgs []string, clusterTokens storage.Interface) []string {
+// writeK3sTokenFile writes the given token into the k3s token file within the data directory.
+// It returns true when the token changed.
+func writeK3sTokenFile(dataDir, token string) (string, bool, error) {
+	file := filepath.Join(dataDir, k3sTokenFile)
+	changed, err := cliutils.WriteConfigFile(file, token)
+	if err != nil {
+		return "", false, fmt.Errorf("write k3s token file: %w", err)
+	}
+	return file, changed, nil
+}
+
+func buildK3sServerArgs(d *deviceapi.Device, nodeIPs []net.IP, dataDir string, docker bool, kubeletArgs []string, clusterTokens storage.Interface) ([]string, bool, error) {
+	token := &deviceapi.DeviceToken{}
+	err := clusterTokens.Get(d.Name, token)
+	if err != nil {
+		return nil, false, err
+	}
+	tokenFile, tokenChanged, err := writeK3sTokenFile(dataDir, token.Data.Token)
+	if err != nil {
+		return nil, false, err
+	}
 	args := []string{
 		"server",
 		// TODO: specify path to k3s config here and configure everything there
-		fmt.Sprintf("--node-external-ip=%s", nodeIP.String()),
 		"--disable-cloud-controller",
 		"--disable-helm-controller",
 		"--disable=servicelb,traefik",
 		fmt.Sprintf("--kube-apiserver-arg=--token-auth-file=%s", "/etc/kubemate/tokens"),
 		fmt.Sprintf("--data-dir=%s", dataDir),
+		// Passing the token as a file prevents it from being exposed within the process list.
+		fmt.Sprintf("--token-file=%s", tokenFile),
 	}
-	token := &deviceapi.DeviceToken{}
-	err := clusterTokens.Get(d.Name, token)
-	if err != nil {
-		logrus.Error(err)
-	} else {
-		args = append(args, fmt.Sprintf("--token=%s", token.Data.Token))
-	}
+	args = append(args, k3sNetworkArgs(nodeIPs, true, d.Spec.DualStack)...)
 	if docker {
 		args = append(args, "--docker")
 	}
 	for _, a := range kubeletArgs {
 		args = append(args, fmt.Sprintf("--kubelet-arg=%s", a))
 	}
-	return args
+	return args, tokenChanged, nil
 }
 
-func buildK3sAgentArgs(joinAddress, tokenName string, nodeIP net.IP, dataDir string, docker bool, kubeletArgs []string, clusterTokens storage.Interface) []string {
-	args := []string{
-		"agent",
-		fmt.Sprintf("--node-external-ip=%s", nodeIP.String()),
-		fmt.Sprintf("--data-dir=%s", dataDir),
-	}
+func buildK3sAgentArgs(joinAddress, tokenName string, nodeIPs []net.IP, dualStack bool, dataDir string, docker bool, kubeletArgs []string, clusterTokens storage.Interface) ([]string, bool, error) {
 	token := &deviceapi.DeviceToken{}
 	err := clusterTokens.Get(tokenName, token)
 	if err != nil {
-		logrus.Error(fmt.Errorf("join server %s: %w", joinAddress, err))
-		return nil
+		return nil, false, err
 	}
-	args = append(args,
+	tokenFile, tokenChanged, err := writeK3sTokenFile(dataDir, token.Data.Token)
+	if err != nil {
+		return nil, false, err
+	}
+	args := []string{
+		"agent",
+		fmt.Sprintf("--data-dir=%s", dataDir),
 		fmt.Sprintf("--server=%s", joinAddress),
-		fmt.Sprintf("--token=%s", token.Data.Token),
-	)
+		fmt.Sprintf("--token-file=%s", tokenFile),
+	}
+	args = append(args, k3sNetworkArgs(nodeIPs, false, dualStack)...)
+	if id := jointoken.ID(token.Data.Token); id != "" {
+		// Let the server account for bootstrap token usages.
+		args = append(args, fmt.Sprintf("--node-label=%s=%s", deviceapi.JoinTokenIDLabel, id))
+	}
 	if docker {
 		args = append(args, "--docker")
 	}
 	for _, a := range kubeletArgs {
 		args = append(args, fmt.Sprintf("--kubelet-arg=%s", a))
 	}
+	return args, tokenChanged, nil
+}
+
+// k3sNetworkArgs returns the k3s arguments that configure the node's addresses and, on a server, the cluster's IP families.
+// With dualStack enabled and an IPv6 node address the cluster uses both IP families, otherwise it uses IPv4 only.
+func k3sNetworkArgs(nodeIPs []net.IP, server, dualStack bool) []string {
+	hasIPv6 := len(nodeIPs) > 1 && nodeIPs[len(nodeIPs)-1].To4() == nil
+	if !dualStack || !hasIPv6 {
+		nodeIPs = nodeIPs[:min(len(nodeIPs), 1)]
+	}
+	ips := strings.Join(networkifaces.IPStrings(nodeIPs), ",")
+	args := []string{fmt.Sprintf("--node-external-ip=%s", ips)}
+	if dualStack && hasIPv6 {
+		args = append(args, fmt.Sprintf("--node-ip=%s", ips))
+		if server {
+			args = append(args,
+				fmt.Sprintf("--cluster-cidr=%s,%s", k3sClusterCIDRv4, k3sClusterCIDRv6),
+				fmt.Sprintf("--service-cidr=%s,%s", k3sServiceCIDRv4, k3sServiceCIDRv6),
+				"--flannel-ipv6-masq",
+			)
+		}
+	}
 	return args
 }
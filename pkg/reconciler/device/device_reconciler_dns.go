@@ -1,28 +1,102 @@
 package device
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"syscall"
+	"time"
+	"unicode"
 
 	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
 	"github.com/mgoltzsche/kubemate/pkg/cliutils"
 	"github.com/mgoltzsche/kubemate/pkg/runner"
 	"github.com/mgoltzsche/kubemate/pkg/storage"
+	"github.com/mgoltzsche/kubemate/pkg/wifi"
 	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// captivePortalDomains are mapped to the access point's IP to show the captive portal page even when connected to the internet.
+// See https://wiki.ding.net/index.php?title=Detecting_captive_portals
+var captivePortalDomains = []string{
+	// Firefox connectivity test
+	"detectportal.firefox.com",
+	// Android connectivity test
+	"connectivitycheck.android.com",
+	"connectivitycheck.gstatic.com",
+	"www.gstatic.com",
+	"gstatic.com",
+	"android.clients.google.com",
+	"play.googleapis.com",
+	"clients1.google.com",
+	"clients3.google.com",
+	"clients4.google.com",
+	// Chinese Android device connectivity test
+	"g.cn",
+	"connect.rom.miui.com",
+	"www.androidbak.net",
+	"www.qualcomm.cn",
+	"captive.v2ex.co",
+	"noisyfox.cn",
+	// Microsoft Windows connectivity test
+	"www.msftconnecttest.com",
+	"www.msftncsi.com",
+	"www.msftncsi.edgesuite.net",
+	// Apple connectivity test
+	"captive.apple.com",
+	"gsp1.apple.com",
+	"www.airport.us",
+	"www.ibook.info",
+	"www.itools.info",
+	"www.thinkdifferent.us",
+	"attwifi.apple.com",
+	// Amazon Kindle connectivity test
+	"spectrum.s3.amazonaws.com",
+	// Arch linux connectivity test
+	"archlinux.org",
+	"ipv4.connman.net",
+	// elementary OS connectivity test
+	"capnet.elementary.io",
+	// Debian/Gnome connectivity test
+	"network-test.debian.org",
+	"nmcheck.gnome.org",
+	// Ubuntu connectivity test
+	"connectivity-check.ubuntu.com",
+}
+
 type deviceDnsServerReconciler struct {
-	deviceName string
-	dir        string
-	ifaces     storage.Interface
-	dnsmasq    *runner.Runner
+	deviceName       string
+	dir              string
+	leaseFile        string
+	ifaces           storage.Interface
+	dnsConfigs       storage.Interface
+	dhcpReservations storage.Interface
+	dnsmasq          *runner.Runner
+}
+
+// dnsmasqConfig specifies the dnsmasq configuration.
+type dnsmasqConfig struct {
+	Interface        string
+	ListenIPs        []string
+	DNS              *deviceapi.DNSConfigSpec
+	SRVRecords       string
+	HostsFile        string
+	ServersFile      string
+	DHCP             bool
+	DHCPHostsFile    string
+	LeaseFile        string
+	IP               string
+	CaptivePortalURL string
 }
 
-func newDeviceDnsServerReconciler(dir, deviceName string, deviceStore, ifaces storage.Interface, logger *logrus.Entry) *deviceDnsServerReconciler {
+func newDeviceDnsServerReconciler(dir, leaseFile, deviceName string, deviceStore, ifaces, dnsConfigs, dhcpReservations storage.Interface, logger *logrus.Entry) *deviceDnsServerReconciler {
 	dnsmasq := runner.New(logger.WithField("proc", "dnsmasq"))
 	dnsmasq.TerminationSignal = syscall.SIGTERM
 	dnsmasq.Reporter = func(c runner.Command) {
@@ -47,15 +121,18 @@ func newDeviceDnsServerReconciler(dir, deviceName string, deviceStore, ifaces st
 		}
 	}
 	return &deviceDnsServerReconciler{
-		deviceName: deviceName,
-		dir:        dir,
-		ifaces:     ifaces,
-		dnsmasq:    dnsmasq,
+		deviceName:       deviceName,
+		dir:              dir,
+		leaseFile:        leaseFile,
+		ifaces:           ifaces,
+		dnsConfigs:       dnsConfigs,
+		dhcpReservations: dhcpReservations,
+		dnsmasq:          dnsmasq,
 	}
 }
 
 func (r *deviceDnsServerReconciler) Reconcile(ctx context.Context, d *deviceapi.Device) error {
-	isAP, iface, ip, err := isAccessPoint(r.ifaces)
+	isAP, iface, err := isAccessPoint(r.ifaces)
 	if err != nil {
 		return err
 	}
@@ -65,7 +142,53 @@ func (r *deviceDnsServerReconciler) Reconcile(ctx context.Context, d *deviceapi.
 		return nil
 	}
 	captivePortalURL := d.Status.Address
-	confPath, err := generateDnsmasqConfig(isAP, iface, r.deviceName, captivePortalURL, ip, "11.0.0.10", "11.0.0.50")
+	if iface == nil {
+		return fmt.Errorf("cannot start dns server since no network interface has an ip address")
+	}
+	c := &deviceapi.DNSConfig{}
+	err = r.dnsConfigs.Get(deviceapi.DNSConfigName, c)
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("get dns config: %w", err)
+	}
+	spec := dnsConfigWithDefaults(c.Spec)
+	link := &iface.Status.Link
+	ips := link.IP6
+	if link.IP4 != "" {
+		ips = append([]string{link.IP4}, link.IP6...)
+	}
+	hostsFile := filepath.Join(r.dir, "hosts")
+	serversFile := filepath.Join(r.dir, "servers")
+	hostsChanged, err := writeFileIfChanged(hostsFile, generateDnsmasqHosts(spec.Zone, r.deviceName, ips, spec.Records, c.Status.Records))
+	if err != nil {
+		return fmt.Errorf("write dns hosts file: %w", err)
+	}
+	serversChanged, err := writeFileIfChanged(serversFile, generateDnsmasqServers(spec.Upstreams))
+	if err != nil {
+		return fmt.Errorf("write dns servers file: %w", err)
+	}
+	reservations := &deviceapi.DHCPReservationList{}
+	err = r.dhcpReservations.List(reservations)
+	if err != nil {
+		return fmt.Errorf("list dhcp reservations: %w", err)
+	}
+	dhcpHostsFile := filepath.Join(r.dir, "dhcp-hosts")
+	dhcpHostsChanged, err := writeFileIfChanged(dhcpHostsFile, generateDnsmasqDHCPHosts(reservations.Items))
+	if err != nil {
+		return fmt.Errorf("write dhcp hosts file: %w", err)
+	}
+	confPath, err := generateDnsmasqConfig(&dnsmasqConfig{
+		Interface:        iface.Name,
+		ListenIPs:        ips,
+		DNS:              &spec,
+		SRVRecords:       generateDnsmasqSRVRecords(spec.Zone, spec.Records, c.Status.Records),
+		HostsFile:        hostsFile,
+		ServersFile:      serversFile,
+		DHCP:             isAP && link.IP4 != "",
+		DHCPHostsFile:    dhcpHostsFile,
+		LeaseFile:        r.leaseFile,
+		IP:               link.IP4,
+		CaptivePortalURL: captivePortalURL,
+	})
 	if err != nil {
 		return err
 	}
@@ -73,8 +196,8 @@ func (r *deviceDnsServerReconciler) Reconcile(ctx context.Context, d *deviceapi.
 	if err != nil {
 		return err
 	}
-	if !restarted {
-		// Reload hosts
+	if !restarted && (hostsChanged || serversChanged || dhcpHostsChanged) {
+		// Reload hosts, servers and dhcp hosts
 		err := r.dnsmasq.SignalReload()
 		if err != nil {
 			return err
@@ -83,241 +206,208 @@ func (r *deviceDnsServerReconciler) Reconcile(ctx context.Context, d *deviceapi.
 	return nil
 }
 
-func isAccessPoint(ifaces storage.Interface) (bool, string, string, error) {
+// isAccessPoint returns the access point interface (which is virtual in accesspoint+station mode) if there is one, otherwise the first interface that is up and has an IP address.
+func isAccessPoint(ifaces storage.Interface) (bool, *deviceapi.NetworkInterface, error) {
 	l := deviceapi.NetworkInterfaceList{}
 	err := ifaces.List(&l)
 	if err != nil {
-		return false, "", "", fmt.Errorf("check access point mode: %w", err)
-	}
-	iface := ""
-	ip := ""
-	for _, r := range l.Items {
-		if r.Status.Link.IP4 != "" {
-			if r.Spec.Wifi.Mode == deviceapi.WifiModeAccessPoint {
-				return true, r.Name, r.Status.Link.IP4, nil
+		return false, nil, fmt.Errorf("check access point mode: %w", err)
+	}
+	var iface *deviceapi.NetworkInterface
+	for i, r := range l.Items {
+		if r.Spec.Wifi.Mode == deviceapi.WifiModeAccessPointStation && r.Status.Link.Type == deviceapi.NetworkInterfaceTypeWifi {
+			// The access point runs on a virtual interface that is not represented by a NetworkInterface resource.
+			apIface := deviceapi.NetworkInterface{}
+			apIface.Name = wifi.VirtualAPInterface
+			apIface.Spec.Wifi.Mode = deviceapi.WifiModeAccessPoint
+			apIface.Status.Link = deviceapi.NetworkLinkStatus{Type: deviceapi.NetworkInterfaceTypeWifi, Up: true, IP4: wifi.AccessPointIP}
+			return true, &apIface, nil
+		}
+		if r.Status.Link.IP4 != "" || len(r.Status.Link.IP6) > 0 {
+			if r.Spec.Wifi.Mode == deviceapi.WifiModeAccessPoint || r.Status.Wifi.Fallback {
+				return true, &l.Items[i], nil
 			}
-			if r.Status.Link.Up && iface == "" {
-				iface = r.Name
-				ip = r.Status.Link.IP4
+			if r.Status.Link.Up && iface == nil {
+				iface = &l.Items[i]
 			}
 		}
 	}
-	return false, iface, ip, nil
+	return false, iface, nil
 }
 
-func generateDnsmasqConfig(dhcp bool, iface, deviceName, captivePortalURL, ip, dhcpIpFrom, dhcpIpTo string) (string, error) {
-	dhcpConf := ""
-	if dhcp {
-		// Route non-resolvable hosts as well as known captive portal test requests to captive portal.
-		// Vendor connectivity request domains have been mapped here explicitly to also show the captive portal page when connected to the internet.
-		// See https://wiki.ding.net/index.php?title=Detecting_captive_portals
-		dhcpConf = strings.NewReplacer("{captivePortalURL}", captivePortalURL, "{ip}", ip, "{ipRangeStart}", dhcpIpFrom, "{ipRangeEnd}", dhcpIpTo).
-			Replace(`dhcp-range={ipRangeStart},{ipRangeEnd},255.255.255.0,2h
-dhcp-option=3,{ip}
-dhcp-option=6,{ip}
-dhcp-option-force=option:domain-search,kube.m8
-dhcp-option-force=option:domain-name,kube.m8
-dhcp-option-force=160,{captivePortalURL}
-# Firefox connectivity test
-address=/detectportal.firefox.com/{ip}
-# Android connectivity test
-address=/connectivitycheck.android.com/{ip}
-address=/connectivitycheck.gstatic.com/{ip}
-address=/www.gstatic.com/{ip}
-address=/gstatic.com/{ip}
-address=/android.clients.google.com/{ip}
-address=/play.googleapis.com/{ip}
-address=/clients1.google.com/{ip}
-address=/clients3.google.com/{ip}
-address=/clients4.google.com/{ip}
-# Chinese Android device connectivity test
-address=/g.cn/{ip}
-address=/connect.rom.miui.com/{ip}
-address=/www.androidbak.net/{ip}
-address=/www.qualcomm.cn/{ip}
-address=/captive.v2ex.co/{ip}
-address=/noisyfox.cn/{ip}
-# Microsoft Windows connectivity test
-address=/www.msftconnecttest.com/{ip}
-address=/www.msftncsi.com/{ip}
-address=/www.msftncsi.edgesuite.net/{ip}
-# Apple connectivity test
-address=/captive.apple.com/{ip}
-address=/gsp1.apple.com/{ip}
-address=/www.airport.us/{ip}
-address=/www.ibook.info/{ip}
-address=/www.itools.info/{ip}
-address=/www.thinkdifferent.us/{ip}
-address=/attwifi.apple.com/{ip}
-# Amazon Kindle connectivity test
-address=/spectrum.s3.amazonaws.com/{ip}
-# Arch linux connectivity test
-address=/archlinux.org/{ip}
-address=/ipv4.connman.net/{ip}
-# elementary OS connectivity test
-address=/capnet.elementary.io/{ip}
-# Debian/Gnome connectivity test
-address=/network-test.debian.org/{ip}
-address=/nmcheck.gnome.org/{ip}
-# Ubuntu connectivity test
-address=/connectivity-check.ubuntu.com/{ip}
-# Fallback for all unknown names
-address=/#/{ip}
-`)
-	}
-	// TODO: configure data dir
-	// TODO: redirect captive portal detection requests
-	conf := strings.NewReplacer("{dhcpConf}", dhcpConf, "{deviceName}", deviceName, "{ip}", ip, "{iface}", iface).Replace(`
-interface={iface}
-listen-address={ip}
-port=53
-domain-needed
-bogus-priv
-address=/kube.m8/{ip}
-address=/{deviceName}.kube.m8/{ip}
-{dhcpConf}
-`)
-	file, _, err := cliutils.WriteTempConfigFile("dnsmasq", conf)
-	return file, err
-	//return os.WriteFile(confPath, []byte(conf), 0600)
+func dnsConfigWithDefaults(spec deviceapi.DNSConfigSpec) deviceapi.DNSConfigSpec {
+	if spec.Zone == "" {
+		spec.Zone = deviceapi.DefaultDNSZone
+	}
+	if spec.DHCP.RangeStart == "" || spec.DHCP.RangeEnd == "" {
+		spec.DHCP.RangeStart = deviceapi.DefaultDHCPRangeStart
+		spec.DHCP.RangeEnd = deviceapi.DefaultDHCPRangeEnd
+	}
+	if spec.DHCP.LeaseTime == nil {
+		spec.DHCP.LeaseTime = &metav1.Duration{Duration: deviceapi.DefaultDHCPLeaseTime}
+	}
+	return spec
 }
 
-func generateBindConfig(ctx context.Context, deviceName, dir string) (string, error) {
-	// See https://www.talk-about-it.ca/setup-bind9-with-isc-dhcp-server-dynamic-host-registration/
-	dataDir := filepath.Join(dir, "data")
-	zoneDir := filepath.Join(dir, "zones")
-	keyFile := filepath.Join(dir, "zone.key")
-	zone := "kube.m8"
-	reverseZone := "0.0.11.in-addr.arpa"
-	zoneFile, err := createZoneFileIfNotExist(zone, deviceName, zoneDir)
-	if err != nil {
-		return "", err
+// qualifyDNSName returns the fully qualified name (without trailing dot) of a record name.
+// Names without a dot are relative to the zone, ignoring leading SRV service and protocol labels.
+func qualifyDNSName(name, zone string) string {
+	prefix := ""
+	for strings.HasPrefix(name, "_") {
+		i := strings.Index(name, ".")
+		if i < 0 {
+			break
+		}
+		prefix, name = prefix+name[:i+1], name[i+1:]
 	}
-	reverseZoneFile, err := createReverseZoneFileIfNotExist(reverseZone, deviceName, zoneDir)
-	if err != nil {
-		return "", err
+	if strings.HasSuffix(name, ".") {
+		return prefix + strings.TrimSuffix(name, ".")
 	}
-	err = os.MkdirAll(dataDir, 0755)
-	if err != nil {
-		return "", fmt.Errorf("create dns server data dir: %w", err)
+	if !strings.Contains(name, ".") {
+		return fmt.Sprintf("%s%s.%s", prefix, name, zone)
 	}
-	keyName := "kubemate"
-	err = generateTsigKeyIfNotExist(ctx, keyFile, keyName)
-	if err != nil {
-		return "", fmt.Errorf("generate dns server key: %w", err)
-	}
-	file, _, err := cliutils.WriteTempConfigFile("bind", `
-acl goodclients {
-	localhost;
-	localnets;
-};
-
-options {
-	directory "{dataDir}";
-	pid-file "/var/run/named/named.pid";
-
-	listen-on port 53 { any; };
-	listen-on-v6 { none; };
-
-	recursion yes;
-	allow-query { goodclients; };
+	return prefix + name
+}
 
-	forwarders {
-		1.1.1.1;
-		8.8.8.8;
-	};
-	forward only;
+// generateDnsmasqHosts generates a hosts file containing the device's names as well as the static and registered records.
+// dnsmasq re-reads the file on SIGHUP.
+func generateDnsmasqHosts(zone, deviceName string, deviceIPs []string, records []deviceapi.DNSRecord, registered []deviceapi.RegisteredDNSRecord) string {
+	names := map[string][]string{}
+	add := func(name, ip string) {
+		if !isDnsmasqSafeValue(name) || !isDnsmasqSafeValue(ip) {
+			return
+		}
+		name = qualifyDNSName(name, zone)
+		for _, n := range names[ip] {
+			if n == name {
+				return
+			}
+		}
+		names[ip] = append(names[ip], name)
+	}
+	for _, ip := range deviceIPs {
+		add(zone+".", ip)
+		add(deviceName, ip)
+	}
+	for _, rec := range records {
+		if rec.Type != deviceapi.DNSRecordTypeSRV {
+			add(rec.Name, rec.Value)
+		}
+	}
+	for _, rec := range registered {
+		if rec.Type != deviceapi.DNSRecordTypeSRV {
+			add(rec.Name, rec.Value)
+		}
+	}
+	ips := make([]string, 0, len(names))
+	for ip := range names {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	var buf bytes.Buffer
+	for _, ip := range ips {
+		fmt.Fprintf(&buf, "%s %s\n", ip, strings.Join(names[ip], " "))
+	}
+	return buf.String()
+}
 
-	dnssec-enable yes;
-	dnssec-validation yes;
-	auth-nxdomain no;
-	notify no;
+// generateDnsmasqSRVRecords generates srv-host options for the SRV records.
+// Other than the hosts file these are not reloaded on SIGHUP, requiring dnsmasq to restart when they change.
+func generateDnsmasqSRVRecords(zone string, records []deviceapi.DNSRecord, registered []deviceapi.RegisteredDNSRecord) string {
+	all := make([]deviceapi.DNSRecord, 0, len(records)+len(registered))
+	all = append(all, records...)
+	for _, rec := range registered {
+		all = append(all, rec.DNSRecord)
+	}
+	lines := make([]string, 0, len(all))
+	for _, rec := range all {
+		if rec.Type != deviceapi.DNSRecordTypeSRV {
+			continue
+		}
+		host, port, err := net.SplitHostPort(rec.Value)
+		if err != nil || !isDnsmasqSafeValue(rec.Name) || !isDnsmasqSafeValue(host) || !isDnsmasqSafeValue(port) {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("srv-host=%s,%s,%s\n", qualifyDNSName(rec.Name, zone), qualifyDNSName(host, zone), port))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "")
+}
 
-	allow-transfer {
-		none; // Don't allow zone transfers by default, zone below allows
-	};
-};
+// isDnsmasqSafeValue returns false if the given value contains characters that would let it inject further dnsmasq options or host names.
+func isDnsmasqSafeValue(v string) bool {
+	return v != "" && !strings.ContainsFunc(v, func(c rune) bool {
+		return c == ',' || unicode.IsSpace(c) || unicode.IsControl(c)
+	})
+}
 
-// TSIG key used for the dynamic update
-include "{keyFile}";
+// generateDnsmasqServers generates a servers file listing the upstream DNS servers.
+func generateDnsmasqServers(upstreams []string) string {
+	var buf bytes.Buffer
+	for _, u := range upstreams {
+		fmt.Fprintf(&buf, "server=%s\n", u)
+	}
+	return buf.String()
+}
 
-zone "{zone}" {
-	type master;
-	file "{zoneFile}";
-	allow-update { key "{keyName}"; };
-};
-zone "{reverseZone}" {
-	type master;
-	notify no;
-	file "{reverseZoneFile}";
-	allow-update { key "{keyName}"; };
-};
-`, "{dataDir}", dataDir, "{zone}", zone, "{reverseZone}", reverseZone, "{zoneFile}", zoneFile, "{reverseZoneFile}", reverseZoneFile, "{keyName}", keyName, "{keyFile}", keyFile)
-	if err != nil {
-		return "", err
+// generateDnsmasqDHCPHosts generates a dhcp-hostsfile that pins the reserved addresses.
+// dnsmasq re-reads the file on SIGHUP.
+func generateDnsmasqDHCPHosts(reservations []deviceapi.DHCPReservation) string {
+	lines := make([]string, 0, len(reservations))
+	for _, r := range reservations {
+		line := fmt.Sprintf("%s,%s", r.Spec.MACAddress, r.Spec.IPAddress)
+		if r.Spec.Hostname != "" {
+			line += "," + r.Spec.Hostname
+		}
+		lines = append(lines, line+"\n")
 	}
-	return file, nil
+	sort.Strings(lines)
+	return strings.Join(lines, "")
 }
 
-func createZoneFileIfNotExist(zone, deviceName, dir string) (string, error) {
-	zoneFile := filepath.Join(dir, zone)
-	_, err := os.Stat(zoneFile)
-	if err == nil {
-		return zoneFile, nil // zone file already exists
-	}
-	conf := strings.NewReplacer("{zone}", zone, "{deviceName}", deviceName).
-		Replace(`$ORIGIN .
-$TTL 1200 ; 10 minutes
-{zone}                  IN SOA  {zone}. root.{zone}. (
-                                16         ; serial
-                                60         ; refresh (1 minute)
-                                60         ; retry (1 minute)
-                                60         ; expire (1 minute)
-                                60         ; minimum (1 minute)
-                                )
-                        NS      {zone}.
-                        NS      localhost.
-                        A       11.0.0.1
-$ORIGIN {zone}.
-$TTL 60 ; 1 minute
-{deviceName}            A       11.0.0.1
-`)
-	//zoneFile, _, err := cliutils.WriteTempConfigFile("dns-zone", conf)
-	err = writeFile(zoneFile, conf)
-	if err != nil {
-		return "", fmt.Errorf("create dns zone file: %w", err)
+// generateDnsmasqConfig writes a dnsmasq config that answers queries within the local zone using the hosts file.
+// The DHCP server and captive portal are configured for IPv4 only.
+func generateDnsmasqConfig(c *dnsmasqConfig) (string, error) {
+	spec := c.DNS
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "interface=%s\nport=53\ndomain-needed\nbogus-priv\nlocalise-queries\n", c.Interface)
+	for _, addr := range c.ListenIPs {
+		fmt.Fprintf(&buf, "listen-address=%s\n", addr)
+	}
+	fmt.Fprintf(&buf, "local=/%s/\ndomain=%s\naddn-hosts=%s\nservers-file=%s\n", spec.Zone, spec.Zone, c.HostsFile, c.ServersFile)
+	if len(spec.Upstreams) > 0 {
+		buf.WriteString("no-resolv\n")
 	}
-	return zoneFile, err
+	buf.WriteString(c.SRVRecords)
+	if c.DHCP {
+		ip := c.IP
+		leaseTime := spec.DHCP.LeaseTime.Duration.Round(time.Second)
+		fmt.Fprintf(&buf, "dhcp-range=%s,%s,255.255.255.0,%ds\n", spec.DHCP.RangeStart, spec.DHCP.RangeEnd, int64(leaseTime.Seconds()))
+		fmt.Fprintf(&buf, "dhcp-hostsfile=%s\ndhcp-leasefile=%s\n", c.DHCPHostsFile, c.LeaseFile)
+		fmt.Fprintf(&buf, "dhcp-option=3,%s\ndhcp-option=6,%s\n", ip, ip)
+		fmt.Fprintf(&buf, "dhcp-option-force=option:domain-search,%s\ndhcp-option-force=option:domain-name,%s\n", spec.Zone, spec.Zone)
+		fmt.Fprintf(&buf, "dhcp-option-force=160,%s\n", c.CaptivePortalURL)
+		// Route known captive portal test requests as well as non-resolvable hosts to the captive portal.
+		for _, domain := range captivePortalDomains {
+			fmt.Fprintf(&buf, "address=/%s/%s\n", domain, ip)
+		}
+		fmt.Fprintf(&buf, "address=/#/%s\n", ip)
+	}
+	file, _, err := cliutils.WriteTempConfigFile("dnsmasq", buf.String())
+	return file, err
 }
 
-func createReverseZoneFileIfNotExist(zone, deviceName, dir string) (string, error) {
-	zoneFile := filepath.Join(dir, "0.0.11.in-addr.arpa")
-	_, err := os.Stat(zoneFile)
-	if err == nil {
-		return zoneFile, nil // zone file already exists
-	}
-	conf := strings.NewReplacer("{zone}", zone, "{deviceName}", deviceName).
-		Replace(`$ORIGIN .
-$TTL 1200 ; 10 minutes
-0.0.11.in-addr.arpa    IN SOA  {zone}. root.{zone}. (
-                                16         ; serial
-                                60         ; refresh (1 minute)
-                                60         ; retry (1 minute)
-                                60         ; expire (1 minute)
-                                60         ; minimum (1 minute)
-                                )
-                        NS      dhcpdns.
-                        A       11.0.0.1
-$ORIGIN 0.0.11.in-addr.arpa.
-$TTL 60 ; 1 minute
-1                       PTR     {deviceName}.{zone}.
-`)
-	//zoneFile, _, err := cliutils.WriteTempConfigFile("reverse-dns-zone", conf)
-	err = writeFile(zoneFile, conf)
+// writeFileIfChanged writes the file atomically unless it already contains the given content.
+func writeFileIfChanged(file, content string) (bool, error) {
+	b, err := os.ReadFile(file)
+	if err == nil && string(b) == content {
+		return false, nil
+	}
+	err = writeFile(file, content)
 	if err != nil {
-		return "", fmt.Errorf("create dns zone file: %w", err)
+		return false, err
 	}
-	return zoneFile, err
+	return true, nil
 }
 
 func writeFile(file, content string) (err error) {
@@ -326,6 +416,9 @@ func writeFile(file, content string) (err error) {
 		return err
 	}
 	f, err := os.CreateTemp(filepath.Dir(file), ".tmp-")
+	if err != nil {
+		return err
+	}
 	defer func() {
 		if err == nil {
 			err = os.Rename(f.Name(), file)
@@ -346,50 +439,3 @@ func writeFile(file, content string) (err error) {
 	}
 	return err
 }
-
-func generateTsigKeyIfNotExist(ctx context.Context, file, keyName string) (err error) {
-	if _, err := os.Stat(file); err == nil {
-		return nil // already exists
-	}
-	dir := filepath.Dir(file)
-	err = os.MkdirAll(dir, 0755)
-	if err != nil {
-		return err
-	}
-	key, err := cliutils.Run(ctx, "tsig-keygen", "-a", "hmac-sha256", keyName)
-	if err != nil {
-		return err
-	}
-	f, err := os.CreateTemp(dir, "kubemate-tsig-key-")
-	if err != nil {
-		return err
-	}
-	defer func() {
-		if err != nil {
-			_ = os.Remove(f.Name())
-		}
-	}()
-	defer func() {
-		if err == nil {
-			err = os.Rename(f.Name(), file)
-		}
-	}()
-	defer func() {
-		if err == nil {
-			err = f.Sync()
-		}
-		e := f.Close()
-		if e != nil && err == nil {
-			err = e
-		}
-	}()
-	err = os.Chmod(f.Name(), 0600)
-	if err != nil {
-		return err
-	}
-	_, err = fmt.Fprint(f, key)
-	if err != nil {
-		return err
-	}
-	return nil
-}
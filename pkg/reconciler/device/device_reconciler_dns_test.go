@@ -0,0 +1,51 @@
+package device
+
+import (
+	"testing"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateDnsmasqHosts(t *testing.T) {
+	records := []deviceapi.DNSRecord{
+		{Name: "nas", Type: deviceapi.DNSRecordTypeA, Value: "11.0.0.5"},
+		{Name: "printer.example.org.", Type: deviceapi.DNSRecordTypeA, Value: "11.0.0.6"},
+	}
+	registered := []deviceapi.RegisteredDNSRecord{
+		{DNSRecord: deviceapi.DNSRecord{Name: "node-b", Type: deviceapi.DNSRecordTypeA, Value: "11.0.0.12"}, Source: "node/node-b"},
+		{DNSRecord: deviceapi.DNSRecord{Name: "app.kube.m8", Type: deviceapi.DNSRecordTypeA, Value: "11.0.0.1"}, Source: "ingress/default/app"},
+		{DNSRecord: deviceapi.DNSRecord{Name: "device-a", Type: deviceapi.DNSRecordTypeAAAA, Value: "fd00::1"}, Source: "node/device-a"},
+		{DNSRecord: deviceapi.DNSRecord{Name: "x\nserver=1.2.3.4\nfoo.kube.m8", Type: deviceapi.DNSRecordTypeA, Value: "11.0.0.13"}, Source: "service/default/inject"},
+		{DNSRecord: deviceapi.DNSRecord{Name: "spaced name", Type: deviceapi.DNSRecordTypeA, Value: "11.0.0.14"}, Source: "service/default/spaced"},
+	}
+	hosts := generateDnsmasqHosts("kube.m8", "device-a", []string{"11.0.0.1", "fd00::1"}, records, registered)
+	require.Equal(t, `11.0.0.1 kube.m8 device-a.kube.m8 app.kube.m8
+11.0.0.12 node-b.kube.m8
+11.0.0.5 nas.kube.m8
+11.0.0.6 printer.example.org
+fd00::1 kube.m8 device-a.kube.m8
+`, hosts)
+}
+
+func TestGenerateDnsmasqSRVRecords(t *testing.T) {
+	records := []deviceapi.DNSRecord{{Name: "_ipp._tcp.printer", Type: deviceapi.DNSRecordTypeSRV, Value: "printer:631"}}
+	registered := []deviceapi.RegisteredDNSRecord{
+		{DNSRecord: deviceapi.DNSRecord{Name: "_http._tcp.media", Type: deviceapi.DNSRecordTypeSRV, Value: "media:8080"}, Source: "service/default/media"},
+		{DNSRecord: deviceapi.DNSRecord{Name: "media", Type: deviceapi.DNSRecordTypeA, Value: "11.0.0.20"}, Source: "service/default/media"},
+		{DNSRecord: deviceapi.DNSRecord{Name: "_http._tcp.x\nserver=1.2.3.4", Type: deviceapi.DNSRecordTypeSRV, Value: "x:80"}, Source: "service/default/inject"},
+		{DNSRecord: deviceapi.DNSRecord{Name: "_http._tcp.y", Type: deviceapi.DNSRecordTypeSRV, Value: "y,0,0:80"}, Source: "service/default/comma"},
+	}
+	srv := generateDnsmasqSRVRecords("kube.m8", records, registered)
+	require.Equal(t, `srv-host=_http._tcp.media.kube.m8,media.kube.m8,8080
+srv-host=_ipp._tcp.printer.kube.m8,printer.kube.m8,631
+`, srv)
+}
+
+func TestGenerateDnsmasqDHCPHosts(t *testing.T) {
+	reservations := []deviceapi.DHCPReservation{
+		{Spec: deviceapi.DHCPReservationSpec{MACAddress: "aa:bb:cc:dd:ee:02", IPAddress: "11.0.0.60"}},
+		{Spec: deviceapi.DHCPReservationSpec{MACAddress: "aa:bb:cc:dd:ee:01", IPAddress: "11.0.0.61", Hostname: "esp32"}},
+	}
+	require.Equal(t, "aa:bb:cc:dd:ee:01,11.0.0.61,esp32\naa:bb:cc:dd:ee:02,11.0.0.60\n", generateDnsmasqDHCPHosts(reservations))
+}
@@ -0,0 +1,156 @@
+package device
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/storage"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestWriteK3sTokenFile(t *testing.T) {
+	dir := t.TempDir()
+	file, changed, err := writeK3sTokenFile(dir, "token1")
+	require.NoError(t, err)
+	require.True(t, changed, "changed after first write")
+	require.Equal(t, filepath.Join(dir, k3sTokenFile), file, "file")
+	_, changed, err = writeK3sTokenFile(dir, "token1")
+	require.NoError(t, err)
+	require.False(t, changed, "changed when writing the same token")
+	file2, changed, err := writeK3sTokenFile(dir, "token2")
+	require.NoError(t, err)
+	require.True(t, changed, "changed after rotation")
+	require.Equal(t, file, file2, "file after rotation")
+	b, err := os.ReadFile(file)
+	require.NoError(t, err)
+	require.Equal(t, "token2", string(b), "token")
+	fi, err := os.Stat(file)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm(), "file mode")
+}
+
+func TestNodeIPs(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, deviceapi.AddToScheme(scheme))
+	link := func(name string, index int, up bool, ip4 string, ip6 ...string) *deviceapi.NetworkInterface {
+		iface := &deviceapi.NetworkInterface{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		iface.Status.Link = deviceapi.NetworkLinkStatus{Index: index, Up: up, IP4: ip4, IP6: ip6}
+		return iface
+	}
+	for _, c := range []struct {
+		name      string
+		links     []*deviceapi.NetworkInterface
+		dualStack bool
+		expected  []string
+	}{
+		{
+			name:     "ipv4 only",
+			links:    []*deviceapi.NetworkInterface{link("eth0", 2, true, "192.168.1.2", "2001:db8::2")},
+			expected: []string{"192.168.1.2"},
+		},
+		{
+			name:      "dual-stack",
+			links:     []*deviceapi.NetworkInterface{link("eth0", 2, true, "192.168.1.2", "2001:db8::2", "2001:db8::3")},
+			dualStack: true,
+			expected:  []string{"192.168.1.2", "2001:db8::2"},
+		},
+		{
+			name: "prefer lowest index with ipv4",
+			links: []*deviceapi.NetworkInterface{
+				link("eth0", 2, true, "", "2001:db8::2"),
+				link("wlan0", 3, true, "192.168.1.3"),
+				link("eth1", 4, true, "192.168.1.4"),
+				link("eth2", 1, false, "192.168.1.5"),
+			},
+			dualStack: true,
+			expected:  []string{"192.168.1.3"},
+		},
+		{
+			name:      "ipv6 only",
+			links:     []*deviceapi.NetworkInterface{link("eth0", 2, true, "", "2001:db8::2")},
+			dualStack: true,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			store := storage.InMemory(scheme)
+			for _, l := range c.links {
+				require.NoError(t, store.Create(l.Name, l))
+			}
+			r := &DeviceReconciler{NetworkInterfaces: store}
+			ips, err := r.nodeIPs(c.dualStack)
+			if c.expected == nil {
+				require.Error(t, err, "nodeIPs")
+				return
+			}
+			require.NoError(t, err, "nodeIPs")
+			actual := make([]string, len(ips))
+			for i, ip := range ips {
+				actual[i] = ip.String()
+			}
+			require.Equal(t, c.expected, actual)
+		})
+	}
+}
+
+func TestK3sNetworkArgs(t *testing.T) {
+	ipv4 := net.ParseIP("192.168.1.2")
+	ipv6 := net.ParseIP("2001:db8::2")
+	for _, c := range []struct {
+		name      string
+		nodeIPs   []net.IP
+		server    bool
+		dualStack bool
+		expected  []string
+	}{
+		{
+			name:     "server ipv4",
+			nodeIPs:  []net.IP{ipv4},
+			server:   true,
+			expected: []string{"--node-external-ip=192.168.1.2"},
+		},
+		{
+			name:     "server ignores ipv6 without dual-stack",
+			nodeIPs:  []net.IP{ipv4, ipv6},
+			server:   true,
+			expected: []string{"--node-external-ip=192.168.1.2"},
+		},
+		{
+			name:      "server dual-stack",
+			nodeIPs:   []net.IP{ipv4, ipv6},
+			server:    true,
+			dualStack: true,
+			expected: []string{
+				"--node-external-ip=192.168.1.2,2001:db8::2",
+				"--node-ip=192.168.1.2,2001:db8::2",
+				"--cluster-cidr=10.42.0.0/16,fd42:42::/56",
+				"--service-cidr=10.43.0.0/16,fd42:43::/112",
+				"--flannel-ipv6-masq",
+			},
+		},
+		{
+			name:      "server dual-stack without ipv6 address",
+			nodeIPs:   []net.IP{ipv4},
+			server:    true,
+			dualStack: true,
+			expected:  []string{"--node-external-ip=192.168.1.2"},
+		},
+		{
+			name:      "agent dual-stack",
+			nodeIPs:   []net.IP{ipv4, ipv6},
+			dualStack: true,
+			expected: []string{
+				"--node-external-ip=192.168.1.2,2001:db8::2",
+				"--node-ip=192.168.1.2,2001:db8::2",
+			},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.expected, k3sNetworkArgs(c.nodeIPs, c.server, c.dualStack))
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package device
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/certpin"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const joinTokenRefreshInterval = 10 * time.Minute
+
+// reconcileServerToken copies the join token k3s derived from the server token into the DeviceToken status.
+func (r *DeviceReconciler) reconcileServerToken() error {
+	t := &deviceapi.DeviceToken{}
+	err := r.DeviceTokens.Get(r.DeviceName, t)
+	if err != nil {
+		return err
+	}
+	if t.Status.JoinToken != "" && isJoinTokenFor(t.Status.JoinToken, t.Data.Token) {
+		return nil // already set
+	}
+	serverTokenFile := filepath.Join(r.DataDir, "server", "token")
+	b, err := os.ReadFile(serverTokenFile)
+	if err != nil {
+		return err
+	}
+	joinToken := strings.TrimSuffix(string(b), "\n")
+	if !isJoinTokenFor(joinToken, t.Data.Token) {
+		return fmt.Errorf("waiting for k3s to apply the rotated server token")
+	}
+	return r.DeviceTokens.Update(r.DeviceName, t, func() error {
+		t.Status.JoinToken = joinToken
+		return nil
+	})
+}
+
+func isJoinTokenFor(joinToken, serverToken string) bool {
+	return strings.HasSuffix(joinToken, fmt.Sprintf("::server:%s", serverToken))
+}
+
+// refreshJoinToken updates the agent's join token in place when the server rotated its token.
+// The server is authenticated by pinning the API certificate fingerprint it published on its Node.
+func (r *DeviceReconciler) refreshJoinToken(ctx context.Context, d *deviceapi.Device) error {
+	t := &deviceapi.DeviceToken{}
+	err := r.DeviceTokens.Get(d.Spec.JoinTokenName, t)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(d.Spec.ServerAddress)
+	if err != nil {
+		return fmt.Errorf("invalid server address %q: %w", d.Spec.ServerAddress, err)
+	}
+	serverName := u.Hostname()
+	config, err := r.nodeClientConfig()
+	if err != nil {
+		return err
+	}
+	c, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	node, err := c.CoreV1().Nodes().Get(ctx, serverName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("get server node: %w", err)
+	}
+	fingerprint := node.GetAnnotations()[deviceapi.APICertFingerprintAnnotation]
+	if fingerprint == "" {
+		return nil // server does not publish its certificate
+	}
+	// The node certificate authenticates the agent when it joined using a bootstrap token, which the server does not accept.
+	nodeTLSConfig, err := rest.TLSConfigFor(config)
+	if err != nil {
+		return fmt.Errorf("load node client certificate: %w", err)
+	}
+	tlsConfig := certpin.TLSConfig(fingerprint)
+	if nodeTLSConfig != nil {
+		tlsConfig.Certificates = nodeTLSConfig.Certificates
+		tlsConfig.GetClientCertificate = nodeTLSConfig.GetClientCertificate
+	}
+	serverToken, err := fetchServerToken(ctx, d.Spec.ServerAddress, serverName, t.Data.Token, tlsConfig)
+	if err != nil {
+		return err
+	}
+	joinToken := serverToken.Status.JoinToken
+	if joinToken == "" || joinToken == t.Data.Token {
+		return nil
+	}
+	r.Logger.Info("updating join token since server token has been rotated")
+	return r.DeviceTokens.Update(t.Name, t, func() error {
+		t.Data.Token = joinToken
+		return nil
+	})
+}
+
+func fetchServerToken(ctx context.Context, serverAddress, serverName, token string, tlsConfig *tls.Config) (*deviceapi.DeviceToken, error) {
+	gv := deviceapi.GroupVersion
+	tokenURL := fmt.Sprintf("%s/apis/%s/%s/devicetokens/%s", strings.TrimSuffix(serverAddress, "/"), gv.Group, gv.Version, serverName)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		Timeout:   15 * time.Second,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch server token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch server token: server responded with status %s", resp.Status)
+	}
+	t := &deviceapi.DeviceToken{}
+	err = json.NewDecoder(resp.Body).Decode(t)
+	if err != nil {
+		return nil, fmt.Errorf("decode server token: %w", err)
+	}
+	return t, nil
+}
@@ -0,0 +1,299 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/pairing"
+	"github.com/mgoltzsche/kubemate/pkg/storage"
+	"github.com/mgoltzsche/kubemate/pkg/tokengen"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	pairingTimeout        = 15 * time.Minute
+	pairingTokenTTL       = time.Hour
+	pairingTokenPrefix    = "pairing-"
+	pairingRetryInterval  = 10 * time.Second
+	pairingPollInterval   = 2 * time.Second
+	completedPairingTTL   = 10 * time.Minute
+	pairingNonceLength    = 16
+	pairingSecretLength   = 32
+	pairingTokenMaxUsages = 1
+)
+
+// DevicePairingReconciler performs the handshake that joins an agent device to a server.
+// On the agent it submits the pairing request to the server and applies the join token the server pushes.
+// On the server it issues a single-use join token and pushes it to the agent once the user confirmed the request.
+type DevicePairingReconciler struct {
+	DeviceName         string
+	DeviceAddress      string
+	APICertFingerprint string
+	Devices            storage.Interface
+	DeviceTokens       storage.Interface
+	DevicePairings     storage.Interface
+	client.Client
+	scheme *runtime.Scheme
+}
+
+func (r *DevicePairingReconciler) AddToScheme(s *runtime.Scheme) error {
+	err := deviceapi.AddToScheme(s)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *DevicePairingReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.scheme = mgr.GetScheme()
+	r.Client = mgr.GetClient()
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&deviceapi.DevicePairing{}).
+		Complete(r)
+}
+
+func (r *DevicePairingReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	p := deviceapi.DevicePairing{}
+	err := r.Client.Get(ctx, req.NamespacedName, &p)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return requeue(err)
+	}
+
+	logger.V(1).Info("reconcile device pairing")
+
+	switch p.Status.Phase {
+	case deviceapi.DevicePairingPhaseCompleted, deviceapi.DevicePairingPhaseFailed:
+		// Garbage-collect finished pairings
+		if wait := time.Until(p.CreationTimestamp.Add(pairingTimeout + completedPairingTTL)); wait > 0 {
+			return ctrl.Result{RequeueAfter: wait}, nil
+		}
+		err = r.DevicePairings.Delete(p.Name, &p, func() error { return nil })
+		if err != nil && !errors.IsNotFound(err) {
+			return requeue(err)
+		}
+		return ctrl.Result{}, nil
+	}
+	if time.Since(p.CreationTimestamp.Time) > pairingTimeout {
+		return r.failPairing(&p, fmt.Errorf("pairing timed out"))
+	}
+	if p.Spec.Agent != "" {
+		return r.reconcileIncomingPairing(ctx, &p)
+	}
+	return r.reconcileOutgoingPairing(ctx, &p)
+}
+
+// reconcileOutgoingPairing runs on the agent.
+func (r *DevicePairingReconciler) reconcileOutgoingPairing(ctx context.Context, p *deviceapi.DevicePairing) (ctrl.Result, error) {
+	if p.Spec.JoinToken != "" {
+		return r.joinServer(ctx, p)
+	}
+	if p.Status.ServerCertFingerprint != "" {
+		// Waiting for the user to confirm the pairing on the server.
+		return ctrl.Result{RequeueAfter: time.Until(p.CreationTimestamp.Add(pairingTimeout))}, nil
+	}
+	serverFingerprint, err := pairing.FetchCertFingerprint(ctx, p.Spec.ServerAddress)
+	if err != nil {
+		return r.retryPairing(p, err)
+	}
+	nonce, err := tokengen.GenerateRandomString(pairingNonceLength)
+	if err != nil {
+		return requeue(err)
+	}
+	secret, err := tokengen.GenerateRandomString(pairingSecretLength)
+	if err != nil {
+		return requeue(err)
+	}
+	// The server names the request itself.
+	req := &deviceapi.DevicePairing{
+		Spec: deviceapi.DevicePairingSpec{
+			Agent:                r.DeviceName,
+			AgentAddress:         r.DeviceAddress,
+			AgentCertFingerprint: r.APICertFingerprint,
+			NonceCommitment:      pairing.NonceCommitment(nonce),
+			Secret:               secret,
+		},
+	}
+	// Store the secret before submitting the request to authenticate the server's response.
+	err = r.DevicePairings.Update(p.Name, p, func() error {
+		p.Spec.Nonce = nonce
+		p.Spec.Secret = secret
+		return nil
+	})
+	if err != nil {
+		return requeue(err)
+	}
+	created, err := pairing.SubmitRequest(ctx, p.Spec.ServerAddress, serverFingerprint, req)
+	if err != nil {
+		return r.retryPairing(p, err)
+	}
+	if created.Status.ServerNonce == "" {
+		return r.failPairing(p, fmt.Errorf("server did not provide a nonce"))
+	}
+	// Reveal the nonce only after receiving the server's nonce so that neither side can choose its nonce based on the other's.
+	created.Spec.Nonce = nonce
+	revealed, err := pairing.RevealNonce(ctx, p.Spec.ServerAddress, serverFingerprint, created)
+	if err != nil {
+		return r.retryPairing(p, err)
+	}
+	code := pairing.ConfirmationCode(serverFingerprint, r.APICertFingerprint, nonce, created.Status.ServerNonce)
+	if revealed.Status.ConfirmationCode != code {
+		return r.failPairing(p, fmt.Errorf("server computed a different confirmation code"))
+	}
+	err = r.DevicePairings.Update(p.Name, p, func() error {
+		p.Status.ServerCertFingerprint = serverFingerprint
+		p.Status.ConfirmationCode = code
+		p.Status.Message = "confirm the pairing on the server"
+		return nil
+	})
+	if err != nil {
+		return requeue(err)
+	}
+	return ctrl.Result{RequeueAfter: pairingTimeout}, nil
+}
+
+// joinServer stores the join token the server pushed and makes the agent join the server.
+func (r *DevicePairingReconciler) joinServer(ctx context.Context, p *deviceapi.DevicePairing) (ctrl.Result, error) {
+	log.FromContext(ctx).Info("received join token, joining server", "server", p.Spec.ServerAddress)
+	t := &deviceapi.DeviceToken{}
+	err := r.DeviceTokens.Get(p.Spec.JoinTokenName, t)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return requeue(err)
+		}
+		t.Data = deviceapi.DeviceTokenData{Type: deviceapi.DeviceTokenTypeJoin, Token: p.Spec.JoinToken}
+		err = r.DeviceTokens.Create(p.Spec.JoinTokenName, t)
+	} else {
+		err = r.DeviceTokens.Update(p.Spec.JoinTokenName, t, func() error {
+			t.Data.Token = p.Spec.JoinToken
+			return nil
+		})
+	}
+	if err != nil {
+		return requeue(err)
+	}
+	d := &deviceapi.Device{}
+	err = r.Devices.Update(r.DeviceName, d, func() error {
+		d.Spec.Mode = deviceapi.DeviceModeAgent
+		d.Spec.ServerAddress = p.Spec.ServerAddress
+		d.Spec.JoinTokenName = p.Spec.JoinTokenName
+		return nil
+	})
+	if err != nil {
+		return requeue(err)
+	}
+	err = r.DevicePairings.Update(p.Name, p, func() error {
+		p.Spec.JoinToken = ""
+		p.Spec.Secret = ""
+		p.Status.Phase = deviceapi.DevicePairingPhaseCompleted
+		p.Status.Message = ""
+		return nil
+	})
+	if err != nil {
+		return requeue(err)
+	}
+	return ctrl.Result{RequeueAfter: completedPairingTTL}, nil
+}
+
+// reconcileIncomingPairing runs on the server.
+func (r *DevicePairingReconciler) reconcileIncomingPairing(ctx context.Context, p *deviceapi.DevicePairing) (ctrl.Result, error) {
+	if !p.Spec.Confirmed {
+		// Waiting for the user to confirm the pairing.
+		return ctrl.Result{RequeueAfter: time.Until(p.CreationTimestamp.Add(pairingTimeout))}, nil
+	}
+	d := &deviceapi.Device{}
+	err := r.Devices.Get(r.DeviceName, d)
+	if err != nil {
+		return requeue(err)
+	}
+	if d.Spec.Mode != deviceapi.DeviceModeServer {
+		return r.failPairing(p, fmt.Errorf("device %s is not a server", r.DeviceName))
+	}
+	if p.Status.Phase != deviceapi.DevicePairingPhaseConfirmed {
+		err = r.DevicePairings.Update(p.Name, p, func() error {
+			p.Status.Phase = deviceapi.DevicePairingPhaseConfirmed
+			p.Status.Message = "issuing join token"
+			return nil
+		})
+		if err != nil {
+			return requeue(err)
+		}
+	}
+	joinToken, err := r.pairingJoinToken(p)
+	if err != nil {
+		return requeue(err)
+	}
+	if joinToken == "" {
+		// Waiting for the DeviceTokenReconciler to create the bootstrap token.
+		return ctrl.Result{RequeueAfter: pairingPollInterval}, nil
+	}
+	err = pairing.PushJoinToken(ctx, p.Spec.AgentAddress, p.Spec.AgentCertFingerprint, p.Spec.Secret, r.DeviceName, joinToken)
+	if err != nil {
+		return r.retryPairing(p, err)
+	}
+	err = r.DevicePairings.Update(p.Name, p, func() error {
+		p.Spec.Secret = ""
+		p.Status.Phase = deviceapi.DevicePairingPhaseCompleted
+		p.Status.Message = ""
+		return nil
+	})
+	if err != nil {
+		return requeue(err)
+	}
+	return ctrl.Result{RequeueAfter: completedPairingTTL}, nil
+}
+
+// pairingJoinToken returns the single-use bootstrap token issued for the pairing or creates it.
+func (r *DevicePairingReconciler) pairingJoinToken(p *deviceapi.DevicePairing) (string, error) {
+	name := pairingTokenPrefix + p.Name
+	t := &deviceapi.DeviceToken{}
+	err := r.DeviceTokens.Get(name, t)
+	if err == nil {
+		return t.Status.JoinToken, nil
+	}
+	if !errors.IsNotFound(err) {
+		return "", err
+	}
+	t.Data = deviceapi.DeviceTokenData{
+		Type:        deviceapi.DeviceTokenTypeBootstrap,
+		Description: fmt.Sprintf("kubemate pairing with %s", p.Spec.Agent),
+		TTL:         &metav1.Duration{Duration: pairingTokenTTL},
+		MaxUses:     pairingTokenMaxUsages,
+	}
+	return "", r.DeviceTokens.Create(name, t)
+}
+
+func (r *DevicePairingReconciler) retryPairing(p *deviceapi.DevicePairing, cause error) (ctrl.Result, error) {
+	err := r.DevicePairings.Update(p.Name, p, func() error {
+		p.Status.Message = cause.Error()
+		return nil
+	})
+	if err != nil {
+		return requeue(err)
+	}
+	return ctrl.Result{RequeueAfter: pairingRetryInterval}, nil
+}
+
+func (r *DevicePairingReconciler) failPairing(p *deviceapi.DevicePairing, cause error) (ctrl.Result, error) {
+	err := r.DevicePairings.Update(p.Name, p, func() error {
+		p.Spec.Secret = ""
+		p.Status.Phase = deviceapi.DevicePairingPhaseFailed
+		p.Status.Message = cause.Error()
+		return nil
+	})
+	if err != nil {
+		return requeue(err)
+	}
+	return ctrl.Result{RequeueAfter: completedPairingTTL}, nil
+}
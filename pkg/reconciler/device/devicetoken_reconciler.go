@@ -0,0 +1,184 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/jointoken"
+	"github.com/mgoltzsche/kubemate/pkg/storage"
+	"github.com/mgoltzsche/kubemate/pkg/tokengen"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const defaultServerTokenRotationInterval = 30 * 24 * time.Hour
+
+// DeviceTokenReconciler issues and expires bootstrap tokens and rotates the server token.
+type DeviceTokenReconciler struct {
+	DeviceName   string
+	K3sDir       string
+	Devices      storage.Interface
+	DeviceTokens storage.Interface
+	client.Client
+	scheme *runtime.Scheme
+}
+
+func (r *DeviceTokenReconciler) AddToScheme(s *runtime.Scheme) error {
+	err := deviceapi.AddToScheme(s)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *DeviceTokenReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.scheme = mgr.GetScheme()
+	r.Client = mgr.GetClient()
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&deviceapi.DeviceToken{}).
+		Watches(&deviceapi.Device{}, handler.EnqueueRequestsFromMapFunc(r.tokenReconcileRequests)).
+		Complete(r)
+}
+
+func (r *DeviceTokenReconciler) tokenReconcileRequests(ctx context.Context, o client.Object) []ctrl.Request {
+	l := &deviceapi.DeviceTokenList{}
+	err := r.DeviceTokens.List(l)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "list device tokens")
+		return nil
+	}
+	reqs := make([]ctrl.Request, len(l.Items))
+	for i, t := range l.Items {
+		reqs[i] = ctrl.Request{NamespacedName: types.NamespacedName{Name: t.Name}}
+	}
+	return reqs
+}
+
+func (r *DeviceTokenReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	t := deviceapi.DeviceToken{}
+	err := r.Client.Get(ctx, req.NamespacedName, &t)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return requeue(err)
+	}
+	d := deviceapi.Device{}
+	err = r.Devices.Get(r.DeviceName, &d)
+	if err != nil {
+		return requeue(err)
+	}
+	if d.Spec.Mode != deviceapi.DeviceModeServer || d.Status.State != deviceapi.DeviceStateRunning {
+		return ctrl.Result{}, nil // k3s server not available, reconciled when the device becomes ready.
+	}
+
+	logger.V(1).Info("reconcile device token")
+
+	switch {
+	case t.Name == r.DeviceName:
+		return r.reconcileServerTokenRotation(ctx, &t)
+	case t.Data.Type == deviceapi.DeviceTokenTypeBootstrap:
+		return r.reconcileBootstrapToken(ctx, &t)
+	}
+	return ctrl.Result{}, nil
+}
+
+func (r *DeviceTokenReconciler) reconcileBootstrapToken(ctx context.Context, t *deviceapi.DeviceToken) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	if t.Status.Expires != nil {
+		if ttl := time.Until(t.Status.Expires.Time); ttl > 0 {
+			return ctrl.Result{RequeueAfter: ttl}, nil
+		}
+		logger.Info("deleting expired bootstrap token")
+		if !t.Status.Revoked {
+			err := jointoken.Delete(ctx, r.K3sDir, t.Status.ID)
+			if err != nil {
+				logger.Error(err, "failed to delete expired bootstrap token") // k3s may have deleted it already
+			}
+		}
+		err := r.DeviceTokens.Delete(t.Name, t, func() error { return nil })
+		if err != nil && !errors.IsNotFound(err) {
+			return requeue(err)
+		}
+		return ctrl.Result{}, nil
+	}
+	ttl := time.Duration(0)
+	if t.Data.TTL != nil {
+		ttl = t.Data.TTL.Duration
+	}
+	logger.Info("creating bootstrap token")
+	token, err := jointoken.Create(ctx, r.K3sDir, ttl, t.Data.Description)
+	if err != nil {
+		e := r.DeviceTokens.Update(t.Name, t, func() error {
+			t.Status.Message = err.Error()
+			return nil
+		})
+		if e != nil {
+			logger.Error(e, "update device token status")
+		}
+		return requeue(err)
+	}
+	err = r.DeviceTokens.Update(t.Name, t, func() error {
+		if t.Status.JoinToken != "" {
+			return fmt.Errorf("bootstrap token was created concurrently")
+		}
+		t.Status.JoinToken = token
+		t.Status.ID = jointoken.ID(token)
+		t.Status.Expires = &metav1.Time{Time: time.Now().Add(ttl)}
+		t.Status.Message = ""
+		return nil
+	})
+	if err != nil {
+		_ = jointoken.Delete(ctx, r.K3sDir, jointoken.ID(token))
+		return requeue(err)
+	}
+	return ctrl.Result{RequeueAfter: ttl}, nil
+}
+
+func (r *DeviceTokenReconciler) reconcileServerTokenRotation(ctx context.Context, t *deviceapi.DeviceToken) (ctrl.Result, error) {
+	interval := defaultServerTokenRotationInterval
+	if t.Data.RotationInterval != nil {
+		interval = t.Data.RotationInterval.Duration
+	}
+	if interval <= 0 || t.Status.JoinToken == "" {
+		return ctrl.Result{}, nil // rotation disabled or k3s did not apply the previous token yet.
+	}
+	lastRotation := t.CreationTimestamp.Time
+	if t.Status.LastRotation != nil {
+		lastRotation = t.Status.LastRotation.Time
+	}
+	if wait := time.Until(lastRotation.Add(interval)); wait > 0 {
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+	log.FromContext(ctx).Info("rotating server token")
+	newToken, err := tokengen.GenerateRandomString(32)
+	if err != nil {
+		return requeue(err)
+	}
+	err = jointoken.Rotate(ctx, r.K3sDir, t.Data.Token, newToken)
+	if err != nil {
+		return requeue(err)
+	}
+	// Changing the token restarts k3s with the new token (see DeviceReconciler).
+	err = r.DeviceTokens.Update(t.Name, t, func() error {
+		t.Data.Token = newToken
+		t.Status.PreviousJoinToken = t.Status.JoinToken
+		t.Status.JoinToken = ""
+		t.Status.LastRotation = &metav1.Time{Time: time.Now()}
+		return nil
+	})
+	if err != nil {
+		return requeue(err)
+	}
+	return ctrl.Result{RequeueAfter: interval}, nil
+}
@@ -0,0 +1,456 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/storage"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// annotationDNSName specifies the name a LoadBalancer or NodePort Service is published with within the local DNS zone.
+	annotationDNSName             = "kubemate.mgoltzsche.github.com/dns-name"
+	dnsConfigSource               = "dnsconfig/" + deviceapi.DNSConfigName
+	eventReasonDNSConflict        = "DNSNameConflict"
+	eventReasonDNSNameOutsideZone = "DNSNameOutsideZone"
+	eventReasonInvalidDNSName     = "InvalidDNSName"
+)
+
+// DNSRecordReconciler registers DNS records for every cluster node, Ingress host and annotated Service within the DNSConfig status.
+// Records that conflict with a record of another object or whose name is invalid or outside the DNS zone are skipped and reported as Event.
+type DNSRecordReconciler struct {
+	DeviceName string
+	Devices    storage.Interface
+	DNSConfigs storage.Interface
+	client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
+	reported map[string]struct{}
+}
+
+// dnsConflict describes a record that was skipped because its name was registered by another object already.
+type dnsConflict struct {
+	Source string
+	Name   string
+	Owner  string
+}
+
+// dnsProblem describes a skipped record that is reported as Event on its source object.
+type dnsProblem struct {
+	Source  string
+	Reason  string
+	Message string
+}
+
+func (r *DNSRecordReconciler) AddToScheme(s *runtime.Scheme) error {
+	err := corev1.AddToScheme(s)
+	if err != nil {
+		return err
+	}
+	err = networkingv1.AddToScheme(s)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *DNSRecordReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.scheme = mgr.GetScheme()
+	r.Client = mgr.GetClient()
+	r.recorder = mgr.GetEventRecorderFor("kubemate-dns")
+	r.reported = map[string]struct{}{}
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("dnsrecord").
+		Watches(&corev1.Node{}, handler.EnqueueRequestsFromMapFunc(r.dnsConfigReconcileRequest)).
+		Watches(&networkingv1.Ingress{}, handler.EnqueueRequestsFromMapFunc(r.dnsConfigReconcileRequest)).
+		Watches(&corev1.Service{}, handler.EnqueueRequestsFromMapFunc(r.dnsConfigReconcileRequest)).
+		// The DNSConfig is served by kubemate, not by the cluster this controller is connected to.
+		WatchesRawSource(storeSource(r.DNSConfigs, ctrl.Request{NamespacedName: types.NamespacedName{Name: deviceapi.DNSConfigName}})).
+		Complete(r)
+}
+
+// storeSource enqueues the given request whenever an object within the given store changes.
+func storeSource(store storage.Interface, req ctrl.Request) source.Source {
+	return source.Func(func(ctx context.Context, queue workqueue.TypedRateLimitingInterface[reconcile.Request]) error {
+		w, err := store.Watch(ctx, "")
+		if err != nil {
+			return fmt.Errorf("watch store: %w", err)
+		}
+		// The watch stops and closes the channel when the context is canceled.
+		ch := w.ResultChan()
+		go func() {
+			defer w.Stop()
+			for range ch {
+				queue.Add(req)
+			}
+		}()
+		return nil
+	})
+}
+
+func (r *DNSRecordReconciler) dnsConfigReconcileRequest(_ context.Context, o client.Object) []ctrl.Request {
+	return []ctrl.Request{{NamespacedName: types.NamespacedName{Name: deviceapi.DNSConfigName}}}
+}
+
+func (r *DNSRecordReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	d := deviceapi.Device{}
+	err := r.Devices.Get(r.DeviceName, &d)
+	if err != nil {
+		return requeue(err)
+	}
+	c := &deviceapi.DNSConfig{}
+	err = r.DNSConfigs.Get(req.Name, c)
+	if err != nil {
+		return requeue(err)
+	}
+	nodes := corev1.NodeList{}
+	err = r.Client.List(ctx, &nodes)
+	if err != nil {
+		return requeue(err)
+	}
+	ingresses := networkingv1.IngressList{}
+	err = r.Client.List(ctx, &ingresses)
+	if err != nil {
+		return requeue(err)
+	}
+	services := corev1.ServiceList{}
+	err = r.Client.List(ctx, &services)
+	if err != nil {
+		return requeue(err)
+	}
+	objects := map[string]client.Object{}
+	for i, n := range nodes.Items {
+		objects[fmt.Sprintf("node/%s", n.Name)] = &nodes.Items[i]
+	}
+	for i, ing := range ingresses.Items {
+		objects[fmt.Sprintf("ingress/%s/%s", ing.Namespace, ing.Name)] = &ingresses.Items[i]
+	}
+	for i, svc := range services.Items {
+		objects[fmt.Sprintf("service/%s/%s", svc.Namespace, svc.Name)] = &services.Items[i]
+	}
+	// The order determines which object owns a name in case of a conflict.
+	records := nodeDNSRecords(nodes.Items)
+	records = append(records, ingressDNSRecords(ingresses.Items, d.Status.IPs)...)
+	svcRecords, problems := serviceDNSRecords(services.Items, d.Status.IPs)
+	records = append(records, svcRecords...)
+	invalid := len(problems)
+	zone := c.Spec.Zone
+	if zone == "" {
+		zone = deviceapi.DefaultDNSZone
+	}
+	records, outOfZoneProblems := rejectOutOfZoneDNSRecords(zone, records)
+	outOfZone := len(outOfZoneProblems)
+	problems = append(problems, outOfZoneProblems...)
+	records, conflicts := resolveDNSConflicts(zone, c.Spec.Records, records)
+	for _, conflict := range conflicts {
+		problems = append(problems, dnsProblem{
+			Source:  conflict.Source,
+			Reason:  eventReasonDNSConflict,
+			Message: fmt.Sprintf("DNS name %s is registered by %s already", conflict.Name, conflict.Owner),
+		})
+	}
+	r.reportProblems(problems, objects)
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Value < b.Value
+	})
+	var skipped []string
+	if len(conflicts) > 0 {
+		skipped = append(skipped, fmt.Sprintf("%d conflicting", len(conflicts)))
+	}
+	if outOfZone > 0 {
+		skipped = append(skipped, fmt.Sprintf("%d out-of-zone", outOfZone))
+	}
+	if invalid > 0 {
+		skipped = append(skipped, fmt.Sprintf("%d invalid", invalid))
+	}
+	msg := ""
+	if len(skipped) > 0 {
+		msg = fmt.Sprintf("skipped %s dns records", strings.Join(skipped, " and "))
+	}
+	if reflect.DeepEqual(c.Status.Records, records) && c.Status.Message == msg {
+		return ctrl.Result{}, nil
+	}
+	logger.Info("updating dns records", "count", len(records), "conflicts", len(conflicts), "outOfZone", outOfZone, "invalid", invalid)
+	err = r.DNSConfigs.Update(req.Name, c, func() error {
+		c.Status.Records = records
+		c.Status.Message = msg
+		return nil
+	})
+	if err != nil {
+		return requeue(fmt.Errorf("update dns config status: %w", err))
+	}
+	return ctrl.Result{}, nil
+}
+
+// reportProblems emits a warning Event for every problem that was not reported before.
+func (r *DNSRecordReconciler) reportProblems(problems []dnsProblem, objects map[string]client.Object) {
+	reported := make(map[string]struct{}, len(problems))
+	for _, p := range problems {
+		key := p.Source + "\n" + p.Reason + "\n" + p.Message
+		reported[key] = struct{}{}
+		if _, ok := r.reported[key]; ok {
+			continue
+		}
+		if o := objects[p.Source]; o != nil {
+			r.recorder.Event(o, corev1.EventTypeWarning, p.Reason, p.Message)
+		}
+	}
+	r.reported = reported
+}
+
+// rejectOutOfZoneDNSRecords drops the records whose name is not within the DNS zone.
+// This prevents an object from overriding a public name such as an Ingress host of an external domain.
+func rejectOutOfZoneDNSRecords(zone string, records []deviceapi.RegisteredDNSRecord) ([]deviceapi.RegisteredDNSRecord, []dnsProblem) {
+	accepted := make([]deviceapi.RegisteredDNSRecord, 0, len(records))
+	var problems []dnsProblem
+	rejected := map[string]struct{}{}
+	for _, rec := range records {
+		name := qualifyDNSName(rec.Name, zone)
+		if isWithinDNSZone(name, zone) {
+			accepted = append(accepted, rec)
+			continue
+		}
+		key := rec.Source + "\n" + name
+		if _, ok := rejected[key]; ok {
+			continue
+		}
+		rejected[key] = struct{}{}
+		problems = append(problems, dnsProblem{
+			Source:  rec.Source,
+			Reason:  eventReasonDNSNameOutsideZone,
+			Message: fmt.Sprintf("DNS name %s is not within the zone %s", name, zone),
+		})
+	}
+	return accepted, problems
+}
+
+// isWithinDNSZone returns true if the given fully qualified name is a name within the given zone.
+func isWithinDNSZone(name, zone string) bool {
+	return strings.HasSuffix(strings.ToLower(name), "."+strings.ToLower(zone))
+}
+
+// resolveDNSConflicts drops the records whose name was registered with different values by a preceding object or statically already.
+// Objects registering the same name with the same values, e.g. Ingresses sharing a host, do not conflict.
+func resolveDNSConflicts(zone string, static []deviceapi.DNSRecord, records []deviceapi.RegisteredDNSRecord) ([]deviceapi.RegisteredDNSRecord, []dnsConflict) {
+	type nameKey struct {
+		Name string
+		SRV  bool
+	}
+	keyOf := func(rec *deviceapi.DNSRecord) nameKey {
+		return nameKey{Name: qualifyDNSName(rec.Name, zone), SRV: rec.Type == deviceapi.DNSRecordTypeSRV}
+	}
+	values := map[nameKey]map[string][]string{}
+	all := make([]deviceapi.RegisteredDNSRecord, 0, len(static)+len(records))
+	for _, rec := range static {
+		all = append(all, deviceapi.RegisteredDNSRecord{DNSRecord: rec, Source: dnsConfigSource})
+	}
+	all = append(all, records...)
+	for _, rec := range all {
+		k := keyOf(&rec.DNSRecord)
+		bySource := values[k]
+		if bySource == nil {
+			bySource = map[string][]string{}
+			values[k] = bySource
+		}
+		bySource[rec.Source] = append(bySource[rec.Source], string(rec.Type)+" "+rec.Value)
+	}
+	owners := map[nameKey]string{}
+	skip := map[nameKey]map[string]struct{}{}
+	var conflicts []dnsConflict
+	for _, rec := range all {
+		k := keyOf(&rec.DNSRecord)
+		owner, ok := owners[k]
+		if !ok {
+			owners[k] = rec.Source
+			continue
+		}
+		if owner == rec.Source {
+			continue
+		}
+		if _, skipped := skip[k][rec.Source]; skipped {
+			continue
+		}
+		if sameValues(values[k][owner], values[k][rec.Source]) {
+			continue
+		}
+		if skip[k] == nil {
+			skip[k] = map[string]struct{}{}
+		}
+		skip[k][rec.Source] = struct{}{}
+		conflicts = append(conflicts, dnsConflict{Source: rec.Source, Name: k.Name, Owner: owner})
+	}
+	resolved := make([]deviceapi.RegisteredDNSRecord, 0, len(records))
+	for _, rec := range records {
+		if _, skipped := skip[keyOf(&rec.DNSRecord)][rec.Source]; !skipped {
+			resolved = append(resolved, rec)
+		}
+	}
+	return resolved, conflicts
+}
+
+func sameValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = append([]string{}, a...), append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	return reflect.DeepEqual(a, b)
+}
+
+// nodeDNSRecords maps every node name to its internal and external addresses.
+func nodeDNSRecords(nodes []corev1.Node) []deviceapi.RegisteredDNSRecord {
+	records := make([]deviceapi.RegisteredDNSRecord, 0, len(nodes))
+	for _, n := range nodes {
+		ips := map[string]struct{}{}
+		for _, a := range n.Status.Addresses {
+			if a.Type != corev1.NodeInternalIP && a.Type != corev1.NodeExternalIP {
+				continue
+			}
+			if _, ok := ips[a.Address]; ok {
+				continue
+			}
+			ips[a.Address] = struct{}{}
+			if rec, ok := addressDNSRecord(n.Name, a.Address, fmt.Sprintf("node/%s", n.Name)); ok {
+				records = append(records, rec)
+			}
+		}
+	}
+	return records
+}
+
+// ingressDNSRecords maps every Ingress host to the given IPs of the server device which runs the ingress controller.
+// Wildcard hosts are skipped.
+func ingressDNSRecords(ingresses []networkingv1.Ingress, ips []string) []deviceapi.RegisteredDNSRecord {
+	var records []deviceapi.RegisteredDNSRecord
+	for _, ing := range ingresses {
+		source := fmt.Sprintf("ingress/%s/%s", ing.Namespace, ing.Name)
+		hosts := map[string]struct{}{}
+		for _, rule := range ing.Spec.Rules {
+			if rule.Host == "" || strings.HasPrefix(rule.Host, "*") {
+				continue
+			}
+			if _, ok := hosts[rule.Host]; ok {
+				continue
+			}
+			hosts[rule.Host] = struct{}{}
+			for _, ip := range ips {
+				if rec, ok := addressDNSRecord(rule.Host, ip, source); ok {
+					records = append(records, rec)
+				}
+			}
+		}
+	}
+	return records
+}
+
+// serviceDNSRecords maps the name of every annotated LoadBalancer or NodePort Service to its addresses and registers an SRV record for each named port.
+// LoadBalancer Services resolve to their load balancer IPs, NodePort Services to the given IPs of the server device.
+// Services annotated with an invalid name are skipped and reported as problem.
+func serviceDNSRecords(services []corev1.Service, nodePortIPs []string) ([]deviceapi.RegisteredDNSRecord, []dnsProblem) {
+	var (
+		records  []deviceapi.RegisteredDNSRecord
+		problems []dnsProblem
+	)
+	for _, svc := range services {
+		name := svc.GetAnnotations()[annotationDNSName]
+		if name == "" {
+			continue
+		}
+		source := fmt.Sprintf("service/%s/%s", svc.Namespace, svc.Name)
+		if errs := validation.IsDNS1123Subdomain(strings.TrimSuffix(name, ".")); len(errs) > 0 {
+			problems = append(problems, dnsProblem{
+				Source:  source,
+				Reason:  eventReasonInvalidDNSName,
+				Message: fmt.Sprintf("invalid DNS name %q within annotation %s: %s", name, annotationDNSName, strings.Join(errs, ", ")),
+			})
+			continue
+		}
+		var ips []string
+		switch svc.Spec.Type {
+		case corev1.ServiceTypeLoadBalancer:
+			for _, ing := range svc.Status.LoadBalancer.Ingress {
+				if ing.IP != "" {
+					ips = append(ips, ing.IP)
+				}
+			}
+		case corev1.ServiceTypeNodePort:
+			ips = nodePortIPs
+		default:
+			continue
+		}
+		if len(ips) == 0 {
+			continue
+		}
+		for _, ip := range ips {
+			if rec, ok := addressDNSRecord(name, ip, source); ok {
+				records = append(records, rec)
+			}
+		}
+		for _, p := range svc.Spec.Ports {
+			port := p.Port
+			if svc.Spec.Type == corev1.ServiceTypeNodePort {
+				port = p.NodePort
+			}
+			if p.Name == "" || port == 0 {
+				continue
+			}
+			proto := strings.ToLower(string(p.Protocol))
+			if proto == "" {
+				proto = "tcp"
+			}
+			records = append(records, deviceapi.RegisteredDNSRecord{
+				DNSRecord: deviceapi.DNSRecord{
+					Name:  fmt.Sprintf("_%s._%s.%s", p.Name, proto, name),
+					Type:  deviceapi.DNSRecordTypeSRV,
+					Value: net.JoinHostPort(name, strconv.Itoa(int(port))),
+				},
+				Source: source,
+			})
+		}
+	}
+	return records, problems
+}
+
+func addressDNSRecord(name, addr, source string) (deviceapi.RegisteredDNSRecord, bool) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return deviceapi.RegisteredDNSRecord{}, false
+	}
+	t := deviceapi.DNSRecordTypeAAAA
+	if ip.To4() != nil {
+		t = deviceapi.DNSRecordTypeA
+	}
+	return deviceapi.RegisteredDNSRecord{
+		DNSRecord: deviceapi.DNSRecord{Name: name, Type: t, Value: addr},
+		Source:    source,
+	}, true
+}
@@ -0,0 +1,129 @@
+package device
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/storage"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestServiceDNSRecords(t *testing.T) {
+	annotations := map[string]string{annotationDNSName: "media"}
+	services := []corev1.Service{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "lb", Namespace: "default", Annotations: annotations},
+			Spec: corev1.ServiceSpec{
+				Type:  corev1.ServiceTypeLoadBalancer,
+				Ports: []corev1.ServicePort{{Name: "http", Protocol: corev1.ProtocolTCP, Port: 8080}},
+			},
+			Status: corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{{IP: "11.0.0.20"}}}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "np", Namespace: "default", Annotations: map[string]string{annotationDNSName: "snapcast"}},
+			Spec: corev1.ServiceSpec{
+				Type:  corev1.ServiceTypeNodePort,
+				Ports: []corev1.ServicePort{{Name: "stream", Protocol: corev1.ProtocolUDP, Port: 1704, NodePort: 31704}, {Port: 80, NodePort: 30080}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "clusterip", Namespace: "default", Annotations: annotations},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "unannotated", Namespace: "default"},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeNodePort},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "inject", Namespace: "default", Annotations: map[string]string{annotationDNSName: "x\nserver=1.2.3.4\nfoo.kube.m8"}},
+			Spec: corev1.ServiceSpec{
+				Type:  corev1.ServiceTypeNodePort,
+				Ports: []corev1.ServicePort{{Name: "http", Protocol: corev1.ProtocolTCP, Port: 80, NodePort: 30080}},
+			},
+		},
+	}
+	records, problems := serviceDNSRecords(services, []string{"11.0.0.1", "fd00::1"})
+	require.Equal(t, []deviceapi.RegisteredDNSRecord{
+		{DNSRecord: deviceapi.DNSRecord{Name: "media", Type: deviceapi.DNSRecordTypeA, Value: "11.0.0.20"}, Source: "service/default/lb"},
+		{DNSRecord: deviceapi.DNSRecord{Name: "_http._tcp.media", Type: deviceapi.DNSRecordTypeSRV, Value: "media:8080"}, Source: "service/default/lb"},
+		{DNSRecord: deviceapi.DNSRecord{Name: "snapcast", Type: deviceapi.DNSRecordTypeA, Value: "11.0.0.1"}, Source: "service/default/np"},
+		{DNSRecord: deviceapi.DNSRecord{Name: "snapcast", Type: deviceapi.DNSRecordTypeAAAA, Value: "fd00::1"}, Source: "service/default/np"},
+		{DNSRecord: deviceapi.DNSRecord{Name: "_stream._udp.snapcast", Type: deviceapi.DNSRecordTypeSRV, Value: "snapcast:31704"}, Source: "service/default/np"},
+	}, records)
+	require.Len(t, problems, 1, "problems")
+	require.Equal(t, "service/default/inject", problems[0].Source, "problem source")
+	require.Equal(t, eventReasonInvalidDNSName, problems[0].Reason, "problem reason")
+}
+
+func TestResolveDNSConflicts(t *testing.T) {
+	static := []deviceapi.DNSRecord{{Name: "nas", Type: deviceapi.DNSRecordTypeA, Value: "11.0.0.5"}}
+	rec := func(name, value, source string) deviceapi.RegisteredDNSRecord {
+		return deviceapi.RegisteredDNSRecord{DNSRecord: deviceapi.DNSRecord{Name: name, Type: deviceapi.DNSRecordTypeA, Value: value}, Source: source}
+	}
+	records := []deviceapi.RegisteredDNSRecord{
+		rec("node-a", "11.0.0.11", "node/node-a"),
+		rec("app.kube.m8", "11.0.0.1", "ingress/default/app"),
+		rec("app", "11.0.0.1", "ingress/default/app-api"),
+		rec("nas.kube.m8.", "11.0.0.1", "ingress/default/nas"),
+		rec("node-a", "11.0.0.30", "service/default/node-a"),
+	}
+	resolved, conflicts := resolveDNSConflicts("kube.m8", static, records)
+	require.Equal(t, records[:3], resolved)
+	require.Equal(t, []dnsConflict{
+		{Source: "ingress/default/nas", Name: "nas.kube.m8", Owner: "dnsconfig/default"},
+		{Source: "service/default/node-a", Name: "node-a.kube.m8", Owner: "node/node-a"},
+	}, conflicts)
+}
+
+func TestRejectOutOfZoneDNSRecords(t *testing.T) {
+	rec := func(name, source string) deviceapi.RegisteredDNSRecord {
+		return deviceapi.RegisteredDNSRecord{DNSRecord: deviceapi.DNSRecord{Name: name, Type: deviceapi.DNSRecordTypeA, Value: "11.0.0.1"}, Source: source}
+	}
+	records := []deviceapi.RegisteredDNSRecord{
+		rec("node-a", "node/node-a"),
+		rec("app.kube.m8", "ingress/default/app"),
+		rec("App.Kube.M8.", "ingress/default/app-upper"),
+		rec("_http._tcp.media", "service/default/media"),
+		rec("www.example.org", "ingress/default/phishing"),
+		rec("example.org.", "ingress/default/phishing"),
+		rec("kube.m8", "ingress/default/apex"),
+		rec("evilkube.m8", "service/default/evil"),
+		rec("evilkube.m8", "service/default/evil"),
+	}
+	accepted, problems := rejectOutOfZoneDNSRecords("kube.m8", records)
+	require.Equal(t, records[:4], accepted)
+	require.Equal(t, []dnsProblem{
+		{Source: "ingress/default/phishing", Reason: eventReasonDNSNameOutsideZone, Message: "DNS name www.example.org is not within the zone kube.m8"},
+		{Source: "ingress/default/phishing", Reason: eventReasonDNSNameOutsideZone, Message: "DNS name example.org is not within the zone kube.m8"},
+		{Source: "ingress/default/apex", Reason: eventReasonDNSNameOutsideZone, Message: "DNS name kube.m8 is not within the zone kube.m8"},
+		{Source: "service/default/evil", Reason: eventReasonDNSNameOutsideZone, Message: "DNS name evilkube.m8 is not within the zone kube.m8"},
+	}, problems)
+}
+
+func TestStoreSource(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, deviceapi.AddToScheme(scheme))
+	store := storage.InMemory(scheme)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: deviceapi.DNSConfigName}}
+	queue := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[reconcile.Request]())
+	defer queue.ShutDown()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	err := storeSource(store, req).Start(ctx, queue)
+	require.NoError(t, err, "start")
+	c := &deviceapi.DNSConfig{ObjectMeta: metav1.ObjectMeta{Name: deviceapi.DNSConfigName}}
+	require.NoError(t, store.Create(c.Name, c))
+	require.Eventually(t, func() bool { return queue.Len() == 1 }, 5*time.Second, 10*time.Millisecond, "should enqueue request on change")
+	item, _ := queue.Get()
+	require.Equal(t, req, item, "request")
+}
@@ -0,0 +1,65 @@
+package device
+
+import (
+	"context"
+	"encoding/base64"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/localca"
+	"github.com/mgoltzsche/kubemate/pkg/storage"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// LocalCAReconciler generates the local CA again when the local DNS zone changed, since the CA is constrained to the zone,
+// and publishes the CA certificate as Certificate.
+type LocalCAReconciler struct {
+	LocalCA      *localca.CA
+	Certificates storage.Interface
+	DNSConfigs   storage.Interface
+	client.Client
+}
+
+func (r *LocalCAReconciler) AddToScheme(s *runtime.Scheme) error {
+	return deviceapi.AddToScheme(s)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *LocalCAReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.Client = mgr.GetClient()
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("localca").
+		For(&deviceapi.DNSConfig{}).
+		Complete(r)
+}
+
+func (r *LocalCAReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	c := &deviceapi.DNSConfig{}
+	err := r.DNSConfigs.Get(req.Name, c)
+	if err != nil {
+		return requeue(err)
+	}
+	zone := c.Spec.Zone
+	if zone == "" {
+		zone = deviceapi.DefaultDNSZone
+	}
+	changed, err := r.LocalCA.SetZone(zone)
+	if err != nil {
+		return requeue(err)
+	}
+	if changed {
+		log.FromContext(ctx).Info("generated new local ca for changed dns zone", "zone", zone)
+	}
+	caCert := base64.StdEncoding.EncodeToString(r.LocalCA.CertPEM())
+	cert := &deviceapi.Certificate{}
+	err = r.Certificates.Update(deviceapi.LocalCACertificateName, cert, func() error {
+		cert.Spec.CACert = caCert
+		return nil
+	})
+	if err != nil {
+		return requeue(err)
+	}
+	return ctrl.Result{}, nil
+}
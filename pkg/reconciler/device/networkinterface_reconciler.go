@@ -2,14 +2,23 @@ package device
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/go-logr/logr"
 	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/cellular"
+	"github.com/mgoltzsche/kubemate/pkg/middleware"
 	"github.com/mgoltzsche/kubemate/pkg/networkifaces"
 	"github.com/mgoltzsche/kubemate/pkg/storage"
 	"github.com/mgoltzsche/kubemate/pkg/utils"
 	"github.com/mgoltzsche/kubemate/pkg/wifi"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -17,6 +26,39 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
+const (
+	stationStatusRefreshInterval = 30 * time.Second
+	stationFallbackScanInterval  = time.Minute
+	// stationFallbackMaxScanInterval limits the backoff of the scan for a saved network after repeated failed connection attempts.
+	stationFallbackMaxScanInterval = 30 * time.Minute
+	// linkConfigConfirmationCheckInterval is the interval in which a pending link configuration change is checked for confirmation.
+	linkConfigConfirmationCheckInterval = 5 * time.Second
+)
+
+// linkConfigurator applies the addressing configuration of a network link.
+type linkConfigurator interface {
+	Apply(name string, conf *deviceapi.NetworkLinkConfig) error
+	Close()
+}
+
+// wifiStation is the radio a wifi station and its access point fallback are operated with.
+type wifiStation interface {
+	StartStation(networks []wifi.StationNetwork) error
+	StopStation()
+	StationStatus() (*wifi.StationStatus, error)
+	StationNetworkInRange(networks []wifi.StationNetwork) bool
+	Scan() error
+	StartAccessPoint(c wifi.AccessPointConfig) (int, error)
+	StopAccessPoint()
+}
+
+// stationFailures counts the consecutive failed attempts of a wifi station to connect to the same saved networks.
+type stationFailures struct {
+	// networks identifies the saved networks including their passwords.
+	networks string
+	count    int
+}
+
 // NetworkInterfaceReconciler reconciles a Device object.
 type NetworkInterfaceReconciler struct {
 	DeviceName        string
@@ -24,10 +66,22 @@ type NetworkInterfaceReconciler struct {
 	Store             storage.Interface
 	WifiPasswords     storage.Interface
 	WifiNetworks      storage.Interface
-	Wifi              *wifi.Wifi
+	Wifi              *wifi.Radios
+	Modems            *cellular.Modems
+	// Clients tracks the API clients in order to confirm link configuration changes.
+	Clients *middleware.ClientTracker
 	client.Client
-	scheme   *runtime.Scheme
-	linkSync *networkifaces.NetworkIfaceSync
+	scheme     *runtime.Scheme
+	linkSync   *networkifaces.NetworkIfaceSync
+	linkConfig linkConfigurator
+	// linkConfigAppliedAt maps the interfaces to the time a pending link configuration was applied at.
+	linkConfigAppliedAt map[string]time.Time
+	// stationDisconnectedSince maps the wifi interfaces to the time since when their station has not been connected.
+	stationDisconnectedSince map[string]time.Time
+	lastFallbackScan         map[string]time.Time
+	stationFailures          map[string]stationFailures
+	// cellularConnected contains the cellular interfaces whose modem has been connected by the reconciler.
+	cellularConnected map[string]bool
 }
 
 func (r *NetworkInterfaceReconciler) AddToScheme(s *runtime.Scheme) error {
@@ -42,6 +96,12 @@ func (r *NetworkInterfaceReconciler) AddToScheme(s *runtime.Scheme) error {
 func (r *NetworkInterfaceReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.scheme = mgr.GetScheme()
 	r.Client = mgr.GetClient()
+	r.linkConfig = networkifaces.NewLinkConfigurator(logrus.WithField("comp", "link-config"))
+	r.linkConfigAppliedAt = map[string]time.Time{}
+	r.stationDisconnectedSince = map[string]time.Time{}
+	r.lastFallbackScan = map[string]time.Time{}
+	r.stationFailures = map[string]stationFailures{}
+	r.cellularConnected = map[string]bool{}
 	r.linkSync = &networkifaces.NetworkIfaceSync{
 		Interfaces:    r.NetworkInterfaces,
 		DefaultAPSSID: r.DeviceName,
@@ -58,6 +118,9 @@ func (r *NetworkInterfaceReconciler) SetupWithManager(mgr ctrl.Manager) error {
 }
 
 func (r *NetworkInterfaceReconciler) Close() error {
+	if r.linkConfig != nil {
+		r.linkConfig.Close()
+	}
 	if r.linkSync != nil {
 		return r.linkSync.Stop()
 	}
@@ -71,15 +134,27 @@ func (r *NetworkInterfaceReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	err = r.Client.Get(ctx, req.NamespacedName, &iface)
 	if err != nil {
 		if errors.IsNotFound(err) {
-			return ctrl.Result{}, nil
+			return ctrl.Result{}, r.removeNetworkInterface(req.Name, logger)
 		}
 		return requeue(err)
 	}
+	if iface.Status.Link.Absent {
+		// The resource is kept for its spec to be applied when the link reappears.
+		return ctrl.Result{}, r.removeNetworkInterface(req.Name, logger)
+	}
 	logger.V(1).Info("reconcile network interface")
 
+	var requeueAfter time.Duration
 	switch iface.Status.Link.Type {
 	case deviceapi.NetworkInterfaceTypeWifi:
 		err = r.reconcileWifiNetworkInterface(&iface, logger)
+		if e := setWifiFirewallStatus(&iface, r.Store, r.Wifi.Radio(iface.Name).FirewallRules()); err == nil {
+			err = e
+		}
+	case deviceapi.NetworkInterfaceTypeCellular:
+		requeueAfter, err = r.reconcileCellularNetworkInterface(&iface, logger)
+	default:
+		requeueAfter, err = r.reconcileLinkConfig(&iface, logger)
 	}
 	if err == nil {
 		err = r.ensureIPAddress(&iface)
@@ -106,22 +181,55 @@ func (r *NetworkInterfaceReconciler) Reconcile(ctx context.Context, req ctrl.Req
 
 	logger.V(1).Info("network interface reconciliation complete")
 
+	if requeueAfter > 0 {
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+	switch iface.Spec.Wifi.Mode {
+	case deviceapi.WifiModeStation, deviceapi.WifiModeAccessPointStation:
+		if iface.Status.Link.Type == deviceapi.NetworkInterfaceTypeWifi {
+			// Refresh the station status periodically since the signal changes and the station roams between networks.
+			return ctrl.Result{RequeueAfter: stationStatusRefreshInterval}, nil
+		}
+	}
 	return ctrl.Result{}, nil
 }
 
-// ensureIPAddress copies the IP address from the interface into the resource status or returns an error.
+// removeNetworkInterface stops the processes of a network interface that has been unplugged or is absent.
+func (r *NetworkInterfaceReconciler) removeNetworkInterface(name string, logger logr.Logger) error {
+	logger.Info("network interface removed")
+	delete(r.linkConfigAppliedAt, name)
+	delete(r.stationDisconnectedSince, name)
+	delete(r.lastFallbackScan, name)
+	delete(r.stationFailures, name)
+	delete(r.cellularConnected, name)
+	err := r.linkConfig.Apply(name, nil)
+	if err != nil {
+		return err
+	}
+	return r.Wifi.Remove(name)
+}
+
+// ensureIPAddress copies the IP addresses from the interface into the resource status or returns an error.
 // This is because the IP may be set after the link up status event was received in which case a reconciliation can be scheduled here.
 func (r *NetworkInterfaceReconciler) ensureIPAddress(iface *deviceapi.NetworkInterface) error {
-	if iface.Status.Link.Up && iface.Status.Link.IP4 == "" {
+	if iface.Status.Link.Up && iface.Status.Link.IP4 == "" && len(iface.Status.Link.IP6) == 0 {
 		ip, err := networkifaces.IPv4Address(iface.Name)
-		if err != nil || ip == nil {
-			if err == nil {
-				err = fmt.Errorf("no ip address assigned to network interface")
-			}
+		if err != nil {
+			return err
+		}
+		ipv6, err := networkifaces.IPv6Addresses(iface.Name)
+		if err != nil {
 			return err
 		}
+		if ip == nil && len(ipv6) == 0 {
+			return fmt.Errorf("no ip address assigned to network interface")
+		}
 		err = r.Store.Update(iface.Name, iface, func() error {
-			iface.Status.Link.IP4 = ip.String()
+			iface.Status.Link.IP4 = ""
+			if ip != nil {
+				iface.Status.Link.IP4 = ip.String()
+			}
+			iface.Status.Link.IP6 = networkifaces.IPStrings(ipv6)
 			return nil
 		})
 		if err != nil {
@@ -132,61 +240,84 @@ func (r *NetworkInterfaceReconciler) ensureIPAddress(iface *deviceapi.NetworkInt
 }
 
 func (r *NetworkInterfaceReconciler) reconcileWifiNetworkInterface(iface *deviceapi.NetworkInterface, logger logr.Logger) error {
+	w := r.Wifi.Radio(iface.Name)
 	switch iface.Spec.Wifi.Mode {
 	case deviceapi.WifiModeAccessPoint:
-		r.Wifi.StopStation()
-		err := r.Wifi.StartWifiInterface()
+		w.StopStation()
+		err := r.startWifiInterface(iface, w, logger)
+		if err != nil {
+			return err
+		}
+		apConf, err := r.accessPointConfig(iface)
 		if err != nil {
 			return err
 		}
-		err = updateWifiNetworkList(r.Wifi, r.WifiNetworks, logger)
+		channel, err := w.StartAccessPoint(apConf)
 		if err != nil {
 			return err
 		}
-		err = setWifiIfaceCountry(iface, r.Store, r.Wifi, logger)
+		err = setWifiChannelStatus(iface, r.Store, channel)
 		if err != nil {
 			return err
 		}
-		wifiPassword := deviceapi.WifiPassword{}
-		err = r.WifiPasswords.Get(deviceapi.AccessPointPasswordKey, &wifiPassword)
+		err = setWifiFallbackStatus(iface, r.Store, false)
 		if err != nil {
 			return err
 		}
-		err = r.Wifi.StartAccessPoint(r.DeviceName, wifiPassword.Data.Password)
+		err = clearStationStatus(iface, r.Store)
 		if err != nil {
 			return err
 		}
 	case deviceapi.WifiModeStation:
-		r.Wifi.StopAccessPoint()
-		err := r.Wifi.StartWifiInterface()
+		err := r.reconcileStation(iface, w, logger)
 		if err != nil {
 			return err
 		}
-		err = updateWifiNetworkList(r.Wifi, r.WifiNetworks, logger)
+	case deviceapi.WifiModeAccessPointStation:
+		err := r.startWifiInterface(iface, w, logger)
 		if err != nil {
 			return err
 		}
-		err = setWifiIfaceCountry(iface, r.Store, r.Wifi, logger)
+		apConf, err := r.accessPointConfig(iface)
 		if err != nil {
 			return err
 		}
-		var pw deviceapi.WifiPassword
-		ssid := iface.Spec.Wifi.Station.SSID
-		if ssid == "" {
-			return fmt.Errorf("no wifi network configured to connect to")
+		networks, err := r.stationNetworks(iface)
+		if err != nil {
+			return err
+		}
+		channel, err := w.StartAccessPointStation(apConf, networks)
+		if err != nil {
+			return err
 		}
-		err = r.WifiPasswords.Get(ssidToResourceName(ssid), &pw)
+		err = setWifiFallbackStatus(iface, r.Store, false)
 		if err != nil {
-			return fmt.Errorf("no password configured for wifi network %q", ssid)
+			return err
 		}
-		err = r.Wifi.StartStation(ssid, pw.Data.Password)
+		err = setWifiChannelStatus(iface, r.Store, channel)
+		if err != nil {
+			return err
+		}
+		err = r.updateStationStatus(iface, w)
 		if err != nil {
 			return err
 		}
 	default:
-		r.Wifi.StopStation()
-		r.Wifi.StopAccessPoint()
-		err := r.Wifi.StopWifiInterface()
+		w.StopStation()
+		w.StopAccessPoint()
+		err := setWifiChannelStatus(iface, r.Store, 0)
+		if err != nil {
+			return err
+		}
+		err = setWifiFallbackStatus(iface, r.Store, false)
+		if err != nil {
+			return err
+		}
+		err = clearStationStatus(iface, r.Store)
+		if err != nil {
+			return err
+		}
+		err = w.StopWifiInterface()
 		if err != nil {
 			return err
 		}
@@ -194,6 +325,309 @@ func (r *NetworkInterfaceReconciler) reconcileWifiNetworkInterface(iface *device
 	return nil
 }
 
+// reconcileStation connects the station to a saved network.
+// When it cannot connect within the fallback timeout, the access point is started instead until a saved network is in range again.
+func (r *NetworkInterfaceReconciler) reconcileStation(iface *deviceapi.NetworkInterface, w *wifi.Wifi, logger logr.Logger) error {
+	err := r.startWifiInterface(iface, w, logger)
+	if err != nil {
+		return err
+	}
+	networks, err := r.stationNetworks(iface)
+	if err != nil {
+		return err
+	}
+	return r.reconcileStationConnection(iface, w, networks, logger)
+}
+
+func (r *NetworkInterfaceReconciler) reconcileStationConnection(iface *deviceapi.NetworkInterface, w wifiStation, networks []wifi.StationNetwork, logger logr.Logger) error {
+	if iface.Status.Wifi.Fallback {
+		return r.reconcileStationFallback(iface, w, networks, logger)
+	}
+	w.StopAccessPoint()
+	err := setWifiChannelStatus(iface, r.Store, 0)
+	if err != nil {
+		return err
+	}
+	err = w.StartStation(networks)
+	if err != nil {
+		return err
+	}
+	err = r.updateStationStatus(iface, w)
+	if err != nil {
+		return err
+	}
+	timeout := deviceapi.DefaultWifiStationFallbackTimeout
+	if t := iface.Spec.Wifi.Station.FallbackTimeout; t != nil {
+		timeout = t.Duration
+	}
+	connected := iface.Status.Wifi.Station != nil && iface.Status.Link.IP4 != ""
+	if connected {
+		delete(r.stationFailures, iface.Name)
+	}
+	if timeout == 0 || connected {
+		delete(r.stationDisconnectedSince, iface.Name)
+		return nil
+	}
+	now := time.Now()
+	if r.stationDisconnectedSince[iface.Name].IsZero() {
+		r.stationDisconnectedSince[iface.Name] = now
+	}
+	if now.Sub(r.stationDisconnectedSince[iface.Name]) < timeout {
+		return nil
+	}
+	failures := r.stationFailures[iface.Name]
+	if key := stationNetworksKey(networks); failures.networks != key {
+		failures = stationFailures{networks: key}
+	}
+	failures.count++
+	r.stationFailures[iface.Name] = failures
+	logger.Info("wifi station could not connect, falling back to access point mode", "timeout", timeout.String(), "attempts", failures.count)
+	delete(r.stationDisconnectedSince, iface.Name)
+	r.lastFallbackScan[iface.Name] = now
+	w.StopStation()
+	err = clearStationStatus(iface, r.Store)
+	if err != nil {
+		return err
+	}
+	err = setWifiFallbackStatus(iface, r.Store, true)
+	if err != nil {
+		return err
+	}
+	return r.reconcileStationFallback(iface, w, networks, logger)
+}
+
+// reconcileStationFallback runs the access point and scans periodically for a saved network to leave the fallback mode.
+// The scan interval is doubled with each failed attempt to connect to the same saved networks
+// in order not to switch between station and access point mode continuously e.g. due to a wrong password.
+func (r *NetworkInterfaceReconciler) reconcileStationFallback(iface *deviceapi.NetworkInterface, w wifiStation, networks []wifi.StationNetwork, logger logr.Logger) error {
+	scanInterval := stationFallbackScanInterval
+	if failures := r.stationFailures[iface.Name]; failures.networks == stationNetworksKey(networks) {
+		scanInterval = stationFallbackBackoff(failures.count)
+	}
+	if time.Since(r.lastFallbackScan[iface.Name]) >= scanInterval {
+		r.lastFallbackScan[iface.Name] = time.Now()
+		err := w.Scan()
+		if err != nil {
+			logger.Error(err, "failed to scan wifi networks")
+		} else {
+			err = updateWifiNetworkList(r.Wifi.Networks(), r.WifiNetworks, logger)
+			if err != nil {
+				return err
+			}
+			if w.StationNetworkInRange(networks) {
+				logger.Info("saved wifi network is in range, leaving access point fallback mode")
+				w.StopAccessPoint()
+				err = setWifiChannelStatus(iface, r.Store, 0)
+				if err != nil {
+					return err
+				}
+				// The status update triggers the reconciliation that starts the station.
+				return setWifiFallbackStatus(iface, r.Store, false)
+			}
+		}
+	}
+	apConf, err := r.accessPointConfig(iface)
+	if err != nil {
+		return err
+	}
+	channel, err := w.StartAccessPoint(apConf)
+	if err != nil {
+		return err
+	}
+	return setWifiChannelStatus(iface, r.Store, channel)
+}
+
+// stationFallbackBackoff returns the interval in which to scan for a saved network after the given number of failed connection attempts.
+func stationFallbackBackoff(failures int) time.Duration {
+	d := stationFallbackScanInterval
+	for i := 1; i < failures && d < stationFallbackMaxScanInterval; i++ {
+		d *= 2
+	}
+	return min(d, stationFallbackMaxScanInterval)
+}
+
+// stationNetworksKey returns a hash of the given saved networks including their passwords.
+func stationNetworksKey(networks []wifi.StationNetwork) string {
+	b, _ := json.Marshal(networks)
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func (r *NetworkInterfaceReconciler) startWifiInterface(iface *deviceapi.NetworkInterface, w *wifi.Wifi, logger logr.Logger) error {
+	err := w.StartWifiInterface()
+	if err != nil {
+		return err
+	}
+	err = updateWifiNetworkList(r.Wifi.Networks(), r.WifiNetworks, logger)
+	if err != nil {
+		return err
+	}
+	return setWifiIfaceCountry(iface, r.Store, w, logger)
+}
+
+func (r *NetworkInterfaceReconciler) accessPointConfig(iface *deviceapi.NetworkInterface) (wifi.AccessPointConfig, error) {
+	wifiPassword := deviceapi.WifiPassword{}
+	err := r.WifiPasswords.Get(deviceapi.AccessPointPasswordKey, &wifiPassword)
+	if err != nil {
+		return wifi.AccessPointConfig{}, err
+	}
+	c, err := accessPointConfig(&iface.Spec.Wifi.AccessPoint, wifiPassword.Data.Password)
+	if err != nil {
+		return c, err
+	}
+	if c.SSID == "" {
+		c.SSID = r.DeviceName
+	}
+	return c, nil
+}
+
+// stationNetworks returns the saved wifi networks along with their passwords.
+// The network specified by the SSID field is preferred over the others.
+func (r *NetworkInterfaceReconciler) stationNetworks(iface *deviceapi.NetworkInterface) ([]wifi.StationNetwork, error) {
+	spec := &iface.Spec.Wifi.Station
+	saved := make([]deviceapi.SavedWifiNetwork, 0, len(spec.Networks)+1)
+	maxPriority := 0
+	for _, n := range spec.Networks {
+		if n.SSID != spec.SSID {
+			saved = append(saved, n)
+		}
+		if n.Priority > maxPriority {
+			maxPriority = n.Priority
+		}
+	}
+	if spec.SSID != "" {
+		n := deviceapi.SavedWifiNetwork{SSID: spec.SSID, Priority: maxPriority + 1}
+		for _, s := range spec.Networks {
+			if s.SSID == spec.SSID {
+				n.PasswordRef = s.PasswordRef
+				n.EAP = s.EAP
+			}
+		}
+		saved = append([]deviceapi.SavedWifiNetwork{n}, saved...)
+	}
+	if len(saved) == 0 {
+		return nil, fmt.Errorf("no wifi network configured to connect to")
+	}
+	networks := make([]wifi.StationNetwork, len(saved))
+	for i, n := range saved {
+		passwordRef := n.PasswordRef
+		if passwordRef == "" {
+			passwordRef = ssidToResourceName(n.SSID)
+		}
+		var pw deviceapi.WifiPassword
+		err := r.WifiPasswords.Get(passwordRef, &pw)
+		if err != nil {
+			return nil, fmt.Errorf("no password configured for wifi network %q", n.SSID)
+		}
+		networks[i] = wifi.StationNetwork{
+			SSID:     n.SSID,
+			Password: pw.Data.Password,
+			Priority: n.Priority,
+		}
+		if eap := n.EAP; eap != nil {
+			networks[i].EAP = &wifi.EAPConfig{
+				Method:            wifi.EAPMethod(eap.Method),
+				Phase2:            eap.Phase2,
+				Identity:          eap.Identity,
+				AnonymousIdentity: eap.AnonymousIdentity,
+				DomainSuffixMatch: eap.DomainSuffixMatch,
+				CACert:            pw.Data.CACert,
+				ClientCert:        pw.Data.ClientCert,
+				ClientKey:         pw.Data.ClientKey,
+				ClientKeyPassword: pw.Data.ClientKeyPassword,
+			}
+		}
+	}
+	return networks, nil
+}
+
+// updateStationStatus stores the wifi network the station is associated with within the NetworkInterface status.
+func (r *NetworkInterfaceReconciler) updateStationStatus(iface *deviceapi.NetworkInterface, w wifiStation) error {
+	s, err := w.StationStatus()
+	if err != nil {
+		return fmt.Errorf("get wifi station status: %w", err)
+	}
+	var status *deviceapi.WifiStationStatus
+	if s != nil {
+		status = &deviceapi.WifiStationStatus{
+			SSID:      s.SSID,
+			BSSID:     s.BSSID,
+			Frequency: s.Frequency,
+			Signal:    s.Signal,
+			Bitrate:   s.Bitrate,
+		}
+	}
+	if equality.Semantic.DeepEqual(iface.Status.Wifi.Station, status) {
+		return nil
+	}
+	return r.Store.Update(iface.Name, iface, func() error {
+		iface.Status.Wifi.Station = status
+		return nil
+	})
+}
+
+// accessPointConfig maps the access point spec to the wifi configuration.
+func accessPointConfig(spec *deviceapi.WifiAccessPointSpec, password string) (wifi.AccessPointConfig, error) {
+	c := wifi.AccessPointConfig{
+		SSID:            spec.SSID,
+		Password:        password,
+		Band:            wifi.Band(spec.Band),
+		Security:        wifi.Security(spec.Security),
+		Hidden:          spec.Hidden,
+		MaxClients:      spec.MaxClients,
+		ClientIsolation: spec.ClientIsolation,
+		IngressOnly:     spec.IngressOnly,
+	}
+	if spec.Channel != "" && spec.Channel != deviceapi.WifiChannelAuto {
+		channel, err := strconv.Atoi(spec.Channel)
+		if err != nil || channel < 1 {
+			return c, fmt.Errorf("invalid wifi channel %q", spec.Channel)
+		}
+		c.Channel = channel
+	}
+	return c, nil
+}
+
+func setWifiChannelStatus(iface *deviceapi.NetworkInterface, ifaces storage.Interface, channel int) error {
+	if iface.Status.Wifi.Channel == channel {
+		return nil
+	}
+	return ifaces.Update(iface.Name, iface, func() error {
+		iface.Status.Wifi.Channel = channel
+		return nil
+	})
+}
+
+func setWifiFirewallStatus(iface *deviceapi.NetworkInterface, ifaces storage.Interface, rules []string) error {
+	if equality.Semantic.DeepEqual(iface.Status.Wifi.FirewallRules, rules) {
+		return nil
+	}
+	return ifaces.Update(iface.Name, iface, func() error {
+		iface.Status.Wifi.FirewallRules = rules
+		return nil
+	})
+}
+
+func setWifiFallbackStatus(iface *deviceapi.NetworkInterface, ifaces storage.Interface, fallback bool) error {
+	if iface.Status.Wifi.Fallback == fallback {
+		return nil
+	}
+	return ifaces.Update(iface.Name, iface, func() error {
+		iface.Status.Wifi.Fallback = fallback
+		return nil
+	})
+}
+
+func clearStationStatus(iface *deviceapi.NetworkInterface, ifaces storage.Interface) error {
+	if iface.Status.Wifi.Station == nil {
+		return nil
+	}
+	return ifaces.Update(iface.Name, iface, func() error {
+		iface.Status.Wifi.Station = nil
+		return nil
+	})
+}
+
 func ssidToResourceName(ssid string) string {
 	ssid = fmt.Sprintf("ssid-%s", ssid)
 	return utils.TruncateName(ssid, utils.MaxResourceNameLength)
@@ -216,9 +650,9 @@ func setWifiIfaceCountry(iface *deviceapi.NetworkInterface, ifaces storage.Inter
 	return nil
 }
 
-func updateWifiNetworkList(w *wifi.Wifi, wifiNetworks storage.Interface, logger logr.Logger) error {
+func updateWifiNetworkList(networks []wifi.WifiNetwork, wifiNetworks storage.Interface, logger logr.Logger) error {
 	foundNetworks := map[string]struct{}{}
-	for _, network := range w.Networks() {
+	for _, network := range networks {
 		n := &deviceapi.WifiNetwork{}
 		n.Name = fmt.Sprintf("ssid-%s", network.SSID)
 		n.Name = utils.TruncateName(n.Name, utils.MaxResourceNameLength)
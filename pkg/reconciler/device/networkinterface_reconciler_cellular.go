@@ -0,0 +1,104 @@
+package device
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/go-logr/logr"
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/cellular"
+)
+
+// cellularStatusRefreshInterval is the interval in which the modem status is refreshed and a lost connection is re-established.
+const cellularStatusRefreshInterval = 30 * time.Second
+
+// reconcileCellularNetworkInterface connects the modem of a cellular interface and applies the IP configuration of its bearer.
+// The link's default route gets a higher metric than wired and wifi links in order to serve as fallback uplink.
+// It returns the time after which the modem status must be refreshed.
+func (r *NetworkInterfaceReconciler) reconcileCellularNetworkInterface(iface *deviceapi.NetworkInterface, logger logr.Logger) (time.Duration, error) {
+	modem, err := r.Modems.Find(iface.Name)
+	if err != nil {
+		return 0, err
+	}
+	conf := iface.Spec.Cellular
+	switch {
+	case conf == nil && r.cellularConnected[iface.Name]:
+		// The modem is left to the host but disconnect the bearer kubemate connected.
+		err = r.Modems.Disconnect(modem)
+		if err != nil {
+			return 0, err
+		}
+		delete(r.cellularConnected, iface.Name)
+		err = r.linkConfig.Apply(iface.Name, nil)
+		if err != nil {
+			return 0, fmt.Errorf("reset cellular link config: %w", err)
+		}
+	case conf != nil && modem.State != cellular.ModemStateConnected && modem.State != cellular.ModemStateConnecting:
+		logger.Info("connecting modem", "modem", modem.Path, "state", modem.State)
+		err = r.Modems.Connect(modem, cellular.ConnectConfig{
+			APN:          conf.APN,
+			PIN:          conf.PIN,
+			AllowRoaming: conf.AllowRoaming,
+		})
+		if e := r.setCellularStatus(iface, modem); e != nil {
+			logger.Error(e, "update cellular status")
+		}
+		if err != nil {
+			return 0, err
+		}
+		modem, err = r.Modems.Find(iface.Name)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if conf != nil && modem.State == cellular.ModemStateConnected {
+		r.cellularConnected[iface.Name] = true
+		ip, err := r.Modems.BearerIPConfig(modem)
+		if err != nil {
+			return 0, err
+		}
+		err = r.linkConfig.Apply(iface.Name, cellularLinkConfig(ip))
+		if err != nil {
+			return 0, fmt.Errorf("apply cellular link config: %w", err)
+		}
+	}
+	return cellularStatusRefreshInterval, r.setCellularStatus(iface, modem)
+}
+
+func (r *NetworkInterfaceReconciler) setCellularStatus(iface *deviceapi.NetworkInterface, modem *cellular.Modem) error {
+	status := &deviceapi.CellularStatus{
+		Modem:              modem.Model,
+		State:              modem.State,
+		RegistrationState:  modem.RegistrationState,
+		Operator:           modem.Operator,
+		AccessTechnologies: modem.AccessTechnologies,
+		SignalQuality:      modem.SignalQuality,
+	}
+	if reflect.DeepEqual(iface.Status.Cellular, status) {
+		return nil
+	}
+	return r.Store.Update(iface.Name, iface, func() error {
+		iface.Status.Cellular = status
+		return nil
+	})
+}
+
+// cellularLinkConfig maps the IP configuration of a modem's bearer to the link configuration.
+func cellularLinkConfig(ip *cellular.BearerIPConfig) *deviceapi.NetworkLinkConfig {
+	c := &deviceapi.NetworkLinkConfig{MTU: ip.MTU}
+	switch ip.Method {
+	case cellular.BearerIPMethodStatic:
+		c.IP = &deviceapi.IPConfig{
+			Mode:      deviceapi.IPConfigModeStatic,
+			Addresses: []string{fmt.Sprintf("%s/%d", ip.Address, ip.Prefix)},
+			DNS:       ip.DNS,
+		}
+		if ip.Gateway != "" {
+			c.IP.Gateways = []string{ip.Gateway}
+		}
+	case cellular.BearerIPMethodDHCP:
+		c.IP = &deviceapi.IPConfig{Mode: deviceapi.IPConfigModeDHCP}
+	}
+	return c
+}
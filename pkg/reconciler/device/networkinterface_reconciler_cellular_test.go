@@ -0,0 +1,47 @@
+package device
+
+import (
+	"testing"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/cellular"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCellularLinkConfig(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		ip       cellular.BearerIPConfig
+		expected deviceapi.NetworkLinkConfig
+	}{
+		{
+			name: "static",
+			ip: cellular.BearerIPConfig{
+				Method:  cellular.BearerIPMethodStatic,
+				Address: "10.64.12.7",
+				Prefix:  29,
+				Gateway: "10.64.12.8",
+				DNS:     []string{"10.74.210.210"},
+				MTU:     1500,
+			},
+			expected: deviceapi.NetworkLinkConfig{
+				MTU: 1500,
+				IP: &deviceapi.IPConfig{
+					Mode:      deviceapi.IPConfigModeStatic,
+					Addresses: []string{"10.64.12.7/29"},
+					Gateways:  []string{"10.64.12.8"},
+					DNS:       []string{"10.74.210.210"},
+				},
+			},
+		},
+		{
+			name:     "dhcp",
+			ip:       cellular.BearerIPConfig{Method: cellular.BearerIPMethodDHCP},
+			expected: deviceapi.NetworkLinkConfig{IP: &deviceapi.IPConfig{Mode: deviceapi.IPConfigModeDHCP}},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, &c.expected, cellularLinkConfig(&c.ip))
+		})
+	}
+}
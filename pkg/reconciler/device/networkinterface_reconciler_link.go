@@ -0,0 +1,80 @@
+package device
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+)
+
+// reconcileLinkConfig applies the link configuration.
+// A changed configuration is rolled back unless the client that changed it reaches the device again after it has been applied.
+// It returns the time after which the confirmation must be checked again.
+func (r *NetworkInterfaceReconciler) reconcileLinkConfig(iface *deviceapi.NetworkInterface, logger logr.Logger) (time.Duration, error) {
+	applyErr := r.linkConfig.Apply(iface.Name, iface.Spec.Link)
+	if applyErr != nil {
+		applyErr = fmt.Errorf("apply link config: %w", applyErr)
+	}
+	pending, err := pendingLinkConfig(iface)
+	if err != nil {
+		return 0, err
+	}
+	if pending == nil {
+		delete(r.linkConfigAppliedAt, iface.Name)
+		return 0, applyErr
+	}
+	appliedAt, applied := r.linkConfigAppliedAt[iface.Name]
+	if !applied && applyErr == nil {
+		appliedAt = time.Now()
+		r.linkConfigAppliedAt[iface.Name] = appliedAt
+		applied = true
+	}
+	if applied && r.Clients.LastSeen(pending.Client).After(appliedAt) {
+		logger.Info("client confirmed the link configuration", "client", pending.Client)
+		delete(r.linkConfigAppliedAt, iface.Name)
+		return 0, r.Store.Update(iface.Name, iface, func() error {
+			delete(iface.Annotations, deviceapi.PendingLinkConfigAnnotation)
+			iface.Status.LinkConfigMessage = ""
+			return nil
+		})
+	}
+	deadline := pending.ChangedAt.Add(deviceapi.LinkConfigConfirmationTimeout)
+	if time.Now().After(deadline) {
+		logger.Info("client did not reach the device after the link configuration change, rolling back", "client", pending.Client)
+		delete(r.linkConfigAppliedAt, iface.Name)
+		// The update triggers the reconciliation that applies the previous configuration.
+		return 0, r.Store.Update(iface.Name, iface, func() error {
+			delete(iface.Annotations, deviceapi.PendingLinkConfigAnnotation)
+			iface.Spec.Link = pending.Rollback
+			iface.Status.LinkConfigMessage = fmt.Sprintf("link configuration rolled back at %s since client %s did not reach the device within %s after the change",
+				time.Now().Format(time.RFC3339), pending.Client, deviceapi.LinkConfigConfirmationTimeout)
+			return nil
+		})
+	}
+	msg := fmt.Sprintf("link configuration is rolled back at %s unless client %s reaches the device again", deadline.Format(time.RFC3339), pending.Client)
+	if iface.Status.LinkConfigMessage != msg {
+		err = r.Store.Update(iface.Name, iface, func() error {
+			iface.Status.LinkConfigMessage = msg
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return linkConfigConfirmationCheckInterval, applyErr
+}
+
+func pendingLinkConfig(iface *deviceapi.NetworkInterface) (*deviceapi.PendingLinkConfig, error) {
+	pendingJSON, ok := iface.Annotations[deviceapi.PendingLinkConfigAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	pending := &deviceapi.PendingLinkConfig{}
+	err := json.Unmarshal([]byte(pendingJSON), pending)
+	if err != nil {
+		return nil, fmt.Errorf("read annotation %s: %w", deviceapi.PendingLinkConfigAnnotation, err)
+	}
+	return pending, nil
+}
@@ -0,0 +1,124 @@
+package device
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/middleware"
+	"github.com/mgoltzsche/kubemate/pkg/storage"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+type fakeLinkConfigurator struct {
+	applied map[string]*deviceapi.NetworkLinkConfig
+}
+
+func (c *fakeLinkConfigurator) Apply(name string, conf *deviceapi.NetworkLinkConfig) error {
+	c.applied[name] = conf
+	return nil
+}
+
+func (c *fakeLinkConfigurator) Close() {}
+
+func TestReconcileLinkConfig(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, deviceapi.AddToScheme(scheme))
+	static := &deviceapi.NetworkLinkConfig{IP: &deviceapi.IPConfig{Mode: deviceapi.IPConfigModeStatic, Addresses: []string{"192.168.1.2/24"}}}
+	dhcp := &deviceapi.NetworkLinkConfig{IP: &deviceapi.IPConfig{Mode: deviceapi.IPConfigModeDHCP}}
+	client := "192.168.1.10"
+	for _, c := range []struct {
+		name            string
+		rollback        *deviceapi.NetworkLinkConfig
+		changedAgo      time.Duration
+		clientConfirmed bool
+		expectRequeue   time.Duration
+		expectLink      *deviceapi.NetworkLinkConfig
+		expectPending   bool
+		expectMessage   string
+	}{
+		{
+			name:          "unconfirmed",
+			changedAgo:    time.Second,
+			expectRequeue: linkConfigConfirmationCheckInterval,
+			expectLink:    static,
+			expectPending: true,
+			expectMessage: "link configuration is rolled back at",
+		},
+		{
+			name:            "confirmed",
+			changedAgo:      time.Second,
+			clientConfirmed: true,
+			expectLink:      static,
+		},
+		{
+			name:          "timeout rolls back to previous config",
+			rollback:      dhcp,
+			changedAgo:    deviceapi.LinkConfigConfirmationTimeout + time.Second,
+			expectLink:    dhcp,
+			expectMessage: "link configuration rolled back at",
+		},
+		{
+			name:          "timeout rolls back first config",
+			changedAgo:    deviceapi.LinkConfigConfirmationTimeout + time.Second,
+			expectMessage: "link configuration rolled back at",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			store := storage.InMemory(scheme)
+			linkConfig := &fakeLinkConfigurator{applied: map[string]*deviceapi.NetworkLinkConfig{}}
+			clients := middleware.NewClientTracker()
+			r := &NetworkInterfaceReconciler{
+				Store:               store,
+				Clients:             clients,
+				linkConfig:          linkConfig,
+				linkConfigAppliedAt: map[string]time.Time{},
+			}
+			pending, err := json.Marshal(deviceapi.PendingLinkConfig{
+				Client:    client,
+				ChangedAt: metav1.NewTime(time.Now().Add(-c.changedAgo)),
+				Rollback:  c.rollback,
+			})
+			require.NoError(t, err)
+			iface := &deviceapi.NetworkInterface{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "eth0",
+					Annotations: map[string]string{deviceapi.PendingLinkConfigAnnotation: string(pending)},
+				},
+				Spec: deviceapi.NetworkInterfaceSpec{Link: static},
+			}
+			require.NoError(t, store.Create(iface.Name, iface))
+			if c.clientConfirmed {
+				r.linkConfigAppliedAt[iface.Name] = time.Now().Add(-time.Second)
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.RemoteAddr = client + ":43210"
+				clients.Handler(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), req)
+			}
+
+			requeue, err := r.reconcileLinkConfig(iface, logr.Discard())
+			require.NoError(t, err, "reconcileLinkConfig")
+			require.Equal(t, c.expectRequeue, requeue, "requeue after")
+			require.Equal(t, static, linkConfig.applied[iface.Name], "should apply the spec")
+			stored := &deviceapi.NetworkInterface{}
+			require.NoError(t, store.Get(iface.Name, stored))
+			require.Equal(t, c.expectLink, stored.Spec.Link, "link spec")
+			_, isPending := stored.Annotations[deviceapi.PendingLinkConfigAnnotation]
+			require.Equal(t, c.expectPending, isPending, "pending annotation")
+			if c.expectMessage == "" {
+				require.Empty(t, stored.Status.LinkConfigMessage, "message")
+			} else {
+				require.Contains(t, stored.Status.LinkConfigMessage, c.expectMessage, "message")
+			}
+
+			_, err = r.reconcileLinkConfig(stored, logr.Discard())
+			require.NoError(t, err, "reconcile again")
+			require.Equal(t, c.expectLink, linkConfig.applied[iface.Name], "should apply the resulting spec")
+		})
+	}
+}
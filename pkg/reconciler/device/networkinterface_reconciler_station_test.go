@@ -0,0 +1,228 @@
+package device
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/storage"
+	"github.com/mgoltzsche/kubemate/pkg/wifi"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+type fakeWifiStation struct {
+	status         *wifi.StationStatus
+	inRange        bool
+	stationStarted bool
+	apStarted      bool
+	scanned        bool
+}
+
+func (w *fakeWifiStation) StartStation(networks []wifi.StationNetwork) error {
+	w.stationStarted = true
+	return nil
+}
+
+func (w *fakeWifiStation) StopStation() {
+	w.stationStarted = false
+}
+
+func (w *fakeWifiStation) StationStatus() (*wifi.StationStatus, error) {
+	if !w.stationStarted {
+		return nil, nil
+	}
+	return w.status, nil
+}
+
+func (w *fakeWifiStation) StationNetworkInRange(networks []wifi.StationNetwork) bool {
+	return w.inRange
+}
+
+func (w *fakeWifiStation) Scan() error {
+	w.scanned = true
+	return nil
+}
+
+func (w *fakeWifiStation) StartAccessPoint(c wifi.AccessPointConfig) (int, error) {
+	w.apStarted = true
+	return 6, nil
+}
+
+func (w *fakeWifiStation) StopAccessPoint() {
+	w.apStarted = false
+}
+
+func TestReconcileStationConnection(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, deviceapi.AddToScheme(scheme))
+	networks := []wifi.StationNetwork{{SSID: "home", Password: "secret123"}}
+	changedNetworks := []wifi.StationNetwork{{SSID: "home", Password: "fixed-secret"}}
+	for _, c := range []struct {
+		name              string
+		fallback          bool
+		connected         bool
+		disconnectedFor   time.Duration
+		failures          int
+		networks          []wifi.StationNetwork
+		lastScanAgo       time.Duration
+		inRange           bool
+		expectFallback    bool
+		expectAccessPoint bool
+		expectScan        bool
+		expectFailures    int
+	}{
+		{
+			name:            "connected",
+			connected:       true,
+			failures:        2,
+			disconnectedFor: time.Minute,
+			expectFailures:  0,
+		},
+		{
+			name:            "disconnected within timeout",
+			disconnectedFor: time.Minute,
+			failures:        1,
+			expectFailures:  1,
+		},
+		{
+			name:              "timeout falls back to access point",
+			disconnectedFor:   deviceapi.DefaultWifiStationFallbackTimeout,
+			expectFallback:    true,
+			expectAccessPoint: true,
+			expectFailures:    1,
+		},
+		{
+			name:              "repeated timeout counts failures",
+			disconnectedFor:   deviceapi.DefaultWifiStationFallbackTimeout,
+			failures:          2,
+			expectFallback:    true,
+			expectAccessPoint: true,
+			expectFailures:    3,
+		},
+		{
+			name:              "timeout with changed networks resets failures",
+			disconnectedFor:   deviceapi.DefaultWifiStationFallbackTimeout,
+			failures:          2,
+			networks:          changedNetworks,
+			expectFallback:    true,
+			expectAccessPoint: true,
+			expectFailures:    1,
+		},
+		{
+			name:              "fallback without network in range",
+			fallback:          true,
+			failures:          1,
+			lastScanAgo:       stationFallbackScanInterval,
+			expectFallback:    true,
+			expectAccessPoint: true,
+			expectScan:        true,
+			expectFailures:    1,
+		},
+		{
+			name:           "fallback leaves when network in range",
+			fallback:       true,
+			failures:       1,
+			lastScanAgo:    stationFallbackScanInterval,
+			inRange:        true,
+			expectScan:     true,
+			expectFailures: 1,
+		},
+		{
+			name:              "fallback backs off after repeated failures",
+			fallback:          true,
+			failures:          3,
+			lastScanAgo:       3 * stationFallbackScanInterval,
+			inRange:           true,
+			expectFallback:    true,
+			expectAccessPoint: true,
+			expectFailures:    3,
+		},
+		{
+			name:           "fallback with changed networks does not back off",
+			fallback:       true,
+			failures:       3,
+			networks:       changedNetworks,
+			lastScanAgo:    stationFallbackScanInterval,
+			inRange:        true,
+			expectScan:     true,
+			expectFailures: 3,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			store := storage.InMemory(scheme)
+			wifiPasswords := storage.InMemory(scheme)
+			apPassword := &deviceapi.WifiPassword{
+				ObjectMeta: metav1.ObjectMeta{Name: deviceapi.AccessPointPasswordKey},
+				Data:       deviceapi.WifiPasswordData{Password: "ap-secret"},
+			}
+			require.NoError(t, wifiPasswords.Create(apPassword.Name, apPassword))
+			r := &NetworkInterfaceReconciler{
+				DeviceName:               "mydevice",
+				Store:                    store,
+				WifiPasswords:            wifiPasswords,
+				WifiNetworks:             storage.InMemory(scheme),
+				Wifi:                     wifi.NewRadios(logrus.NewEntry(logrus.New()), t.TempDir(), nil),
+				stationDisconnectedSince: map[string]time.Time{},
+				lastFallbackScan:         map[string]time.Time{},
+				stationFailures:          map[string]stationFailures{},
+			}
+			iface := &deviceapi.NetworkInterface{
+				ObjectMeta: metav1.ObjectMeta{Name: "wlan0"},
+				Spec: deviceapi.NetworkInterfaceSpec{Wifi: deviceapi.WifiSpec{
+					Mode: deviceapi.WifiModeStation,
+				}},
+			}
+			iface.Status.Wifi.Fallback = c.fallback
+			w := &fakeWifiStation{inRange: c.inRange, apStarted: c.fallback}
+			if c.connected {
+				iface.Status.Link.IP4 = "192.168.1.2"
+				w.status = &wifi.StationStatus{SSID: "home"}
+			}
+			require.NoError(t, store.Create(iface.Name, iface))
+			if c.disconnectedFor > 0 {
+				r.stationDisconnectedSince[iface.Name] = time.Now().Add(-c.disconnectedFor)
+			}
+			if c.lastScanAgo > 0 {
+				r.lastFallbackScan[iface.Name] = time.Now().Add(-c.lastScanAgo)
+			}
+			if c.failures > 0 {
+				r.stationFailures[iface.Name] = stationFailures{networks: stationNetworksKey(networks), count: c.failures}
+			}
+			currentNetworks := networks
+			if c.networks != nil {
+				currentNetworks = c.networks
+			}
+
+			err := r.reconcileStationConnection(iface, w, currentNetworks, logr.Discard())
+			require.NoError(t, err, "reconcileStationConnection")
+			stored := &deviceapi.NetworkInterface{}
+			require.NoError(t, store.Get(iface.Name, stored))
+			require.Equal(t, c.expectFallback, stored.Status.Wifi.Fallback, "fallback status")
+			require.Equal(t, c.expectAccessPoint, w.apStarted, "access point started")
+			require.Equal(t, !c.fallback && !c.expectFallback, w.stationStarted, "station started")
+			require.Equal(t, c.expectScan, w.scanned, "scanned")
+			require.Equal(t, c.expectFailures, r.stationFailures[iface.Name].count, "failures")
+		})
+	}
+}
+
+func TestStationFallbackBackoff(t *testing.T) {
+	for _, c := range []struct {
+		failures int
+		expected time.Duration
+	}{
+		{0, time.Minute},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{5, 16 * time.Minute},
+		{6, stationFallbackMaxScanInterval},
+		{100, stationFallbackMaxScanInterval},
+	} {
+		require.Equal(t, c.expected, stationFallbackBackoff(c.failures), "failures: %d", c.failures)
+	}
+}
@@ -2,11 +2,13 @@ package device
 
 import (
 	"context"
+	"slices"
 
 	"github.com/google/uuid"
 	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
 	"github.com/mgoltzsche/kubemate/pkg/clientconf"
 	"github.com/mgoltzsche/kubemate/pkg/drain"
+	"github.com/mgoltzsche/kubemate/pkg/jointoken"
 	"github.com/mgoltzsche/kubemate/pkg/storage"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -30,10 +32,12 @@ const (
 
 // NodeReconciler reconciles a Node object.
 type NodeReconciler struct {
-	DeviceName  string
-	DeviceStore storage.Interface
-	K3sDir      string
-	Shutdown    func() error
+	DeviceName         string
+	DeviceStore        storage.Interface
+	DeviceTokens       storage.Interface
+	K3sDir             string
+	APICertFingerprint string
+	Shutdown           func() error
 	client.Client
 	scheme   *runtime.Scheme
 	rebootID string
@@ -132,6 +136,24 @@ func (r *NodeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res c
 			err = r.Client.Update(ctx, &n)
 			return ctrl.Result{}, err
 		}
+
+		if n.Name != r.DeviceName {
+			err = r.trackJoinTokenUsage(ctx, &n)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	}
+
+	// Publish the API certificate fingerprint to let agents verify the server when refreshing their join token
+	// and to let the devices verify that a discovered device is a member of the cluster.
+	if n.Name == r.DeviceName && r.APICertFingerprint != "" && a[deviceapi.APICertFingerprintAnnotation] != r.APICertFingerprint {
+		a[deviceapi.APICertFingerprintAnnotation] = r.APICertFingerprint
+		n.SetAnnotations(a)
+		err = r.Client.Update(ctx, &n)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
 	}
 
 	// Execute the following logic only on the corresponding agent/master node.
@@ -162,6 +184,41 @@ func (r *NodeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res c
 	return ctrl.Result{}, nil
 }
 
+// trackJoinTokenUsage records the node that joined using a bootstrap token and revokes the token when it is used up.
+func (r *NodeReconciler) trackJoinTokenUsage(ctx context.Context, n *corev1.Node) error {
+	l := &deviceapi.DeviceTokenList{}
+	err := r.DeviceTokens.List(l)
+	if err != nil {
+		return err
+	}
+	for _, t := range joinTokensUsedBy(n, l.Items) {
+		err = r.DeviceTokens.Update(t.Name, &t, func() error {
+			if !slices.Contains(t.Status.UsedBy, n.Name) {
+				t.Status.UsedBy = append(t.Status.UsedBy, n.Name)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if t.Data.MaxUses > 0 && len(t.Status.UsedBy) >= t.Data.MaxUses && !t.Status.Revoked {
+			log.FromContext(ctx).Info("revoking used up bootstrap token", "token", t.Name)
+			err = jointoken.Delete(ctx, r.K3sDir, t.Status.ID)
+			if err != nil {
+				return err
+			}
+			err = r.DeviceTokens.Update(t.Name, &t, func() error {
+				t.Status.Revoked = true
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (r *NodeReconciler) newCoreClient(m deviceapi.DeviceMode) (kubernetes.Interface, error) {
 	config, err := clientconf.New(r.K3sDir, m)
 	if err != nil {
@@ -169,3 +226,28 @@ func (r *NodeReconciler) newCoreClient(m deviceapi.DeviceMode) (kubernetes.Inter
 	}
 	return kubernetes.NewForConfig(config)
 }
+
+// joinTokensUsedBy returns the bootstrap tokens the given node must be accounted for.
+// Since the JoinTokenIDLabel is set by the joining agent, it cannot be trusted to be present:
+// a node that does not refer to a known bootstrap token is accounted for with every active bootstrap token that existed when the node was created.
+func joinTokensUsedBy(n *corev1.Node, tokens []deviceapi.DeviceToken) []deviceapi.DeviceToken {
+	id := n.Labels[deviceapi.JoinTokenIDLabel]
+	known := id != "" && slices.ContainsFunc(tokens, func(t deviceapi.DeviceToken) bool {
+		return t.Data.Type == deviceapi.DeviceTokenTypeBootstrap && t.Status.ID == id
+	})
+	var used []deviceapi.DeviceToken
+	for _, t := range tokens {
+		if t.Data.Type != deviceapi.DeviceTokenTypeBootstrap || t.Status.ID == "" || slices.Contains(t.Status.UsedBy, n.Name) {
+			continue
+		}
+		if known {
+			if t.Status.ID != id {
+				continue
+			}
+		} else if t.Status.Revoked || n.CreationTimestamp.Before(&t.CreationTimestamp) {
+			continue
+		}
+		used = append(used, t)
+	}
+	return used
+}
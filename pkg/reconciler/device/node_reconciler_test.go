@@ -0,0 +1,88 @@
+package device
+
+import (
+	"testing"
+	"time"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestJoinTokensUsedBy(t *testing.T) {
+	now := time.Now()
+	token := func(name, id string, createdAgo time.Duration, revoked bool, usedBy ...string) deviceapi.DeviceToken {
+		return deviceapi.DeviceToken{
+			ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(now.Add(-createdAgo))},
+			Data:       deviceapi.DeviceTokenData{Type: deviceapi.DeviceTokenTypeBootstrap},
+			Status:     deviceapi.DeviceTokenStatus{ID: id, Revoked: revoked, UsedBy: usedBy},
+		}
+	}
+	tokens := []deviceapi.DeviceToken{
+		token("a", "aaaaaa", time.Hour, false),
+		token("b", "bbbbbb", time.Minute, false),
+		token("revoked", "cccccc", time.Hour, true),
+		token("pending", "", time.Hour, false),
+		{ObjectMeta: metav1.ObjectMeta{Name: "server"}, Data: deviceapi.DeviceTokenData{Type: deviceapi.DeviceTokenTypeServer}},
+	}
+	for _, c := range []struct {
+		name       string
+		label      string
+		createdAgo time.Duration
+		tokens     []deviceapi.DeviceToken
+		expect     []string
+	}{
+		{
+			name:       "labeled node",
+			label:      "aaaaaa",
+			createdAgo: time.Second,
+			expect:     []string{"a"},
+		},
+		{
+			name:       "unlabeled new node",
+			createdAgo: time.Second,
+			expect:     []string{"a", "b"},
+		},
+		{
+			name:       "node with unknown token id",
+			label:      "unknown",
+			createdAgo: time.Second,
+			expect:     []string{"a", "b"},
+		},
+		{
+			name:       "unlabeled node created before token",
+			createdAgo: 30 * time.Minute,
+			expect:     []string{"a"},
+		},
+		{
+			name:       "node that is already accounted for",
+			label:      "aaaaaa",
+			createdAgo: time.Second,
+			tokens:     []deviceapi.DeviceToken{token("a", "aaaaaa", time.Hour, false, "node1")},
+		},
+		{
+			name:       "unlabeled node created before all tokens",
+			createdAgo: 2 * time.Hour,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			n := &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+				Name:              "node1",
+				CreationTimestamp: metav1.NewTime(now.Add(-c.createdAgo)),
+			}}
+			if c.label != "" {
+				n.Labels = map[string]string{deviceapi.JoinTokenIDLabel: c.label}
+			}
+			l := tokens
+			if c.tokens != nil {
+				l = c.tokens
+			}
+			var names []string
+			for _, t := range joinTokensUsedBy(n, l) {
+				names = append(names, t.Name)
+			}
+			require.Equal(t, c.expect, names)
+		})
+	}
+}
@@ -16,14 +16,20 @@ type certificateREST struct {
 	*REST
 }
 
-func NewCertificateREST(scheme *runtime.Scheme, caCert []byte) *certificateREST {
+func NewCertificateREST(scheme *runtime.Scheme, caCert, localCACert []byte) *certificateREST {
 	store := storage.InMemory(scheme)
-	c := &deviceapi.Certificate{}
-	c.Name = "self"
-	c.Spec.CACert = base64.StdEncoding.EncodeToString(caCert)
-	err := store.Create("self", c)
-	if err != nil {
-		panic(err)
+	certs := map[string][]byte{
+		deviceapi.SelfCertificateName:    caCert,
+		deviceapi.LocalCACertificateName: localCACert,
+	}
+	for name, cert := range certs {
+		c := &deviceapi.Certificate{}
+		c.Name = name
+		c.Spec.CACert = base64.StdEncoding.EncodeToString(cert)
+		err := store.Create(name, c)
+		if err != nil {
+			panic(err)
+		}
 	}
 	return &certificateREST{
 		REST: NewREST(&deviceapi.Certificate{}, store),
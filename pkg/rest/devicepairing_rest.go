@@ -0,0 +1,252 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/middleware"
+	"github.com/mgoltzsche/kubemate/pkg/pairing"
+	"github.com/mgoltzsche/kubemate/pkg/storage"
+	"github.com/mgoltzsche/kubemate/pkg/tokengen"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	registryrest "k8s.io/apiserver/pkg/registry/rest"
+)
+
+const (
+	// PairingGroup is the group of the user a server authenticates as when pushing a join token to an agent.
+	PairingGroup = "kubemate-pairing"
+	// maxPendingPairingRequests limits the amount of anonymous pairing requests a server accepts.
+	maxPendingPairingRequests = 10
+	// maxPendingPairingRequestsPerClient limits the amount of anonymous pairing requests a server accepts from a single address.
+	maxPendingPairingRequestsPerClient = 2
+	pairingNonceLength                 = 16
+	// incomingPairingNamePrefix is the prefix of the names the server generates for incoming pairing requests.
+	incomingPairingNamePrefix = "request-"
+)
+
+type devicePairingREST struct {
+	*REST
+	deviceName      string
+	certFingerprint string
+	discovered      storage.Interface
+	mutex           sync.Mutex
+}
+
+// NewDevicePairingREST creates the pairing API of the given device.
+// The discovered devices are used to reject pairing requests that claim the name of another known device.
+func NewDevicePairingREST(scheme *runtime.Scheme, deviceName, certFingerprint string, discovered storage.Interface) *devicePairingREST {
+	return &devicePairingREST{
+		REST:            NewREST(&deviceapi.DevicePairing{}, storage.InMemory(scheme)),
+		deviceName:      deviceName,
+		certFingerprint: certFingerprint,
+		discovered:      discovered,
+	}
+}
+
+// PairingUserName returns the name of the user a server authenticates as when pushing a join token to an agent.
+func PairingUserName(serverName string) string {
+	return fmt.Sprintf("pairing:%s", serverName)
+}
+
+func (r *devicePairingREST) Create(ctx context.Context, obj runtime.Object, createValidation registryrest.ValidateObjectFunc, options *metav1.CreateOptions) (runtime.Object, error) {
+	p, ok := obj.(*deviceapi.DevicePairing)
+	if !ok {
+		return nil, fmt.Errorf("expected DevicePairing but received %T", obj)
+	}
+	u, _ := request.UserFrom(ctx)
+	if u != nil && u.GetName() == user.Anonymous {
+		// Incoming pairing request from an agent
+		clientAddr := middleware.ClientAddressFromContext(ctx)
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		superseded, err := r.validatePairingRequest(p, clientAddr)
+		if err != nil {
+			return nil, err
+		}
+		serverNonce, err := tokengen.GenerateRandomString(pairingNonceLength)
+		if err != nil {
+			return nil, err
+		}
+		// Name the request independently of the unverified agent name.
+		p.Name = ""
+		p.GenerateName = incomingPairingNamePrefix
+		p.Spec.ServerAddress = ""
+		p.Spec.JoinTokenName = ""
+		p.Spec.Confirmed = false
+		p.Spec.JoinToken = ""
+		// The confirmation code is computed once the agent revealed its nonce.
+		p.Status = deviceapi.DevicePairingStatus{
+			Phase:                 deviceapi.DevicePairingPhasePending,
+			ServerCertFingerprint: r.certFingerprint,
+			ServerNonce:           serverNonce,
+			ClientAddress:         clientAddr,
+		}
+		created, err := r.REST.Create(ctx, obj, createValidation, options)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range superseded {
+			err = r.Store().Delete(name, &deviceapi.DevicePairing{}, func() error { return nil })
+			if err != nil && !errors.IsNotFound(err) {
+				return nil, err
+			}
+		}
+		return created, nil
+	}
+	// Pairing initiated by the user on the agent
+	if p.Spec.ServerAddress == "" {
+		return nil, errors.NewBadRequest("no serverAddress specified")
+	}
+	serverURL, err := url.Parse(p.Spec.ServerAddress)
+	if err != nil || serverURL.Scheme != "https" {
+		return nil, errors.NewBadRequest("serverAddress must be an https URL")
+	}
+	if p.Name != serverURL.Hostname() {
+		return nil, errors.NewBadRequest("the pairing must be named after the server")
+	}
+	if p.Spec.JoinTokenName == "" {
+		p.Spec.JoinTokenName = p.Name
+	}
+	p.Spec.Agent = ""
+	p.Spec.AgentAddress = ""
+	p.Spec.AgentCertFingerprint = ""
+	p.Spec.NonceCommitment = ""
+	p.Spec.Nonce = ""
+	p.Spec.Secret = ""
+	p.Spec.Confirmed = false
+	p.Spec.JoinToken = ""
+	p.Status = deviceapi.DevicePairingStatus{Phase: deviceapi.DevicePairingPhasePending}
+	return r.REST.Create(ctx, obj, createValidation, options)
+}
+
+// validatePairingRequest validates an incoming pairing request and limits the amount of pending requests.
+// It returns the names of the unconfirmed pending requests the same client sent previously for the same agent
+// that the new request supersedes, allowing an agent to retry.
+func (r *devicePairingREST) validatePairingRequest(p *deviceapi.DevicePairing, clientAddr string) ([]string, error) {
+	if p.Spec.Agent == "" || p.Spec.AgentAddress == "" || p.Spec.AgentCertFingerprint == "" || p.Spec.NonceCommitment == "" || p.Spec.Secret == "" {
+		return nil, errors.NewBadRequest("pairing request must specify agent, agentAddress, agentCertFingerprint, nonceCommitment and secret")
+	}
+	if p.Spec.Nonce != "" {
+		return nil, errors.NewBadRequest("pairing request must not reveal the nonce before the server provided its nonce")
+	}
+	if len(p.Spec.NonceCommitment) != len(pairing.NonceCommitment("")) || len(p.Spec.Secret) < 32 {
+		return nil, errors.NewBadRequest("pairing request nonce commitment is invalid or secret is too short")
+	}
+	if errs := validation.IsDNS1123Label(p.Spec.Agent); len(errs) > 0 {
+		return nil, errors.NewBadRequest(fmt.Sprintf("invalid agent name: %s", strings.Join(errs, ", ")))
+	}
+	err := r.validateAgentName(p)
+	if err != nil {
+		return nil, err
+	}
+	l := &deviceapi.DevicePairingList{}
+	err = r.Store().List(l)
+	if err != nil {
+		return nil, err
+	}
+	pending := 0
+	pendingFromClient := 0
+	var superseded []string
+	for _, item := range l.Items {
+		if item.Spec.Agent == "" || item.Status.Phase != deviceapi.DevicePairingPhasePending {
+			continue
+		}
+		if item.Status.ClientAddress == clientAddr {
+			if item.Spec.Agent == p.Spec.Agent && !item.Spec.Confirmed {
+				superseded = append(superseded, item.Name)
+				continue
+			}
+			pendingFromClient++
+		}
+		pending++
+	}
+	if pendingFromClient >= maxPendingPairingRequestsPerClient {
+		return nil, errors.NewTooManyRequests(fmt.Sprintf("too many pending pairing requests from %s", clientAddr), 60)
+	}
+	if pending >= maxPendingPairingRequests {
+		return nil, errors.NewTooManyRequests("too many pending pairing requests", 60)
+	}
+	return superseded, nil
+}
+
+// validateAgentName rejects a pairing request that claims the name of this device or of another verified device.
+func (r *devicePairingREST) validateAgentName(p *deviceapi.DevicePairing) error {
+	if p.Spec.Agent == r.deviceName {
+		return errors.NewForbidden(p.GetGroupVersionResource().GroupResource(), p.Spec.Agent, fmt.Errorf("agent name must not be the name of the server"))
+	}
+	if r.discovered == nil {
+		return nil
+	}
+	d := &deviceapi.DeviceDiscovery{}
+	err := r.discovered.Get(p.Spec.Agent, d)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if d.Status.Verified && d.Spec.CertFingerprint != p.Spec.AgentCertFingerprint {
+		return errors.NewForbidden(p.GetGroupVersionResource().GroupResource(), p.Spec.Agent, fmt.Errorf("agent name belongs to another device"))
+	}
+	return nil
+}
+
+func (r *devicePairingREST) Update(ctx context.Context, key string, objInfo registryrest.UpdatedObjectInfo, createValidation registryrest.ValidateObjectFunc, updateValidation registryrest.ValidateObjectUpdateFunc, forceAllowCreate bool, options *metav1.UpdateOptions) (runtime.Object, bool, error) {
+	u, _ := request.UserFrom(ctx)
+	isPairingUser := u != nil && u.GetName() == PairingUserName(key)
+	isAnonymous := u != nil && u.GetName() == user.Anonymous
+	return r.REST.Update(ctx, key, objInfo, createValidation, func(ctx context.Context, obj, old runtime.Object) error {
+		p := obj.(*deviceapi.DevicePairing)
+		o := old.(*deviceapi.DevicePairing)
+		if isAnonymous {
+			// The agent reveals its nonce after it received the server's nonce.
+			return r.revealNonce(p, o)
+		}
+		if isPairingUser {
+			// The server pushes the join token to the agent.
+			if o.Spec.ServerAddress == "" || o.Spec.JoinToken != "" {
+				return errors.NewConflict(p.GetGroupVersionResource().GroupResource(), key, fmt.Errorf("pairing does not accept a join token"))
+			}
+			joinToken := p.Spec.JoinToken
+			o.DeepCopyInto(p)
+			p.Spec.JoinToken = joinToken
+			return nil
+		}
+		// Users can only confirm incoming pairing requests once both devices show the confirmation code.
+		confirmed := p.Spec.Confirmed && o.Spec.Agent != "" && o.Status.ConfirmationCode != ""
+		o.DeepCopyInto(p)
+		p.Spec.Confirmed = confirmed
+		if updateValidation != nil {
+			return updateValidation(ctx, obj, old)
+		}
+		return nil
+	}, forceAllowCreate, options)
+}
+
+// revealNonce accepts the agent's nonce when it matches the nonce commitment of its pairing request and computes the confirmation code.
+func (r *devicePairingREST) revealNonce(p, o *deviceapi.DevicePairing) error {
+	gr := p.GetGroupVersionResource().GroupResource()
+	if o.Spec.Agent == "" || o.Status.Phase != deviceapi.DevicePairingPhasePending {
+		return errors.NewForbidden(gr, o.Name, fmt.Errorf("pairing does not accept a nonce"))
+	}
+	if o.Spec.Nonce != "" {
+		return errors.NewConflict(gr, o.Name, fmt.Errorf("pairing nonce has been revealed already"))
+	}
+	nonce := p.Spec.Nonce
+	if nonce == "" || pairing.NonceCommitment(nonce) != o.Spec.NonceCommitment {
+		return errors.NewBadRequest("nonce does not match the pairing request's nonce commitment")
+	}
+	o.DeepCopyInto(p)
+	p.Spec.Nonce = nonce
+	p.Status.ConfirmationCode = pairing.ConfirmationCode(r.certFingerprint, p.Spec.AgentCertFingerprint, nonce, p.Status.ServerNonce)
+	return nil
+}
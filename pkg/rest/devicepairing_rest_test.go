@@ -0,0 +1,158 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/middleware"
+	"github.com/mgoltzsche/kubemate/pkg/pairing"
+	"github.com/mgoltzsche/kubemate/pkg/storage"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	registryrest "k8s.io/apiserver/pkg/registry/rest"
+)
+
+func TestDevicePairingRESTNonceReveal(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, deviceapi.AddToScheme(scheme))
+	r := NewDevicePairingREST(scheme, "server", "serverfp", nil)
+	anonymous := request.WithUser(context.Background(), &user.DefaultInfo{Name: user.Anonymous})
+	admin := request.WithUser(context.Background(), &user.DefaultInfo{Name: "admin", Groups: []string{"admin"}})
+	nonce := "agent-nonce-0123456789"
+	req := func(nonce string) *deviceapi.DevicePairing {
+		return &deviceapi.DevicePairing{
+			ObjectMeta: metav1.ObjectMeta{Name: "agent1"},
+			Spec: deviceapi.DevicePairingSpec{
+				Agent:                "agent1",
+				AgentAddress:         "https://agent1:8443",
+				AgentCertFingerprint: "agentfp",
+				NonceCommitment:      pairing.NonceCommitment("agent-nonce-0123456789"),
+				Nonce:                nonce,
+				Secret:               strings.Repeat("s", 32),
+			},
+		}
+	}
+	update := func(ctx context.Context, p *deviceapi.DevicePairing) (*deviceapi.DevicePairing, error) {
+		obj, _, err := r.Update(ctx, p.Name, registryrest.DefaultUpdatedObjectInfo(p), nil, nil, false, &metav1.UpdateOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return obj.(*deviceapi.DevicePairing), nil
+	}
+
+	_, err := r.Create(anonymous, req(nonce), registryrest.ValidateAllObjectFunc, &metav1.CreateOptions{})
+	require.Error(t, err, "should reject request that reveals the nonce upfront")
+	obj, err := r.Create(anonymous, req(""), registryrest.ValidateAllObjectFunc, &metav1.CreateOptions{})
+	require.NoError(t, err, "create")
+	created := obj.(*deviceapi.DevicePairing)
+	require.True(t, strings.HasPrefix(created.Name, incomingPairingNamePrefix), "should generate name but was %q", created.Name)
+	require.NotEmpty(t, created.Status.ServerNonce, "server nonce")
+	require.Empty(t, created.Status.ConfirmationCode, "confirmation code before reveal")
+
+	confirm := created.DeepCopy()
+	confirm.Spec.Confirmed = true
+	p, err := update(admin, confirm)
+	require.NoError(t, err, "confirm before reveal")
+	require.False(t, p.Spec.Confirmed, "should not confirm pairing before the nonce was revealed")
+
+	wrong := p.DeepCopy()
+	wrong.Spec.Nonce = "other-nonce-0123456789"
+	_, err = update(anonymous, wrong)
+	require.Error(t, err, "should reject nonce that does not match the commitment")
+
+	reveal := p.DeepCopy()
+	reveal.Spec.Nonce = nonce
+	reveal.Spec.AgentCertFingerprint = "otherfp"
+	p, err = update(anonymous, reveal)
+	require.NoError(t, err, "reveal")
+	require.Equal(t, "agentfp", p.Spec.AgentCertFingerprint, "should not let reveal modify the request")
+	require.Equal(t, pairing.ConfirmationCode("serverfp", "agentfp", nonce, created.Status.ServerNonce), p.Status.ConfirmationCode, "confirmation code")
+	_, err = update(anonymous, reveal)
+	require.Error(t, err, "should reject second reveal")
+
+	confirm = p.DeepCopy()
+	confirm.Spec.Confirmed = true
+	p, err = update(admin, confirm)
+	require.NoError(t, err, "confirm")
+	require.True(t, p.Spec.Confirmed, "confirmed")
+}
+
+func TestDevicePairingRESTCreateLimits(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, deviceapi.AddToScheme(scheme))
+	discovered := storage.InMemory(scheme)
+	require.NoError(t, discovered.Create("agent0", &deviceapi.DeviceDiscovery{
+		Spec:   deviceapi.DeviceDiscoverySpec{CertFingerprint: "agent0fp"},
+		Status: deviceapi.DeviceDiscoveryStatus{Verified: true},
+	}))
+	r := NewDevicePairingREST(scheme, "server", "serverfp", discovered)
+	clientCtx := func(addr string) context.Context {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.RemoteAddr = addr + ":12345"
+		var ctx context.Context
+		middleware.NewClientTracker().Handler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx = req.Context()
+		})).ServeHTTP(httptest.NewRecorder(), req)
+		return request.WithUser(ctx, &user.DefaultInfo{Name: user.Anonymous})
+	}
+	create := func(addr, agent, fingerprint string) (*deviceapi.DevicePairing, error) {
+		p := &deviceapi.DevicePairing{
+			ObjectMeta: metav1.ObjectMeta{Name: agent},
+			Spec: deviceapi.DevicePairingSpec{
+				Agent:                agent,
+				AgentAddress:         "https://" + agent,
+				AgentCertFingerprint: fingerprint,
+				NonceCommitment:      pairing.NonceCommitment("agent-nonce-0123456789"),
+				Secret:               strings.Repeat("s", 32),
+			},
+		}
+		obj, err := r.Create(clientCtx(addr), p, registryrest.ValidateAllObjectFunc, &metav1.CreateOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return obj.(*deviceapi.DevicePairing), nil
+	}
+	pending := func() []string {
+		l := &deviceapi.DevicePairingList{}
+		require.NoError(t, r.Store().List(l))
+		agents := make([]string, 0, len(l.Items))
+		for _, p := range l.Items {
+			agents = append(agents, p.Spec.Agent)
+		}
+		sort.Strings(agents)
+		return agents
+	}
+
+	_, err := create("10.0.0.1", "server", "fp")
+	require.Error(t, err, "should reject server name")
+	_, err = create("10.0.0.1", "agent0", "otherfp")
+	require.Error(t, err, "should reject name of other verified device")
+	_, err = create("10.0.0.1", "Invalid_Name", "fp")
+	require.Error(t, err, "should reject invalid name")
+	p, err := create("10.0.0.1", "agent0", "agent0fp")
+	require.NoError(t, err, "should accept name of verified device with matching fingerprint")
+	require.NotEqual(t, "agent0", p.Name, "name")
+	require.Equal(t, "10.0.0.1", p.Status.ClientAddress, "client address")
+	_, err = create("10.0.0.1", "agent0", "agent0fp")
+	require.NoError(t, err, "should accept retry")
+	require.Equal(t, []string{"agent0"}, pending(), "should replace pending request of the same agent and client")
+	_, err = create("10.0.0.1", "agent1", "fp")
+	require.NoError(t, err, "create second request from client")
+	_, err = create("10.0.0.1", "agent2", "fp")
+	require.Error(t, err, "should limit pending requests per client")
+	for i := 2; i < maxPendingPairingRequests; i++ {
+		_, err = create(fmt.Sprintf("10.0.0.%d", i), fmt.Sprintf("agent%d", i), "fp")
+		require.NoError(t, err, "create request %d", i)
+	}
+	_, err = create("10.0.1.1", "agentx", "fp")
+	require.Error(t, err, "should limit pending requests")
+}
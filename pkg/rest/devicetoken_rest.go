@@ -3,10 +3,14 @@ package rest
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/jointoken"
 	"github.com/mgoltzsche/kubemate/pkg/storage"
 	"github.com/mgoltzsche/kubemate/pkg/tokengen"
+	"github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -14,12 +18,15 @@ import (
 	registryrest "k8s.io/apiserver/pkg/registry/rest"
 )
 
+const defaultBootstrapTokenTTL = 24 * time.Hour
+
 type deviceTokenREST struct {
 	*REST
 	deviceName string
+	k3sDir     string
 }
 
-func NewDeviceTokenREST(dir string, scheme *runtime.Scheme, deviceName string) (*deviceTokenREST, error) {
+func NewDeviceTokenREST(dir string, scheme *runtime.Scheme, deviceName, k3sDir string) (*deviceTokenREST, error) {
 	store, err := storage.FileStore(dir, &deviceapi.DeviceToken{}, scheme)
 	if err != nil {
 		return nil, err
@@ -27,6 +34,7 @@ func NewDeviceTokenREST(dir string, scheme *runtime.Scheme, deviceName string) (
 	r := &deviceTokenREST{
 		REST:       NewREST(&deviceapi.DeviceToken{}, store),
 		deviceName: deviceName,
+		k3sDir:     k3sDir,
 	}
 	// Generate new cluster join token for this device if not exist
 	token := &deviceapi.DeviceToken{}
@@ -47,7 +55,26 @@ func (r *deviceTokenREST) Update(ctx context.Context, key string, objInfo regist
 	if key == r.deviceName {
 		return nil, false, fmt.Errorf("refusing to update cluster join token on the server manually. please delete it to force regeneration")
 	}
-	return r.REST.Update(ctx, key, objInfo, createValidation, updateValidation, forceAllowCreate, options)
+	return r.REST.Update(ctx, key, objInfo, createValidation, func(ctx context.Context, obj, old runtime.Object) error {
+		t := obj.(*deviceapi.DeviceToken)
+		o := old.(*deviceapi.DeviceToken)
+		if t.Data.Type == "" {
+			t.Data.Type = o.Data.Type
+		}
+		if t.Data.Type != o.Data.Type {
+			return errors.NewBadRequest("the token type cannot be changed")
+		}
+		t.Status = o.Status
+		if t.Data.Type == deviceapi.DeviceTokenTypeBootstrap {
+			t.Data = o.Data // bootstrap tokens are immutable
+		} else if err := validateDeviceToken(t); err != nil {
+			return err
+		}
+		if updateValidation != nil {
+			return updateValidation(ctx, obj, old)
+		}
+		return nil
+	}, forceAllowCreate, options)
 }
 
 func (r *deviceTokenREST) Create(ctx context.Context, obj runtime.Object, createValidation registryrest.ValidateObjectFunc, options *metav1.CreateOptions) (runtime.Object, error) {
@@ -58,6 +85,18 @@ func (r *deviceTokenREST) Create(ctx context.Context, obj runtime.Object, create
 	if m.GetName() == r.deviceName {
 		return nil, fmt.Errorf("refusing to create cluster join token on the server manually. please delete it to force regeneration")
 	}
+	t, ok := obj.(*deviceapi.DeviceToken)
+	if !ok {
+		return nil, fmt.Errorf("expected DeviceToken but received %T", obj)
+	}
+	if t.Data.Type == "" {
+		t.Data.Type = deviceapi.DeviceTokenTypeJoin
+	}
+	t.Status = deviceapi.DeviceTokenStatus{}
+	err = validateDeviceToken(t)
+	if err != nil {
+		return nil, err
+	}
 	return r.REST.Create(ctx, obj, createValidation, options)
 }
 
@@ -71,9 +110,48 @@ func (r *deviceTokenREST) Delete(ctx context.Context, key string, deleteValidati
 		r.regenerateClusterJoinToken()
 		return nil, false, nil
 	}
+	t := &deviceapi.DeviceToken{}
+	err := r.Store().Get(key, t)
+	if err != nil {
+		return nil, false, err
+	}
+	if t.Data.Type == deviceapi.DeviceTokenTypeBootstrap && t.Status.ID != "" && !t.Status.Revoked {
+		// Revoke the token within k3s as well.
+		// Failures are tolerated since k3s may not run anymore, in which case the token expires on its own.
+		err = jointoken.Delete(ctx, r.k3sDir, t.Status.ID)
+		if err != nil {
+			logrus.WithError(err).Warn("failed to revoke bootstrap token")
+		}
+	}
 	return r.REST.Delete(ctx, key, deleteValidation, options)
 }
 
+func validateDeviceToken(t *deviceapi.DeviceToken) error {
+	switch t.Data.Type {
+	case deviceapi.DeviceTokenTypeJoin, "":
+		t.Data.Token = strings.TrimSpace(t.Data.Token)
+		err := jointoken.Validate(t.Data.Token)
+		if err != nil {
+			return errors.NewBadRequest(err.Error())
+		}
+	case deviceapi.DeviceTokenTypeBootstrap:
+		if t.Data.Token != "" {
+			return errors.NewBadRequest("bootstrap tokens are generated by the server and must not specify a token")
+		}
+		if t.Data.MaxUses < 0 {
+			return errors.NewBadRequest("maxUses must not be negative")
+		}
+		if t.Data.TTL == nil {
+			t.Data.TTL = &metav1.Duration{Duration: defaultBootstrapTokenTTL}
+		} else if t.Data.TTL.Duration < time.Minute {
+			return errors.NewBadRequest("bootstrap token ttl must be at least 1m")
+		}
+	default:
+		return errors.NewBadRequest(fmt.Sprintf("unsupported token type %q specified", t.Data.Type))
+	}
+	return nil
+}
+
 func (r *deviceTokenREST) regenerateClusterJoinToken() (*deviceapi.DeviceToken, error) {
 	token, err := tokengen.GenerateRandomString(32)
 	if err != nil {
@@ -86,6 +164,7 @@ func (r *deviceTokenREST) regenerateClusterJoinToken() (*deviceapi.DeviceToken,
 			return nil, err
 		}
 		t.Data.Token = token
+		t.Data.Type = deviceapi.DeviceTokenTypeServer
 		err = r.Store().Create(r.deviceName, t)
 		if err != nil {
 			return nil, err
@@ -94,7 +173,9 @@ func (r *deviceTokenREST) regenerateClusterJoinToken() (*deviceapi.DeviceToken,
 	}
 	err = r.Store().Update(r.deviceName, t, func() error {
 		t.Data.Token = token
+		t.Data.Type = deviceapi.DeviceTokenTypeServer
 		t.Status.JoinToken = ""
+		t.Status.PreviousJoinToken = ""
 		return nil
 	})
 	if err != nil {
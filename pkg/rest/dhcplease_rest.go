@@ -0,0 +1,34 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/storage"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	registryrest "k8s.io/apiserver/pkg/registry/rest"
+)
+
+type dhcpLeaseREST struct {
+	*REST
+}
+
+func NewDHCPLeaseREST(store storage.Interface) *dhcpLeaseREST {
+	return &dhcpLeaseREST{
+		REST: NewREST(&deviceapi.DHCPLease{}, store),
+	}
+}
+
+func (r *dhcpLeaseREST) Delete(ctx context.Context, key string, deleteValidation registryrest.ValidateObjectFunc, options *metav1.DeleteOptions) (runtime.Object, bool, error) {
+	return nil, false, fmt.Errorf("cannot delete dhcp lease")
+}
+
+func (r *dhcpLeaseREST) Create(ctx context.Context, obj runtime.Object, createValidation registryrest.ValidateObjectFunc, options *metav1.CreateOptions) (runtime.Object, error) {
+	return nil, fmt.Errorf("cannot create dhcp lease")
+}
+
+func (r *dhcpLeaseREST) Update(ctx context.Context, key string, objInfo registryrest.UpdatedObjectInfo, createValidation registryrest.ValidateObjectFunc, updateValidation registryrest.ValidateObjectUpdateFunc, forceAllowCreate bool, options *metav1.UpdateOptions) (runtime.Object, bool, error) {
+	return nil, false, fmt.Errorf("cannot update dhcp lease")
+}
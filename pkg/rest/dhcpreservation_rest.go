@@ -0,0 +1,93 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/storage"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	registryrest "k8s.io/apiserver/pkg/registry/rest"
+)
+
+type dhcpReservationREST struct {
+	*REST
+}
+
+func NewDHCPReservationREST(dir string, scheme *runtime.Scheme) (*dhcpReservationREST, error) {
+	store, err := storage.FileStore(dir, &deviceapi.DHCPReservation{}, scheme)
+	if err != nil {
+		return nil, err
+	}
+	return &dhcpReservationREST{REST: NewREST(&deviceapi.DHCPReservation{}, store)}, nil
+}
+
+func (r *dhcpReservationREST) Create(ctx context.Context, obj runtime.Object, createValidation registryrest.ValidateObjectFunc, options *metav1.CreateOptions) (runtime.Object, error) {
+	err := r.validate(obj.(*deviceapi.DHCPReservation))
+	if err != nil {
+		return nil, err
+	}
+	return r.REST.Create(ctx, obj, createValidation, options)
+}
+
+func (r *dhcpReservationREST) Update(ctx context.Context, key string, objInfo registryrest.UpdatedObjectInfo, createValidation registryrest.ValidateObjectFunc, updateValidation registryrest.ValidateObjectUpdateFunc, forceAllowCreate bool, options *metav1.UpdateOptions) (runtime.Object, bool, error) {
+	return r.REST.Update(ctx, key, objInfo, createValidation, func(ctx context.Context, obj, old runtime.Object) error {
+		err := r.validate(obj.(*deviceapi.DHCPReservation))
+		if err != nil {
+			return err
+		}
+		if updateValidation != nil {
+			return updateValidation(ctx, obj, old)
+		}
+		return nil
+	}, forceAllowCreate, options)
+}
+
+// validate normalizes the MAC address and rejects reservations that are invalid or collide with another reservation.
+func (r *dhcpReservationREST) validate(res *deviceapi.DHCPReservation) error {
+	err := validateDHCPReservationSpec(&res.Spec)
+	if err != nil {
+		return errors.NewBadRequest(fmt.Sprintf("invalid dhcp reservation: %s", err))
+	}
+	l := &deviceapi.DHCPReservationList{}
+	err = r.Store().List(l)
+	if err != nil {
+		return err
+	}
+	for _, o := range l.Items {
+		if o.Name == res.Name {
+			continue
+		}
+		if o.Spec.MACAddress == res.Spec.MACAddress {
+			return errors.NewConflict(r.resource.GetGroupVersionResource().GroupResource(), res.Name, fmt.Errorf("mac address %s is reserved by %s already", res.Spec.MACAddress, o.Name))
+		}
+		if o.Spec.IPAddress == res.Spec.IPAddress {
+			return errors.NewConflict(r.resource.GetGroupVersionResource().GroupResource(), res.Name, fmt.Errorf("ip address %s is reserved by %s already", res.Spec.IPAddress, o.Name))
+		}
+	}
+	return nil
+}
+
+func validateDHCPReservationSpec(spec *deviceapi.DHCPReservationSpec) error {
+	mac, err := net.ParseMAC(spec.MACAddress)
+	if err != nil {
+		return fmt.Errorf("macAddress: %w", err)
+	}
+	spec.MACAddress = mac.String()
+	ip := net.ParseIP(spec.IPAddress).To4()
+	if ip == nil {
+		return fmt.Errorf("ipAddress %q is not an IPv4 address", spec.IPAddress)
+	}
+	spec.IPAddress = ip.String()
+	if spec.Hostname != "" {
+		if errs := validation.IsDNS1123Label(spec.Hostname); len(errs) > 0 {
+			return fmt.Errorf("hostname: %s", strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/storage"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	registryrest "k8s.io/apiserver/pkg/registry/rest"
+)
+
+type dnsConfigREST struct {
+	*REST
+}
+
+func NewDNSConfigREST(dir string, scheme *runtime.Scheme) (*dnsConfigREST, error) {
+	store, err := storage.FileStore(dir, &deviceapi.DNSConfig{}, scheme)
+	if err != nil {
+		return nil, err
+	}
+	c := &deviceapi.DNSConfig{}
+	err = store.Get(deviceapi.DNSConfigName, c)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return nil, err
+		}
+		c.Name = deviceapi.DNSConfigName
+		c.Spec = deviceapi.DNSConfigSpec{
+			Zone: deviceapi.DefaultDNSZone,
+			DHCP: deviceapi.DHCPSpec{
+				RangeStart: deviceapi.DefaultDHCPRangeStart,
+				RangeEnd:   deviceapi.DefaultDHCPRangeEnd,
+				LeaseTime:  &metav1.Duration{Duration: deviceapi.DefaultDHCPLeaseTime},
+			},
+		}
+		err = store.Create(c.Name, c)
+		if err != nil {
+			return nil, fmt.Errorf("create default dns config: %w", err)
+		}
+	}
+	return &dnsConfigREST{REST: NewREST(&deviceapi.DNSConfig{}, store)}, nil
+}
+
+func (r *dnsConfigREST) Create(ctx context.Context, obj runtime.Object, createValidation registryrest.ValidateObjectFunc, options *metav1.CreateOptions) (runtime.Object, error) {
+	return nil, errors.NewMethodNotSupported(r.resource.GetGroupVersionResource().GroupResource(), "create")
+}
+
+func (r *dnsConfigREST) Update(ctx context.Context, key string, objInfo registryrest.UpdatedObjectInfo, createValidation registryrest.ValidateObjectFunc, updateValidation registryrest.ValidateObjectUpdateFunc, forceAllowCreate bool, options *metav1.UpdateOptions) (runtime.Object, bool, error) {
+	return r.REST.Update(ctx, key, objInfo, createValidation, func(ctx context.Context, obj, old runtime.Object) error {
+		c := obj.(*deviceapi.DNSConfig)
+		// The status is maintained by the server.
+		c.Status = old.(*deviceapi.DNSConfig).Status
+		err := validateDNSConfigSpec(&c.Spec)
+		if err != nil {
+			return errors.NewBadRequest(fmt.Sprintf("invalid dns config: %s", err))
+		}
+		if updateValidation != nil {
+			return updateValidation(ctx, obj, old)
+		}
+		return nil
+	}, forceAllowCreate, options)
+}
+
+func (r *dnsConfigREST) Delete(ctx context.Context, key string, deleteValidation registryrest.ValidateObjectFunc, options *metav1.DeleteOptions) (runtime.Object, bool, error) {
+	return nil, false, errors.NewBadRequest("refusing to delete the dns config")
+}
+
+func validateDNSConfigSpec(spec *deviceapi.DNSConfigSpec) error {
+	if spec.Zone != "" {
+		if errs := validation.IsDNS1123Subdomain(spec.Zone); len(errs) > 0 {
+			return fmt.Errorf("zone: %s", strings.Join(errs, ", "))
+		}
+	}
+	for _, u := range spec.Upstreams {
+		if net.ParseIP(u) == nil {
+			return fmt.Errorf("upstream %q is not an IP address", u)
+		}
+	}
+	for _, rec := range spec.Records {
+		name := rec.Name
+		if rec.Type == deviceapi.DNSRecordTypeSRV {
+			labels := strings.SplitN(name, ".", 3)
+			if len(labels) < 3 || !strings.HasPrefix(labels[0], "_") || !strings.HasPrefix(labels[1], "_") {
+				return fmt.Errorf("srv record name %q must be prefixed with the service and protocol, e.g. _http._tcp.", rec.Name)
+			}
+			name = labels[2]
+		}
+		if errs := validation.IsDNS1123Subdomain(strings.TrimSuffix(name, ".")); len(errs) > 0 {
+			return fmt.Errorf("record name %q: %s", rec.Name, strings.Join(errs, ", "))
+		}
+		ip := net.ParseIP(rec.Value)
+		switch rec.Type {
+		case deviceapi.DNSRecordTypeA:
+			if ip == nil || ip.To4() == nil {
+				return fmt.Errorf("record %s: value %q is not an IPv4 address", rec.Name, rec.Value)
+			}
+		case deviceapi.DNSRecordTypeAAAA:
+			if ip == nil || ip.To4() != nil {
+				return fmt.Errorf("record %s: value %q is not an IPv6 address", rec.Name, rec.Value)
+			}
+		case deviceapi.DNSRecordTypeSRV:
+			host, port, err := net.SplitHostPort(rec.Value)
+			if err != nil {
+				return fmt.Errorf("record %s: value %q must specify a target host and port: %w", rec.Name, rec.Value, err)
+			}
+			if errs := validation.IsDNS1123Subdomain(strings.TrimSuffix(host, ".")); len(errs) > 0 {
+				return fmt.Errorf("record %s: target %q: %s", rec.Name, host, strings.Join(errs, ", "))
+			}
+			if p, err := strconv.Atoi(port); err != nil || validation.IsValidPortNum(p) != nil {
+				return fmt.Errorf("record %s: invalid port %q", rec.Name, port)
+			}
+		default:
+			return fmt.Errorf("record %s: unsupported type %q", rec.Name, rec.Type)
+		}
+	}
+	start, end := spec.DHCP.RangeStart, spec.DHCP.RangeEnd
+	if start != "" || end != "" {
+		startIP, endIP := net.ParseIP(start).To4(), net.ParseIP(end).To4()
+		if startIP == nil || endIP == nil {
+			return fmt.Errorf("dhcp range must be specified as IPv4 addresses")
+		}
+		if bytes.Compare(startIP, endIP) > 0 {
+			return fmt.Errorf("dhcp range start %s is greater than its end %s", start, end)
+		}
+	}
+	if spec.DHCP.LeaseTime != nil && spec.DHCP.LeaseTime.Duration < 2*time.Minute {
+		return fmt.Errorf("dhcp lease time must be at least 2m")
+	}
+	return nil
+}
@@ -2,12 +2,20 @@ package rest
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net"
+	"strconv"
+	"strings"
 
 	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/mgoltzsche/kubemate/pkg/middleware"
 	"github.com/mgoltzsche/kubemate/pkg/storage"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 	registryrest "k8s.io/apiserver/pkg/registry/rest"
 )
 
@@ -24,3 +32,231 @@ func NewNetworkInterfaceREST(store storage.Interface) *networkInterfaceREST {
 func (r *networkInterfaceREST) Create(ctx context.Context, obj runtime.Object, createValidation registryrest.ValidateObjectFunc, options *metav1.CreateOptions) (runtime.Object, error) {
 	return nil, fmt.Errorf("cannot create network interface")
 }
+
+func (r *networkInterfaceREST) Update(ctx context.Context, key string, objInfo registryrest.UpdatedObjectInfo, createValidation registryrest.ValidateObjectFunc, updateValidation registryrest.ValidateObjectUpdateFunc, forceAllowCreate bool, options *metav1.UpdateOptions) (runtime.Object, bool, error) {
+	return r.REST.Update(ctx, key, objInfo, createValidation, func(ctx context.Context, obj, old runtime.Object) error {
+		iface := obj.(*deviceapi.NetworkInterface)
+		oldIface := old.(*deviceapi.NetworkInterface)
+		spec := &iface.Spec.Wifi
+		err := validateWifiAccessPointSpec(&spec.AccessPoint)
+		if err != nil {
+			return errors.NewBadRequest(fmt.Sprintf("invalid wifi access point configuration: %s", err))
+		}
+		err = validateWifiStationSpec(&spec.Station)
+		if err != nil {
+			return errors.NewBadRequest(fmt.Sprintf("invalid wifi station configuration: %s", err))
+		}
+		if t := oldIface.Status.Link.Type; iface.Spec.Link != nil && (t == deviceapi.NetworkInterfaceTypeWifi || t == deviceapi.NetworkInterfaceTypeCellular) {
+			return errors.NewBadRequest(fmt.Sprintf("link configuration is not supported for %s interfaces", oldIface.Status.Link.Type))
+		}
+		if iface.Spec.Cellular != nil && oldIface.Status.Link.Type != deviceapi.NetworkInterfaceTypeCellular {
+			return errors.NewBadRequest("cellular configuration is only supported for cellular interfaces")
+		}
+		err = validateCellularConfig(iface.Spec.Cellular)
+		if err != nil {
+			return errors.NewBadRequest(fmt.Sprintf("invalid cellular configuration: %s", err))
+		}
+		err = validateNetworkLinkConfig(iface.Spec.Link)
+		if err != nil {
+			return errors.NewBadRequest(fmt.Sprintf("invalid link configuration: %s", err))
+		}
+		err = setPendingLinkConfig(ctx, iface, oldIface)
+		if err != nil {
+			return err
+		}
+		if updateValidation != nil {
+			return updateValidation(ctx, obj, old)
+		}
+		return nil
+	}, forceAllowCreate, options)
+}
+
+// validateWifiAccessPointSpec validates the syntax of the access point configuration.
+// Whether the wifi radio supports it is checked when the access point is started.
+func validateWifiAccessPointSpec(spec *deviceapi.WifiAccessPointSpec) error {
+	switch spec.Band {
+	case "", deviceapi.WifiBand2GHz, deviceapi.WifiBand5GHz:
+	default:
+		return fmt.Errorf("unsupported band %q", spec.Band)
+	}
+	switch spec.Security {
+	case "", deviceapi.WifiSecurityWPA2, deviceapi.WifiSecurityWPA3, deviceapi.WifiSecurityWPA2WPA3:
+	default:
+		return fmt.Errorf("unsupported security mode %q", spec.Security)
+	}
+	if spec.Channel != "" && spec.Channel != deviceapi.WifiChannelAuto {
+		channel, err := strconv.Atoi(spec.Channel)
+		if err != nil || channel < 1 || channel > 196 {
+			return fmt.Errorf("channel must be %q or a channel number but was %q", deviceapi.WifiChannelAuto, spec.Channel)
+		}
+	}
+	if len(spec.SSID) > 32 {
+		return fmt.Errorf("ssid must not exceed 32 bytes")
+	}
+	if spec.MaxClients < 0 {
+		return fmt.Errorf("maxClients must not be negative")
+	}
+	return nil
+}
+
+func validateWifiStationSpec(spec *deviceapi.WifiStationSpec) error {
+	if len(spec.SSID) > 32 {
+		return fmt.Errorf("ssid must not exceed 32 bytes")
+	}
+	ssids := make(map[string]struct{}, len(spec.Networks))
+	for i, n := range spec.Networks {
+		if n.SSID == "" || len(n.SSID) > 32 {
+			return fmt.Errorf("networks[%d].ssid must be between 1 and 32 bytes long", i)
+		}
+		if _, dup := ssids[n.SSID]; dup {
+			return fmt.Errorf("networks[%d].ssid: duplicate network %q", i, n.SSID)
+		}
+		ssids[n.SSID] = struct{}{}
+		if n.PasswordRef != "" {
+			if errs := validation.IsDNS1123Subdomain(n.PasswordRef); len(errs) > 0 {
+				return fmt.Errorf("networks[%d].passwordRef: %s", i, strings.Join(errs, ", "))
+			}
+		}
+		if eap := n.EAP; eap != nil {
+			switch eap.Method {
+			case deviceapi.WifiEAPMethodPEAP, deviceapi.WifiEAPMethodTTLS, deviceapi.WifiEAPMethodTLS:
+			default:
+				return fmt.Errorf("networks[%d].eap.method: unsupported method %q", i, eap.Method)
+			}
+			if eap.Identity == "" {
+				return fmt.Errorf("networks[%d].eap.identity must be specified", i)
+			}
+		}
+	}
+	return nil
+}
+
+func validateCellularConfig(spec *deviceapi.CellularConfig) error {
+	if spec == nil {
+		return nil
+	}
+	if spec.APN == "" {
+		return fmt.Errorf("no apn specified")
+	}
+	if strings.ContainsAny(spec.APN, ", ") {
+		return fmt.Errorf("apn must not contain spaces or commas")
+	}
+	if spec.PIN != "" {
+		if len(spec.PIN) < 4 || len(spec.PIN) > 8 || strings.Trim(spec.PIN, "0123456789") != "" {
+			return fmt.Errorf("pin must consist of 4 to 8 digits")
+		}
+	}
+	return nil
+}
+
+func validateNetworkLinkConfig(spec *deviceapi.NetworkLinkConfig) error {
+	if spec == nil {
+		return nil
+	}
+	if spec.MTU < 0 || spec.MTU > 65535 {
+		return fmt.Errorf("mtu must be between 0 and 65535")
+	}
+	err := validateIPConfig(spec.IP)
+	if err != nil {
+		return fmt.Errorf("ip: %w", err)
+	}
+	ids := make(map[int]struct{}, len(spec.VLANs))
+	for i, v := range spec.VLANs {
+		if v.ID < 1 || v.ID > 4094 {
+			return fmt.Errorf("vlans[%d].id must be between 1 and 4094", i)
+		}
+		if _, dup := ids[v.ID]; dup {
+			return fmt.Errorf("vlans[%d].id: duplicate vlan %d", i, v.ID)
+		}
+		ids[v.ID] = struct{}{}
+		if v.MTU < 0 || v.MTU > 65535 {
+			return fmt.Errorf("vlans[%d].mtu must be between 0 and 65535", i)
+		}
+		err = validateIPConfig(v.IP)
+		if err != nil {
+			return fmt.Errorf("vlans[%d].ip: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func validateIPConfig(spec *deviceapi.IPConfig) error {
+	if spec == nil {
+		return nil
+	}
+	switch spec.Mode {
+	case deviceapi.IPConfigModeDHCP:
+		if len(spec.Addresses) > 0 || len(spec.Gateways) > 0 || len(spec.DNS) > 0 {
+			return fmt.Errorf("addresses, gateways and dns must not be specified in %s mode", spec.Mode)
+		}
+	case deviceapi.IPConfigModeStatic:
+		if len(spec.Addresses) == 0 {
+			return fmt.Errorf("addresses must be specified in %s mode", spec.Mode)
+		}
+	default:
+		return fmt.Errorf("unsupported mode %q", spec.Mode)
+	}
+	for i, a := range spec.Addresses {
+		if _, _, err := net.ParseCIDR(a); err != nil {
+			return fmt.Errorf("addresses[%d]: %q is not an address in CIDR notation", i, a)
+		}
+	}
+	for i, gw := range spec.Gateways {
+		if net.ParseIP(gw) == nil {
+			return fmt.Errorf("gateways[%d]: invalid ip %q", i, gw)
+		}
+	}
+	for i, ip := range spec.DNS {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("dns[%d]: invalid ip %q", i, ip)
+		}
+	}
+	return nil
+}
+
+// setPendingLinkConfig records the client that changed the link configuration along with the configuration to roll back to
+// unless the client reaches the device again after the change has been applied.
+func setPendingLinkConfig(ctx context.Context, iface, old *deviceapi.NetworkInterface) error {
+	pendingJSON, pending := old.Annotations[deviceapi.PendingLinkConfigAnnotation]
+	if equality.Semantic.DeepEqual(iface.Spec.Link, old.Spec.Link) {
+		// Preserve the pending state since clients cannot modify it.
+		if pending {
+			setPendingLinkConfigAnnotation(iface, pendingJSON)
+		} else {
+			delete(iface.Annotations, deviceapi.PendingLinkConfigAnnotation)
+		}
+		return nil
+	}
+	client := middleware.ClientAddressFromContext(ctx)
+	if ip := net.ParseIP(client); ip == nil || ip.IsLoopback() {
+		// Local clients cannot lose connectivity to the device.
+		delete(iface.Annotations, deviceapi.PendingLinkConfigAnnotation)
+		return nil
+	}
+	c := deviceapi.PendingLinkConfig{
+		Client:    client,
+		ChangedAt: metav1.Now(),
+		Rollback:  old.Spec.Link,
+	}
+	if pending {
+		// Keep rolling back to the latest confirmed configuration.
+		prev := deviceapi.PendingLinkConfig{}
+		err := json.Unmarshal([]byte(pendingJSON), &prev)
+		if err == nil {
+			c.Rollback = prev.Rollback
+		}
+	}
+	b, err := json.Marshal(&c)
+	if err != nil {
+		return fmt.Errorf("marshal pending link config: %w", err)
+	}
+	setPendingLinkConfigAnnotation(iface, string(b))
+	return nil
+}
+
+func setPendingLinkConfigAnnotation(iface *deviceapi.NetworkInterface, pendingJSON string) {
+	if iface.Annotations == nil {
+		iface.Annotations = map[string]string{}
+	}
+	iface.Annotations[deviceapi.PendingLinkConfigAnnotation] = pendingJSON
+}
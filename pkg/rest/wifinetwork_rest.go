@@ -16,7 +16,7 @@ type wifiNetworkREST struct {
 	*REST
 }
 
-func NewWifiNetworkREST(wifi *wifi.Wifi, scheme *runtime.Scheme) *wifiNetworkREST {
+func NewWifiNetworkREST(wifi *wifi.Radios, scheme *runtime.Scheme) *wifiNetworkREST {
 	store := storage.InMemory(scheme)
 	/*store := storage.RefreshPeriodically(storage.InMemory(scheme), 10*time.Second, func(store storage.Interface) {
 		err := updateWifiNetworkList(wifi, store)
@@ -8,8 +8,10 @@ import (
 	"github.com/mgoltzsche/kubemate/pkg/passwordgen"
 	"github.com/mgoltzsche/kubemate/pkg/storage"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
 	registryrest "k8s.io/apiserver/pkg/registry/rest"
 )
 
@@ -40,6 +42,81 @@ func NewWifiPasswordREST(dir string, scheme *runtime.Scheme) (*wifiPasswordREST,
 	return r, nil
 }
 
+func (r *wifiPasswordREST) Get(ctx context.Context, name string, options *metav1.GetOptions) (runtime.Object, error) {
+	obj, err := r.REST.Get(ctx, name, options)
+	if err != nil {
+		return nil, err
+	}
+	return redactWifiPassword(obj), nil
+}
+
+func (r *wifiPasswordREST) List(ctx context.Context, options *metainternalversion.ListOptions) (runtime.Object, error) {
+	obj, err := r.REST.List(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	l := obj.(*deviceapi.WifiPasswordList)
+	for i := range l.Items {
+		redactWifiPassword(&l.Items[i])
+	}
+	return l, nil
+}
+
+func (r *wifiPasswordREST) Watch(ctx context.Context, options *metainternalversion.ListOptions) (watch.Interface, error) {
+	w, err := r.REST.Watch(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	return watch.Filter(w, func(evt watch.Event) (watch.Event, bool) {
+		if pw, ok := evt.Object.(*deviceapi.WifiPassword); ok {
+			evt.Object = redactWifiPassword(pw.DeepCopy())
+		}
+		return evt, true
+	}), nil
+}
+
+func (r *wifiPasswordREST) Create(ctx context.Context, obj runtime.Object, createValidation registryrest.ValidateObjectFunc, options *metav1.CreateOptions) (runtime.Object, error) {
+	obj, err := r.REST.Create(ctx, obj, createValidation, options)
+	if err != nil {
+		return nil, err
+	}
+	return redactWifiPassword(obj.DeepCopyObject()), nil
+}
+
+func (r *wifiPasswordREST) Update(ctx context.Context, key string, objInfo registryrest.UpdatedObjectInfo, createValidation registryrest.ValidateObjectFunc, updateValidation registryrest.ValidateObjectUpdateFunc, forceAllowCreate bool, options *metav1.UpdateOptions) (runtime.Object, bool, error) {
+	obj, created, err := r.REST.Update(ctx, key, objInfo, createValidation, func(ctx context.Context, obj, old runtime.Object) error {
+		// Keep the write-only secrets unless they are specified.
+		data, oldData := &obj.(*deviceapi.WifiPassword).Data, &old.(*deviceapi.WifiPassword).Data
+		if data.Password == "" {
+			data.Password = oldData.Password
+		}
+		if data.ClientKey == "" {
+			data.ClientKey = oldData.ClientKey
+			data.ClientKeyPassword = oldData.ClientKeyPassword
+		}
+		if updateValidation != nil {
+			return updateValidation(ctx, obj, old)
+		}
+		return nil
+	}, forceAllowCreate, options)
+	if err != nil {
+		return nil, false, err
+	}
+	return redactWifiPassword(obj), created, nil
+}
+
+// redactWifiPassword removes the write-only secrets from the provided object.
+// Only the access point password is readable in order to let users connect their clients.
+func redactWifiPassword(obj runtime.Object) runtime.Object {
+	pw := obj.(*deviceapi.WifiPassword)
+	if pw.Name != deviceapi.AccessPointPasswordKey {
+		pw.Data.Password = ""
+	}
+	pw.Data.ClientKey = ""
+	pw.Data.ClientKeyPassword = ""
+	return pw
+}
+
 func (r *wifiPasswordREST) Delete(ctx context.Context, key string, deleteValidation registryrest.ValidateObjectFunc, options *metav1.DeleteOptions) (runtime.Object, bool, error) {
 	if key == deviceapi.AccessPointPasswordKey {
 		pw := &deviceapi.WifiPassword{}
@@ -0,0 +1,43 @@
+package rest
+
+import (
+	"context"
+	"testing"
+
+	deviceapi "github.com/mgoltzsche/kubemate/pkg/apis/devices/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	registryrest "k8s.io/apiserver/pkg/registry/rest"
+)
+
+func TestWifiPasswordRESTRedaction(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, deviceapi.AddToScheme(scheme))
+	r, err := NewWifiPasswordREST(t.TempDir(), scheme)
+	require.NoError(t, err)
+	ctx := context.Background()
+	pw := &deviceapi.WifiPassword{
+		ObjectMeta: metav1.ObjectMeta{Name: "office"},
+		Data:       deviceapi.WifiPasswordData{Password: "eap-secret", CACert: "cert", ClientKey: "key"},
+	}
+
+	obj, err := r.Create(ctx, pw, registryrest.ValidateAllObjectFunc, &metav1.CreateOptions{})
+	require.NoError(t, err, "create")
+	require.Equal(t, deviceapi.WifiPasswordData{CACert: "cert"}, obj.(*deviceapi.WifiPassword).Data, "created")
+	obj, err = r.Get(ctx, pw.Name, &metav1.GetOptions{})
+	require.NoError(t, err, "get")
+	read := obj.(*deviceapi.WifiPassword)
+	require.Equal(t, deviceapi.WifiPasswordData{CACert: "cert"}, read.Data, "get")
+
+	read.Data.CACert = "cert2"
+	_, _, err = r.Update(ctx, pw.Name, registryrest.DefaultUpdatedObjectInfo(read), nil, nil, false, &metav1.UpdateOptions{})
+	require.NoError(t, err, "update")
+	stored := &deviceapi.WifiPassword{}
+	require.NoError(t, r.Store().Get(pw.Name, stored))
+	require.Equal(t, deviceapi.WifiPasswordData{Password: "eap-secret", CACert: "cert2", ClientKey: "key"}, stored.Data, "should keep write-only secrets")
+
+	obj, err = r.Get(ctx, deviceapi.AccessPointPasswordKey, &metav1.GetOptions{})
+	require.NoError(t, err, "get access point password")
+	require.NotEmpty(t, obj.(*deviceapi.WifiPassword).Data.Password, "access point password")
+}
@@ -1,47 +1,179 @@
 package wifi
 
 import (
+	"encoding/hex"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/mgoltzsche/kubemate/pkg/cliutils"
 	"github.com/mgoltzsche/kubemate/pkg/runner"
 )
 
-func (w *Wifi) StartAccessPoint(ssid, password string) error {
-	if password == "" {
-		return fmt.Errorf("start accesspoint: no wifi password configured")
+// Band specifies a wifi frequency band.
+type Band string
+
+// Security specifies the authentication method of the access point.
+type Security string
+
+const (
+	Band2GHz         Band     = "2.4GHz"
+	Band5GHz         Band     = "5GHz"
+	SecurityWPA2     Security = "wpa2"
+	SecurityWPA3     Security = "wpa3"
+	SecurityWPA2WPA3 Security = "wpa2-wpa3"
+)
+
+// AccessPointConfig specifies the access point configuration.
+type AccessPointConfig struct {
+	SSID     string
+	Password string
+	Band     Band
+	// Channel is the channel number or 0 to pick the least congested channel.
+	Channel    int
+	Security   Security
+	Hidden     bool
+	MaxClients int
+	// ClientIsolation prevents the clients from communicating with each other.
+	ClientIsolation bool
+	// IngressOnly restricts the clients to the cluster's ingress instead of NATing them through the uplink.
+	IngressOnly bool
+}
+
+// StartAccessPoint starts the access point and returns the channel it operates on.
+func (w *Wifi) StartAccessPoint(c AccessPointConfig) (int, error) {
+	if c.Password == "" {
+		return 0, fmt.Errorf("start accesspoint: no wifi password configured")
+	}
+	err := w.accessPoint.acquire(w.WifiIface)
+	if err != nil {
+		return 0, fmt.Errorf("start accesspoint: %w", err)
+	}
+	channel, err := w.accessPointChannel(&c)
+	if err != nil {
+		return 0, fmt.Errorf("start accesspoint: %w", err)
 	}
 	ifacesConfChanged, err := w.generateNetworkInterfacesConfIfNotExist()
 	if err != nil {
-		return err
+		return 0, err
 	}
-	hostapdConf, hostapdConfChanged, err := w.generateHostapdConf(ssid, password)
+	hostapdConf, hostapdConfChanged, err := cliutils.WriteTempConfigFile("hostapd", generateHostapdConf(w.WifiIface, w.CountryCode, &c, channel))
 	if err != nil {
-		return err
+		return 0, err
 	}
 	if ifacesConfChanged || hostapdConfChanged || /*dhcpdConfChanged ||*/ w.mode != WifiModeAccessPoint {
 		err = w.restartWifiInterface()
 		if err != nil {
-			return err
+			return 0, err
 		}
-		err = runCmd("ip", "addr", "add", "11.0.0.1/24", "dev", w.WifiIface)
+		err = runCmd("ip", "addr", "add", AccessPointIP+"/24", "dev", w.WifiIface)
 		if err != nil {
-			return err
+			return 0, err
 		}
 		w.mode = WifiModeAccessPoint
 	}
-	w.installAPRoutes()
+	err = w.installAPRoutes(w.WifiIface, w.uplinkIface(w.WifiIface), &c)
+	if err != nil {
+		return 0, err
+	}
 	_, err = w.ap.Start(runner.Cmd("hostapd", hostapdConf))
+	if err != nil {
+		return 0, err
+	}
+	return channel, nil
+}
+
+// accessPointChannel validates the configuration against the radio's capabilities and returns the channel to use.
+// An automatically picked channel is kept as long as the band does not change to avoid restarting the access point after each scan.
+func (w *Wifi) accessPointChannel(c *AccessPointConfig) (int, error) {
+	if c.Band == "" {
+		c.Band = Band2GHz
+	}
+	if c.Security == "" {
+		c.Security = SecurityWPA2
+	}
+	caps, err := w.PhyCapabilities()
+	if err != nil {
+		return 0, err
+	}
+	err = w.validateAccessPointConfig(caps, c)
+	if err != nil {
+		return 0, err
+	}
+	if c.Channel > 0 {
+		ch := caps.Channel(c.Band, c.Channel)
+		if ch == nil {
+			return 0, fmt.Errorf("wifi interface %s does not support channel %d within the %s band", w.WifiIface, c.Channel, c.Band)
+		}
+		if !ch.Usable() {
+			return 0, fmt.Errorf("wifi interface %s cannot operate an access point on channel %d", w.WifiIface, c.Channel)
+		}
+		return c.Channel, nil
+	}
+	if ch := caps.Channel(c.Band, w.autoChannel); ch != nil && ch.Usable() {
+		return w.autoChannel, nil
+	}
+	channel, err := leastCongestedChannel(caps, c.Band, w.networks)
+	if err != nil {
+		return 0, err
+	}
+	w.autoChannel = channel
+	return channel, nil
+}
+
+func (w *Wifi) validateAccessPointConfig(caps *PhyCapabilities, c *AccessPointConfig) error {
+	err := validateAccessPointCredentials(c)
 	if err != nil {
 		return err
 	}
+	if !caps.AccessPoint {
+		return fmt.Errorf("wifi interface %s does not support access point mode", w.WifiIface)
+	}
+	if c.Security != SecurityWPA2 && !caps.PMF {
+		return fmt.Errorf("wifi interface %s does not support %s since it lacks management frame protection", w.WifiIface, c.Security)
+	}
+	if caps.MaxAPClients > 0 && c.MaxClients > caps.MaxAPClients {
+		return fmt.Errorf("wifi interface %s supports at most %d clients", w.WifiIface, caps.MaxAPClients)
+	}
+	return nil
+}
+
+// validateAccessPointCredentials validates the SSID and the password against the limits of the standard.
+// The password is rejected unless it consists of 8 to 63 printable ASCII characters since hostapd's config file cannot represent others.
+func validateAccessPointCredentials(c *AccessPointConfig) error {
+	if len(c.SSID) == 0 || len(c.SSID) > 32 {
+		return fmt.Errorf("access point ssid must be 1 to 32 bytes long")
+	}
+	err := validatePassphrase(c.Password)
+	if err != nil {
+		return fmt.Errorf("access point %w", err)
+	}
+	return nil
+}
+
+// validatePassphrase returns an error unless the given WPA passphrase consists of 8 to 63 printable ASCII characters.
+func validatePassphrase(password string) error {
+	if len(password) < 8 || len(password) > 63 {
+		return fmt.Errorf("password must be 8 to 63 characters long")
+	}
+	for _, ch := range password {
+		if ch < 0x20 || ch > 0x7e {
+			return fmt.Errorf("password must consist of printable ASCII characters only")
+		}
+	}
 	return nil
 }
 
 func (w *Wifi) StopAccessPoint() {
-	w.uninstallAPRoutes()
+	if w.mode == WifiModeAccessPointStation {
+		w.stopAccessPointStation()
+		return
+	}
+	if w.accessPoint.release(w.WifiIface) {
+		w.uninstallAPRoutes()
+	}
 	w.ap.Stop()
+	w.autoChannel = 0
 	if w.mode == WifiModeAccessPoint {
 		err := w.restartWifiInterface()
 		if err != nil {
@@ -72,72 +204,48 @@ iface %[2]s inet dhcp
 	return false, nil
 }
 
-func (w *Wifi) generateHostapdConf(ssid, password string) (string, bool, error) {
+func generateHostapdConf(iface, countryCode string, c *AccessPointConfig, channel int) string {
 	// See https://wiki.gentoo.org/wiki/Hostapd
-	return cliutils.WriteTempConfigFile("hostapd", `interface={iface}
+	hwMode := "g"
+	if c.Band == Band5GHz {
+		hwMode = "a"
+	}
+	hidden := 0
+	if c.Hidden {
+		hidden = 1
+	}
+	keyMgmt, pmf := "WPA-PSK", 0
+	switch c.Security {
+	case SecurityWPA3:
+		keyMgmt, pmf = "SAE", 2
+	case SecurityWPA2WPA3:
+		keyMgmt, pmf = "WPA-PSK SAE", 1
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, `interface=%s
 driver=nl80211
-hw_mode=g
-channel=6
+hw_mode=%s
+channel=%d
+country_code=%s
 ieee80211d=1
-ignore_broadcast_ssid=0
-country_code={countryCode}
-ieee80211d=1
-
-ssid={ssid}
+ignore_broadcast_ssid=%d
+`, iface, hwMode, channel, countryCode, hidden)
+	if c.MaxClients > 0 {
+		fmt.Fprintf(&b, "max_num_sta=%d\n", c.MaxClients)
+	}
+	if c.ClientIsolation {
+		b.WriteString("ap_isolate=1\n")
+	}
+	// The SSID is hex-encoded to prevent it from injecting options.
+	fmt.Fprintf(&b, `
+ssid2=%s
 wpa=2
-wpa_passphrase={password}
-wpa_key_mgmt=WPA-PSK
-wpa_pairwise=TKIP
+wpa_passphrase=%s
+wpa_key_mgmt=%s
 rsn_pairwise=CCMP
+ieee80211w=%d
 auth_algs=1
 macaddr_acl=0
-`, "{iface}", w.WifiIface, "{countryCode}", w.CountryCode, "{ssid}", ssid, "{password}", password)
-}
-
-func (w *Wifi) installAPRoutes() {
-	w.logger.WithField("iface", w.WifiIface).Debug("adding access point ip routes")
-	w.configureIPRoutes(w.addIPTablesRule)
-}
-
-func (w *Wifi) uninstallAPRoutes() {
-	w.logger.WithField("iface", w.WifiIface).Debug("removing access point ip routes")
-	w.configureIPRoutes(w.delIPTablesRule)
-}
-
-func (w *Wifi) configureIPRoutes(apply func(table, chain, inIface, outIface, jump, state string)) {
-	apply("nat", "POSTROUTING", "", w.WifiIface, "MASQUERADE", "")
-	apply("filter", "FORWARD", w.EthIface, w.WifiIface, "ACCEPT", "RELATED,ESTABLISHED")
-	apply("filter", "FORWARD", w.WifiIface, w.EthIface, "ACCEPT", "")
-}
-
-func (w *Wifi) addIPTablesRule(table, chain, inIface, outIface, jump, state string) {
-	err := modifyIPTables("-C", table, chain, inIface, outIface, jump, state)
-	if err != nil {
-		err = modifyIPTables("-A", table, chain, inIface, outIface, jump, state)
-		if err != nil {
-			w.logger.Warn(fmt.Errorf("failed to add iptables rule %s:%s %s->%s %s %s: %w", table, chain, inIface, outIface, jump, state, err))
-		}
-	}
-}
-
-func (w *Wifi) delIPTablesRule(table, chain, inIface, outIface, jump, state string) {
-	err := modifyIPTables("-C", table, chain, inIface, outIface, jump, state)
-	if err != nil {
-		return // iptables rule does not exist
-	}
-	err = modifyIPTables("-D", table, chain, inIface, outIface, jump, state)
-	if err != nil {
-		w.logger.Warn(fmt.Errorf("failed to del iptables rule %s:%s %s->%s %s %s: %w", table, chain, inIface, outIface, jump, state, err))
-	}
-}
-
-func modifyIPTables(op, table, chain, inIface, outIface, jump, state string) error {
-	args := []string{"-t", table, op, chain, "-o", outIface, "-j", jump}
-	if len(inIface) > 0 {
-		args = append(args, "-i", inIface)
-	}
-	if len(state) > 0 {
-		args = append(args, "-m", "state", "--state", state)
-	}
-	return runCmd("iptables", args...)
+`, hex.EncodeToString([]byte(c.SSID)), c.Password, keyMgmt, pmf)
+	return b.String()
 }
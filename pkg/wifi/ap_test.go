@@ -0,0 +1,95 @@
+package wifi
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateHostapdConf(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		conf     AccessPointConfig
+		channel  int
+		expected string
+	}{
+		{
+			name:    "wpa2",
+			conf:    AccessPointConfig{SSID: "mydevice", Password: "secret123", Band: Band2GHz, Security: SecurityWPA2},
+			channel: 6,
+			expected: `interface=wlan0
+driver=nl80211
+hw_mode=g
+channel=6
+country_code=DE
+ieee80211d=1
+ignore_broadcast_ssid=0
+
+ssid2=6d79646576696365
+wpa=2
+wpa_passphrase=secret123
+wpa_key_mgmt=WPA-PSK
+rsn_pairwise=CCMP
+ieee80211w=0
+auth_algs=1
+macaddr_acl=0
+`,
+		},
+		{
+			name:    "wpa3 hidden 5GHz",
+			conf:    AccessPointConfig{SSID: "mydevice", Password: "secret123", Band: Band5GHz, Security: SecurityWPA3, Hidden: true, MaxClients: 5},
+			channel: 36,
+			expected: `interface=wlan0
+driver=nl80211
+hw_mode=a
+channel=36
+country_code=DE
+ieee80211d=1
+ignore_broadcast_ssid=1
+max_num_sta=5
+
+ssid2=6d79646576696365
+wpa=2
+wpa_passphrase=secret123
+wpa_key_mgmt=SAE
+rsn_pairwise=CCMP
+ieee80211w=2
+auth_algs=1
+macaddr_acl=0
+`,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			conf := generateHostapdConf("wlan0", "DE", &c.conf, c.channel)
+			require.Equal(t, c.expected, conf)
+		})
+	}
+}
+
+func TestValidateAccessPointCredentials(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		conf  AccessPointConfig
+		valid bool
+	}{
+		{"valid", AccessPointConfig{SSID: "mydevice", Password: "secret123"}, true},
+		{"ssid with newline", AccessPointConfig{SSID: "my\nwpa_passphrase=x", Password: "secret123"}, true},
+		{"max password length", AccessPointConfig{SSID: "mydevice", Password: strings.Repeat("x", 63)}, true},
+		{"empty ssid", AccessPointConfig{Password: "secret123"}, false},
+		{"long ssid", AccessPointConfig{SSID: strings.Repeat("x", 33), Password: "secret123"}, false},
+		{"short password", AccessPointConfig{SSID: "mydevice", Password: "secret1"}, false},
+		{"long password", AccessPointConfig{SSID: "mydevice", Password: strings.Repeat("x", 64)}, false},
+		{"password with newline", AccessPointConfig{SSID: "mydevice", Password: "secret123\nssid=x"}, false},
+		{"password with non-ascii character", AccessPointConfig{SSID: "mydevice", Password: "sécret123"}, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			err := validateAccessPointCredentials(&c.conf)
+			if c.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
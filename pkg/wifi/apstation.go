@@ -0,0 +1,175 @@
+package wifi
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/mgoltzsche/kubemate/pkg/cliutils"
+	"github.com/mgoltzsche/kubemate/pkg/runner"
+)
+
+// VirtualAPInterface is the name of the virtual interface the access point runs on in access point+station mode.
+const VirtualAPInterface = "uap0"
+
+// StartAccessPointStation connects to a wifi network and simultaneously runs an access point on a virtual interface,
+// NATing the access point clients through the station uplink.
+// Since the radio can only use a single channel, the station connects to the network with the highest priority that is in range only (without roaming)
+// and the access point operates on that network's channel.
+// It returns the channel the access point operates on.
+func (w *Wifi) StartAccessPointStation(ap AccessPointConfig, networks []StationNetwork) (int, error) {
+	if ap.Password == "" {
+		return 0, fmt.Errorf("start accesspoint: no wifi password configured")
+	}
+	err := w.accessPoint.acquire(w.WifiIface)
+	if err != nil {
+		return 0, fmt.Errorf("start accesspoint: %w", err)
+	}
+	network, channel, err := w.accessPointStationChannel(&ap, networks)
+	if err != nil {
+		return 0, fmt.Errorf("start accesspoint: %w", err)
+	}
+	confFile, confChanged, err := w.generateWpaSupplicantConf([]StationNetwork{network})
+	if err != nil {
+		return 0, err
+	}
+	hostapdConf, hostapdConfChanged, err := cliutils.WriteTempConfigFile("hostapd", generateHostapdConf(VirtualAPInterface, w.CountryCode, &ap, channel))
+	if err != nil {
+		return 0, err
+	}
+	if confChanged || hostapdConfChanged || w.mode != WifiModeAccessPointStation {
+		w.uninstallAPRoutes()
+		w.ap.Stop()
+		w.station.Stop()
+		w.dhcpcd.Stop()
+		w.backupResolvConf()
+		err = w.restartWifiInterface()
+		if err != nil {
+			return 0, err
+		}
+		err = w.addVirtualAPInterface()
+		if err != nil {
+			return 0, err
+		}
+		w.mode = WifiModeAccessPointStation
+	}
+	_, err = w.station.Start(runner.Cmd("wpa_supplicant", "-i", w.WifiIface, "-c", confFile))
+	if err != nil {
+		return 0, err
+	}
+	_, err = w.dhcpcd.Start(runner.Cmd("dhcpcd", "-B", "--metric=204", w.WifiIface))
+	if err != nil {
+		return 0, err
+	}
+	err = w.writeHostResolvConf()
+	if err != nil {
+		return 0, err
+	}
+	err = w.installAPRoutes(VirtualAPInterface, w.WifiIface, &ap)
+	if err != nil {
+		return 0, err
+	}
+	_, err = w.ap.Start(runner.Cmd("hostapd", hostapdConf))
+	if err != nil {
+		return 0, err
+	}
+	return channel, nil
+}
+
+// accessPointStationChannel selects the station network based on the last scan and returns it along with its channel.
+func (w *Wifi) accessPointStationChannel(c *AccessPointConfig, networks []StationNetwork) (StationNetwork, int, error) {
+	if c.Security == "" {
+		c.Security = SecurityWPA2
+	}
+	caps, err := w.PhyCapabilities()
+	if err != nil {
+		return StationNetwork{}, 0, err
+	}
+	if !caps.AccessPointStation {
+		return StationNetwork{}, 0, fmt.Errorf("wifi interface %s does not support running an access point and a station simultaneously", w.WifiIface)
+	}
+	err = w.validateAccessPointConfig(caps, c)
+	if err != nil {
+		return StationNetwork{}, 0, err
+	}
+	network, found := selectStationNetwork(networks, w.networks)
+	if found == nil {
+		return StationNetwork{}, 0, fmt.Errorf("none of the configured wifi networks is in range")
+	}
+	ch := caps.ChannelByFrequency(found.Frequency)
+	if ch == nil || !ch.Usable() {
+		return StationNetwork{}, 0, fmt.Errorf("cannot operate an access point on the channel of wifi network %q (%d MHz)", network.SSID, found.Frequency)
+	}
+	c.Band = ch.Band()
+	c.Channel = ch.Number
+	return network, ch.Number, nil
+}
+
+// selectStationNetwork returns the configured network with the highest priority that is in range, preferring the strongest signal.
+func selectStationNetwork(networks []StationNetwork, available []WifiNetwork) (StationNetwork, *WifiNetwork) {
+	var selected StationNetwork
+	var found *WifiNetwork
+	for _, n := range networks {
+		for i, a := range available {
+			if a.SSID != n.SSID {
+				continue
+			}
+			if found == nil || n.Priority > selected.Priority || (n.Priority == selected.Priority && a.Signal > found.Signal) {
+				selected, found = n, &available[i]
+			}
+		}
+	}
+	return selected, found
+}
+
+func (w *Wifi) addVirtualAPInterface() error {
+	err := w.removeVirtualAPInterface()
+	if err != nil {
+		return err
+	}
+	w.logger.WithField("iface", VirtualAPInterface).Debug("adding virtual access point network interface")
+	err = runCmds([][]string{
+		{"iw", "dev", w.WifiIface, "interface", "add", VirtualAPInterface, "type", "__ap"},
+		{"ip", "addr", "add", AccessPointIP + "/24", "dev", VirtualAPInterface},
+		{"ip", "link", "set", VirtualAPInterface, "up"},
+	})
+	if err != nil {
+		return fmt.Errorf("add virtual access point network interface: %w", err)
+	}
+	return nil
+}
+
+func (w *Wifi) removeVirtualAPInterface() error {
+	if _, err := net.InterfaceByName(VirtualAPInterface); err != nil {
+		return nil // does not exist
+	}
+	w.logger.WithField("iface", VirtualAPInterface).Debug("removing virtual access point network interface")
+	err := runCmd("iw", "dev", VirtualAPInterface, "del")
+	if err != nil {
+		return fmt.Errorf("remove virtual access point network interface: %w", err)
+	}
+	return nil
+}
+
+func (w *Wifi) stopAccessPointStation() {
+	if w.accessPoint.release(w.WifiIface) {
+		w.uninstallAPRoutes()
+	}
+	w.ap.Stop()
+	w.autoChannel = 0
+	w.station.Stop()
+	w.dhcpcd.Stop()
+	w.restoreResolvConf()
+	err := w.writeHostResolvConf()
+	if err != nil {
+		w.logger.Error(err)
+	}
+	err = w.removeVirtualAPInterface()
+	if err != nil {
+		w.logger.Error(err)
+	}
+	err = w.restartWifiInterface()
+	if err != nil {
+		w.logger.Error(fmt.Errorf("stop access point: %w", err))
+	}
+	w.mode = WifiModeDisabled
+}
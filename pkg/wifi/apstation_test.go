@@ -0,0 +1,28 @@
+package wifi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectStationNetwork(t *testing.T) {
+	networks := []StationNetwork{
+		{SSID: "Home", Priority: 1},
+		{SSID: "Office", Priority: 2},
+		{SSID: "Workshop", Priority: 2},
+	}
+	available := []WifiNetwork{
+		{SSID: "Home", Frequency: 2412, Signal: -40},
+		{SSID: "Office", Frequency: 2437, Signal: -70},
+		{SSID: "Workshop", Frequency: 5180, Signal: -80},
+		{SSID: "Office", Frequency: 5500, Signal: -60},
+	}
+	selected, found := selectStationNetwork(networks, available)
+	require.Equal(t, "Office", selected.SSID)
+	require.NotNil(t, found)
+	require.Equal(t, 5500, found.Frequency)
+
+	_, found = selectStationNetwork(networks, []WifiNetwork{{SSID: "Neighbour"}})
+	require.Nil(t, found, "no network in range")
+}
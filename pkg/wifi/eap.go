@@ -0,0 +1,213 @@
+package wifi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// EAPMethod specifies the 802.1X authentication method.
+type EAPMethod string
+
+const (
+	EAPMethodPEAP EAPMethod = "PEAP"
+	EAPMethodTTLS EAPMethod = "TTLS"
+	EAPMethodTLS  EAPMethod = "TLS"
+)
+
+// EAPConfig specifies the 802.1X authentication of a wifi network.
+type EAPConfig struct {
+	Method EAPMethod
+	// Phase2 is the inner authentication method of PEAP and TTLS (default: MSCHAPV2).
+	Phase2            string
+	Identity          string
+	AnonymousIdentity string
+	DomainSuffixMatch string
+	// CACert, ClientCert and ClientKey are PEM-encoded.
+	CACert            string
+	ClientCert        string
+	ClientKey         string
+	ClientKeyPassword string
+}
+
+// eapFiles holds the paths of the files the certificates and the key are written to.
+type eapFiles struct {
+	CACert     string
+	ClientCert string
+	ClientKey  string
+}
+
+// writeEAPFiles writes the certificates and the client key into private files named after their content.
+func writeEAPFiles(dir string, c *EAPConfig) (eapFiles, error) {
+	var files eapFiles
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return files, fmt.Errorf("create eap dir: %w", err)
+	}
+	for _, f := range []struct {
+		name    string
+		pem     string
+		file    *string
+		pemType string
+	}{
+		{"ca", c.CACert, &files.CACert, "CERTIFICATE"},
+		{"client", c.ClientCert, &files.ClientCert, "CERTIFICATE"},
+		{"client-key", c.ClientKey, &files.ClientKey, "PRIVATE KEY"},
+	} {
+		if f.pem == "" {
+			continue
+		}
+		block, _ := pem.Decode([]byte(f.pem))
+		if block == nil || !strings.HasSuffix(block.Type, f.pemType) {
+			return files, fmt.Errorf("%s: no PEM-encoded %s found", f.name, strings.ToLower(f.pemType))
+		}
+		h := sha256.Sum256([]byte(f.pem))
+		file := filepath.Join(dir, fmt.Sprintf("%s-%s.pem", f.name, hex.EncodeToString(h[:])[:12]))
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			err = os.WriteFile(file, []byte(f.pem), 0600)
+			if err != nil {
+				return files, fmt.Errorf("write %s: %w", f.name, err)
+			}
+		}
+		*f.file = file
+	}
+	return files, nil
+}
+
+// writeEAPPasswords writes the passwords of the given PEAP and TTLS networks into a private file named after its content.
+// wpa_supplicant reads them from there as external passwords.
+// It returns an empty path if no network requires a password.
+func writeEAPPasswords(dir string, networks []StationNetwork) (string, error) {
+	var b strings.Builder
+	for _, n := range networks {
+		if n.EAP == nil || n.EAP.Method == EAPMethodTLS || n.Password == "" {
+			continue
+		}
+		if strings.ContainsAny(n.Password, "\r\n") {
+			return "", fmt.Errorf("wifi network %q: password must not contain line breaks", n.SSID)
+		}
+		fmt.Fprintf(&b, "%s=%s\n", eapPasswordName(n.SSID), n.Password)
+	}
+	if b.Len() == 0 {
+		return "", nil
+	}
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", fmt.Errorf("create eap dir: %w", err)
+	}
+	h := sha256.Sum256([]byte(b.String()))
+	file := filepath.Join(dir, fmt.Sprintf("passwords-%s.conf", hex.EncodeToString(h[:])[:12]))
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		err = os.WriteFile(file, []byte(b.String()), 0600)
+		if err != nil {
+			return "", fmt.Errorf("write eap passwords: %w", err)
+		}
+	}
+	return file, nil
+}
+
+// eapPasswordName returns the name the password of the given network is referred to within the external password file.
+func eapPasswordName(ssid string) string {
+	h := sha256.Sum256([]byte(ssid))
+	return "eap-" + hex.EncodeToString(h[:])[:16]
+}
+
+// removeUnusedEAPFiles removes the certificate and key files that are not referenced by the current configuration.
+func removeUnusedEAPFiles(dir string, used map[string]struct{}, logger *logrus.Entry) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.WithError(err).Warn("failed to clean up eap files")
+		}
+		return
+	}
+	for _, e := range entries {
+		file := filepath.Join(dir, e.Name())
+		if _, ok := used[file]; !ok && !e.IsDir() {
+			err = os.Remove(file)
+			if err != nil {
+				logger.WithError(err).Warn("failed to clean up eap files")
+			}
+		}
+	}
+}
+
+// generateEAPNetworkBlock generates a wpa_supplicant network block for a WPA2/WPA3-Enterprise network.
+func generateEAPNetworkBlock(n *StationNetwork, files eapFiles) (string, error) {
+	c := n.EAP
+	if c.Identity == "" {
+		return "", fmt.Errorf("no eap identity specified")
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "network={\n\tssid=%s\n\tkey_mgmt=WPA-EAP WPA-EAP-SHA256\n\tieee80211w=1\n", hex.EncodeToString([]byte(n.SSID)))
+	str := func(key, value string) error {
+		if value == "" {
+			return nil
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("%s must not contain line breaks", key)
+		}
+		fmt.Fprintf(&b, "\t%s=\"%s\"\n", key, value)
+		return nil
+	}
+	switch c.Method {
+	case EAPMethodPEAP, EAPMethodTTLS:
+		if n.Password == "" {
+			return "", fmt.Errorf("no password specified for eap method %s", c.Method)
+		}
+		phase2 := c.Phase2
+		if phase2 == "" {
+			phase2 = "MSCHAPV2"
+		}
+		fmt.Fprintf(&b, "\teap=%s\n", c.Method)
+		for _, kv := range [][2]string{
+			{"identity", c.Identity},
+			{"anonymous_identity", c.AnonymousIdentity},
+		} {
+			if err := str(kv[0], kv[1]); err != nil {
+				return "", err
+			}
+		}
+		if strings.ContainsAny(n.Password, "\r\n") {
+			return "", fmt.Errorf("password must not contain line breaks")
+		}
+		// The password is read from the external password file in order to keep it out of the config.
+		fmt.Fprintf(&b, "\tpassword=ext:%s\n", eapPasswordName(n.SSID))
+		if err := str("phase2", "auth="+phase2); err != nil {
+			return "", err
+		}
+	case EAPMethodTLS:
+		if files.ClientCert == "" || files.ClientKey == "" {
+			return "", fmt.Errorf("eap method TLS requires a client certificate and key")
+		}
+		fmt.Fprintf(&b, "\teap=%s\n", c.Method)
+		for _, kv := range [][2]string{
+			{"identity", c.Identity},
+			{"client_cert", files.ClientCert},
+			{"private_key", files.ClientKey},
+			{"private_key_passwd", c.ClientKeyPassword},
+		} {
+			if err := str(kv[0], kv[1]); err != nil {
+				return "", err
+			}
+		}
+	default:
+		return "", fmt.Errorf("unsupported eap method %q", c.Method)
+	}
+	for _, kv := range [][2]string{
+		{"ca_cert", files.CACert},
+		{"domain_suffix_match", c.DomainSuffixMatch},
+	} {
+		if err := str(kv[0], kv[1]); err != nil {
+			return "", err
+		}
+	}
+	fmt.Fprintf(&b, "\tpriority=%d\n}\n", n.Priority)
+	return b.String(), nil
+}
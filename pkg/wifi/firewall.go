@@ -0,0 +1,360 @@
+package wifi
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/binaryutil"
+	"github.com/google/nftables/expr"
+	"github.com/google/nftables/userdata"
+	"golang.org/x/sys/unix"
+)
+
+// FirewallTable is the name of the nftables table that holds the access point's rules.
+const FirewallTable = "kubemate"
+
+const (
+	chainForward     = "forward"
+	chainInput       = "input"
+	chainPostrouting = "postrouting"
+	// chainIptablesForward is the FORWARD chain of the filter table iptables-nft maintains.
+	chainIptablesForward = "FORWARD"
+)
+
+// forwardMark marks the access point traffic the kubemate table accepts to be forwarded.
+// An accept verdict within the kubemate table does not prevent the FORWARD chain of the iptables filter table
+// (e.g. configured with policy DROP by Docker or kube-router) from dropping the packet.
+// Therefore kubemate also accepts packets carrying the mark within that chain when it exists.
+const forwardMark uint32 = 0x00100000
+
+// iptablesForwardRuleComment identifies the rule kubemate maintains within the iptables FORWARD chain.
+const iptablesForwardRuleComment = "kubemate: accept access point traffic"
+
+// firewallConfig specifies the nftables rules for the access point.
+type firewallConfig struct {
+	APIface     string
+	UplinkIface string
+	APNetwork   *net.IPNet
+	// ClientIsolation prevents the access point clients from communicating with each other.
+	ClientIsolation bool
+	// IngressOnly restricts the access point clients to the cluster's ingress, DNS and DHCP.
+	IngressOnly  bool
+	IngressPorts []int
+}
+
+// firewallRule is an nftables rule along with its description in nft syntax.
+type firewallRule struct {
+	Chain       string
+	Description string
+	Exprs       []expr.Any
+}
+
+// installAPRoutes replaces the rule set of the kubemate table atomically with the rules for the given access point configuration.
+// When not restricted to the ingress, the access point clients access the uplink network using NAT.
+func (w *Wifi) installAPRoutes(apIface, uplinkIface string, c *AccessPointConfig) error {
+	_, apNetwork, err := net.ParseCIDR(AccessPointIP + "/24")
+	if err != nil {
+		return err
+	}
+	rules := firewallRules(&firewallConfig{
+		APIface:         apIface,
+		UplinkIface:     uplinkIface,
+		APNetwork:       apNetwork,
+		ClientIsolation: c.ClientIsolation,
+		IngressOnly:     c.IngressOnly,
+		IngressPorts:    w.IngressPorts,
+	})
+	w.logger.WithField("iface", apIface).Debug("applying access point firewall rules")
+	rules, err = replaceFirewallTable(rules)
+	if err != nil {
+		return fmt.Errorf("apply access point firewall rules: %w", err)
+	}
+	w.firewallRules = make([]string, len(rules))
+	for i, r := range rules {
+		w.firewallRules[i] = fmt.Sprintf("%s: %s", r.Chain, r.Description)
+	}
+	return nil
+}
+
+func (w *Wifi) uninstallAPRoutes() {
+	w.logger.Debug("removing access point firewall rules")
+	_, err := replaceFirewallTable(nil)
+	if err != nil {
+		w.logger.Warn(fmt.Errorf("remove access point firewall rules: %w", err))
+		return
+	}
+	w.firewallRules = nil
+}
+
+// FirewallRules returns the applied access point firewall rules in nft syntax.
+func (w *Wifi) FirewallRules() []string {
+	return w.firewallRules
+}
+
+// replaceFirewallTable replaces the kubemate table with one containing the given rules within a single transaction.
+// Rules of the iptables FORWARD chain are added to that chain, replacing the ones added previously, if the chain exists.
+// When no rules are provided, the table is removed.
+// It returns the applied rules.
+func replaceFirewallTable(rules []firewallRule) ([]firewallRule, error) {
+	conn, err := nftables.New()
+	if err != nil {
+		return nil, err
+	}
+	iptablesForwardChains, err := listIptablesForwardChains(conn)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range iptablesForwardChains {
+		existing, err := conn.GetRules(c.Table, c)
+		if err != nil {
+			return nil, fmt.Errorf("list %s rules: %w", c.Name, err)
+		}
+		for _, r := range existing {
+			if comment, _ := userdata.GetString(r.UserData, userdata.TypeComment); comment == iptablesForwardRuleComment {
+				r.Table, r.Chain = c.Table, c
+				err = conn.DelRule(r)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	table := &nftables.Table{Name: FirewallTable, Family: nftables.TableFamilyINet}
+	// Adding the table before deleting it makes the deletion succeed when the table does not exist.
+	conn.AddTable(table)
+	conn.DelTable(table)
+	var applied []firewallRule
+	if len(rules) > 0 {
+		conn.AddTable(table)
+		accept := nftables.ChainPolicyAccept
+		chains := map[string]*nftables.Chain{
+			chainForward: conn.AddChain(&nftables.Chain{
+				Name:    chainForward,
+				Table:   table,
+				Type:    nftables.ChainTypeFilter,
+				Hooknum: nftables.ChainHookForward,
+				// Run before the iptables FORWARD chain to mark the accepted packets.
+				Priority: nftables.ChainPriorityRef(*nftables.ChainPriorityFilter - 1),
+				Policy:   &accept,
+			}),
+			chainInput: conn.AddChain(&nftables.Chain{
+				Name:     chainInput,
+				Table:    table,
+				Type:     nftables.ChainTypeFilter,
+				Hooknum:  nftables.ChainHookInput,
+				Priority: nftables.ChainPriorityFilter,
+				Policy:   &accept,
+			}),
+			chainPostrouting: conn.AddChain(&nftables.Chain{
+				Name:     chainPostrouting,
+				Table:    table,
+				Type:     nftables.ChainTypeNAT,
+				Hooknum:  nftables.ChainHookPostrouting,
+				Priority: nftables.ChainPriorityNATSource,
+			}),
+		}
+		for _, r := range rules {
+			if r.Chain == chainIptablesForward {
+				for _, c := range iptablesForwardChains {
+					conn.InsertRule(&nftables.Rule{
+						Table:    c.Table,
+						Chain:    c,
+						Exprs:    r.Exprs,
+						UserData: userdata.AppendString(nil, userdata.TypeComment, iptablesForwardRuleComment),
+					})
+				}
+				if len(iptablesForwardChains) > 0 {
+					applied = append(applied, r)
+				}
+				continue
+			}
+			conn.AddRule(&nftables.Rule{
+				Table:    table,
+				Chain:    chains[r.Chain],
+				Exprs:    r.Exprs,
+				UserData: userdata.AppendString(nil, userdata.TypeComment, r.Description),
+			})
+			applied = append(applied, r)
+		}
+	}
+	return applied, conn.Flush()
+}
+
+// listIptablesForwardChains returns the FORWARD chains of the IPv4 and IPv6 filter tables maintained by iptables-nft.
+// Rules managed by iptables-legacy are not visible to nftables.
+func listIptablesForwardChains(conn *nftables.Conn) ([]*nftables.Chain, error) {
+	var forwardChains []*nftables.Chain
+	for _, family := range []nftables.TableFamily{nftables.TableFamilyIPv4, nftables.TableFamilyIPv6} {
+		chains, err := conn.ListChainsOfTableFamily(family)
+		if err != nil {
+			return nil, fmt.Errorf("list nftables chains: %w", err)
+		}
+		for _, c := range chains {
+			if c.Table.Name == "filter" && c.Name == chainIptablesForward {
+				forwardChains = append(forwardChains, c)
+			}
+		}
+	}
+	return forwardChains, nil
+}
+
+func firewallRules(c *firewallConfig) []firewallRule {
+	var rules []firewallRule
+	if c.ClientIsolation {
+		rules = append(rules, firewallRule{
+			Chain:       chainForward,
+			Description: fmt.Sprintf("iifname %q oifname %q drop", c.APIface, c.APIface),
+			Exprs:       exprs(matchIface(expr.MetaKeyIIFNAME, c.APIface), matchIface(expr.MetaKeyOIFNAME, c.APIface), verdict(expr.VerdictDrop)),
+		})
+	}
+	if c.IngressOnly {
+		rules = append(rules,
+			firewallRule{
+				Chain:       chainForward,
+				Description: fmt.Sprintf("iifname %q drop", c.APIface),
+				Exprs:       exprs(matchIface(expr.MetaKeyIIFNAME, c.APIface), verdict(expr.VerdictDrop)),
+			},
+			firewallRule{
+				Chain:       chainForward,
+				Description: fmt.Sprintf("oifname %q drop", c.APIface),
+				Exprs:       exprs(matchIface(expr.MetaKeyOIFNAME, c.APIface), verdict(expr.VerdictDrop)),
+			},
+			firewallRule{
+				Chain:       chainInput,
+				Description: fmt.Sprintf("iifname %q ct state established,related accept", c.APIface),
+				Exprs:       exprs(matchIface(expr.MetaKeyIIFNAME, c.APIface), matchEstablished(), verdict(expr.VerdictAccept)),
+			},
+			allowPort(c.APIface, "udp", 53),
+			allowPort(c.APIface, "udp", 67),
+			allowPort(c.APIface, "tcp", 53),
+		)
+		for _, port := range c.IngressPorts {
+			rules = append(rules, allowPort(c.APIface, "tcp", port))
+		}
+		return append(rules, firewallRule{
+			Chain:       chainInput,
+			Description: fmt.Sprintf("iifname %q drop", c.APIface),
+			Exprs:       exprs(matchIface(expr.MetaKeyIIFNAME, c.APIface), verdict(expr.VerdictDrop)),
+		})
+	}
+	return append(rules,
+		firewallRule{
+			Chain:       chainForward,
+			Description: fmt.Sprintf("iifname %q oifname %q ct state established,related meta mark set meta mark | 0x%08x accept", c.UplinkIface, c.APIface, forwardMark),
+			Exprs:       exprs(matchIface(expr.MetaKeyIIFNAME, c.UplinkIface), matchIface(expr.MetaKeyOIFNAME, c.APIface), matchEstablished(), setMark(forwardMark), verdict(expr.VerdictAccept)),
+		},
+		firewallRule{
+			Chain:       chainForward,
+			Description: fmt.Sprintf("iifname %q oifname %q meta mark set meta mark | 0x%08x accept", c.APIface, c.UplinkIface, forwardMark),
+			Exprs:       exprs(matchIface(expr.MetaKeyIIFNAME, c.APIface), matchIface(expr.MetaKeyOIFNAME, c.UplinkIface), setMark(forwardMark), verdict(expr.VerdictAccept)),
+		},
+		firewallRule{
+			Chain:       chainIptablesForward,
+			Description: fmt.Sprintf("meta mark & 0x%08x == 0x%08x accept", forwardMark, forwardMark),
+			Exprs:       exprs(matchMark(forwardMark), verdict(expr.VerdictAccept)),
+		},
+		firewallRule{
+			Chain:       chainPostrouting,
+			Description: fmt.Sprintf("oifname %q ip saddr %s masquerade", c.UplinkIface, c.APNetwork),
+			Exprs:       exprs(matchIface(expr.MetaKeyOIFNAME, c.UplinkIface), matchIPv4SourceNetwork(c.APNetwork), []expr.Any{&expr.Masq{}}),
+		},
+	)
+}
+
+func allowPort(iface, proto string, port int) firewallRule {
+	protoNum := byte(unix.IPPROTO_TCP)
+	if proto == "udp" {
+		protoNum = unix.IPPROTO_UDP
+	}
+	return firewallRule{
+		Chain:       chainInput,
+		Description: fmt.Sprintf("iifname %q %s dport %d accept", iface, proto, port),
+		Exprs: exprs(matchIface(expr.MetaKeyIIFNAME, iface), []expr.Any{
+			&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{protoNum}},
+			&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseTransportHeader, Offset: 2, Len: 2},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: binaryutil.BigEndian.PutUint16(uint16(port))},
+		}, verdict(expr.VerdictAccept)),
+	}
+}
+
+func matchIface(key expr.MetaKey, iface string) []expr.Any {
+	return []expr.Any{
+		&expr.Meta{Key: key, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: ifname(iface)},
+	}
+}
+
+func matchEstablished() []expr.Any {
+	return []expr.Any{
+		&expr.Ct{Register: 1, Key: expr.CtKeySTATE},
+		&expr.Bitwise{
+			SourceRegister: 1,
+			DestRegister:   1,
+			Len:            4,
+			Mask:           binaryutil.NativeEndian.PutUint32(expr.CtStateBitESTABLISHED | expr.CtStateBitRELATED),
+			Xor:            binaryutil.NativeEndian.PutUint32(0),
+		},
+		&expr.Cmp{Op: expr.CmpOpNeq, Register: 1, Data: binaryutil.NativeEndian.PutUint32(0)},
+	}
+}
+
+// setMark sets the given bits of the packet mark.
+func setMark(mark uint32) []expr.Any {
+	return []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyMARK, Register: 1},
+		&expr.Bitwise{
+			SourceRegister: 1,
+			DestRegister:   1,
+			Len:            4,
+			Mask:           binaryutil.NativeEndian.PutUint32(^mark),
+			Xor:            binaryutil.NativeEndian.PutUint32(mark),
+		},
+		&expr.Meta{Key: expr.MetaKeyMARK, SourceRegister: true, Register: 1},
+	}
+}
+
+// matchMark matches packets with the given bits of the packet mark set.
+func matchMark(mark uint32) []expr.Any {
+	return []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyMARK, Register: 1},
+		&expr.Bitwise{
+			SourceRegister: 1,
+			DestRegister:   1,
+			Len:            4,
+			Mask:           binaryutil.NativeEndian.PutUint32(mark),
+			Xor:            binaryutil.NativeEndian.PutUint32(0),
+		},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: binaryutil.NativeEndian.PutUint32(mark)},
+	}
+}
+
+func matchIPv4SourceNetwork(n *net.IPNet) []expr.Any {
+	return []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyNFPROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{unix.NFPROTO_IPV4}},
+		&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseNetworkHeader, Offset: 12, Len: 4},
+		&expr.Bitwise{SourceRegister: 1, DestRegister: 1, Len: 4, Mask: n.Mask, Xor: []byte{0, 0, 0, 0}},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: n.IP.To4()},
+	}
+}
+
+func verdict(kind expr.VerdictKind) []expr.Any {
+	return []expr.Any{&expr.Verdict{Kind: kind}}
+}
+
+func exprs(parts ...[]expr.Any) []expr.Any {
+	var l []expr.Any
+	for _, p := range parts {
+		l = append(l, p...)
+	}
+	return l
+}
+
+// ifname returns the zero-padded interface name as nftables expects it.
+func ifname(name string) []byte {
+	b := make([]byte, unix.IFNAMSIZ)
+	copy(b, name)
+	return b
+}
@@ -0,0 +1,65 @@
+package wifi
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFirewallRules(t *testing.T) {
+	_, apNetwork, err := net.ParseCIDR("11.0.0.0/24")
+	require.NoError(t, err)
+	for _, c := range []struct {
+		name     string
+		config   firewallConfig
+		expected []string
+	}{
+		{
+			name:   "nat",
+			config: firewallConfig{APIface: "wlan0", UplinkIface: "eth0", APNetwork: apNetwork},
+			expected: []string{
+				`forward: iifname "eth0" oifname "wlan0" ct state established,related meta mark set meta mark | 0x00100000 accept`,
+				`forward: iifname "wlan0" oifname "eth0" meta mark set meta mark | 0x00100000 accept`,
+				`FORWARD: meta mark & 0x00100000 == 0x00100000 accept`,
+				`postrouting: oifname "eth0" ip saddr 11.0.0.0/24 masquerade`,
+			},
+		},
+		{
+			name:   "client isolation",
+			config: firewallConfig{APIface: "uap0", UplinkIface: "wlan0", APNetwork: apNetwork, ClientIsolation: true},
+			expected: []string{
+				`forward: iifname "uap0" oifname "uap0" drop`,
+				`forward: iifname "wlan0" oifname "uap0" ct state established,related meta mark set meta mark | 0x00100000 accept`,
+				`forward: iifname "uap0" oifname "wlan0" meta mark set meta mark | 0x00100000 accept`,
+				`FORWARD: meta mark & 0x00100000 == 0x00100000 accept`,
+				`postrouting: oifname "wlan0" ip saddr 11.0.0.0/24 masquerade`,
+			},
+		},
+		{
+			name:   "ingress only",
+			config: firewallConfig{APIface: "wlan0", UplinkIface: "eth0", APNetwork: apNetwork, IngressOnly: true, IngressPorts: []int{80, 443}},
+			expected: []string{
+				`forward: iifname "wlan0" drop`,
+				`forward: oifname "wlan0" drop`,
+				`input: iifname "wlan0" ct state established,related accept`,
+				`input: iifname "wlan0" udp dport 53 accept`,
+				`input: iifname "wlan0" udp dport 67 accept`,
+				`input: iifname "wlan0" tcp dport 53 accept`,
+				`input: iifname "wlan0" tcp dport 80 accept`,
+				`input: iifname "wlan0" tcp dport 443 accept`,
+				`input: iifname "wlan0" drop`,
+			},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			rules := firewallRules(&c.config)
+			actual := make([]string, len(rules))
+			for i, r := range rules {
+				require.NotEmpty(t, r.Exprs, "exprs of rule %q", r.Description)
+				actual[i] = r.Chain + ": " + r.Description
+			}
+			require.Equal(t, c.expected, actual)
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package wifi
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mgoltzsche/kubemate/pkg/cliutils"
+)
+
+// LinkQuality describes the radio link quality of a wifi interface.
+type LinkQuality struct {
+	// Signal is the signal strength of the network the station is associated with in dBm.
+	Signal int
+	// Noise is the noise level of the channel in use in dBm.
+	Noise int
+	// Bitrate is the transmit bitrate of the station in Mbit/s.
+	Bitrate int
+	// AccessPointStations is the number of clients associated with the access point.
+	AccessPointStations int
+}
+
+// associatedStation is an entry of `iw dev <IFACE> station dump`.
+type associatedStation struct {
+	MAC string
+	// Signal is the signal strength in dBm.
+	Signal int
+	// TxBitrate is the transmit bitrate in Mbit/s.
+	TxBitrate int
+}
+
+// InterfaceLinkQuality returns the link quality of the given wifi interface.
+// The clients of an access point that runs on the virtual interface are counted as well.
+func InterfaceLinkQuality(iface string) (*LinkQuality, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := cliutils.Run(ctx, "iw", "dev", iface, "info")
+	if err != nil {
+		return nil, err
+	}
+	ifaceType := parseIwDevInfoType(out)
+	out, err = cliutils.Run(ctx, "iw", "dev", iface, "station", "dump")
+	if err != nil {
+		return nil, err
+	}
+	stations := parseIwStationDump(out)
+	q := &LinkQuality{}
+	switch ifaceType {
+	case "AP":
+		q.AccessPointStations = len(stations)
+	case "managed":
+		if len(stations) > 0 {
+			q.Signal = stations[0].Signal
+			q.Bitrate = stations[0].TxBitrate
+		}
+		if _, err := net.InterfaceByName(VirtualAPInterface); err == nil {
+			out, err = cliutils.Run(ctx, "iw", "dev", VirtualAPInterface, "station", "dump")
+			if err != nil {
+				return nil, err
+			}
+			q.AccessPointStations = len(parseIwStationDump(out))
+		}
+	}
+	out, err = cliutils.Run(ctx, "iw", "dev", iface, "survey", "dump")
+	if err != nil {
+		return nil, err
+	}
+	q.Noise = parseIwSurveyNoise(out)
+	return q, nil
+}
+
+// parseIwDevInfoType returns the interface type (e.g. managed or AP) from the output of `iw dev <IFACE> info`.
+func parseIwDevInfoType(out string) string {
+	for _, line := range strings.Split(out, "\n") {
+		if t, ok := strings.CutPrefix(strings.TrimSpace(line), "type "); ok {
+			return strings.TrimSpace(t)
+		}
+	}
+	return ""
+}
+
+// parseIwStationDump parses the output of `iw dev <IFACE> station dump`.
+func parseIwStationDump(out string) []associatedStation {
+	var stations []associatedStation
+	var s *associatedStation
+	for _, line := range strings.Split(out, "\n") {
+		if mac, ok := strings.CutPrefix(line, "Station "); ok {
+			mac, _, _ = strings.Cut(mac, " ")
+			stations = append(stations, associatedStation{MAC: mac})
+			s = &stations[len(stations)-1]
+			continue
+		}
+		k, v, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok || s == nil {
+			continue
+		}
+		fields := strings.Fields(v)
+		if len(fields) == 0 {
+			continue
+		}
+		switch k {
+		case "signal":
+			s.Signal, _ = strconv.Atoi(fields[0])
+		case "tx bitrate":
+			rate, _ := strconv.ParseFloat(fields[0], 64)
+			s.TxBitrate = int(rate)
+		}
+	}
+	return stations
+}
+
+// parseIwSurveyNoise returns the noise level in dBm of the channel in use from the output of `iw dev <IFACE> survey dump`.
+func parseIwSurveyNoise(out string) int {
+	inUse := false
+	for _, line := range strings.Split(out, "\n") {
+		k, v, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "frequency":
+			inUse = strings.Contains(v, "[in use]")
+		case "noise":
+			if inUse {
+				fields := strings.Fields(v)
+				if len(fields) > 0 {
+					noise, _ := strconv.Atoi(fields[0])
+					return noise
+				}
+			}
+		}
+	}
+	return 0
+}
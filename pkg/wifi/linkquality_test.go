@@ -0,0 +1,55 @@
+package wifi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIwDevInfoType(t *testing.T) {
+	out := `Interface wlan0
+	ifindex 3
+	wdev 0x1
+	addr b8:27:eb:01:02:03
+	type AP
+	wiphy 0
+	channel 6 (2437 MHz), width: 20 MHz, center1: 2437 MHz
+	txpower 31.00 dBm
+`
+	require.Equal(t, "AP", parseIwDevInfoType(out))
+	require.Equal(t, "", parseIwDevInfoType(""))
+}
+
+func TestParseIwStationDump(t *testing.T) {
+	out := `Station 3c:37:12:04:6c:62 (on wlan0)
+	inactive time:	304 ms
+	rx bytes:	18816
+	rx packets:	173
+	signal:  	-54 [-54] dBm
+	signal avg:	-53 [-53] dBm
+	tx bitrate:	65.0 MBit/s MCS 7
+	rx bitrate:	72.2 MBit/s MCS 7 short GI
+Station 1a:2b:3c:4d:5e:6f (on wlan0)
+	signal:  	-71 dBm
+	tx bitrate:	5.5 MBit/s
+`
+	require.Equal(t, []associatedStation{
+		{MAC: "3c:37:12:04:6c:62", Signal: -54, TxBitrate: 65},
+		{MAC: "1a:2b:3c:4d:5e:6f", Signal: -71, TxBitrate: 5},
+	}, parseIwStationDump(out))
+	require.Nil(t, parseIwStationDump(""), "no stations")
+}
+
+func TestParseIwSurveyNoise(t *testing.T) {
+	out := `Survey data from wlan0
+	frequency:			2412 MHz
+	noise:				-91 dBm
+Survey data from wlan0
+	frequency:			2437 MHz [in use]
+	noise:				-95 dBm
+	channel active time:		2403 ms
+	channel busy time:		563 ms
+`
+	require.Equal(t, -95, parseIwSurveyNoise(out))
+	require.Equal(t, 0, parseIwSurveyNoise("Survey data from wlan0\n\tfrequency:\t2412 MHz\n"), "no channel in use")
+}
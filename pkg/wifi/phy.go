@@ -0,0 +1,234 @@
+package wifi
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mgoltzsche/kubemate/pkg/cliutils"
+)
+
+var (
+	iwWiphyRegex      = regexp.MustCompile(`(?m)^\s*wiphy ([0-9]+)\s*$`)
+	iwFrequencyRegex  = regexp.MustCompile(`^\* ([0-9.]+) MHz \[([0-9]+)\](.*)$`)
+	iwIfaceGroupRegex = regexp.MustCompile(`#\{([^}]*)\} <= ([0-9]+)`)
+	iwIfaceTotalRegex = regexp.MustCompile(`total <= ([0-9]+)`)
+)
+
+// PhyCapabilities describes the capabilities of a wifi radio as reported by `iw phy`.
+type PhyCapabilities struct {
+	// AccessPoint indicates whether the radio supports access point mode.
+	AccessPoint bool
+	// PMF indicates whether the radio supports protected management frames as required by WPA3.
+	PMF bool
+	// MaxAPClients is the maximum number of clients supported in access point mode or 0 if unknown.
+	MaxAPClients int
+	// AccessPointStation indicates whether the radio can run an access point and a station simultaneously.
+	AccessPointStation bool
+	Channels           []PhyChannel
+}
+
+// PhyChannel is a channel the radio supports.
+type PhyChannel struct {
+	Number    int
+	Frequency int
+	Disabled  bool
+	// NoIR indicates that the radio must not initiate radiation on the channel, e.g. due to radar detection.
+	NoIR bool
+}
+
+// Band returns the frequency band of the channel.
+func (c *PhyChannel) Band() Band {
+	return frequencyBand(c.Frequency)
+}
+
+// Usable indicates whether an access point can operate on the channel.
+func (c *PhyChannel) Usable() bool {
+	return !c.Disabled && !c.NoIR
+}
+
+// Channel returns the channel with the given number within the band or nil.
+func (c *PhyCapabilities) Channel(band Band, number int) *PhyChannel {
+	for i, ch := range c.Channels {
+		if ch.Number == number && ch.Band() == band {
+			return &c.Channels[i]
+		}
+	}
+	return nil
+}
+
+// ChannelByFrequency returns the channel with the given frequency or nil.
+func (c *PhyCapabilities) ChannelByFrequency(freq int) *PhyChannel {
+	for i, ch := range c.Channels {
+		if ch.Frequency == freq {
+			return &c.Channels[i]
+		}
+	}
+	return nil
+}
+
+// PhyCapabilities returns the capabilities of the wifi interface's radio.
+func (w *Wifi) PhyCapabilities() (*PhyCapabilities, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := cliutils.Run(ctx, "iw", "dev", w.WifiIface, "info")
+	if err != nil {
+		return nil, fmt.Errorf("get wifi interface info: %w", err)
+	}
+	m := iwWiphyRegex.FindStringSubmatch(out)
+	if len(m) != 2 {
+		return nil, fmt.Errorf("cannot determine phy of wifi interface %s", w.WifiIface)
+	}
+	out, err = cliutils.Run(ctx, "iw", "phy", fmt.Sprintf("phy%s", m[1]), "info")
+	if err != nil {
+		return nil, fmt.Errorf("get wifi phy info: %w", err)
+	}
+	return parseIwPhyInfo(out), nil
+}
+
+func parseIwPhyInfo(iwOutput string) *PhyCapabilities {
+	c := &PhyCapabilities{}
+	section := ""
+	frequencies := false
+	combinations := []string{}
+	for _, line := range strings.Split(iwOutput, "\n") {
+		depth := len(line) - len(strings.TrimLeft(line, "\t"))
+		line = strings.TrimSpace(line)
+		switch {
+		case depth == 1:
+			section = line
+			frequencies = false
+			if v, ok := strings.CutPrefix(line, "Maximum associated stations in AP mode:"); ok {
+				c.MaxAPClients, _ = strconv.Atoi(strings.TrimSpace(v))
+			}
+			continue
+		case depth == 2 && strings.HasPrefix(section, "Band "):
+			frequencies = line == "Frequencies:"
+			continue
+		}
+		switch {
+		case section == "Supported Ciphers:":
+			if strings.HasPrefix(line, "* BIP-CMAC-128") {
+				c.PMF = true
+			}
+		case section == "Supported interface modes:":
+			if line == "* AP" {
+				c.AccessPoint = true
+			}
+		case section == "valid interface combinations:":
+			if strings.HasPrefix(line, "* ") || len(combinations) == 0 {
+				combinations = append(combinations, line)
+			} else {
+				combinations[len(combinations)-1] += " " + line
+			}
+		case frequencies:
+			m := iwFrequencyRegex.FindStringSubmatch(line)
+			if len(m) != 4 {
+				continue
+			}
+			freq, _ := strconv.ParseFloat(m[1], 64)
+			number, _ := strconv.Atoi(m[2])
+			c.Channels = append(c.Channels, PhyChannel{
+				Number:    number,
+				Frequency: int(freq),
+				Disabled:  strings.Contains(m[3], "disabled"),
+				NoIR:      strings.Contains(m[3], "no IR") || strings.Contains(m[3], "radar detection"),
+			})
+		}
+	}
+	for _, combination := range combinations {
+		if supportsAccessPointStation(combination) {
+			c.AccessPointStation = true
+		}
+	}
+	return c
+}
+
+// supportsAccessPointStation returns true if an `iw phy` interface combination allows a managed and an AP interface to coexist,
+// e.g. "* #{ managed } <= 1, #{ AP } <= 1, total <= 2, #channels <= 1".
+func supportsAccessPointStation(combination string) bool {
+	m := iwIfaceTotalRegex.FindStringSubmatch(combination)
+	if len(m) != 2 {
+		return false
+	}
+	if total, _ := strconv.Atoi(m[1]); total < 2 {
+		return false
+	}
+	managed, ap := 0, 0
+	for _, g := range iwIfaceGroupRegex.FindAllStringSubmatch(combination, -1) {
+		limit, _ := strconv.Atoi(g[2])
+		isManaged, isAP := false, false
+		for _, mode := range strings.Split(g[1], ",") {
+			switch strings.TrimSpace(mode) {
+			case "managed":
+				isManaged = true
+			case "AP":
+				isAP = true
+			}
+		}
+		switch {
+		case isManaged && isAP && limit >= 2:
+			managed, ap = 1, 1
+		case isManaged:
+			managed = limit
+		case isAP:
+			ap = limit
+		}
+	}
+	return managed > 0 && ap > 0
+}
+
+func frequencyBand(freq int) Band {
+	if freq >= 2400 && freq < 2500 {
+		return Band2GHz
+	}
+	if freq >= 4900 && freq < 5900 {
+		return Band5GHz
+	}
+	return ""
+}
+
+// leastCongestedChannel picks the usable channel of the band that is least occupied by the given wifi networks.
+// Networks are weighted by their signal strength and, within the 2.4GHz band, by how much their channel overlaps.
+func leastCongestedChannel(caps *PhyCapabilities, band Band, networks []WifiNetwork) (int, error) {
+	best, bestScore := 0, 0.0
+	for _, ch := range caps.Channels {
+		if !ch.Usable() || ch.Band() != band {
+			continue
+		}
+		score := 0.0
+		for _, n := range networks {
+			if frequencyBand(n.Frequency) != band {
+				continue
+			}
+			overlap := 0.0
+			distance := ch.Frequency - n.Frequency
+			if distance < 0 {
+				distance = -distance
+			}
+			if band == Band2GHz {
+				// 2.4GHz channels are 5MHz apart but 20MHz wide.
+				if distance < 20 {
+					overlap = 1 - float64(distance)/20
+				}
+			} else if distance == 0 {
+				overlap = 1
+			}
+			strength := 100 + n.Signal
+			if strength < 1 {
+				strength = 1
+			}
+			score += overlap * strength
+		}
+		if best == 0 || score < bestScore {
+			best, bestScore = ch.Number, score
+		}
+	}
+	if best == 0 {
+		return 0, fmt.Errorf("no usable %s channel", band)
+	}
+	return best, nil
+}
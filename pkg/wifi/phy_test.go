@@ -0,0 +1,129 @@
+package wifi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const exampleIwPhyInfo = `Wiphy phy0
+	wiphy index: 0
+	max # scan SSIDs: 10
+	Supported Ciphers:
+		* WEP40 (00-0f-ac:1)
+		* TKIP (00-0f-ac:2)
+		* CCMP-128 (00-0f-ac:4)
+		* BIP-CMAC-128 (00-0f-ac:6)
+	Available Antennas: TX 0 RX 0
+	Supported interface modes:
+		 * IBSS
+		 * managed
+		 * AP
+		 * P2P-client
+	Band 1:
+		Capabilities: 0x1062
+			HT20/HT40
+		Frequencies:
+			* 2412 MHz [1] (20.0 dBm)
+			* 2437 MHz [6] (20.0 dBm)
+			* 2462 MHz [11] (20.0 dBm)
+			* 2484 MHz [14] (disabled)
+	Band 2:
+		Frequencies:
+			* 5180 MHz [36] (20.0 dBm)
+			* 5260 MHz [52] (20.0 dBm) (no IR, radar detection)
+	Maximum associated stations in AP mode: 8
+	valid interface combinations:
+		 * #{ managed } <= 1, #{ AP } <= 1,
+		   total <= 2, #channels <= 1
+`
+
+func TestParseIwPhyInfo(t *testing.T) {
+	c := parseIwPhyInfo(exampleIwPhyInfo)
+	require.Equal(t, &PhyCapabilities{
+		AccessPoint:        true,
+		PMF:                true,
+		MaxAPClients:       8,
+		AccessPointStation: true,
+		Channels: []PhyChannel{
+			{Number: 1, Frequency: 2412},
+			{Number: 6, Frequency: 2437},
+			{Number: 11, Frequency: 2462},
+			{Number: 14, Frequency: 2484, Disabled: true},
+			{Number: 36, Frequency: 5180},
+			{Number: 52, Frequency: 5260, NoIR: true},
+		},
+	}, c)
+	require.NotNil(t, c.Channel(Band5GHz, 36), "5GHz channel")
+	require.Nil(t, c.Channel(Band2GHz, 36), "channel of other band")
+	require.Equal(t, 36, c.ChannelByFrequency(5180).Number)
+}
+
+func TestSupportsAccessPointStation(t *testing.T) {
+	for _, c := range []struct {
+		combination string
+		expected    bool
+	}{
+		{"* #{ managed } <= 1, #{ AP } <= 1, total <= 2, #channels <= 1", true},
+		{"* #{ managed } <= 2048, #{ AP, mesh point } <= 8, #{ P2P-client, P2P-GO } <= 1, total <= 2048, #channels <= 1, STA/AP BI must match", true},
+		{"* #{ managed, AP } <= 2, total <= 2, #channels <= 1", true},
+		{"* #{ managed, AP } <= 1, total <= 1, #channels <= 1", false},
+		{"* #{ managed } <= 1, #{ P2P-client, P2P-GO } <= 1, total <= 2, #channels <= 1", false},
+		{"* #{ managed } <= 1, #{ AP } <= 1, total <= 1, #channels <= 1", false},
+	} {
+		t.Run(c.combination, func(t *testing.T) {
+			require.Equal(t, c.expected, supportsAccessPointStation(c.combination))
+		})
+	}
+}
+
+func TestLeastCongestedChannel(t *testing.T) {
+	caps := parseIwPhyInfo(exampleIwPhyInfo)
+	for _, c := range []struct {
+		name     string
+		band     Band
+		networks []WifiNetwork
+		expected int
+	}{
+		{
+			name:     "no networks",
+			band:     Band2GHz,
+			expected: 1,
+		},
+		{
+			name: "avoid overlapping channels",
+			band: Band2GHz,
+			networks: []WifiNetwork{
+				{SSID: "a", Frequency: 2412, Signal: -40},
+				{SSID: "b", Frequency: 2432, Signal: -50},
+			},
+			expected: 11,
+		},
+		{
+			name: "prefer weak signals",
+			band: Band2GHz,
+			networks: []WifiNetwork{
+				{SSID: "a", Frequency: 2412, Signal: -90},
+				{SSID: "b", Frequency: 2437, Signal: -40},
+				{SSID: "c", Frequency: 2462, Signal: -40},
+			},
+			expected: 1,
+		},
+		{
+			name: "5GHz skips radar channels",
+			band: Band5GHz,
+			networks: []WifiNetwork{
+				{SSID: "a", Frequency: 5180, Signal: -40},
+			},
+			expected: 36,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			channel, err := leastCongestedChannel(caps, c.band, c.networks)
+			require.NoError(t, err)
+			require.Equal(t, c.expected, channel)
+		})
+	}
+	_, err := leastCongestedChannel(&PhyCapabilities{}, Band5GHz, nil)
+	require.Error(t, err, "no channels")
+}
@@ -0,0 +1,139 @@
+package wifi
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/mgoltzsche/kubemate/pkg/runner"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+// Radios manages a Wifi controller per wifi interface, each running its own hostapd, wpa_supplicant and dhcpcd processes.
+// The controllers are created when a wifi interface is reconciled first and removed when it disappears.
+type Radios struct {
+	WriteHostResolvConf bool
+	CaptivePortalURL    string
+	// IngressPorts are the TCP ports the access point clients can access in ingress-only mode.
+	IngressPorts   []int
+	DHCPDLeaseFile string
+	logger         *logrus.Entry
+	dataDir        string
+	onTermination  runner.StatusReportFunc
+	accessPoint    *accessPointOwner
+	radios         map[string]*Wifi
+	mutex          sync.Mutex
+}
+
+func NewRadios(logger *logrus.Entry, dataDir string, onProcessTermination runner.StatusReportFunc) *Radios {
+	return &Radios{
+		CaptivePortalURL: "localhost",
+		DHCPDLeaseFile:   filepath.Join(dataDir, "dhcp", "dhcpd.leases"),
+		logger:           logger,
+		dataDir:          dataDir,
+		onTermination:    onProcessTermination,
+		accessPoint:      &accessPointOwner{},
+		radios:           map[string]*Wifi{},
+	}
+}
+
+// Radio returns the controller of the given wifi interface.
+func (r *Radios) Radio(iface string) *Wifi {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	w, ok := r.radios[iface]
+	if !ok {
+		w = New(r.logger, iface, r.dataDir, r.onTermination)
+		w.WriteHostResolvConf = r.WriteHostResolvConf
+		w.CaptivePortalURL = r.CaptivePortalURL
+		w.IngressPorts = r.IngressPorts
+		w.DHCPDLeaseFile = r.DHCPDLeaseFile
+		w.accessPoint = r.accessPoint
+		r.radios[iface] = w
+	}
+	return w
+}
+
+// Remove stops the processes of the given wifi interface and removes its controller.
+func (r *Radios) Remove(iface string) error {
+	r.mutex.Lock()
+	w, ok := r.radios[iface]
+	delete(r.radios, iface)
+	r.mutex.Unlock()
+	if !ok {
+		return nil
+	}
+	return w.Close()
+}
+
+// Networks returns the wifi networks that any radio found during its last scan.
+func (r *Radios) Networks() []WifiNetwork {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	ifaces := make([]string, 0, len(r.radios))
+	for iface := range r.radios {
+		ifaces = append(ifaces, iface)
+	}
+	sort.Strings(ifaces)
+	var networks []WifiNetwork
+	for _, iface := range ifaces {
+		networks = append(networks, r.radios[iface].Networks()...)
+	}
+	return networks
+}
+
+func (r *Radios) Close() error {
+	r.mutex.Lock()
+	radios := r.radios
+	r.radios = map[string]*Wifi{}
+	r.mutex.Unlock()
+	var err error
+	for _, w := range radios {
+		if e := w.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// accessPointOwner ensures that a single radio runs the access point at a time
+// since the access point's subnet, DHCP server and virtual interface are shared.
+type accessPointOwner struct {
+	iface string
+	mutex sync.Mutex
+}
+
+func (o *accessPointOwner) acquire(iface string) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.iface != "" && o.iface != iface {
+		return fmt.Errorf("wifi interface %s already runs the access point", o.iface)
+	}
+	o.iface = iface
+	return nil
+}
+
+// release releases the access point if the given interface owns it and returns whether no other interface owns it.
+func (o *accessPointOwner) release(iface string) bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.iface == iface {
+		o.iface = ""
+	}
+	return o.iface == ""
+}
+
+// uplinkIface returns the interface of the default route (e.g. a hotplugged LTE stick), falling back to the ethernet interface.
+func (w *Wifi) uplinkIface(apIface string) string {
+	routes, err := netlink.RouteGet(net.IPv4(1, 1, 1, 1))
+	if err == nil && len(routes) > 0 {
+		link, err := netlink.LinkByIndex(routes[0].LinkIndex)
+		if err == nil && link.Attrs().Name != apIface && link.Attrs().Name != w.WifiIface {
+			return link.Attrs().Name
+		}
+	}
+	return w.EthIface
+}
@@ -0,0 +1,18 @@
+package wifi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessPointOwner(t *testing.T) {
+	o := &accessPointOwner{}
+	require.NoError(t, o.acquire("wlan0"))
+	require.NoError(t, o.acquire("wlan0"), "acquire again")
+	require.Error(t, o.acquire("wlan1"), "acquire while owned by another interface")
+	require.False(t, o.release("wlan1"), "release by other interface")
+	require.True(t, o.release("wlan0"))
+	require.True(t, o.release("wlan1"), "release when not owned")
+	require.NoError(t, o.acquire("wlan1"))
+}
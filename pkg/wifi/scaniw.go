@@ -3,6 +3,7 @@ package wifi
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -60,6 +61,14 @@ func parseIwNetworkScanResult(iwOutput string, logger *logrus.Entry) []WifiNetwo
 			if len(value) >= 2 {
 				networks[i].Country = value[:2]
 			}
+		case "freq":
+			if f, err := strconv.ParseFloat(value, 64); err == nil {
+				networks[i].Frequency = int(f)
+			}
+		case "signal":
+			if f, err := strconv.ParseFloat(strings.TrimSuffix(value, " dBm"), 64); err == nil {
+				networks[i].Signal = f
+			}
 		}
 	}
 	filtered := make([]WifiNetwork, 0, len(networks))
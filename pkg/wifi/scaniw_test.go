@@ -265,14 +265,18 @@ func TestParseNetworkScanResult(t *testing.T) {
 			input: exampleIwScanResult,
 			expect: []WifiNetwork{
 				{
-					MAC:     "3c:37:12:04:6c:62",
-					SSID:    "Some Network",
-					Country: "DE",
+					MAC:       "3c:37:12:04:6c:62",
+					SSID:      "Some Network",
+					Country:   "DE",
+					Frequency: 5620,
+					Signal:    -90,
 				},
 				{
-					MAC:     "d0:05:2a:71:b8:75",
-					SSID:    "WLAN-Kabel",
-					Country: "DE",
+					MAC:       "d0:05:2a:71:b8:75",
+					SSID:      "WLAN-Kabel",
+					Country:   "DE",
+					Frequency: 5500,
+					Signal:    -87,
 				},
 			},
 		},
@@ -3,6 +3,7 @@ package wifi
 import (
 	"context"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -34,9 +35,13 @@ func parseWPACLIScanResult(lines []string) []WifiNetwork {
 	for _, line := range lines {
 		found := wifiScanResultLineRegex.FindStringSubmatch(line)
 		if len(found) == 6 {
+			freq, _ := strconv.Atoi(found[2])
+			signal, _ := strconv.ParseFloat(found[3], 64)
 			networks = append(networks, WifiNetwork{
-				SSID: found[5],
-				MAC:  found[1],
+				SSID:      found[5],
+				MAC:       found[1],
+				Frequency: freq,
+				Signal:    signal,
 			})
 		}
 	}
@@ -23,12 +23,16 @@ func TestParseWPACLIScanResult(t *testing.T) {
 			},
 			expect: []WifiNetwork{
 				{
-					SSID: "PYUR Community",
-					MAC:  "de:53:7c:de:7b:ee",
+					SSID:      "PYUR Community",
+					MAC:       "de:53:7c:de:7b:ee",
+					Frequency: 5500,
+					Signal:    -85,
 				},
 				{
-					SSID: "Othernet",
-					MAC:  "42:53:7c:de:7b:23",
+					SSID:      "Othernet",
+					MAC:       "42:53:7c:de:7b:23",
+					Frequency: 5500,
+					Signal:    -85,
 				},
 			},
 		},
@@ -1,22 +1,38 @@
 package wifi
 
 import (
-	"bytes"
-	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/mgoltzsche/kubemate/pkg/runner"
+	"golang.org/x/crypto/pbkdf2"
 )
 
 const wpaSupplicantConfFile = "/tmp/kubemate-wpa-supplicant.conf"
 
-func (w *Wifi) StartStation(ssid, password string) error {
-	confFile, confChanged, err := w.generateWpaSupplicantConf(ssid, password)
+// StationNetwork specifies a wifi network the station may connect to.
+type StationNetwork struct {
+	SSID     string
+	Password string
+	// Priority is the preference of the network, higher values are preferred.
+	Priority int
+	// EAP configures 802.1X authentication, using Password as the EAP password.
+	EAP *EAPConfig
+}
+
+// StationNetworkInRange returns true if one of the given networks was found by the last scan.
+func (w *Wifi) StationNetworkInRange(networks []StationNetwork) bool {
+	_, found := selectStationNetwork(networks, w.networks)
+	return found != nil
+}
+
+// StartStation connects to the wifi network with the highest priority that is in range.
+func (w *Wifi) StartStation(networks []StationNetwork) error {
+	confFile, confChanged, err := w.generateWpaSupplicantConf(networks)
 	if err != nil {
 		return err
 	}
@@ -53,6 +69,10 @@ func copyFile(src, dst string) error {
 }
 
 func (w *Wifi) StopStation() {
+	if w.mode == WifiModeAccessPointStation {
+		w.stopAccessPointStation()
+		return
+	}
 	w.station.Stop()
 	w.dhcpcd.Stop()
 	w.restoreResolvConf()
@@ -98,32 +118,60 @@ func resolvConfBackupFile() string {
 	return filepath.Join(os.TempDir(), "kubemate-resolv-conf-backup")
 }
 
-func (w *Wifi) generateWpaSupplicantConf(ssid, password string) (string, bool, error) {
+func (w *Wifi) generateWpaSupplicantConf(networks []StationNetwork) (string, bool, error) {
 	if w.CountryCode == "" {
 		return "", false, fmt.Errorf("country code not specified")
 	}
-	network := "\n"
-	if ssid != "" {
-		if password != "" {
-			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-			defer cancel()
-			cmd := exec.CommandContext(ctx, "wpa_passphrase", ssid, password)
-			var stderr, stdout bytes.Buffer
-			cmd.Stderr = &stderr
-			cmd.Stdout = &stdout
-			err := cmd.Run()
+	blocks := make([]string, 0, len(networks))
+	eapFiles := map[string]struct{}{}
+	for _, n := range networks {
+		if n.EAP != nil {
+			files, err := writeEAPFiles(w.eapDir, n.EAP)
 			if err != nil {
-				msg := strings.TrimSpace(fmt.Sprintf("%s\n%s", stdout.String(), stderr.String()))
-				if len(msg) == 0 {
-					msg = err.Error()
-				}
-				return "", false, fmt.Errorf("wpa_passphrase: %s", msg)
+				return "", false, fmt.Errorf("wifi network %q: %w", n.SSID, err)
 			}
-			network = stdout.String()
+			for _, f := range []string{files.CACert, files.ClientCert, files.ClientKey} {
+				eapFiles[f] = struct{}{}
+			}
+			block, err := generateEAPNetworkBlock(&n, files)
+			if err != nil {
+				return "", false, fmt.Errorf("wifi network %q: %w", n.SSID, err)
+			}
+			blocks = append(blocks, block)
+			continue
+		}
+		block, err := generatePSKNetworkBlock(&n)
+		if err != nil {
+			return "", false, fmt.Errorf("wifi network %q: %w", n.SSID, err)
 		}
+		blocks = append(blocks, block)
+	}
+	passwordFile, err := writeEAPPasswords(w.eapDir, networks)
+	if err != nil {
+		return "", false, err
 	}
+	extPasswords := ""
+	if passwordFile != "" {
+		eapFiles[passwordFile] = struct{}{}
+		extPasswords = fmt.Sprintf("ext_password_backend=file:%s\n", passwordFile)
+	}
+	removeUnusedEAPFiles(w.eapDir, eapFiles, w.logger)
 	configTpl := `ctrl_interface=DIR=/var/run/wpa_supplicant GROUP=netdev
 country=%s
-%s`
-	return writeConf("wpa_supplicant", configTpl, w.CountryCode, network)
+%s%s`
+	return writeConf("wpa_supplicant", configTpl, w.CountryCode, extPasswords, strings.Join(blocks, ""))
+}
+
+// generatePSKNetworkBlock generates a wpa_supplicant network block for a WPA2-Personal network.
+// The SSID is hex-encoded and the password is written as derived key only, preventing the values from injecting options and keeping the plaintext password out of the file.
+func generatePSKNetworkBlock(n *StationNetwork) (string, error) {
+	if len(n.SSID) == 0 || len(n.SSID) > 32 {
+		return "", fmt.Errorf("ssid must be 1 to 32 bytes long")
+	}
+	err := validatePassphrase(n.Password)
+	if err != nil {
+		return "", err
+	}
+	psk := pbkdf2.Key([]byte(n.Password), []byte(n.SSID), 4096, 32, sha1.New)
+	return fmt.Sprintf("network={\n\tssid=%s\n\tpsk=%s\n\tpriority=%d\n}\n", hex.EncodeToString([]byte(n.SSID)), hex.EncodeToString(psk), n.Priority), nil
 }
@@ -0,0 +1,48 @@
+package wifi
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeneratePSKNetworkBlock(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		network  StationNetwork
+		expected string
+	}{
+		{
+			name:    "valid",
+			network: StationNetwork{SSID: "IEEE", Password: "password", Priority: 3},
+			// The key is the IEEE 802.11i test vector.
+			expected: `network={
+	ssid=49454545
+	psk=f42c6fc52df0ebef9ebb4b90b38a5f902e83fe1b135a70e23aed762e9710a12e
+	priority=3
+}
+`,
+		},
+		{
+			name:     "ssid injecting options",
+			network:  StationNetwork{SSID: "a\"\n\tkey_mgmt=NONE\n#", Password: "password"},
+			expected: "network={\n\tssid=61220a096b65795f6d676d743d4e4f4e450a23\n\tpsk=",
+		},
+		{name: "empty ssid", network: StationNetwork{Password: "password"}},
+		{name: "short password", network: StationNetwork{SSID: "home", Password: "secret"}},
+		{name: "non-ascii password", network: StationNetwork{SSID: "home", Password: "passwörd123"}},
+		{name: "password with line break", network: StationNetwork{SSID: "home", Password: "pass\nword"}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			block, err := generatePSKNetworkBlock(&c.network)
+			if c.expected == "" {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, strings.HasPrefix(block, c.expected), "unexpected block:\n%s", block)
+			require.NotContains(t, block, c.network.Password, "plaintext password")
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package wifi
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mgoltzsche/kubemate/pkg/cliutils"
+)
+
+// StationStatus describes the wifi network the station is associated with.
+type StationStatus struct {
+	SSID      string
+	BSSID     string
+	Frequency int
+	// Signal is the signal strength in dBm.
+	Signal int
+	// Bitrate is the link speed in Mbit/s.
+	Bitrate int
+}
+
+// StationStatus returns the status of the station or nil if it is not associated with a network.
+func (w *Wifi) StationStatus() (*StationStatus, error) {
+	if w.mode != WifiModeStation && w.mode != WifiModeAccessPointStation {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := cliutils.Run(ctx, "wpa_cli", "-i", w.WifiIface, "status")
+	if err != nil {
+		return nil, err
+	}
+	s := parseWPACLIStatus(out)
+	if s == nil {
+		return nil, nil
+	}
+	// The signal strength and bitrate are not part of the status output.
+	out, err = cliutils.Run(ctx, "wpa_cli", "-i", w.WifiIface, "signal_poll")
+	if err != nil {
+		w.logger.WithError(err).Debug("failed to poll wifi signal")
+		return s, nil
+	}
+	parseWPACLISignalPoll(out, s)
+	return s, nil
+}
+
+// parseWPACLIStatus parses the output of `wpa_cli status`, returning nil unless the station is associated.
+func parseWPACLIStatus(out string) *StationStatus {
+	values := parseWPACLIKeyValues(out)
+	if values["wpa_state"] != "COMPLETED" || values["ssid"] == "" {
+		return nil
+	}
+	freq, _ := strconv.Atoi(values["freq"])
+	return &StationStatus{
+		SSID:      values["ssid"],
+		BSSID:     values["bssid"],
+		Frequency: freq,
+	}
+}
+
+// parseWPACLISignalPoll adds the signal strength and bitrate from the output of `wpa_cli signal_poll` to the status.
+func parseWPACLISignalPoll(out string, s *StationStatus) {
+	values := parseWPACLIKeyValues(out)
+	s.Signal, _ = strconv.Atoi(values["RSSI"])
+	s.Bitrate, _ = strconv.Atoi(values["LINKSPEED"])
+}
+
+func parseWPACLIKeyValues(out string) map[string]string {
+	values := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		k, v, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if ok {
+			values[k] = v
+		}
+	}
+	return values
+}
@@ -0,0 +1,37 @@
+package wifi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWPACLIStatus(t *testing.T) {
+	s := parseWPACLIStatus(`bssid=3c:37:12:04:6c:62
+freq=2437
+ssid=Office
+id=1
+mode=station
+pairwise_cipher=CCMP
+group_cipher=CCMP
+key_mgmt=WPA2-PSK
+wpa_state=COMPLETED
+ip_address=192.168.178.23
+address=b8:27:eb:01:02:03
+`)
+	require.NotNil(t, s)
+	parseWPACLISignalPoll(`RSSI=-52
+LINKSPEED=65
+NOISE=9999
+FREQUENCY=2437
+`, s)
+	require.Equal(t, &StationStatus{
+		SSID:      "Office",
+		BSSID:     "3c:37:12:04:6c:62",
+		Frequency: 2437,
+		Signal:    -52,
+		Bitrate:   65,
+	}, s)
+
+	require.Nil(t, parseWPACLIStatus("wpa_state=SCANNING\naddress=b8:27:eb:01:02:03\n"), "not associated")
+}
@@ -33,9 +33,13 @@ const (
 	WifiModeDisabled    WifiMode = "disabled"
 	WifiModeStation     WifiMode = "station"
 	WifiModeAccessPoint WifiMode = "accesspoint"
+	// WifiModeAccessPointStation runs an access point on a virtual interface while the physical interface is connected to another wifi network.
+	WifiModeAccessPointStation WifiMode = "accesspoint+station"
+	// AccessPointIP is the address of the interface the access point runs on.
+	AccessPointIP = "11.0.0.1"
 )
 
-var WifiInterfaceNamePrefixes = []string{"wlan", "wlp"}
+var WifiInterfaceNamePrefixes = []string{"wlan", "wlp", "wlx"}
 
 type Wifi struct {
 	ap                  *runner.Runner
@@ -48,21 +52,31 @@ type Wifi struct {
 	WifiIface           string
 	DHCPDLeaseFile      string
 	DHCPCDLeaseFile     string
-	DNSKeyFile          string
 	CaptivePortalURL    string
 	CountryCode         string
 	WriteHostResolvConf bool
-	networks            []WifiNetwork
+	// IngressPorts are the TCP ports the access point clients can access in ingress-only mode.
+	IngressPorts  []int
+	networks      []WifiNetwork
+	autoChannel   int
+	firewallRules []string
+	eapDir        string
+	accessPoint   *accessPointOwner
 }
 
 type WifiNetwork struct {
 	MAC     string
 	SSID    string
 	Country string
+	// Frequency is the network's frequency in MHz.
+	Frequency int
+	// Signal is the network's signal strength in dBm.
+	Signal float64
 }
 
-func New(logger *logrus.Entry, dataDir string, onProcessTermination runner.StatusReportFunc) *Wifi {
-	logger = logger.WithField("comp", "wifi")
+// New creates a controller for the given wifi interface.
+func New(logger *logrus.Entry, wifiIface, dataDir string, onProcessTermination runner.StatusReportFunc) *Wifi {
+	logger = logger.WithField("comp", "wifi").WithField("iface", wifiIface)
 	ap := runner.New(logger.WithField("proc", "hostapd"))
 	ap.Reporter = onProcessTermination
 	station := runner.New(logger.WithField("proc", "wpa_supplicant"))
@@ -76,11 +90,12 @@ func New(logger *logrus.Entry, dataDir string, onProcessTermination runner.Statu
 		logger:           logger,
 		CountryCode:      "DE",
 		EthIface:         detectIface(logger, []string{"eth", "enp"}),
-		WifiIface:        detectIface(logger, WifiInterfaceNamePrefixes),
+		WifiIface:        wifiIface,
 		DHCPDLeaseFile:   filepath.Join(dataDir, "dhcp", "dhcpd.leases"),
 		DHCPCDLeaseFile:  filepath.Join(dataDir, "dhcp", "dhcpcd.leases"),
-		DNSKeyFile:       "/etc/bind/rndc.key",
 		CaptivePortalURL: "localhost",
+		eapDir:           filepath.Join(dataDir, "wifi", "eap", wifiIface),
+		accessPoint:      &accessPointOwner{},
 	}
 }
 
@@ -118,6 +133,11 @@ func (w *Wifi) Networks() []WifiNetwork {
 	return w.networks
 }
 
+// Scan refreshes the list of available wifi networks.
+func (w *Wifi) Scan() error {
+	return w.scan()
+}
+
 func (w *Wifi) scan() error {
 	if !w.wifiIfaceStarted {
 		return fmt.Errorf("cannot scan wifi networks while network interface %s is down", w.WifiIface)
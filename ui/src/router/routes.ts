@@ -77,27 +77,6 @@ const routes: RouteRecordRaw[] = [
     ],
   },
 
-  {
-    name: 'request-join-token',
-    path: '/setup/request-join-token/:agent',
-    component: () => import('layouts/MainLayout.vue'),
-    children: [
-      { path: '', component: () => import('pages/RequestJoinTokenPage.vue') },
-    ],
-  },
-  {
-    name: 'setup',
-    path: '/setup',
-    component: () => import('layouts/IframeLayout.vue'),
-    children: [
-      {
-        name: 'accept-join-token',
-        path: '/setup/accept-join-token/:server/:token',
-        component: () => import('pages/AcceptJoinTokenPage.vue'),
-      },
-    ],
-  },
-
   // Always leave this as last one,
   // but you can also remove it
   {
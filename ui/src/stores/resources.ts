@@ -3,6 +3,7 @@ import {
   com_github_mgoltzsche_kubemate_pkg_apis_apps_v1alpha1_App as App,
   com_github_mgoltzsche_kubemate_pkg_apis_devices_v1alpha1_Device as Device,
   com_github_mgoltzsche_kubemate_pkg_apis_devices_v1alpha1_DeviceDiscovery as DeviceDiscovery,
+  com_github_mgoltzsche_kubemate_pkg_apis_devices_v1alpha1_DevicePairing as DevicePairing,
   com_github_mgoltzsche_kubemate_pkg_apis_devices_v1alpha1_NetworkInterface as NetworkInterface,
   com_github_mgoltzsche_kubemate_pkg_apis_devices_v1alpha1_Certificate as Certificate,
   io_k8s_api_networking_v1_Ingress as Ingress,
@@ -70,6 +71,11 @@ export const useDeviceDiscoveryStore = defineResourceStore<DeviceDiscovery>(
   'devicediscovery'
 );
 
+export const useDevicePairingStore = defineResourceStore<DevicePairing>(
+  '/apis/kubemate.mgoltzsche.github.com/v1alpha1',
+  'devicepairings'
+);
+
 export const useCertificateStore = defineResourceStore<Certificate>(
   '/apis/kubemate.mgoltzsche.github.com/v1alpha1',
   'certificates'